@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/komuw/ong/internal/octx"
+	"github.com/komuw/ong/internal/tracectx"
 	"github.com/komuw/ong/log"
 )
 
@@ -35,7 +36,10 @@ const (
 
 // Safe creates a http client that has some good defaults & is safe from server-side request forgery (SSRF).
 // It also logs requests and responses using [log.Logger]
+// The [W3C Trace Context] of the request's context, if any, is propagated using the traceparent & tracestate headers.
 // The timeout is optional.
+//
+// [W3C Trace Context]: https://www.w3.org/TR/trace-context/
 func Safe(l *slog.Logger, timeout ...time.Duration) *http.Client {
 	t := defaultTimeout
 	if len(timeout) > 0 {
@@ -46,7 +50,10 @@ func Safe(l *slog.Logger, timeout ...time.Duration) *http.Client {
 
 // Unsafe creates a http client that has some good defaults & is NOT safe from server-side request forgery (SSRF).
 // It also logs requests and responses using [log.Logger]
+// The [W3C Trace Context] of the request's context, if any, is propagated using the traceparent & tracestate headers.
 // The timeout is optional
+//
+// [W3C Trace Context]: https://www.w3.org/TR/trace-context/
 func Unsafe(l *slog.Logger, timeout ...time.Duration) *http.Client {
 	t := defaultTimeout
 	if len(timeout) > 0 {
@@ -135,6 +142,16 @@ func (lr *loggingRT) RoundTrip(req *http.Request) (res *http.Response, err error
 
 	req.Header.Set(logIDHeader, log.GetId(ctx))
 
+	// Propagate the W3C trace context, so that the server can join our trace.
+	// https://www.w3.org/TR/trace-context/
+	t, ok := tracectx.Get(ctx)
+	if ok {
+		t = t.Child()
+	} else {
+		t = tracectx.New()
+	}
+	t.Inject(req.Header)
+
 	return lr.Transport.RoundTrip(req)
 }
 
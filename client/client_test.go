@@ -5,9 +5,11 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/komuw/ong/internal/tracectx"
 	"github.com/komuw/ong/log"
 
 	"go.akshayshah.org/attest"
@@ -173,3 +175,47 @@ func TestClient(t *testing.T) {
 		// }
 	})
 }
+
+func TestTraceContext(t *testing.T) {
+	t.Parallel()
+
+	var traceparent, tracestate string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get(tracectx.ParentHeader)
+		tracestate = r.Header.Get(tracectx.StateHeader)
+	}))
+	t.Cleanup(func() { ts.Close() })
+
+	cli := Unsafe(getLogger())
+	t.Cleanup(func() { cli.CloseIdleConnections() })
+
+	get := func(ctx context.Context) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+		attest.Ok(t, err)
+		res, err := cli.Do(req)
+		attest.Ok(t, err)
+		res.Body.Close()
+	}
+
+	{
+		// starts a new trace.
+		get(context.Background())
+		tr, ok := tracectx.Parse(traceparent, tracestate)
+		attest.True(t, ok)
+		attest.NotEqual(t, tr.TraceID, [16]byte{})
+		attest.Zero(t, tracestate)
+	}
+
+	{
+		// propagates the trace in ctx.
+		parent := tracectx.New()
+		parent.State = "congo=t61rcWkgMzE"
+		get(tracectx.Set(context.Background(), parent))
+
+		tr, ok := tracectx.Parse(traceparent, tracestate)
+		attest.True(t, ok)
+		attest.Equal(t, tr.TraceID, parent.TraceID)
+		attest.NotEqual(t, tr.ParentID, parent.SpanID) // the client request is its own span.
+		attest.Equal(t, tracestate, parent.State)
+	}
+}
@@ -12,9 +12,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/komuw/ong/cookie"
+	"github.com/komuw/ong/cry"
 	"github.com/komuw/ong/internal/acme"
 	"github.com/komuw/ong/internal/clientip"
 	"github.com/komuw/ong/internal/key"
+	"github.com/komuw/ong/sess"
 )
 
 // ratelimit middleware.
@@ -166,6 +169,9 @@ type Opts struct {
 	middlewareOpts
 	// serverOpts are parameters that are used by server.
 	serverOpts
+	// Dev is true if the Opts were created by [DevOpts].
+	// It turns on conveniences that are only suitable for development, like reloading templates when they change.
+	Dev bool
 }
 
 // String implements [fmt.Stringer]
@@ -173,9 +179,11 @@ func (o Opts) String() string {
 	return fmt.Sprintf(`Opts{
   middlewareOpts: %v
   serverOpts: %v
+  Dev: %v
 }`,
 		o.middlewareOpts,
 		o.serverOpts,
+		o.Dev,
 	)
 }
 
@@ -194,6 +202,9 @@ func (o Opts) GoString() string {
 //
 // secretKey is used for securing signed data. It should be unique & kept secret.
 // If it becomes compromised, generate a new one and restart your application using the new one.
+// oldSecretKeys are keys that were previously used as secretKey. Data, like cookies, that was secured using them is still accepted.
+// This allows you to rotate secretKey without logging out all your users. Once that data has expired, remove the old keys.
+// See [cry.Keyring]
 //
 // strategy is the algorithm to use when fetching the client's IP address; see [ClientIPstrategy].
 // It is important to choose your strategy carefully, see the warning in [ClientIPstrategy].
@@ -223,6 +234,11 @@ func (o Opts) GoString() string {
 // sessionCookieDuration is the duration that session cookie will be valid. If it is less than 1second, [DefaultSessionCookieDuration] is used instead.
 // sessionAntiReplayFunc is the function used to return a token that will be used to try and mitigate against [replay attacks]. This mitigation not foolproof.
 // If it is nil, [DefaultSessionAntiReplayFunc] is used instead.
+// sessionStore is where sessions are stored server-side, see [sess.NewMemoryStore] & [sess.NewFileStore]. If it is nil, sessions are stored in encrypted cookies.
+// cookieOpts are the attributes, like SameSite & Path, of the csrf and session cookies. The zero value is a reasonable default, see [cookie.Opts].
+//
+// rejectFunc renders the response whenever a middleware rejects a request, for example when a client is rate limited. See [RejectFunc]
+// If it is nil, the response is a problem+json or html document, depending on the Accept header of the request.
 //
 // maxBodyBytes is the maximum size in bytes for incoming request bodies. If this is zero, a reasonable default is used.
 //
@@ -261,6 +277,7 @@ func New(
 
 	// middleware
 	secretKey string,
+	oldSecretKeys []string,
 	strategy ClientIPstrategy,
 	logFunc func(r http.Request, response http.Header, statusCode int, fields []any),
 	rateLimit float64,
@@ -276,6 +293,9 @@ func New(
 	csrfTokenDuration time.Duration,
 	sessionCookieDuration time.Duration,
 	sessionAntiReplayFunc func(r http.Request) string,
+	sessionStore sess.Store,
+	cookieOpts cookie.Opts,
+	rejectFunc RejectFunc,
 	// server
 	maxBodyBytes uint64,
 	serverLogLevel slog.Level,
@@ -296,6 +316,7 @@ func New(
 		port,
 		logger,
 		secretKey,
+		oldSecretKeys,
 		strategy,
 		logFunc,
 		rateLimit,
@@ -311,6 +332,9 @@ func New(
 		csrfTokenDuration,
 		sessionCookieDuration,
 		sessionAntiReplayFunc,
+		sessionStore,
+		cookieOpts,
+		rejectFunc,
 	)
 	if err != nil {
 		panic(err)
@@ -361,6 +385,7 @@ func WithOpts(
 
 		// middleware
 		secretKey,
+		nil,
 		strategy,
 		nil,
 		DefaultRateLimit,
@@ -376,6 +401,9 @@ func WithOpts(
 		DefaultCsrfCookieDuration,
 		DefaultSessionCookieDuration,
 		DefaultSessionAntiReplayFunc,
+		nil,
+		cookie.Opts{},
+		nil,
 		// server
 		DefaultMaxBodyBytes,
 		DefaultServerLogLevel,
@@ -394,7 +422,7 @@ func WithOpts(
 }
 
 // DevOpts returns a new Opts that has sensible defaults, especially for dev environments.
-// It also automatically creates & configures the developer TLS certificates/key.
+// It also automatically creates & configures the developer TLS certificates/key, and sets [Opts.Dev]
 // It panics on error.
 //
 // See [New] for extra documentation.
@@ -403,7 +431,7 @@ func DevOpts(logger *slog.Logger, secretKey string) Opts {
 	httpsPort := uint16(65081)
 	certFile, keyFile := createDevCertKey(logger)
 
-	return New(
+	o := New(
 		// common
 		domain,
 		httpsPort,
@@ -411,6 +439,7 @@ func DevOpts(logger *slog.Logger, secretKey string) Opts {
 
 		// middleware
 		secretKey,
+		nil,
 		clientip.DirectIpStrategy,
 		nil,
 		DefaultRateLimit,
@@ -426,6 +455,9 @@ func DevOpts(logger *slog.Logger, secretKey string) Opts {
 		DefaultCsrfCookieDuration,
 		DefaultSessionCookieDuration,
 		DefaultSessionAntiReplayFunc,
+		nil,
+		cookie.Opts{},
+		nil,
 		// server
 		DefaultMaxBodyBytes,
 		DefaultServerLogLevel,
@@ -441,6 +473,9 @@ func DevOpts(logger *slog.Logger, secretKey string) Opts {
 		"",
 		nil,
 	)
+	o.Dev = true
+
+	return o
 }
 
 // CertOpts returns a new Opts that has sensible defaults given certFile & keyFile.
@@ -468,6 +503,7 @@ func CertOpts(
 
 		// middleware
 		secretKey,
+		nil,
 		clientip.DirectIpStrategy,
 		nil,
 		DefaultRateLimit,
@@ -483,6 +519,9 @@ func CertOpts(
 		DefaultCsrfCookieDuration,
 		DefaultSessionCookieDuration,
 		DefaultSessionAntiReplayFunc,
+		nil,
+		cookie.Opts{},
+		nil,
 		// server
 		DefaultMaxBodyBytes,
 		DefaultServerLogLevel,
@@ -528,6 +567,7 @@ func AcmeOpts(
 
 		// middleware
 		secretKey,
+		nil,
 		clientip.DirectIpStrategy,
 		nil,
 		DefaultRateLimit,
@@ -543,6 +583,9 @@ func AcmeOpts(
 		DefaultCsrfCookieDuration,
 		DefaultSessionCookieDuration,
 		DefaultSessionAntiReplayFunc,
+		nil,
+		cookie.Opts{},
+		nil,
 		// server
 		DefaultMaxBodyBytes,
 		DefaultServerLogLevel,
@@ -587,6 +630,7 @@ func LetsEncryptOpts(
 
 		// middleware
 		secretKey,
+		nil,
 		clientip.DirectIpStrategy,
 		nil,
 		DefaultRateLimit,
@@ -602,6 +646,9 @@ func LetsEncryptOpts(
 		DefaultCsrfCookieDuration,
 		DefaultSessionCookieDuration,
 		DefaultSessionAntiReplayFunc,
+		nil,
+		cookie.Opts{},
+		nil,
 		// server
 		DefaultMaxBodyBytes,
 		DefaultServerLogLevel,
@@ -646,8 +693,11 @@ type middlewareOpts struct {
 	// - https://pkg.go.dev/fmt#:~:text=When%20printing%20a%20struct
 	// - https://go.dev/play/p/wL2gqumZ23b
 	SecretKey secureKey
-	Strategy  ClientIPstrategy
-	LogFunc   func(r http.Request, response http.Header, statusCode int, fields []any)
+	// Keyring holds SecretKey as its primary key, plus any old secret keys.
+	// It is used to encrypt & decrypt cookies, csrf tokens and sessions.
+	Keyring  *cry.Keyring
+	Strategy ClientIPstrategy
+	LogFunc  func(r http.Request, response http.Header, statusCode int, fields []any)
 
 	// ratelimit
 	RateLimit float64
@@ -671,6 +721,13 @@ type middlewareOpts struct {
 	// session
 	SessionCookieDuration time.Duration
 	SessionAntiReplayFunc func(r http.Request) string // Does NOT take a pointer to http.Request for security reasons.
+	SessionStore          sess.Store
+
+	// cookies
+	CookieOpts cookie.Opts
+
+	// rejections
+	RejectFunc RejectFunc
 }
 
 // String implements [fmt.Stringer]
@@ -679,6 +736,7 @@ func (m middlewareOpts) String() string {
   Domain: %s,
   HttpsPort: %d,
   SecretKey: %s,
+  Keyring: %v,
   Strategy: %v,
   RateLimit: %v,
   LoadShedSamplingPeriod: %v,
@@ -693,10 +751,13 @@ func (m middlewareOpts) String() string {
   CsrfTokenDuration: %v,
   SessionCookieDuration: %v,
   SessionAntiReplayFunc: %T,
+  SessionStore: %T,
+  CookieOpts: %+v,
 }`,
 		m.Domain,
 		m.HttpsPort,
 		m.SecretKey,
+		m.Keyring,
 		m.Strategy,
 		m.RateLimit,
 		m.LoadShedSamplingPeriod,
@@ -711,6 +772,8 @@ func (m middlewareOpts) String() string {
 		m.CsrfTokenDuration,
 		m.SessionCookieDuration,
 		m.SessionAntiReplayFunc,
+		m.SessionStore,
+		m.CookieOpts,
 	)
 }
 
@@ -724,6 +787,7 @@ func newMiddlewareOpts(
 	httpsPort uint16,
 	logger *slog.Logger,
 	secretKey string,
+	oldSecretKeys []string,
 	strategy ClientIPstrategy,
 	logFunc func(r http.Request, response http.Header, statusCode int, fields []any),
 	rateLimit float64,
@@ -739,6 +803,9 @@ func newMiddlewareOpts(
 	csrfTokenDuration time.Duration,
 	sessionCookieDuration time.Duration,
 	sessionAntiReplayFunc func(r http.Request) string,
+	sessionStore sess.Store,
+	cookieOpts cookie.Opts,
+	rejectFunc RejectFunc,
 ) (middlewareOpts, error) {
 	if err := acme.Validate(domain); err != nil {
 		return middlewareOpts{}, err
@@ -756,6 +823,10 @@ func newMiddlewareOpts(
 	if err := key.IsSecure(secretKey); err != nil {
 		return middlewareOpts{}, err
 	}
+	kr, err := cry.NewKeyring(secretKey, oldSecretKeys...)
+	if err != nil {
+		return middlewareOpts{}, err
+	}
 
 	{ // cors validation.
 		if err := validateAllowedOrigins(allowedOrigins); err != nil {
@@ -778,11 +849,16 @@ func newMiddlewareOpts(
 		}
 	}
 
+	if err := cookieOpts.Validate(cookieOpts.Name(sess.CookieName), domain); err != nil {
+		return middlewareOpts{}, err
+	}
+
 	return middlewareOpts{
 		Domain:    domain,
 		HttpsPort: httpsPort,
 		Logger:    logger,
 		SecretKey: secureKey(secretKey),
+		Keyring:   kr,
 		Strategy:  strategy,
 		LogFunc:   logFunc,
 
@@ -808,6 +884,13 @@ func newMiddlewareOpts(
 		// session
 		SessionCookieDuration: sessionCookieDuration,
 		SessionAntiReplayFunc: sessionAntiReplayFunc,
+		SessionStore:          sessionStore,
+
+		// cookies
+		CookieOpts: cookieOpts,
+
+		// rejections
+		RejectFunc: rejectFunc,
 	}, nil
 }
 
@@ -989,6 +1072,10 @@ func (s serverOpts) GoString() string {
 // Equal compares two Opts for equality.
 // It was added for testing purposes.
 func (o Opts) Equal(other Opts) bool {
+	if o.Dev != other.Dev {
+		return false
+	}
+
 	{
 		if o.serverOpts.port != other.serverOpts.port {
 			return false
@@ -1057,6 +1144,9 @@ func (o Opts) Equal(other Opts) bool {
 		if o.SecretKey != other.SecretKey {
 			return false
 		}
+		if !slices.Equal(o.Keyring.IDs(), other.Keyring.IDs()) {
+			return false
+		}
 		if o.Strategy != other.Strategy {
 			return false
 		}
@@ -1105,6 +1195,12 @@ func (o Opts) Equal(other Opts) bool {
 		if o.SessionAntiReplayFunc(http.Request{}) != other.SessionAntiReplayFunc(http.Request{}) {
 			return false
 		}
+		if o.SessionStore != other.SessionStore {
+			return false
+		}
+		if o.CookieOpts != other.CookieOpts {
+			return false
+		}
 	}
 	return true
 }
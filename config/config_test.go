@@ -5,9 +5,12 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/komuw/ong/cookie"
+	"github.com/komuw/ong/cry"
 	"github.com/komuw/ong/internal/clientip"
 	"github.com/komuw/ong/internal/tst"
 	"github.com/komuw/ong/log"
@@ -33,6 +36,8 @@ func validOpts(t *testing.T) Opts {
 		l,
 		// The security key to use for securing signed data.
 		"super-h@rd-Pas1word",
+		// Secret keys that were previously used, in this case none.
+		nil,
 		// In this case, the actual client IP address is fetched from the given http header.
 		SingleIpStrategy("CF-Connecting-IP"),
 		// function to use for logging in middlewares.
@@ -66,6 +71,12 @@ func validOpts(t *testing.T) Opts {
 		6*time.Hour,
 		// Use a given header to try and mitigate against replay-attacks.
 		func(r http.Request) string { return r.Header.Get("Anti-Replay") },
+		// Store sessions in encrypted cookies.
+		nil,
+		// Use the default attributes for the csrf & session cookies.
+		cookie.Opts{},
+		// Render rejections as problem+json or html depending on the Accept header.
+		nil,
 		//
 		// The maximum size in bytes for incoming request bodies.
 		2*1024*1024,
@@ -139,6 +150,7 @@ func TestNewMiddlewareOpts(t *testing.T) {
 				opt.HttpsPort,
 				slog.Default(),
 				string(opt.SecretKey),
+				nil,
 				opt.Strategy,
 				nil,
 				opt.RateLimit,
@@ -154,6 +166,9 @@ func TestNewMiddlewareOpts(t *testing.T) {
 				opt.CsrfTokenDuration,
 				opt.SessionCookieDuration,
 				opt.SessionAntiReplayFunc,
+				opt.SessionStore,
+				opt.CookieOpts,
+				opt.RejectFunc,
 			)
 			attest.Ok(t, err)
 			tt.assert(o)
@@ -201,6 +216,7 @@ func TestNewMiddlewareOptsDomain(t *testing.T) {
 					443,
 					slog.Default(),
 					tst.SecretKey(),
+					nil,
 					clientip.DirectIpStrategy,
 					nil,
 					DefaultRateLimit,
@@ -216,6 +232,9 @@ func TestNewMiddlewareOptsDomain(t *testing.T) {
 					DefaultCsrfCookieDuration,
 					DefaultSessionCookieDuration,
 					DefaultSessionAntiReplayFunc,
+					nil,
+					cookie.Opts{},
+					nil,
 				)
 				attest.Error(t, err)
 			} else {
@@ -224,6 +243,7 @@ func TestNewMiddlewareOptsDomain(t *testing.T) {
 					443,
 					slog.Default(),
 					tst.SecretKey(),
+					nil,
 					clientip.DirectIpStrategy,
 					nil,
 					DefaultRateLimit,
@@ -239,6 +259,9 @@ func TestNewMiddlewareOptsDomain(t *testing.T) {
 					DefaultCsrfCookieDuration,
 					DefaultSessionCookieDuration,
 					DefaultSessionAntiReplayFunc,
+					nil,
+					cookie.Opts{},
+					nil,
 				)
 				attest.Ok(t, err)
 			}
@@ -254,12 +277,15 @@ func TestOpts(t *testing.T) {
 
 		l := log.New(context.Background(), &bytes.Buffer{}, 500)
 		got := DevOpts(l, tst.SecretKey())
+		kr, err := cry.NewKeyring(tst.SecretKey())
+		attest.Ok(t, err)
 
 		want := Opts{
 			middlewareOpts: middlewareOpts{
 				Domain:                 "localhost",
 				HttpsPort:              65081,
 				SecretKey:              secureKey(tst.SecretKey()),
+				Keyring:                kr,
 				Strategy:               clientip.DirectIpStrategy,
 				LogFunc:                nil,
 				RateLimit:              DefaultRateLimit,
@@ -299,6 +325,7 @@ func TestOpts(t *testing.T) {
 				Network:       "tcp",
 				HttpPort:      ":65080",
 			},
+			Dev: true,
 		}
 
 		attest.Equal(t, got, want)
@@ -306,6 +333,22 @@ func TestOpts(t *testing.T) {
 		attest.Subsequence(t, got.SecretKey.String(), "REDACTED")
 		attest.Subsequence(t, got.String(), "REDACTED")
 		attest.Subsequence(t, got.GoString(), "REDACTED")
+		attest.False(t, strings.Contains(got.String(), tst.SecretKey()))
+	})
+
+	t.Run("old secret keys", func(t *testing.T) {
+		t.Parallel()
+
+		o := validOpts(t)
+		attest.Equal(t, len(o.Keyring.IDs()), 1)
+
+		other := validOpts(t)
+		attest.True(t, o.Equal(other))
+
+		kr, err := cry.NewKeyring(string(o.SecretKey), "some-0ld-h@rd-Pas1word")
+		attest.Ok(t, err)
+		other.Keyring = kr
+		attest.False(t, o.Equal(other))
 	})
 
 	// t.Run("with opts", func(t *testing.T) {
@@ -9,8 +9,10 @@ import (
 	"time"
 
 	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/cookie"
 	"github.com/komuw/ong/log"
 	"github.com/komuw/ong/middleware"
+	"github.com/komuw/ong/sess"
 )
 
 func loginHandler() http.HandlerFunc {
@@ -30,6 +32,8 @@ func ExampleNew() {
 		l,
 		// The security key to use for securing signed data.
 		"super-h@rd-Pas1word",
+		// Security keys that were previously used. Data secured using them is still accepted, allowing for key rotation.
+		[]string{"some-0ld-h@rd-Pas1word"},
 		// In this case, the actual client IP address is fetched from the given http header.
 		config.SingleIpStrategy("CF-Connecting-IP"),
 		// function to use for logging in middlewares
@@ -67,6 +71,12 @@ func ExampleNew() {
 		6*time.Hour,
 		// Use a given header to try and mitigate against replay-attacks.
 		func(r http.Request) string { return r.Header.Get("Anti-Replay") },
+		// Store sessions server-side, in memory. They are idle after 30minutes, and expire after 12hours regardless.
+		sess.NewMemoryStore(30*time.Minute, 12*time.Hour),
+		// Use SameSite=Lax so that users who are redirected back from an OAuth identity provider keep their session.
+		cookie.Opts{SameSite: http.SameSiteLaxMode},
+		// This is an API, so rejections like rate limiting are always rendered as problem+json.
+		middleware.RejectJSON,
 		//
 		// The maximum size in bytes for incoming request bodies.
 		2*1024*1024,
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RejectionKind describes why one of the ong middlewares rejected a request.
+type RejectionKind string
+
+const (
+	// RejectionRateLimit is used when a client has sent too many requests.
+	RejectionRateLimit = RejectionKind("rateLimit")
+	// RejectionLoadShed is used when the server is overloaded.
+	RejectionLoadShed = RejectionKind("loadShed")
+	// RejectionCsrf is used when a request has a missing or invalid csrf token.
+	// The client is redirected, using a http 303, to the same url so that it can get a new token.
+	RejectionCsrf = RejectionKind("csrf")
+	// RejectionMethod is used when a request uses a http method that is not allowed by the middleware, eg [github.com/komuw/ong/middleware.Get].
+	RejectionMethod = RejectionKind("method")
+	// RejectionHost is used when the HOST http header of a request does not match the domain of the application.
+	RejectionHost = RejectionKind("host")
+	// RejectionPanic is used when a http handler panicked.
+	RejectionPanic = RejectionKind("panic")
+	// RejectionAuth is used when a request has missing or invalid credentials, see [github.com/komuw/ong/middleware.Authenticate].
+	// The WWW-Authenticate http header has already been set.
+	RejectionAuth = RejectionKind("auth")
+	// RejectionThrottle is used when a client has failed authentication too many times, see [github.com/komuw/ong/middleware.Authenticate].
+	RejectionThrottle = RejectionKind("throttle")
+	// RejectionIdempotency is used when a request has an invalid idempotency key,
+	// or one that is in use by another request, see [github.com/komuw/ong/middleware.Idempotency].
+	RejectionIdempotency = RejectionKind("idempotency")
+)
+
+// Rejection is a request that has been rejected by one of the ong middlewares.
+type Rejection struct {
+	Kind RejectionKind
+	// Status is the http status code of the response.
+	Status int
+	// RetryAfter is how long the client should wait before retrying. It is zero if it does not apply.
+	// The Retry-After http header has already been set when it is non-zero.
+	RetryAfter time.Duration
+	// Reason is the internal cause of the rejection. It is logged, but it should never be sent to clients.
+	Reason error
+}
+
+// Message returns a description of the rejection that is safe to show to clients.
+func (rj Rejection) Message() string {
+	switch rj.Kind {
+	case RejectionRateLimit:
+		return fmt.Sprintf("Too many requests, retry after %s.", rj.RetryAfter)
+	case RejectionLoadShed:
+		return fmt.Sprintf("The server is overloaded, retry after %s.", rj.RetryAfter)
+	case RejectionCsrf:
+		return "The form has expired, please submit it again."
+	case RejectionMethod:
+		return "The http method is not allowed."
+	case RejectionAuth:
+		return "Authentication is required."
+	case RejectionThrottle:
+		return fmt.Sprintf("Too many failed authentication attempts, retry after %s.", rj.RetryAfter)
+	case RejectionIdempotency:
+		switch rj.Status {
+		case http.StatusBadRequest:
+			return "The idempotency key is invalid."
+		case http.StatusConflict:
+			return "A request with the same idempotency key is in progress, retry later."
+		case http.StatusUnprocessableEntity:
+			return "The idempotency key has already been used for a different request."
+		case http.StatusServiceUnavailable:
+			return fmt.Sprintf("Too many requests are in progress, retry after %s.", rj.RetryAfter)
+		}
+		return http.StatusText(rj.Status)
+	default:
+		return http.StatusText(rj.Status)
+	}
+}
+
+// RejectFunc renders the response of a request that has been rejected by one of the ong middlewares.
+// Any headers specific to the rejection, like Retry-After, Allow or Location, have already been set on w.
+// It should write both the status code & body. See [github.com/komuw/ong/middleware.RejectJSON] & [github.com/komuw/ong/middleware.RejectHTML]
+type RejectFunc func(w http.ResponseWriter, r *http.Request, rj Rejection)
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.akshayshah.org/attest"
+)
+
+func TestRejection(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		rj   Rejection
+		want string
+	}{
+		{Rejection{Kind: RejectionRateLimit, Status: http.StatusTooManyRequests, RetryAfter: 15 * time.Minute}, "Too many requests, retry after 15m0s."},
+		{Rejection{Kind: RejectionLoadShed, Status: http.StatusServiceUnavailable, RetryAfter: time.Minute}, "The server is overloaded, retry after 1m0s."},
+		{Rejection{Kind: RejectionCsrf, Status: http.StatusSeeOther}, "The form has expired, please submit it again."},
+		{Rejection{Kind: RejectionMethod, Status: http.StatusMethodNotAllowed}, "The http method is not allowed."},
+		{Rejection{Kind: RejectionHost, Status: http.StatusNotFound}, "Not Found"},
+		{Rejection{Kind: RejectionPanic, Status: http.StatusInternalServerError}, "Internal Server Error"},
+		{Rejection{Kind: RejectionAuth, Status: http.StatusUnauthorized}, "Authentication is required."},
+		{Rejection{Kind: RejectionThrottle, Status: http.StatusTooManyRequests, RetryAfter: 2 * time.Second}, "Too many failed authentication attempts, retry after 2s."},
+		{Rejection{Kind: RejectionIdempotency, Status: http.StatusBadRequest}, "The idempotency key is invalid."},
+		{Rejection{Kind: RejectionIdempotency, Status: http.StatusConflict}, "A request with the same idempotency key is in progress, retry later."},
+		{Rejection{Kind: RejectionIdempotency, Status: http.StatusUnprocessableEntity}, "The idempotency key has already been used for a different request."},
+		{Rejection{Kind: RejectionIdempotency, Status: http.StatusServiceUnavailable, RetryAfter: 5 * time.Second}, "Too many requests are in progress, retry after 5s."},
+		{Rejection{Kind: RejectionIdempotency, Status: http.StatusInternalServerError}, "Internal Server Error"},
+	}
+	for _, tt := range tests {
+		tt.rj.Reason = errors.New("ong/middleware/some: internal reason")
+		got := tt.rj.Message()
+		attest.Equal(t, got, tt.want)
+		attest.False(t, strings.Contains(got, "ong/"))
+	}
+}
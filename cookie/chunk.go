@@ -0,0 +1,127 @@
+package cookie
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxChunks is the maximum number of cookies that a value can be split across.
+// It is well below maxCookiesPerDomain so that other cookies of the site still fit.
+const maxChunks = 10
+
+// chunkName is the name of the cookie that holds the i'th chunk of the value of the cookie called name.
+func chunkName(name string, i int) string {
+	return name + "." + strconv.Itoa(i)
+}
+
+// split splits value into chunks that each fit in a cookie.
+// It returns [ErrTooLarge] if more than maxChunks cookies are needed, or if the cookies of the site would exceed maxCookiesPerDomain.
+func split(r *http.Request, name, value string) ([]string, error) {
+	if len(name)+len(value) <= maxCookieSize {
+		return []string{value}, nil
+	}
+
+	// The name of each chunk has a suffix of at most 3 bytes; `.NN`
+	size := maxCookieSize - len(name) - 3
+	chunks := []string{}
+	for len(value) > 0 {
+		n := min(size, len(value))
+		chunks = append(chunks, value[:n])
+		value = value[n:]
+	}
+	if len(chunks) > maxChunks {
+		return nil, ErrTooLarge
+	}
+
+	others := 0
+	for _, c := range r.Cookies() {
+		if !isChunkOf(c.Name, name) {
+			others++
+		}
+	}
+	if others+len(chunks) > maxCookiesPerDomain {
+		return nil, ErrTooLarge
+	}
+
+	return chunks, nil
+}
+
+// isChunkOf reports whether cookieName is the cookie called name, or one of its chunks.
+func isChunkOf(cookieName, name string) bool {
+	if cookieName == name {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(cookieName, name+".")
+	if !ok {
+		return false
+	}
+	i, err := strconv.Atoi(suffix)
+	return err == nil && i >= 0 && i < maxChunks
+}
+
+// deleteLeftovers deletes the cookies, that were sent in r, which are no longer part of the value of the cookie called name.
+// This is the case when a value shrinks and needs fewer chunks than before.
+func deleteLeftovers(r *http.Request, w http.ResponseWriter, name string, numChunks int, domain string, o Opts) {
+	for _, c := range r.Cookies() {
+		if !isChunkOf(c.Name, name) {
+			continue
+		}
+
+		stale := false
+		if c.Name == name {
+			// The value is now chunked.
+			stale = numChunks > 1
+		} else {
+			i, _ := strconv.Atoi(strings.TrimPrefix(c.Name, name+"."))
+			stale = numChunks == 1 || i >= numChunks
+		}
+		if stale {
+			_ = SetOpts(w, c.Name, "", domain, -1*time.Second, o)
+		}
+	}
+}
+
+// getChunked returns a copy of the named cookie. If the value was split across numbered cookies, they are reassembled.
+func getChunked(r *http.Request, name string) (*http.Cookie, error) {
+	c, err := Get(r, name)
+	if err == nil {
+		return c, nil
+	}
+
+	first, errC := Get(r, chunkName(name, 0))
+	if errC != nil {
+		// Report the error of the unchunked cookie.
+		return nil, err
+	}
+
+	var b strings.Builder
+	b.WriteString(first.Value)
+	for i := 1; i < maxChunks; i++ {
+		chunk, errC := Get(r, chunkName(name, i))
+		if errC != nil {
+			break
+		}
+		b.WriteString(chunk.Value)
+	}
+
+	first.Name = name
+	first.Value = b.String()
+	return first, nil
+}
+
+// DeleteEncrypted removes the named cookie, that was created by [SetEncrypted] or [SetEncryptedOpts], including any of its chunks that were sent in r.
+// domain & o should be the same as the ones that the cookie was created with.
+func DeleteEncrypted(r *http.Request, w http.ResponseWriter, name, domain string, o Opts) {
+	deleted := false
+	for _, c := range r.Cookies() {
+		if isChunkOf(c.Name, name) {
+			_ = SetOpts(w, c.Name, "", domain, -1*time.Second, o)
+			deleted = deleted || c.Name == name
+		}
+	}
+	if !deleted {
+		_ = SetOpts(w, name, "", domain, -1*time.Second, o)
+	}
+}
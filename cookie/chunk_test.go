@@ -0,0 +1,195 @@
+package cookie
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.akshayshah.org/attest"
+)
+
+// nextRequest returns a request that carries the cookies that res asked the browser to keep.
+func nextRequest(res *http.Response, prev *http.Request) *http.Request {
+	jar := map[string]string{}
+	for _, c := range prev.Cookies() {
+		jar[c.Name] = c.Value
+	}
+	for _, c := range res.Cookies() {
+		if c.MaxAge < 0 {
+			delete(jar, c.Name)
+		} else {
+			jar[c.Name] = c.Value
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+	for k, v := range jar {
+		req.AddCookie(&http.Cookie{Name: k, Value: v})
+	}
+	return req
+}
+
+func TestChunks(t *testing.T) {
+	t.Parallel()
+
+	name := "logId"
+	domain := "localhost"
+	mAge := time.Hour
+
+	t.Run("large value is chunked", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		value := strings.Repeat("a", 10_000)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		attest.Ok(t, SetEncrypted(req, rec, name, value, domain, mAge, kr))
+
+		res := rec.Result()
+		defer res.Body.Close()
+		cookies := res.Cookies()
+		attest.True(t, len(cookies) > 1)
+		for i, c := range cookies {
+			attest.Equal(t, c.Name, fmt.Sprintf("%s.%d", name, i))
+			attest.True(t, len(c.Name)+len(c.Value) <= maxCookieSize)
+		}
+
+		got, err := GetEncrypted(nextRequest(res, req), name, kr)
+		attest.Ok(t, err)
+		attest.Equal(t, got.Value, value)
+		attest.Equal(t, got.Name, name)
+	})
+
+	t.Run("shrinking cleans up chunks", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		attest.Ok(t, SetEncrypted(req, rec, name, strings.Repeat("a", 10_000), domain, mAge, kr))
+		res := rec.Result()
+		defer res.Body.Close()
+		req = nextRequest(res, req)
+		numChunks := len(req.Cookies())
+
+		// shrink to fewer chunks.
+		rec = httptest.NewRecorder()
+		attest.Ok(t, SetEncrypted(req, rec, name, strings.Repeat("b", 5_000), domain, mAge, kr))
+		res = rec.Result()
+		defer res.Body.Close()
+		req = nextRequest(res, req)
+		attest.True(t, len(req.Cookies()) < numChunks)
+		got, err := GetEncrypted(req, name, kr)
+		attest.Ok(t, err)
+		attest.Equal(t, got.Value, strings.Repeat("b", 5_000))
+
+		// shrink to a single cookie.
+		rec = httptest.NewRecorder()
+		attest.Ok(t, SetEncrypted(req, rec, name, "small", domain, mAge, kr))
+		res = rec.Result()
+		defer res.Body.Close()
+		req = nextRequest(res, req)
+		attest.Equal(t, len(req.Cookies()), 1)
+		attest.Equal(t, req.Cookies()[0].Name, name)
+		got, err = GetEncrypted(req, name, kr)
+		attest.Ok(t, err)
+		attest.Equal(t, got.Value, "small")
+
+		// grow again.
+		rec = httptest.NewRecorder()
+		attest.Ok(t, SetEncrypted(req, rec, name, strings.Repeat("c", 10_000), domain, mAge, kr))
+		res = rec.Result()
+		defer res.Body.Close()
+		req = nextRequest(res, req)
+		for _, c := range req.Cookies() {
+			attest.NotEqual(t, c.Name, name)
+		}
+		got, err = GetEncrypted(req, name, kr)
+		attest.Ok(t, err)
+		attest.Equal(t, got.Value, strings.Repeat("c", 10_000))
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		err := SetEncrypted(req, rec, name, strings.Repeat("a", 50_000), domain, mAge, kr)
+		attest.ErrorIs(t, err, ErrTooLarge)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, len(res.Cookies()), 0)
+	})
+
+	t.Run("too many cookies for domain", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		for i := range maxCookiesPerDomain - 1 {
+			req.AddCookie(&http.Cookie{Name: fmt.Sprintf("other%d", i), Value: "v"})
+		}
+
+		rec := httptest.NewRecorder()
+		// A single cookie still fits.
+		attest.Ok(t, SetEncrypted(req, rec, name, "small", domain, mAge, kr))
+		// But multiple chunks do not.
+		err := SetEncrypted(req, rec, name, strings.Repeat("a", 10_000), domain, mAge, kr)
+		attest.ErrorIs(t, err, ErrTooLarge)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req.AddCookie(&http.Cookie{Name: "other", Value: "v"})
+		attest.Ok(t, SetEncrypted(req, rec, name, strings.Repeat("a", 10_000), domain, mAge, kr))
+		res := rec.Result()
+		defer res.Body.Close()
+		req = nextRequest(res, req)
+
+		rec = httptest.NewRecorder()
+		DeleteEncrypted(req, rec, name, domain, Opts{})
+		res = rec.Result()
+		defer res.Body.Close()
+		req = nextRequest(res, req)
+
+		attest.Equal(t, len(req.Cookies()), 1)
+		attest.Equal(t, req.Cookies()[0].Name, "other")
+		_, err := GetEncrypted(req, name, kr)
+		attest.Error(t, err)
+	})
+
+	t.Run("tampered chunk", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		attest.Ok(t, SetEncrypted(req, rec, name, strings.Repeat("a", 10_000), domain, mAge, kr))
+		res := rec.Result()
+		defer res.Body.Close()
+
+		// drop the last chunk.
+		req2 := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		cookies := res.Cookies()
+		for _, c := range cookies[:len(cookies)-1] {
+			req2.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		}
+		_, err := GetEncrypted(req2, name, kr)
+		attest.Error(t, err)
+	})
+}
@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/komuw/ong/cry"
@@ -26,12 +25,72 @@ const (
 	// see: https://datatracker.ietf.org/doc/html/rfc6265#section-6.1
 )
 
+// ErrTooLarge is returned when a cookie value is larger than what browsers accept, even after being split across multiple cookies.
+// Browsers silently drop such cookies.
+var ErrTooLarge = errors.New("ong/cookie: cookie value is too large")
+
+const (
+	hostPrefix   = "__Host-"
+	securePrefix = "__Secure-"
+)
+
+// Opts are the attributes of a cookie, other than its name, value, domain & max age.
+// The zero value is a valid Opts; it is what [Set] & [SetEncrypted] use.
+// Cookies are always created with the Secure attribute.
+type Opts struct {
+	// Path is the Path attribute of the cookie. It defaults to "/".
+	Path string
+	// SameSite is the SameSite attribute of the cookie. It defaults to [http.SameSiteStrictMode].
+	// Use [http.SameSiteLaxMode] for cookies that should be sent when users are redirected back from another site, like an OAuth identity provider.
+	SameSite http.SameSite
+	// Partitioned creates a [partitioned cookie], also known as CHIPS. It is needed for cookies that are set by content that is embedded in other sites.
+	// Partitioned cookies should also use [http.SameSiteNoneMode].
+	//
+	// [partitioned cookie]: https://developer.mozilla.org/en-US/docs/Web/Privacy/Privacy_sandbox/Partitioned_cookies
+	Partitioned bool
+	// HostOnly omits the Domain attribute, so that the cookie is only sent to the exact host that set it(excluding subdomains).
+	HostOnly bool
+	// JsAccess makes the cookie accessible to Javascript.
+	// In most cases it should be false(exceptions are rare, like when setting a csrf cookie)
+	JsAccess bool
+}
+
+// Name returns the name that should be used for a cookie called name.
+// It adds the __Host- prefix if o allows it, that is, if the cookie is host-only and its path is "/".
+// Browsers only accept __Host- cookies that are secure, host-only and whose path is "/"; which guards them from being overwritten by subdomains.
+func (o Opts) Name(name string) string {
+	if o.HostOnly && (o.Path == "" || o.Path == "/") && !strings.HasPrefix(name, hostPrefix) {
+		return hostPrefix + name
+	}
+	return name
+}
+
+// Validate checks the attributes of a cookie called name against the rules of its name prefix.
+// See: https://datatracker.ietf.org/doc/html/draft-ietf-httpbis-rfc6265bis#name-cookie-name-prefixes
+func (o Opts) Validate(name, domain string) error {
+	if o.Path != "" && !strings.HasPrefix(o.Path, "/") {
+		return fmt.Errorf("ong/cookie: path of cookie %s should start with a slash", name)
+	}
+	if strings.HasPrefix(name, hostPrefix) {
+		if domain != "" && !o.HostOnly {
+			return fmt.Errorf("ong/cookie: cookie %s should not have a domain, use Opts.HostOnly", name)
+		}
+		if o.Path != "" && o.Path != "/" {
+			return fmt.Errorf("ong/cookie: path of cookie %s should be /", name)
+		}
+	}
+	// Cookies with the __Secure- prefix only need the Secure attribute, which is always set.
+	return nil
+}
+
 // Set creates a cookie on the HTTP response.
 //
 // If domain is an empty string, the cookie is set for the current host(excluding subdomains) else it is set for the given domain and its subdomains.
 // If mAge == 0, a session cookie is created. If mAge < 0, it means delete the cookie now.
 // If jsAccess is false, the cookie will be in-accesible to Javascript.
 // In most cases you should set it to false(exceptions are rare, like when setting a csrf cookie)
+//
+// Use [SetOpts] to control the other attributes of the cookie.
 func Set(
 	w http.ResponseWriter,
 	name string,
@@ -40,6 +99,24 @@ func Set(
 	mAge time.Duration,
 	jsAccess bool,
 ) {
+	// The only possible error is for names with a __Host- prefix and a non-empty domain, which browsers would reject anyway.
+	_ = SetOpts(w, name, value, domain, mAge, Opts{JsAccess: jsAccess})
+}
+
+// SetOpts is like [Set] except that the other attributes of the cookie are taken from o.
+// It returns an error if the attributes violate the rules of the __Host- or __Secure- prefixes of name.
+func SetOpts(
+	w http.ResponseWriter,
+	name string,
+	value string,
+	domain string,
+	mAge time.Duration,
+	o Opts,
+) error {
+	if err := o.Validate(name, domain); err != nil {
+		return err
+	}
+
 	// Since expires is relative to the browser & we are calculating it on the server-side;
 	// there's a possibility of it not doing what u expect.
 	// However, browsers usually ignore this in place of maxAge.
@@ -53,9 +130,20 @@ func Set(
 	}
 
 	httpOnly := true
-	if jsAccess {
+	if o.JsAccess {
 		httpOnly = false
 	}
+	path := "/"
+	if o.Path != "" {
+		path = o.Path
+	}
+	sameSite := http.SameSiteStrictMode
+	if o.SameSite != 0 {
+		sameSite = o.SameSite
+	}
+	if o.HostOnly {
+		domain = ""
+	}
 
 	c := &http.Cookie{
 		Name:  name,
@@ -69,12 +157,13 @@ func Set(
 		// Every browser that supports MaxAge will ignore Expires regardless of it's value
 		// https://datatracker.ietf.org/doc/html/rfc2616#section-13.2.4
 		MaxAge: maxAge,
-		Path:   "/",
+		Path:   path,
 
 		// Security
-		HttpOnly: httpOnly, // If true, makes cookie inaccessible to JS. Should be false for csrf cookies.
-		Secure:   true,     // https only.
-		SameSite: http.SameSiteStrictMode,
+		HttpOnly:    httpOnly, // If true, makes cookie inaccessible to JS. Should be false for csrf cookies.
+		Secure:      true,     // https only.
+		SameSite:    sameSite,
+		Partitioned: o.Partitioned,
 	}
 
 	// Session cookies are those that do not specify the Expires or Max-Age attribute.
@@ -86,6 +175,7 @@ func Set(
 	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Cookies#define_the_lifetime_of_a_cookie
 
 	http.SetCookie(w, c)
+	return nil
 }
 
 // Get returns a copy of the named cookie.
@@ -118,13 +208,9 @@ func Get(r *http.Request, name string) (*http.Cookie, error) {
 // So `sep` should not be any of those.
 const sep = ":"
 
-var (
-	enc  cry.Enc   //nolint:gochecknoglobals
-	once sync.Once //nolint:gochecknoglobals
-)
-
 // SetEncrypted creates a cookie on the HTTP response.
-// The cookie value(but not the name) is encrypted and authenticated using [cry.Enc].
+// The cookie value(but not the name) is encrypted and authenticated using the primary key of kr.
+// The cookie can be read using [GetEncrypted] for as long as that key remains in the keyring, even after it is no longer the primary key.
 //
 // Note: While encrypted cookies can guarantee that the data has not been tampered with,
 // that it is all there and correct, and that the clients cannot read its raw value; they cannot guarantee freshness.
@@ -132,6 +218,9 @@ var (
 //
 // Also see [Set]
 //
+// If the encrypted value is too large to fit in one cookie, it is split across numbered cookies; `<name>.0`, `<name>.1` and so on.
+// It returns [ErrTooLarge], and does not set any cookie, if the value would need more cookies than browsers accept.
+//
 // [replay attacks]: https://en.wikipedia.org/wiki/Replay_attack
 func SetEncrypted(
 	r *http.Request,
@@ -140,12 +229,46 @@ func SetEncrypted(
 	value string,
 	domain string,
 	mAge time.Duration,
-	secretKey string,
-) {
-	once.Do(func() {
-		enc = cry.New(secretKey)
-	})
+	kr *cry.Keyring,
+) error {
+	return SetEncryptedOpts(r, w, name, value, domain, mAge, Opts{}, kr)
+}
+
+// SetEncryptedOpts is like [SetEncrypted] except that the other attributes of the cookie are taken from o.
+// It returns an error if the attributes violate the rules of the __Host- or __Secure- prefixes of name.
+func SetEncryptedOpts(
+	r *http.Request,
+	w http.ResponseWriter,
+	name string,
+	value string,
+	domain string,
+	mAge time.Duration,
+	o Opts,
+	kr *cry.Keyring,
+) error {
+	if err := o.Validate(name, domain); err != nil {
+		return err
+	}
 
+	chunks, err := split(r, name, encryptedValue(r, value, mAge, kr))
+	if err != nil {
+		return err
+	}
+
+	if len(chunks) == 1 {
+		_ = SetOpts(w, name, chunks[0], domain, mAge, o)
+	} else {
+		for i, c := range chunks {
+			_ = SetOpts(w, chunkName(name, i), c, domain, mAge, o)
+		}
+	}
+	deleteLeftovers(r, w, name, len(chunks), domain, o)
+
+	return nil
+}
+
+// encryptedValue returns the value of the cookie that is set by [SetEncrypted].
+func encryptedValue(r *http.Request, value string, mAge time.Duration, kr *cry.Keyring) string {
 	antiReplay := getAntiReplay(r)
 	expires := strconv.FormatInt(
 		time.Now().UTC().Add(mAge).Unix(),
@@ -153,36 +276,31 @@ func SetEncrypted(
 	)
 	combined := antiReplay + expires + value
 
-	encryptedEncodedVal := fmt.Sprintf(
+	return fmt.Sprintf(
 		"%d%s%d%s%s",
 		len(antiReplay),
 		sep,
 		len(expires),
 		sep,
-		enc.EncryptEncode(combined),
+		kr.EncryptEncode(combined),
 	)
+}
 
-	Set(
-		w,
-		name,
-		encryptedEncodedVal,
-		domain,
-		mAge,
-		false,
-	)
+// ValidateEncrypted returns [ErrTooLarge] if the cookies that [SetEncrypted] would create, for the given name & value, are too large for browsers to accept.
+func ValidateEncrypted(r *http.Request, name, value string, kr *cry.Keyring) error {
+	_, err := split(r, name, encryptedValue(r, value, 0, kr))
+	return err
 }
 
 // GetEncrypted authenticates, un-encrypts and returns a copy of the named cookie with the value decrypted.
+// The cookie should have been created by [SetEncrypted] using any of the keys in kr.
+// If the value was split across numbered cookies, they are reassembled.
 func GetEncrypted(
 	r *http.Request,
 	name string,
-	secretKey string,
+	kr *cry.Keyring,
 ) (*http.Cookie, error) {
-	once.Do(func() {
-		enc = cry.New(secretKey)
-	})
-
-	c, err := Get(r, name)
+	c, err := getChunked(r, name)
 	if err != nil {
 		return nil, err
 	}
@@ -202,7 +320,7 @@ func GetEncrypted(
 		return nil, err
 	}
 
-	decryptedVal, err := enc.DecryptDecode(subs[2])
+	decryptedVal, err := kr.DecryptDecode(subs[2])
 	if err != nil {
 		return nil, err
 	}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/komuw/ong/cry"
 	"github.com/komuw/ong/internal/tst"
 	"go.akshayshah.org/attest"
 	"go.uber.org/goleak"
@@ -19,9 +21,9 @@ func setHandler(name, value, domain string, mAge time.Duration, jsAccess bool) h
 	}
 }
 
-func setEncryptedHandler(name, value, domain string, mAge time.Duration, secretKey string) http.HandlerFunc {
+func setEncryptedHandler(name, value, domain string, mAge time.Duration, kr *cry.Keyring) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		SetEncrypted(r, w, name, value, domain, mAge, secretKey)
+		SetEncrypted(r, w, name, value, domain, mAge, kr)
 		fmt.Fprint(w, "hello")
 	}
 }
@@ -31,6 +33,15 @@ func TestMain(m *testing.M) {
 	goleak.VerifyTestMain(m)
 }
 
+// testKeyring returns a keyring that can be used in tests.
+func testKeyring(t testing.TB) *cry.Keyring {
+	t.Helper()
+
+	kr, err := cry.NewKeyring(tst.SecretKey())
+	attest.Ok(t, err)
+	return kr
+}
+
 func TestCookies(t *testing.T) {
 	t.Parallel()
 
@@ -124,8 +135,8 @@ func TestCookies(t *testing.T) {
 		value := "hello world are you okay"
 		domain := "localhost"
 		mAge := 23 * time.Hour
-		secretKey := tst.SecretKey()
-		handler := setEncryptedHandler(name, value, domain, mAge, secretKey)
+		kr := testKeyring(t)
+		handler := setEncryptedHandler(name, value, domain, mAge, kr)
 
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
@@ -146,7 +157,7 @@ func TestCookies(t *testing.T) {
 		attest.Equal(t, cookie.HttpOnly, true)
 
 		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
-		val, err := GetEncrypted(req, cookie.Name, secretKey)
+		val, err := GetEncrypted(req, cookie.Name, kr)
 
 		attest.Ok(t, err)
 		attest.Equal(t, val.Value, value)
@@ -160,8 +171,8 @@ func TestCookies(t *testing.T) {
 		value := "hello world are you okay"
 		domain := "localhost"
 		mAge := -23 * time.Hour
-		secretKey := tst.SecretKey()
-		handler := setEncryptedHandler(name, value, domain, mAge, secretKey)
+		kr := testKeyring(t)
+		handler := setEncryptedHandler(name, value, domain, mAge, kr)
 
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
@@ -179,12 +190,53 @@ func TestCookies(t *testing.T) {
 		attest.Equal(t, cookie.HttpOnly, true)
 
 		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
-		val, err := GetEncrypted(req, cookie.Name, secretKey)
+		val, err := GetEncrypted(req, cookie.Name, kr)
 
 		attest.Zero(t, val)
 		attest.Error(t, err)
 	})
 
+	t.Run("encrypted key rotation", func(t *testing.T) {
+		t.Parallel()
+
+		name := "logId"
+		value := "hello world are you okay"
+		oldKey := "some-0ld-h@rd-Pas1word"
+		before, err := cry.NewKeyring(oldKey)
+		attest.Ok(t, err)
+		handler := setEncryptedHandler(name, value, "localhost", 23*time.Hour, before)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		handler.ServeHTTP(rec, req)
+		res := rec.Result()
+		defer res.Body.Close()
+		cookie := res.Cookies()[0]
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+
+		// A keyring with a different key cannot read it.
+		_, err = GetEncrypted(req, cookie.Name, testKeyring(t))
+		attest.Error(t, err)
+
+		// But one that has the key as an old key can.
+		after, err := cry.NewKeyring(tst.SecretKey(), oldKey)
+		attest.Ok(t, err)
+		val, err := GetEncrypted(req, cookie.Name, after)
+		attest.Ok(t, err)
+		attest.Equal(t, val.Value, value)
+	})
+
+	t.Run("validate encrypted", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+
+		attest.Ok(t, ValidateEncrypted(req, "logId", strings.Repeat("a", 2_000), kr))
+		attest.Ok(t, ValidateEncrypted(req, "logId", strings.Repeat("a", 10_000), kr))
+		attest.ErrorIs(t, ValidateEncrypted(req, "logId", strings.Repeat("a", 50_000), kr), ErrTooLarge)
+	})
+
 	t.Run("anti-replay", func(t *testing.T) {
 		t.Parallel()
 
@@ -237,6 +289,124 @@ func TestDelete(t *testing.T) {
 	})
 }
 
+func TestOpts(t *testing.T) {
+	t.Parallel()
+
+	t.Run("defaults", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		attest.Ok(t, SetOpts(rec, "logId", "skmHajue8k", "example.com", time.Minute, Opts{}))
+		res := rec.Result()
+		defer res.Body.Close()
+
+		attest.Equal(t, len(res.Cookies()), 1)
+		c := res.Cookies()[0]
+		attest.Equal(t, c.Path, "/")
+		attest.Equal(t, c.Domain, "example.com")
+		attest.Equal(t, c.SameSite, http.SameSiteStrictMode)
+		attest.True(t, c.Secure)
+		attest.True(t, c.HttpOnly)
+		attest.False(t, c.Partitioned)
+	})
+
+	t.Run("attributes", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		o := Opts{Path: "/widget", SameSite: http.SameSiteNoneMode, Partitioned: true, JsAccess: true}
+		attest.Ok(t, SetOpts(rec, "logId", "skmHajue8k", "example.com", time.Minute, o))
+		res := rec.Result()
+		defer res.Body.Close()
+
+		attest.Equal(t, len(res.Cookies()), 1)
+		c := res.Cookies()[0]
+		attest.Equal(t, c.Path, "/widget")
+		attest.Equal(t, c.SameSite, http.SameSiteNoneMode)
+		attest.True(t, c.Partitioned)
+		attest.False(t, c.HttpOnly)
+		attest.Subsequence(t, res.Header.Get("Set-Cookie"), "Partitioned")
+	})
+
+	t.Run("host prefix", func(t *testing.T) {
+		t.Parallel()
+
+		o := Opts{HostOnly: true}
+		name := o.Name("logId")
+		attest.Equal(t, name, "__Host-logId")
+		attest.Equal(t, o.Name(name), name)
+		attest.Equal(t, Opts{}.Name("logId"), "logId")
+		attest.Equal(t, Opts{HostOnly: true, Path: "/api"}.Name("logId"), "logId")
+
+		rec := httptest.NewRecorder()
+		attest.Ok(t, SetOpts(rec, name, "skmHajue8k", "example.com", time.Minute, o))
+		res := rec.Result()
+		defer res.Body.Close()
+
+		attest.Equal(t, len(res.Cookies()), 1)
+		c := res.Cookies()[0]
+		attest.Equal(t, c.Name, name)
+		attest.Equal(t, c.Domain, "")
+		attest.Equal(t, c.Path, "/")
+	})
+
+	t.Run("prefix rules", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []struct {
+			name    string
+			cName   string
+			domain  string
+			o       Opts
+			wantErr bool
+		}{
+			{name: "plain", cName: "logId", domain: "example.com", o: Opts{}, wantErr: false},
+			{name: "relative path", cName: "logId", domain: "example.com", o: Opts{Path: "api"}, wantErr: true},
+			{name: "host with domain", cName: "__Host-logId", domain: "example.com", o: Opts{}, wantErr: true},
+			{name: "host without domain", cName: "__Host-logId", domain: "", o: Opts{}, wantErr: false},
+			{name: "host with path", cName: "__Host-logId", domain: "", o: Opts{HostOnly: true, Path: "/api"}, wantErr: true},
+			{name: "secure", cName: "__Secure-logId", domain: "example.com", o: Opts{Path: "/api"}, wantErr: false},
+		}
+		for _, tt := range tests {
+			err := tt.o.Validate(tt.cName, tt.domain)
+			if tt.wantErr {
+				attest.Error(t, err, attest.Sprintf("case: %s", tt.name))
+				attest.Error(t, SetOpts(httptest.NewRecorder(), tt.cName, "v", tt.domain, time.Minute, tt.o))
+			} else {
+				attest.Ok(t, err, attest.Sprintf("case: %s", tt.name))
+			}
+		}
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		o := Opts{HostOnly: true, SameSite: http.SameSiteLaxMode}
+		name := o.Name("logId")
+		value := "hello world are you okay"
+
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		rec := httptest.NewRecorder()
+		attest.Ok(t, SetEncryptedOpts(req, rec, name, value, "example.com", time.Minute, o, kr))
+		res := rec.Result()
+		defer res.Body.Close()
+
+		attest.Equal(t, len(res.Cookies()), 1)
+		c := res.Cookies()[0]
+		attest.Equal(t, c.Name, "__Host-logId")
+		attest.Equal(t, c.SameSite, http.SameSiteLaxMode)
+		attest.Equal(t, c.Domain, "")
+
+		req = nextRequest(res, req)
+		got, err := GetEncrypted(req, name, kr)
+		attest.Ok(t, err)
+		attest.Equal(t, got.Value, value)
+
+		attest.Error(t, SetEncryptedOpts(req, httptest.NewRecorder(), name, value, "example.com", time.Minute, Opts{}, kr))
+	})
+}
+
 var result int //nolint:gochecknoglobals
 
 func BenchmarkSetEncrypted(b *testing.B) {
@@ -246,8 +416,9 @@ func BenchmarkSetEncrypted(b *testing.B) {
 
 	b.ReportAllocs()
 	b.ResetTimer()
+	kr := testKeyring(b)
 	for range b.N {
-		r = testSetEncrypted(req, res)
+		r = testSetEncrypted(req, res, kr)
 	}
 
 	// always store the result to a package level variable
@@ -255,7 +426,7 @@ func BenchmarkSetEncrypted(b *testing.B) {
 	result = r
 }
 
-func testSetEncrypted(req *http.Request, res http.ResponseWriter) int {
-	SetEncrypted(req, res, "name", "value", "example.com", 2*time.Hour, tst.SecretKey())
+func testSetEncrypted(req *http.Request, res http.ResponseWriter, kr *cry.Keyring) int {
+	SetEncrypted(req, res, "name", "value", "example.com", 2*time.Hour, kr)
 	return 3
 }
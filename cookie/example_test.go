@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/komuw/ong/cookie"
+	"github.com/komuw/ong/cry"
 )
 
 type shoppingCart struct {
@@ -15,10 +16,9 @@ type shoppingCart struct {
 	Price    uint8
 }
 
-func shoppingCartHandler() http.HandlerFunc {
+func shoppingCartHandler(kr *cry.Keyring) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		cookieName := "cart"
-		secretKey := "superSecret"
 		item := shoppingCart{ItemName: "shoe", Price: 89}
 
 		b, err := json.Marshal(item)
@@ -26,24 +26,33 @@ func shoppingCartHandler() http.HandlerFunc {
 			panic(err)
 		}
 
-		cookie.SetEncrypted(
+		if err := cookie.SetEncrypted(
 			r,
 			w,
 			cookieName,
 			string(b),
 			"example.com",
 			2*time.Hour,
-			secretKey,
-		)
+			kr,
+		); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		fmt.Fprint(w, "thanks for shopping!")
 	}
 }
 
 func ExampleSetEncrypted() {
+	// Once "super-h@rd-Pas1word" is rotated out, it can be passed as an old key so that existing cookies remain valid.
+	kr, err := cry.NewKeyring("super-h@rd-Pas1word")
+	if err != nil {
+		panic(err)
+	}
+
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/shop", nil)
-	shoppingCartHandler().ServeHTTP(rec, req)
+	shoppingCartHandler(kr).ServeHTTP(rec, req)
 
 	res := rec.Result()
 	defer res.Body.Close()
@@ -57,3 +66,51 @@ func ExampleSetEncrypted() {
 	// Output:
 	// cart
 }
+
+func ExampleSetOpts() {
+	// A host-only cookie, that is also sent when users are redirected back from another site.
+	o := cookie.Opts{HostOnly: true, SameSite: http.SameSiteLaxMode}
+
+	rec := httptest.NewRecorder()
+	if err := cookie.SetOpts(rec, o.Name("oauth_state"), "xyz", "example.com", 10*time.Minute, o); err != nil {
+		panic(err)
+	}
+
+	res := rec.Result()
+	defer res.Body.Close()
+
+	c := res.Cookies()[0]
+	fmt.Println(c.Name, c.SameSite == http.SameSiteLaxMode)
+
+	// Output:
+	// __Host-oauth_state true
+}
+
+func ExampleGetSigned() {
+	kr, err := cry.NewKeyring("super-h@rd-Pas1word")
+	if err != nil {
+		panic(err)
+	}
+
+	// The locale can be read by Javascript, but it cannot be forged.
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/settings", nil)
+	if err := cookie.SetSigned(req, rec, "locale", "en-GB", "example.com", 24*time.Hour, kr); err != nil {
+		panic(err)
+	}
+
+	res := rec.Result()
+	defer res.Body.Close()
+
+	next := httptest.NewRequest(http.MethodGet, "/home", nil)
+	next.AddCookie(res.Cookies()[0])
+	c, err := cookie.GetSigned(next, "locale", kr)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(c.Value)
+
+	// Output:
+	// en-GB
+}
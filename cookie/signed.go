@@ -0,0 +1,119 @@
+package cookie
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/komuw/ong/cry"
+)
+
+// SetSigned creates a cookie on the HTTP response.
+// The cookie value is signed using the primary key of kr, but it is not encrypted.
+// This is useful for values that Javascript or other services need to read but should not be able to forge, like a UI locale.
+// The cookie can be read using [GetSigned] for as long as that key remains in the keyring, even after it is no longer the primary key.
+//
+// The cookie value has the format; `<expiry>:<value>:<signature>` where value is encoded using [base64.RawURLEncoding]
+// and expiry is a unix timestamp. The signature also covers the name of the cookie, so a value cannot be moved to another cookie.
+// Like encrypted cookies, it covers the expiry and any anti-replay data of r too.
+// The cookie is accessible to Javascript, use [SetSignedOpts] to change that.
+//
+// It returns [ErrTooLarge], and does not set the cookie, if the value does not fit in a cookie.
+//
+// Also see [SetEncrypted]
+func SetSigned(
+	r *http.Request,
+	w http.ResponseWriter,
+	name string,
+	value string,
+	domain string,
+	mAge time.Duration,
+	kr *cry.Keyring,
+) error {
+	return SetSignedOpts(r, w, name, value, domain, mAge, Opts{JsAccess: true}, kr)
+}
+
+// SetSignedOpts is like [SetSigned] except that the other attributes of the cookie are taken from o.
+// It returns an error if the attributes violate the rules of the __Host- or __Secure- prefixes of name.
+func SetSignedOpts(
+	r *http.Request,
+	w http.ResponseWriter,
+	name string,
+	value string,
+	domain string,
+	mAge time.Duration,
+	o Opts,
+	kr *cry.Keyring,
+) error {
+	if err := o.Validate(name, domain); err != nil {
+		return err
+	}
+
+	expires := strconv.FormatInt(
+		time.Now().UTC().Add(mAge).Unix(),
+		10,
+	)
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+	sig := kr.Sign(signedMsg(name, getAntiReplay(r), expires, encoded))
+
+	signed := expires + sep + encoded + sep + sig
+	if len(name)+len(signed) > maxCookieSize {
+		return ErrTooLarge
+	}
+
+	return SetOpts(w, name, signed, domain, mAge, o)
+}
+
+// GetSigned authenticates and returns a copy of the named cookie with the value decoded.
+// The cookie should have been created by [SetSigned] using any of the keys in kr.
+func GetSigned(
+	r *http.Request,
+	name string,
+	kr *cry.Keyring,
+) (*http.Cookie, error) {
+	c, err := Get(r, name)
+	if err != nil {
+		return nil, err
+	}
+
+	subs := strings.Split(c.Value, sep)
+	if len(subs) != 3 {
+		return nil, errors.New("ong/cookie: invalid cookie")
+	}
+	expiresStr, encoded, sig := subs[0], subs[1], subs[2]
+
+	// Try and prevent replay attacks & session hijacking, see [GetEncrypted].
+	// A mismatched anti replay value shows up as an invalid signature.
+	if err := kr.Verify(signedMsg(name, getAntiReplay(r), expiresStr, encoded), sig); err != nil {
+		return nil, err
+	}
+
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	// You cannot trust anything about the incoming cookie except its value.
+	// So we cannot use `c.MaxAge` here, since a client could have modified that.
+	if diff := expires - time.Now().UTC().Unix(); diff <= 0 {
+		return nil, errors.New("ong/cookie: cookie is expired")
+	}
+
+	val, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Value = string(val)
+	return c, nil
+}
+
+// signedMsg returns the message that is signed for cookies created by [SetSigned].
+func signedMsg(name, antiReplay, expires, encodedValue string) string {
+	// name & antiReplay are length-prefixed so that they cannot be confused with the other parts.
+	return strconv.Itoa(len(name)) + sep + name + sep +
+		strconv.Itoa(len(antiReplay)) + sep + antiReplay + sep +
+		expires + sep + encodedValue
+}
@@ -0,0 +1,172 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/komuw/ong/cry"
+	"github.com/komuw/ong/internal/tst"
+	"go.akshayshah.org/attest"
+)
+
+func TestSigned(t *testing.T) {
+	t.Parallel()
+
+	t.Run("set and get", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		name := "locale"
+		value := "en-GB; dark mode, please"
+
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		rec := httptest.NewRecorder()
+		attest.Ok(t, SetSigned(req, rec, name, value, "localhost", time.Hour, kr))
+		res := rec.Result()
+		defer res.Body.Close()
+
+		attest.Equal(t, len(res.Cookies()), 1)
+		c := res.Cookies()[0]
+		attest.Equal(t, c.Name, name)
+		attest.False(t, c.HttpOnly)
+		attest.Equal(t, len(strings.Split(c.Value, sep)), 3)
+
+		req = nextRequest(res, req)
+		got, err := GetSigned(req, name, kr)
+		attest.Ok(t, err)
+		attest.Equal(t, got.Value, value)
+
+		// Encrypted cookies cannot be read as signed ones.
+		_, err = GetEncrypted(req, name, kr)
+		attest.Error(t, err)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		name := "flags"
+
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		rec := httptest.NewRecorder()
+		attest.Ok(t, SetSigned(req, rec, name, "beta=false", "localhost", time.Hour, kr))
+		res := rec.Result()
+		defer res.Body.Close()
+		subs := strings.Split(res.Cookies()[0].Value, sep)
+
+		forged := []string{
+			strings.Join([]string{subs[0], "YmV0YT10cnVl", subs[2]}, sep),           // beta=true
+			strings.Join([]string{"99999999999", subs[1], subs[2]}, sep),            // extended expiry
+			strings.Join([]string{subs[0], subs[1], kr.Sign("beta=true")}, sep),     // signature of another message
+			strings.Join([]string{subs[0], subs[1]}, sep),                           // missing signature
+			strings.Join([]string{subs[0], subs[1], subs[2][:len(subs[2])-1]}, sep), // truncated signature
+		}
+		for _, v := range forged {
+			r := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+			r.AddCookie(&http.Cookie{Name: name, Value: v})
+			_, err := GetSigned(r, name, kr)
+			attest.Error(t, err, attest.Sprintf("value: %s", v))
+		}
+	})
+
+	t.Run("moved to another cookie", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		rec := httptest.NewRecorder()
+		attest.Ok(t, SetSigned(req, rec, "prefs", "admin", "localhost", time.Hour, kr))
+		res := rec.Result()
+		defer res.Body.Close()
+		c := res.Cookies()[0]
+
+		same := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		same.AddCookie(&http.Cookie{Name: "prefs", Value: c.Value})
+		_, err := GetSigned(same, "prefs", kr)
+		attest.Ok(t, err)
+
+		// The value is valid, but it was signed for another cookie.
+		other := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		other.AddCookie(&http.Cookie{Name: "role", Value: c.Value})
+		_, err = GetSigned(other, "role", kr)
+		attest.Error(t, err)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		rec := httptest.NewRecorder()
+		attest.Ok(t, SetSigned(req, rec, "locale", "en", "localhost", -1*time.Second, kr))
+		res := rec.Result()
+		defer res.Body.Close()
+
+		c := res.Cookies()[0]
+		req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		_, err := GetSigned(req, c.Name, kr)
+		attest.Error(t, err)
+	})
+
+	t.Run("anti-replay", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		req := SetAntiReplay(httptest.NewRequest(http.MethodGet, "/someUri", nil), "client-A")
+		rec := httptest.NewRecorder()
+		attest.Ok(t, SetSigned(req, rec, "locale", "en", "localhost", time.Hour, kr))
+		res := rec.Result()
+		defer res.Body.Close()
+		c := res.Cookies()[0]
+
+		same := SetAntiReplay(httptest.NewRequest(http.MethodGet, "/someUri", nil), "client-A")
+		same.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		_, err := GetSigned(same, c.Name, kr)
+		attest.Ok(t, err)
+
+		other := SetAntiReplay(httptest.NewRequest(http.MethodGet, "/someUri", nil), "client-B")
+		other.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		_, err = GetSigned(other, c.Name, kr)
+		attest.Error(t, err)
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		t.Parallel()
+
+		oldKey := "some-0ld-h@rd-Pas1word"
+		before, err := cry.NewKeyring(oldKey)
+		attest.Ok(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		rec := httptest.NewRecorder()
+		attest.Ok(t, SetSigned(req, rec, "locale", "en", "localhost", time.Hour, before))
+		res := rec.Result()
+		defer res.Body.Close()
+		req = nextRequest(res, req)
+
+		_, err = GetSigned(req, "locale", testKeyring(t))
+		attest.Error(t, err)
+
+		after, err := cry.NewKeyring(tst.SecretKey(), oldKey)
+		attest.Ok(t, err)
+		got, err := GetSigned(req, "locale", after)
+		attest.Ok(t, err)
+		attest.Equal(t, got.Value, "en")
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		rec := httptest.NewRecorder()
+		err := SetSigned(req, rec, "locale", strings.Repeat("a", 4_000), "localhost", time.Hour, testKeyring(t))
+		attest.ErrorIs(t, err, ErrTooLarge)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, len(res.Cookies()), 0)
+	})
+}
@@ -100,8 +100,28 @@ func New(secretKey string) Enc {
 
 // Encrypt, encrypts and authenticates(tamper-proofs) the plainTextMsg using XChaCha20-Poly1305 and returns encrypted bytes.
 func (e Enc) Encrypt(plainTextMsg string) (encryptedMsg []byte) {
-	msgToEncrypt := []byte(plainTextMsg)
+	return e.seal([]byte(plainTextMsg), nil)
+}
+
+// EncryptWithAD is like [Enc.Encrypt] except that it also authenticates additionalData.
+// additionalData is not encrypted and is not part of the result; the exact same additionalData has to be passed to [Enc.DecryptWithAD].
+// It is useful to bind a ciphertext to its context, like the database row it is stored in.
+func (e Enc) EncryptWithAD(plainTextMsg string, additionalData []byte) (encryptedMsg []byte) {
+	return e.seal([]byte(plainTextMsg), additionalData)
+}
+
+// Decrypt authenticates and un-encrypts the encryptedMsg using XChaCha20-Poly1305 and returns decrypted bytes.
+func (e Enc) Decrypt(encryptedMsg []byte) (decryptedMsg []byte, err error) {
+	return e.open(encryptedMsg, nil)
+}
 
+// DecryptWithAD authenticates and un-encrypts the encryptedMsg, that was produced by [Enc.EncryptWithAD], using XChaCha20-Poly1305.
+// It fails if additionalData is not the one that was used during encryption.
+func (e Enc) DecryptWithAD(encryptedMsg, additionalData []byte) (decryptedMsg []byte, err error) {
+	return e.open(encryptedMsg, additionalData)
+}
+
+func (e Enc) seal(msgToEncrypt, additionalData []byte) (encryptedMsg []byte) {
 	// Select a random nonce.
 	// https://github.com/golang/crypto/blob/v0.26.0/chacha20poly1305/chacha20poly1305_test.go#L222
 	nonce := random(
@@ -113,7 +133,7 @@ func (e Enc) Encrypt(plainTextMsg string) (encryptedMsg []byte) {
 	//
 	// version as additionalData ensures that encryption/decryption will fail if using different versions of `ong/cry`
 	// another option would be to prepend the version similar to salt.
-	encrypted := e.aead.Seal(nonce, nonce, msgToEncrypt, []byte{version})
+	encrypted := e.aead.Seal(nonce, nonce, msgToEncrypt, ad(additionalData))
 
 	// Append the salt & nonce to encrypted msg.
 	// |salt|nonce|encryptedMsg|
@@ -132,9 +152,8 @@ func (e Enc) Encrypt(plainTextMsg string) (encryptedMsg []byte) {
 	return encrypted
 }
 
-// Decrypt authenticates and un-encrypts the encryptedMsg using XChaCha20-Poly1305 and returns decrypted bytes.
-func (e Enc) Decrypt(encryptedMsg []byte) (decryptedMsg []byte, err error) {
-	if len(encryptedMsg) < chacha20poly1305.NonceSizeX {
+func (e Enc) open(encryptedMsg, additionalData []byte) (decryptedMsg []byte, err error) {
+	if len(encryptedMsg) < saltLen+chacha20poly1305.NonceSizeX {
 		return nil, errors.New("ong/cry: ciphertext too short")
 	}
 
@@ -154,7 +173,12 @@ func (e Enc) Decrypt(encryptedMsg []byte) (decryptedMsg []byte, err error) {
 	}
 
 	// Decrypt the message and check it wasn't tampered with.
-	return aead.Open(nil, nonce, ciphertext, []byte{version})
+	return aead.Open(nil, nonce, ciphertext, ad(additionalData))
+}
+
+// ad returns the additional data that is authenticated alongside a message.
+func ad(additionalData []byte) []byte {
+	return append([]byte{version}, additionalData...)
 }
 
 // EncryptEncode is like [Enc.Encrypt] except that it returns a string that is encoded using [base64.RawURLEncoding]
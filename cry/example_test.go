@@ -1,7 +1,11 @@
 package cry_test
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/komuw/ong/cry"
 )
@@ -50,3 +54,140 @@ func ExampleHash() {
 
 	fmt.Println(hashedPasswd)
 }
+
+func ExampleHasher() {
+	h, err := cry.NewHasher(2, 64*1024, 2)
+	if err != nil {
+		panic(err)
+	}
+
+	password := "my NSA-hard password"
+	// A hash produced by an older system, or using older parameters.
+	storedHash := cry.Hash(password)
+
+	if err := h.Verify(password, storedHash); err != nil {
+		panic(err)
+	}
+	if h.NeedsRehash(storedHash) {
+		// Since the password is now known, upgrade the hash.
+		storedHash = h.Hash(password)
+	}
+
+	fmt.Println(h.NeedsRehash(storedHash))
+
+	// Output: false
+}
+
+func ExampleIssueToken() {
+	// Services that share a secret can use local tokens, whose contents are encrypted.
+	// Use [cry.PublicTokenKey] & [cry.VerifyingTokenKey] if the verifiers should not be able to issue tokens.
+	k, err := cry.LocalTokenKey("2024-01", "super-h@rd-Pas1word")
+	if err != nil {
+		panic(err)
+	}
+
+	token, err := cry.IssueToken(k, cry.Claims{
+		Issuer:   "auth.example.com",
+		Subject:  "user-1234",
+		Audience: []string{"api.example.com"},
+		Expiry:   time.Now().Add(15 * time.Minute),
+		Custom:   map[string]any{"role": "admin"},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	v, err := cry.NewTokenVerifier("auth.example.com", "api.example.com", 30*time.Second, k)
+	if err != nil {
+		panic(err)
+	}
+	claims, err := v.Verify(token)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(claims.Subject, claims.Custom["role"])
+
+	// Output: user-1234 admin
+}
+
+func ExampleKeyring() {
+	// Data encrypted before the rotation, using the then primary key.
+	before, err := cry.NewKeyring("some-0ld-h@rd-Pas1word")
+	if err != nil {
+		panic(err)
+	}
+	encrypted := before.EncryptEncode("Muziki asili yake - Remmy Ongala.")
+
+	// After rotation, the old key is only used for decryption.
+	kr, err := cry.NewKeyring("super-h@rd-Pas1word", "some-0ld-h@rd-Pas1word")
+	if err != nil {
+		panic(err)
+	}
+	decrypted, err := kr.DecryptDecode(encrypted)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(decrypted)
+
+	// Output: Muziki asili yake - Remmy Ongala.
+}
+
+func ExampleEnc_NewEncryptingWriter() {
+	e := cry.New("super-h@rd-Pas1word")
+
+	// In practice, this would be something like an *os.File
+	encrypted := &bytes.Buffer{}
+	w := e.NewEncryptingWriter(encrypted)
+	if _, err := io.Copy(w, strings.NewReader("Muziki asili yake - Remmy Ongala.")); err != nil {
+		panic(err)
+	}
+	// Close has to be called, otherwise decryption fails.
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+
+	decrypted, err := io.ReadAll(e.NewDecryptingReader(encrypted))
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(string(decrypted))
+
+	// Output: Muziki asili yake - Remmy Ongala.
+}
+
+func ExampleField() {
+	kr, err := cry.NewKeyring("super-h@rd-Pas1word")
+	if err != nil {
+		panic(err)
+	}
+	bi := cry.NewBlindIndex("some-other-Super-h@rd-password")
+
+	userID := "1234"
+	email := cry.NewField[string](kr, "users", "email", userID)
+	email.V = "alice@example.com"
+	emailIndex := bi.Compute("users", "email", email.V)
+
+	// db.Exec("INSERT INTO users (id, email, email_index) VALUES (?, ?, ?)", userID, email, emailIndex)
+	stored, err := email.Value()
+	if err != nil {
+		panic(err)
+	}
+	_ = emailIndex
+
+	// db.QueryRow("SELECT id, email FROM users WHERE email_index = ?", emailIndex).Scan(&id, &fetched)
+	var fetched cry.Field[string]
+	if err := fetched.Scan(stored); err != nil {
+		panic(err)
+	}
+	// Now that the row ID is known, decrypt the email.
+	if err := fetched.Open(kr, "users", "email", userID); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(fetched.V)
+
+	// Output: alice@example.com
+}
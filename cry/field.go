@@ -0,0 +1,232 @@
+package cry
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/komuw/ong/internal/key"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+)
+
+var (
+	_ sql.Scanner      = &Field[string]{}
+	_ driver.Valuer    = Field[string]{}
+	_ json.Marshaler   = Field[string]{}
+	_ json.Unmarshaler = &Field[string]{}
+
+	// blindIndexSalt is used to derive blind index keys. It is fixed so that the same secret key always produces the same index.
+	blindIndexSalt = []byte("ong/cry/blindindex")
+)
+
+// Field is a value of type T that is stored encrypted, for example in a database column.
+//
+// The ciphertext is bound to the table, column & row ID that it belongs to. Thus, an attacker with access to the database
+// cannot move it to another row or column, say by swapping the encrypted emails of two users.
+//
+// It implements [sql.Scanner] & [driver.Valuer] so that it can be used directly with [database/sql],
+// and [json.Marshaler] & [json.Unmarshaler], in which case the ciphertext(not V) is what is marshaled.
+//
+// Fields are encrypted using a [Keyring], so the secret key can be rotated without re-encrypting existing rows.
+// Rows that were encrypted using an old key can still be read, and are encrypted using the primary key once they are written again.
+//
+// Use [NewField] to get a Field that can be written.
+// A Field that is read, using [Field.Scan] or [Field.UnmarshalJSON], only holds the ciphertext until [Field.Open] is called.
+// That way, the row ID can come from the same row or JSON document.
+type Field[T any] struct {
+	// V is the plaintext value.
+	V T
+
+	kr *Keyring
+	ad []byte
+	// encrypted is the ciphertext that was read, it is decrypted by [Field.Open].
+	encrypted []byte
+}
+
+// NewField returns a [Field] that is encrypted using kr and is bound to the given table, column & rowID.
+// A Field created using NewField is also decrypted as soon as it is read.
+func NewField[T any](kr *Keyring, table, column, rowID string) Field[T] {
+	return Field[T]{kr: kr, ad: fieldAD(table, column, rowID)}
+}
+
+// fieldAD returns the associated data of a field.
+// Each part is length prefixed so that, say; table "ab" & column "c" is not the same as table "a" & column "bc".
+func fieldAD(parts ...string) []byte {
+	b := []byte("ong/cry/field")
+	for _, p := range parts {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(p)))
+		b = append(b, p...)
+	}
+	return b
+}
+
+// String implements [fmt.Stringer]
+// It does not reveal V.
+func (f Field[T]) String() string {
+	return "Field{<REDACTED>}"
+}
+
+// GoString implements [fmt.GoStringer]
+func (f Field[T]) GoString() string {
+	return f.String()
+}
+
+// Open binds f to kr and the given table, column & rowID, then decrypts the ciphertext that was read into V.
+// It returns an error if the ciphertext was not encrypted for that table, column & rowID.
+//
+// Call it after [sql.Row.Scan] or [json.Unmarshal], once the row ID is known:
+//
+//	var id string
+//	var email cry.Field[string]
+//	err := db.QueryRow("SELECT id, email FROM users WHERE email_index = ?", idx).Scan(&id, &email)
+//	err = email.Open(kr, "users", "email", id)
+//
+// Afterwards, f can be written back to the same row.
+func (f *Field[T]) Open(kr *Keyring, table, column, rowID string) error {
+	f.kr = kr
+	f.ad = fieldAD(table, column, rowID)
+	return f.decrypt()
+}
+
+func (f Field[T]) encrypt() (string, error) {
+	if f.kr == nil {
+		return "", errors.New("ong/cry: Field was not created using NewField nor opened using Field.Open")
+	}
+
+	b, err := json.Marshal(f.V)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(f.kr.EncryptWithAD(string(b), f.ad)), nil
+}
+
+// read keeps the ciphertext in encryptedEncoded and decrypts it if f is already bound to a row.
+func (f *Field[T]) read(encryptedEncoded []byte) error {
+	encrypted, err := base64.RawURLEncoding.AppendDecode(nil, encryptedEncoded)
+	if err != nil {
+		return err
+	}
+	f.encrypted = encrypted
+
+	if f.kr == nil {
+		return nil
+	}
+	return f.decrypt()
+}
+
+func (f *Field[T]) decrypt() error {
+	if f.kr == nil {
+		return errors.New("ong/cry: Field has no keyring")
+	}
+
+	var v T
+	if f.encrypted != nil {
+		// The keyring caches the keys derived for the salts of other processes, so decrypting many rows stays cheap.
+		b, err := f.kr.DecryptWithAD(f.encrypted, f.ad)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+	}
+	f.V = v
+
+	return nil
+}
+
+// Value implements [driver.Valuer]
+func (f Field[T]) Value() (driver.Value, error) {
+	return f.encrypt()
+}
+
+// Scan implements [sql.Scanner]
+// A NULL column results in the zero value of T.
+// Unless f was created using [NewField], the value is only decrypted once [Field.Open] is called.
+func (f *Field[T]) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		var zero T
+		f.V = zero
+		f.encrypted = nil
+		return nil
+	case string:
+		return f.read([]byte(v))
+	case []byte:
+		return f.read(v)
+	default:
+		return fmt.Errorf("ong/cry: cannot scan %T into Field", src)
+	}
+}
+
+// MarshalJSON implements [json.Marshaler]
+func (f Field[T]) MarshalJSON() ([]byte, error) {
+	s, err := f.encrypt()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(s)
+}
+
+// UnmarshalJSON implements [json.Unmarshaler]
+// Unless f was created using [NewField], the value is only decrypted once [Field.Open] is called.
+func (f *Field[T]) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return f.read([]byte(s))
+}
+
+// BlindIndex computes keyed hashes of values, so that encrypted columns can be looked up by equality without decrypting them.
+// Store the result of [BlindIndex.Compute] in a separate, indexed, column alongside the encrypted one.
+//
+// Note that a blind index reveals which rows have equal values. Do not use it for columns with few possible values, like booleans or gender.
+//
+// Use [NewBlindIndex] to get a valid BlindIndex.
+type BlindIndex struct {
+	key []byte
+}
+
+// String implements [fmt.Stringer]
+func (b BlindIndex) String() string {
+	return "BlindIndex{key:<REDACTED>}"
+}
+
+// GoString implements [fmt.GoStringer]
+func (b BlindIndex) GoString() string {
+	return b.String()
+}
+
+// NewBlindIndex returns a [BlindIndex] whose key is derived from secretKey.
+// Use a secretKey that is different from the one used to encrypt the values.
+//
+// It panics on error.
+func NewBlindIndex(secretKey string) BlindIndex {
+	if err := key.IsSecure(secretKey); err != nil {
+		panic(err)
+	}
+
+	return BlindIndex{key: argon2.IDKey([]byte(secretKey), blindIndexSalt, _time, memory, threads, keyLen)}
+}
+
+// Compute returns the blind index of value, in the given table & column, encoded using [base64.RawURLEncoding].
+// Each table & column uses a different key, so the same value has unrelated indices in different columns.
+func (b BlindIndex) Compute(table, column, value string) string {
+	colKey := make([]byte, sha256.Size)
+	_, _ = io.ReadFull(hkdf.New(sha256.New, b.key, nil, fieldAD(table, column)), colKey)
+
+	m := hmac.New(sha256.New, colKey)
+	_, _ = m.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
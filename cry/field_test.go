@@ -0,0 +1,237 @@
+package cry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/komuw/ong/internal/tst"
+	"go.akshayshah.org/attest"
+)
+
+func TestEncryptWithAD(t *testing.T) {
+	t.Parallel()
+
+	msg := "hello world!"
+	enc := New(tst.SecretKey())
+
+	encrypted := enc.EncryptWithAD(msg, []byte("users:1"))
+	decrypted, err := enc.DecryptWithAD(encrypted, []byte("users:1"))
+	attest.Ok(t, err)
+	attest.Equal(t, string(decrypted), msg)
+
+	_, err = enc.DecryptWithAD(encrypted, []byte("users:2"))
+	attest.Error(t, err)
+	_, err = enc.Decrypt(encrypted)
+	attest.Error(t, err)
+
+	// Without additional data, it is the same as Encrypt.
+	decrypted, err = enc.DecryptWithAD(enc.Encrypt(msg), nil)
+	attest.Ok(t, err)
+	attest.Equal(t, string(decrypted), msg)
+}
+
+func TestField(t *testing.T) {
+	t.Parallel()
+
+	enc, err := NewKeyring(tst.SecretKey())
+	attest.Ok(t, err)
+
+	type address struct {
+		Street string
+		Zip    int
+	}
+
+	t.Run("value and scan", func(t *testing.T) {
+		t.Parallel()
+
+		f := NewField[address](enc, "users", "address", "1")
+		f.V = address{"Kenyatta Avenue", 100}
+
+		v, err := f.Value()
+		attest.Ok(t, err)
+		s, ok := v.(string)
+		attest.True(t, ok)
+		attest.False(t, strings.Contains(s, "Kenyatta"))
+
+		for _, src := range []any{s, []byte(s)} {
+			g := NewField[address](enc, "users", "address", "1")
+			attest.Ok(t, g.Scan(src))
+			attest.Equal(t, g.V, f.V)
+		}
+
+		g := NewField[address](enc, "users", "address", "1")
+		g.V = f.V
+		attest.Ok(t, g.Scan(nil))
+		attest.Zero(t, g.V)
+		attest.Error(t, g.Scan(42))
+	})
+
+	t.Run("bound to row", func(t *testing.T) {
+		t.Parallel()
+
+		f := NewField[string](enc, "users", "email", "1")
+		f.V = "alice@example.com"
+		v, err := f.Value()
+		attest.Ok(t, err)
+
+		for _, g := range []Field[string]{
+			NewField[string](enc, "users", "email", "2"),
+			NewField[string](enc, "users", "phone", "1"),
+			NewField[string](enc, "admins", "email", "1"),
+			NewField[string](enc, "users", "emai", "l1"),
+		} {
+			attest.Error(t, g.Scan(v))
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+
+		f := NewField[string](enc, "users", "email", "1")
+		f.V = "alice@example.com"
+
+		b, err := json.Marshal(f)
+		attest.Ok(t, err)
+		attest.False(t, strings.Contains(string(b), "alice"))
+
+		g := NewField[string](enc, "users", "email", "1")
+		attest.Ok(t, json.Unmarshal(b, &g))
+		attest.Equal(t, g.V, f.V)
+	})
+
+	t.Run("not created using NewField", func(t *testing.T) {
+		t.Parallel()
+
+		f := Field[string]{V: "hello"}
+		_, err := f.Value()
+		attest.Error(t, err)
+		_, err = json.Marshal(f)
+		attest.Error(t, err)
+		attest.Error(t, f.Scan("not base64!"))
+	})
+
+	t.Run("open", func(t *testing.T) {
+		t.Parallel()
+
+		type user struct {
+			ID    string
+			Email Field[string]
+		}
+
+		email := NewField[string](enc, "users", "email", "1")
+		email.V = "alice@example.com"
+		v, err := email.Value()
+		attest.Ok(t, err)
+		b, err := json.Marshal(user{ID: "1", Email: email})
+		attest.Ok(t, err)
+
+		{ // scan, then open once the row ID is known.
+			var f Field[string]
+			attest.Ok(t, f.Scan(v))
+			attest.Zero(t, f.V)
+			attest.Ok(t, f.Open(enc, "users", "email", "1"))
+			attest.Equal(t, f.V, email.V)
+
+			// It can then be written back.
+			v2, err := f.Value()
+			attest.Ok(t, err)
+			g := NewField[string](enc, "users", "email", "1")
+			attest.Ok(t, g.Scan(v2))
+			attest.Equal(t, g.V, email.V)
+		}
+
+		{ // unmarshal into a zero Field.
+			var u user
+			attest.Ok(t, json.Unmarshal(b, &u))
+			attest.Zero(t, u.Email.V)
+			attest.Ok(t, u.Email.Open(enc, "users", "email", u.ID))
+			attest.Equal(t, u.Email.V, email.V)
+		}
+
+		{ // another row.
+			var f Field[string]
+			attest.Ok(t, f.Scan(v))
+			attest.Error(t, f.Open(enc, "users", "email", "2"))
+			attest.Zero(t, f.V)
+		}
+
+		{ // NULL column.
+			var f Field[string]
+			attest.Ok(t, f.Scan(nil))
+			attest.Ok(t, f.Open(enc, "users", "email", "1"))
+			attest.Zero(t, f.V)
+		}
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		t.Parallel()
+
+		oldKey := "some-0ld-h@rd-Pas1word"
+		before, err := NewKeyring(oldKey)
+		attest.Ok(t, err)
+		f := NewField[string](before, "users", "email", "1")
+		f.V = "alice@example.com"
+		v, err := f.Value()
+		attest.Ok(t, err)
+
+		g := NewField[string](enc, "users", "email", "1")
+		attest.Error(t, g.Scan(v))
+
+		after, err := NewKeyring(tst.SecretKey(), oldKey)
+		attest.Ok(t, err)
+		h := NewField[string](after, "users", "email", "1")
+		attest.Ok(t, h.Scan(v))
+		attest.Equal(t, h.V, f.V)
+
+		// Once written again, it is encrypted using the new primary key.
+		v2, err := h.Value()
+		attest.Ok(t, err)
+		attest.Ok(t, g.Scan(v2))
+		attest.Equal(t, g.V, f.V)
+	})
+
+	t.Run("rows encrypted by other processes", func(t *testing.T) {
+		t.Parallel()
+
+		// Each process derives its own salt.
+		other := &Keyring{primary: keyringEntry{id: enc.primary.id, enc: New(tst.SecretKey()), aead: newSaltCache()}}
+		f := NewField[string](other, "users", "email", "1")
+		f.V = "alice@example.com"
+		v, err := f.Value()
+		attest.Ok(t, err)
+
+		for range 3 {
+			g := NewField[string](enc, "users", "email", "1")
+			attest.Ok(t, g.Scan(v))
+			attest.Equal(t, g.V, f.V)
+		}
+		// The key derived for the salt of the other process is reused.
+		_, ok := enc.primary.aead.get(other.primary.enc.salt)
+		attest.True(t, ok)
+	})
+
+	t.Run("does not leak value", func(t *testing.T) {
+		t.Parallel()
+
+		f := NewField[string](enc, "users", "email", "1")
+		f.V = "alice@example.com"
+		attest.False(t, strings.Contains(fmt.Sprint(f), "alice"))
+		attest.False(t, strings.Contains(fmt.Sprintf("%#v", f), "alice"))
+	})
+}
+
+func TestBlindIndex(t *testing.T) {
+	t.Parallel()
+
+	attest.Panics(t, func() { _ = NewBlindIndex("hi") })
+
+	b := NewBlindIndex(tst.SecretKey())
+	a1 := b.Compute("users", "email", "alice@example.com")
+	attest.Equal(t, a1, NewBlindIndex(tst.SecretKey()).Compute("users", "email", "alice@example.com"))
+	attest.NotEqual(t, a1, b.Compute("users", "email", "bob@example.com"))
+	attest.NotEqual(t, a1, b.Compute("admins", "email", "alice@example.com"))
+	attest.NotEqual(t, a1, NewBlindIndex("some-0ld-h@rd-Pas1word").Compute("users", "email", "alice@example.com"))
+	attest.Subsequence(t, fmt.Sprint(b), "REDACTED")
+}
@@ -33,6 +33,7 @@ func deriveKey(password, salt []byte) []byte {
 
 // Hash returns the argon2id hash of the password.
 // It is safe to persist the result in your database instead of storing the actual password.
+// It uses fixed parameters, use [Hasher] if you need to tune them.
 func Hash(password string) string {
 	salt := random(saltLen, saltLen)
 	derivedKey := deriveKey([]byte(password), salt)
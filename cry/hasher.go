@@ -0,0 +1,295 @@
+package cry
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Some of the code here is inspired by:
+//   (a) https://github.com/P-H-C/phc-string-format/blob/master/phc-sf-spec.md which is the format of the hashes produced by [Hasher].
+//   (b) https://github.com/alexedwards/argon2id whose license(MIT) can be found here: https://github.com/alexedwards/argon2id/blob/v1.0.0/LICENSE
+
+const (
+	argon2idID = "argon2id"
+	scryptID   = "scrypt"
+	// legacyID is the format of hashes produced by [Hash].
+	legacyID = "ong"
+
+	// These bound the parameters accepted when verifying hashes, since they are read from the hash
+	// and a malicious hash could otherwise make verification use a lot of memory or cpu.
+	maxArgon2Memory  = 4 * 1024 * 1024 // 4GB
+	maxArgon2Time    = 100
+	maxScryptLogN    = 24
+	maxScryptMemory  = 4 * 1024 * 1024 * 1024
+	maxHashKeyLength = 1024
+)
+
+// VerifyFunc verifies that password matches hash.
+// It should return nil if they match, and an error otherwise.
+type VerifyFunc func(password, hash string) error
+
+// Hasher hashes passwords using argon2id with configurable cost parameters.
+//
+// Hashes are in the [PHC string format], which includes the parameters used. This means that hashes produced using different parameters
+// can still be verified, and that [Hasher.NeedsRehash] can tell when a hash was produced using parameters other than the current ones.
+//
+// Hasher can also verify hashes in other formats, see [Hasher.Register].
+// Out of the box, it can verify hashes produced by [Hash], bcrypt and scrypt([PHC string format]).
+//
+// Use [NewHasher] to get a valid Hasher.
+//
+// [PHC string format]: https://github.com/P-H-C/phc-string-format/blob/master/phc-sf-spec.md
+type Hasher struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+
+	mu sync.RWMutex // protects formats
+	// +checklocks:mu
+	formats map[string]VerifyFunc
+}
+
+// NewHasher returns a [Hasher] that uses the given argon2id parameters.
+// iterations is the number of passes over the memory, memoryKiB is the amount of memory used in KiB and parallelism is the number of threads.
+// A zero value for any of them means that the value used by [Hash] is used instead.
+//
+// Higher values make hashes harder to crack but also slower to compute; tune them according to your hardware.
+// See https://www.rfc-editor.org/rfc/rfc9106.html#section-4
+func NewHasher(iterations, memoryKiB uint32, parallelism uint8) (*Hasher, error) {
+	if iterations == 0 {
+		iterations = _time
+	}
+	if memoryKiB == 0 {
+		memoryKiB = memory
+	}
+	if parallelism == 0 {
+		parallelism = threads
+	}
+
+	if iterations > maxArgon2Time {
+		return nil, fmt.Errorf("ong/cry: iterations should not exceed %d", maxArgon2Time)
+	}
+	if memoryKiB > maxArgon2Memory {
+		return nil, fmt.Errorf("ong/cry: memory should not exceed %dKiB", maxArgon2Memory)
+	}
+	if memoryKiB < 8*uint32(parallelism) {
+		// https://www.rfc-editor.org/rfc/rfc9106.html#section-3.1
+		return nil, errors.New("ong/cry: memory should be at least 8KiB per thread")
+	}
+
+	h := &Hasher{
+		time:    iterations,
+		memory:  memoryKiB,
+		threads: parallelism,
+		formats: map[string]VerifyFunc{},
+	}
+	h.formats[argon2idID] = verifyArgon2id
+	h.formats[scryptID] = verifyScrypt
+	h.formats[legacyID] = Eql
+	for _, id := range []string{"2a", "2b", "2y"} {
+		h.formats[id] = verifyBcrypt
+	}
+
+	return h, nil
+}
+
+// String implements [fmt.Stringer]
+func (h *Hasher) String() string {
+	return fmt.Sprintf("Hasher{argon2id, t=%d, m=%d, p=%d}", h.time, h.memory, h.threads)
+}
+
+// GoString implements [fmt.GoStringer]
+func (h *Hasher) GoString() string {
+	return h.String()
+}
+
+// Register adds a verifier for hashes whose PHC identifier is id, ie hashes of the form `$<id>$...`.
+// It can be used to verify hashes of legacy systems, say `pbkdf2-sha256`, so that users can be migrated to argon2id as they log in.
+// It replaces any verifier that was previously registered for id.
+func (h *Hasher) Register(id string, verify VerifyFunc) error {
+	if id == "" || strings.Contains(id, separator) {
+		return fmt.Errorf("ong/cry: invalid hash identifier %q", id)
+	}
+	if verify == nil {
+		return errors.New("ong/cry: verify func cannot be nil")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.formats[id] = verify
+
+	return nil
+}
+
+// Hash returns the argon2id hash of the password, in the PHC string format.
+// It is safe to persist the result in your database instead of storing the actual password.
+func (h *Hasher) Hash(password string) string {
+	salt := random(16, 16) // RFC 9106 recommends 128bits.
+	dk := argon2.IDKey([]byte(password), salt, h.time, h.memory, h.threads, keyLen)
+
+	return fmt.Sprintf(
+		"$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idID,
+		argon2.Version,
+		h.memory,
+		h.time,
+		h.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(dk),
+	)
+}
+
+// Verify performs a constant-time comparison between the password and the hash.
+// The hash can be in any of the formats that h knows about, see [Hasher.Register].
+func (h *Hasher) Verify(password, hash string) error {
+	h.mu.RLock()
+	verify, ok := h.formats[hashID(hash)]
+	h.mu.RUnlock()
+	if !ok {
+		return errors.New("ong/cry: unknown hash format")
+	}
+
+	return verify(password, hash)
+}
+
+// NeedsRehash reports whether hash was produced using a format or parameters other than the current ones of h.
+// It is meant to be used after a successful [Hasher.Verify], at which point the password is known and can be rehashed using [Hasher.Hash].
+func (h *Hasher) NeedsRehash(hash string) bool {
+	if hashID(hash) != argon2idID {
+		return true
+	}
+
+	p, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return p.version != argon2.Version ||
+		p.time != h.time ||
+		p.memory != h.memory ||
+		p.threads != h.threads ||
+		len(p.key) != keyLen
+}
+
+// hashID returns the identifier of the format of hash.
+func hashID(hash string) string {
+	if !strings.HasPrefix(hash, separator) {
+		// Hashes produced by [Hash] have the format; version$salt$key
+		return legacyID
+	}
+	id, _, _ := strings.Cut(hash[1:], separator)
+	return id
+}
+
+type argon2idParams struct {
+	version int
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2id parses hashes of the form $argon2id$v=19$m=65536,t=1,p=2$salt$key
+func parseArgon2id(hash string) (argon2idParams, error) {
+	errInvalid := errors.New("ong/cry: invalid argon2id hash")
+
+	parts := strings.Split(hash, separator)
+	if len(parts) != 6 || parts[1] != argon2idID {
+		return argon2idParams{}, errInvalid
+	}
+
+	p := argon2idParams{}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &p.version); err != nil {
+		return argon2idParams{}, errInvalid
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return argon2idParams{}, errInvalid
+	}
+	if p.memory > maxArgon2Memory || p.time > maxArgon2Time || p.time < 1 || p.threads < 1 {
+		return argon2idParams{}, errInvalid
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return argon2idParams{}, errInvalid
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) < 1 || len(p.key) > maxHashKeyLength {
+		return argon2idParams{}, errInvalid
+	}
+
+	return p, nil
+}
+
+func verifyArgon2id(password, hash string) error {
+	p, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	if p.version != argon2.Version {
+		return errors.New("ong/cry: version mismatch")
+	}
+
+	dk := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	if subtle.ConstantTimeCompare(dk, p.key) == 1 {
+		return nil
+	}
+
+	return errors.New("ong/cry: password mismatch")
+}
+
+// verifyScrypt verifies hashes of the form $scrypt$ln=15,r=8,p=1$salt$key
+func verifyScrypt(password, hash string) error {
+	errInvalid := errors.New("ong/cry: invalid scrypt hash")
+
+	parts := strings.Split(hash, separator)
+	if len(parts) != 5 || parts[1] != scryptID {
+		return errInvalid
+	}
+
+	var ln, r, p int
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &ln, &r, &p); err != nil {
+		return errInvalid
+	}
+	// scrypt uses 128 * N * r bytes of memory.
+	if ln < 1 || ln > maxScryptLogN || r < 1 || p < 1 || 128*(1<<ln)*r > maxScryptMemory || r*p >= 1<<30 {
+		return errInvalid
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return errInvalid
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(key) < 1 || len(key) > maxHashKeyLength {
+		return errInvalid
+	}
+
+	dk, err := scrypt.Key([]byte(password), salt, 1<<ln, r, p, len(key))
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(dk, key) == 1 {
+		return nil
+	}
+
+	return errors.New("ong/cry: password mismatch")
+}
+
+func verifyBcrypt(password, hash string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return errors.New("ong/cry: password mismatch")
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package cry
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.akshayshah.org/attest"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+func TestHasher(t *testing.T) {
+	t.Parallel()
+
+	t.Run("hash and verify", func(t *testing.T) {
+		t.Parallel()
+
+		h, err := NewHasher(0, 0, 0)
+		attest.Ok(t, err)
+
+		password := "hey ho"
+		hash := h.Hash(password)
+		attest.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=1,p=2$"))
+		attest.NotEqual(t, hash, h.Hash(password)) // salted.
+
+		attest.Ok(t, h.Verify(password, hash))
+		attest.Error(t, h.Verify("not "+password, hash))
+		attest.False(t, h.NeedsRehash(hash))
+	})
+
+	t.Run("bad params", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewHasher(maxArgon2Time+1, 0, 0)
+		attest.Error(t, err)
+
+		_, err = NewHasher(0, maxArgon2Memory+1, 0)
+		attest.Error(t, err)
+
+		_, err = NewHasher(0, 8, 4)
+		attest.Error(t, err)
+	})
+
+	t.Run("needs rehash", func(t *testing.T) {
+		t.Parallel()
+
+		password := "hey ho"
+		weak, err := NewHasher(1, 8*1024, 1)
+		attest.Ok(t, err)
+		strong, err := NewHasher(2, 16*1024, 1)
+		attest.Ok(t, err)
+
+		weakHash := weak.Hash(password)
+		// hashes produced using other parameters can still be verified.
+		attest.Ok(t, strong.Verify(password, weakHash))
+		attest.True(t, strong.NeedsRehash(weakHash))
+		attest.False(t, weak.NeedsRehash(weakHash))
+
+		strongHash := strong.Hash(password)
+		attest.Ok(t, weak.Verify(password, strongHash))
+		attest.False(t, strong.NeedsRehash(strongHash))
+
+		attest.True(t, strong.NeedsRehash(Hash(password)))
+		attest.True(t, strong.NeedsRehash("$argon2id$garbage"))
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		t.Parallel()
+
+		h, err := NewHasher(0, 0, 0)
+		attest.Ok(t, err)
+
+		password := "hey ho"
+		legacy := Hash(password)
+		attest.Ok(t, h.Verify(password, legacy))
+		attest.Error(t, h.Verify("not "+password, legacy))
+		attest.True(t, h.NeedsRehash(legacy))
+	})
+
+	t.Run("bcrypt", func(t *testing.T) {
+		t.Parallel()
+
+		h, err := NewHasher(0, 0, 0)
+		attest.Ok(t, err)
+
+		password := "hey ho"
+		b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		attest.Ok(t, err)
+
+		attest.Ok(t, h.Verify(password, string(b)))
+		attest.Error(t, h.Verify("not "+password, string(b)))
+		attest.True(t, h.NeedsRehash(string(b)))
+	})
+
+	t.Run("scrypt", func(t *testing.T) {
+		t.Parallel()
+
+		h, err := NewHasher(0, 0, 0)
+		attest.Ok(t, err)
+
+		password := "hey ho"
+		salt := random(16, 16)
+		dk, err := scrypt.Key([]byte(password), salt, 1<<10, 8, 1, 32)
+		attest.Ok(t, err)
+		hash := fmt.Sprintf("$scrypt$ln=10,r=8,p=1$%s$%s",
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(dk),
+		)
+
+		attest.Ok(t, h.Verify(password, hash))
+		attest.Error(t, h.Verify("not "+password, hash))
+		attest.True(t, h.NeedsRehash(hash))
+
+		// excessive parameters are rejected.
+		attest.Error(t, h.Verify(password, strings.Replace(hash, "ln=10", "ln=40", 1)))
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		t.Parallel()
+
+		h, err := NewHasher(0, 0, 0)
+		attest.Ok(t, err)
+
+		attest.Error(t, h.Verify("hey ho", "$pbkdf2-sha256$i=1000$salt$key"))
+	})
+
+	t.Run("register", func(t *testing.T) {
+		t.Parallel()
+
+		h, err := NewHasher(0, 0, 0)
+		attest.Ok(t, err)
+
+		attest.Error(t, h.Register("", func(string, string) error { return nil }))
+		attest.Error(t, h.Register("a$b", func(string, string) error { return nil }))
+		attest.Error(t, h.Register("plain", nil))
+
+		err = h.Register("plain", func(password, hash string) error {
+			if hash != "$plain$"+password {
+				return errors.New("mismatch")
+			}
+			return nil
+		})
+		attest.Ok(t, err)
+
+		attest.Ok(t, h.Verify("hey ho", "$plain$hey ho"))
+		attest.Error(t, h.Verify("hey", "$plain$hey ho"))
+		attest.True(t, h.NeedsRehash("$plain$hey ho"))
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		t.Parallel()
+
+		h, err := NewHasher(0, 0, 0)
+		attest.Ok(t, err)
+
+		password := "hey ho"
+		hash := h.Hash(password)
+
+		for _, bad := range []string{
+			strings.Replace(hash, "v=19", "v=16", 1),
+			strings.Replace(hash, "t=1", "t=2", 1),
+			strings.Replace(hash, "m=65536", "m=99999999", 1),
+			hash + "$extra",
+			hash[:len(hash)-5],
+		} {
+			attest.Error(t, h.Verify(password, bad), attest.Sprintf("hash: %s", bad))
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package cry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/komuw/ong/internal/key"
+	"github.com/komuw/ong/internal/ometrics"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// keyIDLen is the length of the key ID that is prepended to messages encrypted by a [Keyring].
+	keyIDLen = 4
+	// maxKeyringCache is the maximum number of secret keys whose derived state is cached.
+	maxKeyringCache = 100
+)
+
+var (
+	// keyIDSalt is used to derive key IDs. It is fixed so that the same secret key always has the same ID.
+	keyIDSalt = []byte("ong/cry/keyring")
+
+	// keyringCache caches the state derived from each secret key, since deriving it using argon2 is expensive.
+	// Keyrings are immutable, so sharing this state between keyrings that have the same secret keys is safe.
+	keyringCache = &entryCache{m: map[[sha256.Size]byte]keyringEntry{}} //nolint:gochecknoglobals
+)
+
+// Keyring holds a primary secret key that is used for encryption, plus older secret keys that are still accepted for decryption.
+// This allows secret keys to be rotated without invalidating data, like cookies, that was encrypted using the older keys.
+//
+// Messages encrypted by a Keyring are prefixed with the ID of the key that was used to encrypt them.
+// The ID is derived from the secret key, thus it does not change between restarts of an application.
+//
+// Use [NewKeyring] to get a valid Keyring.
+type Keyring struct {
+	primary keyringEntry
+	others  []keyringEntry
+}
+
+type keyringEntry struct {
+	id   []byte
+	enc  Enc
+	aead *saltCache
+	mac  []byte // the key used by [Keyring.Sign]
+}
+
+// NewKeyring returns a [Keyring] whose primary key is primaryKey.
+// oldKeys are keys that were previously used as the primary key. They are only used for decryption.
+// To rotate a secret key, make the current primary key an old key and add a new primary key.
+// Once data encrypted using an old key has expired, that old key can be removed.
+func NewKeyring(primaryKey string, oldKeys ...string) (*Keyring, error) {
+	seen := map[string]bool{}
+	entries := make([]keyringEntry, 0, 1+len(oldKeys))
+	for _, k := range append([]string{primaryKey}, oldKeys...) {
+		if err := key.IsSecure(k); err != nil {
+			return nil, err
+		}
+		if seen[k] {
+			return nil, errors.New("ong/cry: duplicate key in keyring")
+		}
+		seen[k] = true
+
+		e := keyringCache.get(k)
+		if slices.ContainsFunc(entries, func(o keyringEntry) bool { return bytes.Equal(o.id, e.id) }) {
+			// Astronomically unlikely, but two keys with the same ID would make decryption ambiguous.
+			return nil, errors.New("ong/cry: keys in keyring have clashing IDs")
+		}
+		entries = append(entries, e)
+	}
+
+	return &Keyring{primary: entries[0], others: entries[1:]}, nil
+}
+
+// String implements [fmt.Stringer]
+func (k *Keyring) String() string {
+	return fmt.Sprintf("Keyring{ids:%s}", strings.Join(k.IDs(), ","))
+}
+
+// GoString implements [fmt.GoStringer]
+func (k *Keyring) GoString() string {
+	return k.String()
+}
+
+// IDs returns the hex encoded IDs of the keys in the keyring, starting with the primary key.
+func (k *Keyring) IDs() []string {
+	if k == nil {
+		return nil
+	}
+	ids := make([]string, 0, 1+len(k.others))
+	ids = append(ids, hex.EncodeToString(k.primary.id))
+	for _, e := range k.others {
+		ids = append(ids, hex.EncodeToString(e.id))
+	}
+	return ids
+}
+
+// Encrypt is like [Enc.Encrypt] except that it uses the primary key and prefixes the result with that key's ID.
+func (k *Keyring) Encrypt(plainTextMsg string) (encryptedMsg []byte) {
+	return k.EncryptWithAD(plainTextMsg, nil)
+}
+
+// Decrypt authenticates and un-encrypts the encryptedMsg using whichever key, in the keyring, was used to encrypt it.
+func (k *Keyring) Decrypt(encryptedMsg []byte) (decryptedMsg []byte, err error) {
+	return k.DecryptWithAD(encryptedMsg, nil)
+}
+
+// EncryptWithAD is like [Keyring.Encrypt] except that it also authenticates additionalData. See [Enc.EncryptWithAD]
+func (k *Keyring) EncryptWithAD(plainTextMsg string, additionalData []byte) (encryptedMsg []byte) {
+	// |keyID|salt|nonce|encryptedMsg|
+	return append(slices.Clone(k.primary.id), k.primary.enc.EncryptWithAD(plainTextMsg, additionalData)...)
+}
+
+// DecryptWithAD is like [Keyring.Decrypt] except that it also authenticates additionalData. See [Enc.DecryptWithAD]
+func (k *Keyring) DecryptWithAD(encryptedMsg, additionalData []byte) (decryptedMsg []byte, err error) {
+	if len(encryptedMsg) < keyIDLen {
+		return nil, errors.New("ong/cry: ciphertext too short")
+	}
+
+	kid, msg := encryptedMsg[:keyIDLen], encryptedMsg[keyIDLen:]
+	if bytes.Equal(kid, k.primary.id) {
+		return k.primary.decrypt(msg, additionalData)
+	}
+	for _, e := range k.others {
+		if bytes.Equal(kid, e.id) {
+			decryptedMsg, err = e.decrypt(msg, additionalData)
+			if err == nil {
+				ometrics.OldKeyDecryptions.Inc(hex.EncodeToString(e.id))
+			}
+			return decryptedMsg, err
+		}
+	}
+
+	// The message may have been encrypted, using the primary key, by [Enc] before keyrings existed.
+	// Such messages have no key ID.
+	return k.primary.decrypt(encryptedMsg, additionalData)
+}
+
+// EncryptEncode is like [Keyring.Encrypt] except that it returns a string that is encoded using [base64.RawURLEncoding]
+func (k *Keyring) EncryptEncode(plainTextMsg string) (encryptedEncodedMsg string) {
+	return base64.RawURLEncoding.EncodeToString(k.Encrypt(plainTextMsg))
+}
+
+// DecryptDecode takes an encryptedEncodedMsg that was generated using [Keyring.EncryptEncode] and returns the original un-encrypted string.
+func (k *Keyring) DecryptDecode(encryptedEncodedMsg string) (plainTextMsg string, err error) {
+	encryptedMsg, err := base64.RawURLEncoding.DecodeString(encryptedEncodedMsg)
+	if err != nil {
+		return "", err
+	}
+
+	decrypted, err := k.Decrypt(encryptedMsg)
+	if err != nil {
+		return "", err
+	}
+
+	return string(decrypted), nil
+}
+
+func (e keyringEntry) decrypt(encryptedMsg, additionalData []byte) ([]byte, error) {
+	return decryptCached(e.enc, e.aead, encryptedMsg, additionalData)
+}
+
+// entryCache is a bounded cache of the state derived from secret keys.
+type entryCache struct {
+	mu sync.Mutex // protects m
+	// +checklocks:mu
+	m map[[sha256.Size]byte]keyringEntry
+}
+
+func (c *entryCache) get(secretKey string) keyringEntry {
+	h := sha256.Sum256([]byte(secretKey))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.m[h]; ok {
+		return e
+	}
+
+	e := keyringEntry{
+		// A fast hash of the secret key would let an attacker cheaply check guesses of the key.
+		// So use argon2, just like the key used for encryption.
+		id:   argon2.IDKey([]byte(secretKey), keyIDSalt, _time, memory, threads, keyIDLen),
+		enc:  New(secretKey),
+		aead: newSaltCache(),
+		mac:  argon2.IDKey([]byte(secretKey), signSalt, _time, memory, threads, keyLen),
+	}
+	if len(c.m) >= maxKeyringCache {
+		c.m = map[[sha256.Size]byte]keyringEntry{}
+	}
+	c.m[h] = e
+
+	return e
+}
+
+// decryptCached is like [Enc.DecryptWithAD], except that it caches, in c, the keys derived for salts other than e's own.
+// Messages are usually encrypted by a different process(and thus salt) than the one decrypting them,
+// and deriving a key using argon2 on every decryption would be expensive.
+func decryptCached(e Enc, c *saltCache, encryptedMsg, additionalData []byte) ([]byte, error) {
+	if len(encryptedMsg) < saltLen+chacha20poly1305.NonceSizeX {
+		return nil, errors.New("ong/cry: ciphertext too short")
+	}
+	salt, nonce, ciphertext := encryptedMsg[:saltLen], encryptedMsg[saltLen:saltLen+chacha20poly1305.NonceSizeX], encryptedMsg[saltLen+chacha20poly1305.NonceSizeX:]
+
+	if slices.Equal(salt, e.salt) {
+		return e.aead.Open(nil, nonce, ciphertext, ad(additionalData))
+	}
+	if aead, ok := c.get(salt); ok {
+		return aead.Open(nil, nonce, ciphertext, ad(additionalData))
+	}
+
+	aead, err := chacha20poly1305.NewX(deriveKey(e.key, salt))
+	if err != nil {
+		return nil, err
+	}
+	decryptedMsg, err := aead.Open(nil, nonce, ciphertext, ad(additionalData))
+	if err != nil {
+		return nil, err
+	}
+	c.add(salt, aead)
+
+	return decryptedMsg, nil
+}
@@ -0,0 +1,150 @@
+package cry
+
+import (
+	"encoding/hex"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/komuw/ong/internal/ometrics"
+	"github.com/komuw/ong/internal/tst"
+	"go.akshayshah.org/attest"
+)
+
+func TestKeyring(t *testing.T) {
+	t.Parallel()
+
+	oldKey := "some-0ld-h@rd-Pas1word"
+
+	t.Run("new", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewKeyring("hi")
+		attest.Error(t, err)
+		_, err = NewKeyring(tst.SecretKey(), "hi")
+		attest.Error(t, err)
+		_, err = NewKeyring(tst.SecretKey(), tst.SecretKey())
+		attest.Error(t, err)
+
+		kr, err := NewKeyring(tst.SecretKey(), oldKey)
+		attest.Ok(t, err)
+		attest.Equal(t, len(kr.IDs()), 2)
+		attest.False(t, strings.Contains(kr.String(), tst.SecretKey()))
+	})
+
+	t.Run("ids are stable", func(t *testing.T) {
+		t.Parallel()
+
+		a, err := NewKeyring(tst.SecretKey(), oldKey)
+		attest.Ok(t, err)
+		b, err := NewKeyring(oldKey)
+		attest.Ok(t, err)
+		attest.Equal(t, a.IDs()[1], b.IDs()[0])
+		attest.NotEqual(t, a.IDs()[0], b.IDs()[0])
+	})
+
+	t.Run("encrypt/decrypt", func(t *testing.T) {
+		t.Parallel()
+
+		msg := "hello world!"
+		kr, err := NewKeyring(tst.SecretKey())
+		attest.Ok(t, err)
+
+		encrypted := kr.Encrypt(msg)
+		attest.Equal(t, hex.EncodeToString(encrypted[:keyIDLen]), kr.IDs()[0])
+		decrypted, err := kr.Decrypt(encrypted)
+		attest.Ok(t, err)
+		attest.Equal(t, string(decrypted), msg)
+
+		encoded := kr.EncryptEncode(msg)
+		decoded, err := kr.DecryptDecode(encoded)
+		attest.Ok(t, err)
+		attest.Equal(t, decoded, msg)
+
+		// tampering.
+		encrypted[len(encrypted)-1] = encrypted[len(encrypted)-1] ^ 1
+		_, err = kr.Decrypt(encrypted)
+		attest.Error(t, err)
+		_, err = kr.Decrypt([]byte("hi"))
+		attest.Error(t, err)
+	})
+
+	t.Run("additional data", func(t *testing.T) {
+		t.Parallel()
+
+		msg := "hello world!"
+		kr, err := NewKeyring(tst.SecretKey())
+		attest.Ok(t, err)
+
+		encrypted := kr.EncryptWithAD(msg, []byte("users:1"))
+		decrypted, err := kr.DecryptWithAD(encrypted, []byte("users:1"))
+		attest.Ok(t, err)
+		attest.Equal(t, string(decrypted), msg)
+
+		_, err = kr.DecryptWithAD(encrypted, []byte("users:2"))
+		attest.Error(t, err)
+		_, err = kr.Decrypt(encrypted)
+		attest.Error(t, err)
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		t.Parallel()
+
+		msg := "hello world!"
+		before, err := NewKeyring(oldKey)
+		attest.Ok(t, err)
+		encrypted := before.EncryptEncode(msg)
+
+		after, err := NewKeyring(tst.SecretKey(), oldKey)
+		attest.Ok(t, err)
+		oldID := after.IDs()[1]
+		count := ometrics.OldKeyDecryptions.Value(oldID)
+
+		decrypted, err := after.DecryptDecode(encrypted)
+		attest.Ok(t, err)
+		attest.Equal(t, decrypted, msg)
+		attest.Equal(t, ometrics.OldKeyDecryptions.Value(oldID), count+1)
+
+		// New messages use the new primary key.
+		encrypted = after.EncryptEncode(msg)
+		_, err = before.DecryptDecode(encrypted)
+		attest.Error(t, err)
+
+		// Once the old key is removed, its messages are no longer accepted.
+		removed, err := NewKeyring(tst.SecretKey())
+		attest.Ok(t, err)
+		_, err = removed.DecryptDecode(before.EncryptEncode(msg))
+		attest.Error(t, err)
+	})
+
+	t.Run("messages without key ID", func(t *testing.T) {
+		t.Parallel()
+
+		msg := "hello world!"
+		kr, err := NewKeyring(tst.SecretKey())
+		attest.Ok(t, err)
+
+		decrypted, err := kr.DecryptDecode(New(tst.SecretKey()).EncryptEncode(msg))
+		attest.Ok(t, err)
+		attest.Equal(t, decrypted, msg)
+	})
+
+	t.Run("different salts", func(t *testing.T) {
+		t.Parallel()
+
+		// Mimic messages encrypted by another instance of the app.
+		msg := "hello world!"
+		other := keyringEntry{id: []byte("abcd"), enc: New(tst.SecretKey()), aead: newSaltCache()}
+		kr, err := NewKeyring(tst.SecretKey())
+		attest.Ok(t, err)
+		encrypted := append(slices.Clone(kr.primary.id), other.enc.Encrypt(msg)...)
+
+		for range 3 {
+			decrypted, err := kr.Decrypt(encrypted)
+			attest.Ok(t, err)
+			attest.Equal(t, string(decrypted), msg)
+		}
+		_, ok := kr.primary.aead.get(other.enc.salt)
+		attest.True(t, ok)
+	})
+}
@@ -0,0 +1,66 @@
+package cry
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+
+	"github.com/komuw/ong/internal/ometrics"
+)
+
+// signSalt is used to derive signing keys. It is fixed so that the same secret key always produces the same signatures.
+var signSalt = []byte("ong/cry/sign") //nolint:gochecknoglobals
+
+// errBadSignature is returned when a signature does not match its message.
+var errBadSignature = errors.New("ong/cry: invalid signature")
+
+// Sign returns a signature, that authenticates msg, using the primary key of k.
+// Unlike [Keyring.Encrypt], msg is not hidden; the signature only guarantees that msg has not been tampered with.
+//
+// The signature is a HMAC-SHA256 prefixed with the ID of the key that was used, and is encoded using [base64.RawURLEncoding].
+func (k *Keyring) Sign(msg string) (signature string) {
+	// |keyID|mac|
+	return base64.RawURLEncoding.EncodeToString(
+		append(slices.Clone(k.primary.id), k.primary.sign(msg)...),
+	)
+}
+
+// Verify checks that signature was produced by [Keyring.Sign], for msg, using any of the keys in k.
+func (k *Keyring) Verify(msg, signature string) error {
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return errBadSignature
+	}
+	if len(sig) != keyIDLen+sha256.Size {
+		return errBadSignature
+	}
+
+	kid, mac := sig[:keyIDLen], sig[keyIDLen:]
+	if bytes.Equal(kid, k.primary.id) {
+		if hmac.Equal(mac, k.primary.sign(msg)) {
+			return nil
+		}
+		return errBadSignature
+	}
+	for _, e := range k.others {
+		if bytes.Equal(kid, e.id) {
+			if hmac.Equal(mac, e.sign(msg)) {
+				ometrics.OldKeyDecryptions.Inc(hex.EncodeToString(e.id))
+				return nil
+			}
+			return errBadSignature
+		}
+	}
+
+	return errBadSignature
+}
+
+func (e keyringEntry) sign(msg string) []byte {
+	m := hmac.New(sha256.New, e.mac)
+	_, _ = m.Write([]byte(msg))
+	return m.Sum(nil)
+}
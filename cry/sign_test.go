@@ -0,0 +1,70 @@
+package cry
+
+import (
+	"testing"
+
+	"github.com/komuw/ong/internal/ometrics"
+	"github.com/komuw/ong/internal/tst"
+	"go.akshayshah.org/attest"
+)
+
+func TestSign(t *testing.T) {
+	t.Parallel()
+
+	// Not the same old key as in the other tests, so that the count of its metric is not affected by them.
+	oldKey := "some-0ld-s1gning-P@ssword"
+
+	t.Run("sign/verify", func(t *testing.T) {
+		t.Parallel()
+
+		kr, err := NewKeyring(tst.SecretKey())
+		attest.Ok(t, err)
+
+		msg := "hello world!"
+		sig := kr.Sign(msg)
+		attest.Equal(t, sig, kr.Sign(msg)) // deterministic.
+		attest.Ok(t, kr.Verify(msg, sig))
+
+		attest.Error(t, kr.Verify("hello world?", sig))
+		attest.Error(t, kr.Verify(msg, sig[:len(sig)-2]))
+		attest.Error(t, kr.Verify(msg, "not-base64!"))
+		attest.Error(t, kr.Verify(msg, ""))
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		t.Parallel()
+
+		msg := "hello world!"
+		before, err := NewKeyring(oldKey)
+		attest.Ok(t, err)
+		sig := before.Sign(msg)
+
+		after, err := NewKeyring(tst.SecretKey(), oldKey)
+		attest.Ok(t, err)
+		oldID := after.IDs()[1]
+		count := ometrics.OldKeyDecryptions.Value(oldID)
+		attest.Ok(t, after.Verify(msg, sig))
+		attest.Equal(t, ometrics.OldKeyDecryptions.Value(oldID), count+1)
+		attest.Error(t, after.Verify("hello world?", sig))
+		attest.Equal(t, ometrics.OldKeyDecryptions.Value(oldID), count+1)
+
+		// New signatures use the new primary key.
+		attest.Error(t, before.Verify(msg, after.Sign(msg)))
+
+		// Once the old key is removed, its signatures are no longer accepted.
+		removed, err := NewKeyring(tst.SecretKey())
+		attest.Ok(t, err)
+		attest.Error(t, removed.Verify(msg, sig))
+	})
+
+	t.Run("not the encryption key", func(t *testing.T) {
+		t.Parallel()
+
+		kr, err := NewKeyring(tst.SecretKey())
+		attest.Ok(t, err)
+
+		// The signing key is derived separately from the encryption key & the key ID.
+		attest.NotEqual(t, kr.primary.mac, kr.primary.enc.key)
+		attest.Equal(t, len(kr.primary.mac), keyLen)
+	})
+}
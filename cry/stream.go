@@ -0,0 +1,292 @@
+package cry
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+	"slices"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Some of the code here is inspired by:
+//   (a) https://eprint.iacr.org/2015/189.pdf (Online Authenticated-Encryption and its Nonce-Reuse Misuse-Resistance) which describes the STREAM construction.
+//   (b) https://github.com/C2SP/C2SP/blob/main/age.md#payload which is a STREAM construction using ChaCha20-Poly1305.
+//
+// A stream has the format:
+//   |streamVersion|salt|noncePrefix|chunk|chunk|...|finalChunk|
+//
+// Each chunk is the encryption of chunkSize bytes of plaintext, except the final chunk which can be shorter(or even empty).
+// The nonce of each chunk is:
+//   |noncePrefix(16 bytes)|counter(7 bytes, big endian)|finalFlag(1 byte)|
+//
+// The counter prevents chunks from being reordered, and the final flag prevents the stream from being truncated.
+
+const (
+	streamVersion   = byte(1)
+	chunkSize       = 64 * 1024
+	encChunkSize    = chunkSize + chacha20poly1305.Overhead
+	noncePrefixLen  = chacha20poly1305.NonceSizeX - 8
+	streamHeaderLen = 1 + saltLen + noncePrefixLen
+	maxChunkCounter = 1<<56 - 1
+)
+
+var (
+	errStreamClosed    = errors.New("ong/cry: write to closed stream")
+	errStreamTooLong   = errors.New("ong/cry: stream is too long")
+	errStreamTruncated = errors.New("ong/cry: stream is truncated or has been tampered with")
+)
+
+// streamNonce is the nonce of the chunk numbered counter.
+type streamNonce [chacha20poly1305.NonceSizeX]byte
+
+func newStreamNonce(prefix []byte) streamNonce {
+	var n streamNonce
+	copy(n[:noncePrefixLen], prefix)
+	return n
+}
+
+// set updates the counter and final flag of the nonce.
+func (n *streamNonce) set(counter uint64, final bool) {
+	var c [8]byte
+	binary.BigEndian.PutUint64(c[:], counter)
+	copy(n[noncePrefixLen:noncePrefixLen+7], c[1:])
+	n[len(n)-1] = 0
+	if final {
+		n[len(n)-1] = 1
+	}
+}
+
+// NewEncryptingWriter returns a writer that encrypts and authenticates everything that is written to it, and writes the result to w.
+// Unlike [Enc.Encrypt], it does not hold the whole message in memory. This makes it suitable for encrypting large payloads, like files.
+//
+// The returned writer has to be closed in order to write the final chunk of the stream, otherwise decryption will fail.
+// Closing it does not close w.
+//
+// The result can be decrypted using [Enc.NewDecryptingReader] of an Enc that has the same secret key.
+func (e Enc) NewEncryptingWriter(w io.Writer) io.WriteCloser {
+	return &encWriter{
+		w:    w,
+		aead: e.aead,
+		salt: e.salt,
+		buf:  make([]byte, 0, encChunkSize),
+	}
+}
+
+type encWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	salt    []byte
+	nonce   streamNonce
+	counter uint64
+	buf     []byte // plaintext that is yet to be encrypted.
+	started bool
+	closed  bool
+	err     error
+}
+
+func (ew *encWriter) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	if ew.closed {
+		return 0, errStreamClosed
+	}
+	if err := ew.writeHeader(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for len(p) > 0 {
+		if len(ew.buf) == chunkSize {
+			// We only know that a full chunk is not the final one once there is more data.
+			if err := ew.flush(false); err != nil {
+				return n, err
+			}
+		}
+
+		c := min(chunkSize-len(ew.buf), len(p))
+		ew.buf = append(ew.buf, p[:c]...)
+		p = p[c:]
+		n = n + c
+	}
+
+	return n, nil
+}
+
+// Close encrypts & writes the final chunk.
+func (ew *encWriter) Close() error {
+	if ew.err != nil {
+		return ew.err
+	}
+	if ew.closed {
+		return nil
+	}
+	if err := ew.writeHeader(); err != nil {
+		return err
+	}
+	if err := ew.flush(true); err != nil {
+		return err
+	}
+	ew.closed = true
+
+	return nil
+}
+
+func (ew *encWriter) writeHeader() error {
+	if ew.started {
+		return nil
+	}
+	ew.started = true
+
+	prefix := random(noncePrefixLen, noncePrefixLen)
+	ew.nonce = newStreamNonce(prefix)
+
+	header := make([]byte, 0, streamHeaderLen)
+	header = append(header, streamVersion)
+	header = append(header, ew.salt...)
+	header = append(header, prefix...)
+	if _, err := ew.w.Write(header); err != nil {
+		ew.err = err
+		return err
+	}
+
+	return nil
+}
+
+func (ew *encWriter) flush(final bool) error {
+	if ew.counter > maxChunkCounter {
+		ew.err = errStreamTooLong
+		return ew.err
+	}
+
+	ew.nonce.set(ew.counter, final)
+	ct := ew.aead.Seal(ew.buf[:0], ew.nonce[:], ew.buf, []byte{version})
+	if _, err := ew.w.Write(ct); err != nil {
+		ew.err = err
+		return err
+	}
+
+	ew.counter = ew.counter + 1
+	ew.buf = ew.buf[:0]
+
+	return nil
+}
+
+// NewDecryptingReader returns a reader that authenticates and decrypts the stream, produced by [Enc.NewEncryptingWriter], that is read from r.
+// Only authenticated plaintext is ever returned.
+// Reading returns an error if the stream has been tampered with, reordered or truncated.
+func (e Enc) NewDecryptingReader(r io.Reader) io.Reader {
+	return &decReader{
+		r:   bufio.NewReaderSize(r, encChunkSize+1),
+		enc: e,
+		buf: make([]byte, encChunkSize),
+	}
+}
+
+type decReader struct {
+	r       *bufio.Reader
+	enc     Enc
+	aead    cipher.AEAD
+	nonce   streamNonce
+	counter uint64
+	buf     []byte
+	pt      []byte // decrypted plaintext that is yet to be read.
+	started bool
+	done    bool
+	err     error
+}
+
+func (dr *decReader) Read(p []byte) (int, error) {
+	for len(dr.pt) == 0 {
+		if dr.err != nil {
+			return 0, dr.err
+		}
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.next(); err != nil {
+			dr.err = err
+		}
+	}
+
+	n := copy(p, dr.pt)
+	dr.pt = dr.pt[n:]
+
+	return n, nil
+}
+
+func (dr *decReader) readHeader() error {
+	header := make([]byte, streamHeaderLen)
+	if _, err := io.ReadFull(dr.r, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return errStreamTruncated
+		}
+		return err
+	}
+	if header[0] != streamVersion {
+		return errors.New("ong/cry: unknown stream version")
+	}
+
+	salt, prefix := header[1:1+saltLen], header[1+saltLen:]
+	dr.aead = dr.enc.aead
+	if !slices.Equal(salt, dr.enc.salt) {
+		// The stream was encrypted using a different salt.
+		aead, err := chacha20poly1305.NewX(deriveKey(dr.enc.key, salt))
+		if err != nil {
+			return err
+		}
+		dr.aead = aead
+	}
+	dr.nonce = newStreamNonce(prefix)
+	dr.started = true
+
+	return nil
+}
+
+// next decrypts the next chunk.
+func (dr *decReader) next() error {
+	if !dr.started {
+		if err := dr.readHeader(); err != nil {
+			return err
+		}
+	}
+	if dr.counter > maxChunkCounter {
+		return errStreamTooLong
+	}
+
+	n, err := io.ReadFull(dr.r, dr.buf)
+	final := false
+	switch {
+	case errors.Is(err, io.EOF):
+		// Every stream ends with a final chunk, which is at least chacha20poly1305.Overhead bytes long.
+		return errStreamTruncated
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		final = true
+	case err != nil:
+		return err
+	default:
+		// A full chunk is the final one only if there is no more data after it.
+		if _, errP := dr.r.Peek(1); errors.Is(errP, io.EOF) {
+			final = true
+		} else if errP != nil {
+			return errP
+		}
+	}
+
+	dr.nonce.set(dr.counter, final)
+	pt, err := dr.aead.Open(dr.buf[:0], dr.nonce[:], dr.buf[:n], []byte{version})
+	if err != nil {
+		// This is also the case if the stream was truncated at a chunk boundary,
+		// since the last chunk would not have been sealed as the final one.
+		return errStreamTruncated
+	}
+
+	dr.counter = dr.counter + 1
+	dr.pt = pt
+	dr.done = final
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package cry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/komuw/ong/internal/tst"
+	"go.akshayshah.org/attest"
+)
+
+func encryptStream(t *testing.T, e Enc, msg []byte) []byte {
+	t.Helper()
+
+	b := &bytes.Buffer{}
+	w := e.NewEncryptingWriter(b)
+	_, err := w.Write(msg)
+	attest.Ok(t, err)
+	attest.Ok(t, w.Close())
+
+	return b.Bytes()
+}
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+
+	key := tst.SecretKey()
+	enc := New(key)
+
+	t.Run("roundtrip", func(t *testing.T) {
+		t.Parallel()
+
+		for _, size := range []int{0, 1, 100, chunkSize - 1, chunkSize, chunkSize + 1, 3 * chunkSize, 3*chunkSize + 7} {
+			msg := make([]byte, size)
+			_, _ = rand.Read(msg)
+
+			ct := encryptStream(t, enc, msg)
+			attest.Equal(t, len(ct), streamHeaderLen+size+(max(1, (size+chunkSize-1)/chunkSize))*(encChunkSize-chunkSize), attest.Sprintf("size: %d", size))
+
+			got, err := io.ReadAll(enc.NewDecryptingReader(bytes.NewReader(ct)))
+			attest.Ok(t, err, attest.Sprintf("size: %d", size))
+			attest.True(t, bytes.Equal(got, msg), attest.Sprintf("size: %d", size))
+		}
+	})
+
+	t.Run("many small writes", func(t *testing.T) {
+		t.Parallel()
+
+		msg := bytes.Repeat([]byte("hello world!"), chunkSize/4)
+		b := &bytes.Buffer{}
+		w := enc.NewEncryptingWriter(b)
+		for i := 0; i < len(msg); i = i + 7 {
+			_, err := w.Write(msg[i:min(i+7, len(msg))])
+			attest.Ok(t, err)
+		}
+		attest.Ok(t, w.Close())
+		_, err := w.Write([]byte("more"))
+		attest.Error(t, err)
+
+		got, err := io.ReadAll(enc.NewDecryptingReader(b))
+		attest.Ok(t, err)
+		attest.True(t, bytes.Equal(got, msg))
+	})
+
+	t.Run("different Enc with same key", func(t *testing.T) {
+		t.Parallel()
+
+		msg := []byte("Muziki asili yake - Remmy Ongala.")
+		ct := encryptStream(t, enc, msg)
+
+		got, err := io.ReadAll(New(key).NewDecryptingReader(bytes.NewReader(ct)))
+		attest.Ok(t, err)
+		attest.Equal(t, string(got), string(msg))
+
+		_, err = io.ReadAll(New("some-0ld-h@rd-Pas1word").NewDecryptingReader(bytes.NewReader(ct)))
+		attest.Error(t, err)
+	})
+
+	t.Run("tampering", func(t *testing.T) {
+		t.Parallel()
+
+		msg := make([]byte, 3*chunkSize+100)
+		_, _ = rand.Read(msg)
+		ct := encryptStream(t, enc, msg)
+		body := ct[streamHeaderLen:]
+		chunk := func(i int) []byte { return body[i*encChunkSize : min((i+1)*encChunkSize, len(body))] }
+
+		cases := map[string][]byte{
+			"empty":            {},
+			"header only":      ct[:streamHeaderLen],
+			"truncated":        ct[:len(ct)-10],
+			"chunk boundary":   ct[:streamHeaderLen+2*encChunkSize],
+			"final chunk gone": ct[:streamHeaderLen+3*encChunkSize],
+			"extra data":       append(append([]byte{}, ct...), 1, 2, 3),
+			"bit flip":         func() []byte { c := bytes.Clone(ct); c[streamHeaderLen+5] ^= 1; return c }(),
+			"bad version":      func() []byte { c := bytes.Clone(ct); c[0] = 9; return c }(),
+			"reordered": func() []byte {
+				c := bytes.Clone(ct[:streamHeaderLen])
+				for _, i := range []int{1, 0, 2, 3} {
+					c = append(c, chunk(i)...)
+				}
+				return c
+			}(),
+		}
+		for name, c := range cases {
+			got, err := io.ReadAll(enc.NewDecryptingReader(bytes.NewReader(c)))
+			attest.Error(t, err, attest.Sprintf("case: %s", name))
+			// Only authenticated chunks are returned.
+			attest.True(t, bytes.HasPrefix(msg, got), attest.Sprintf("case: %s", name))
+		}
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		t.Parallel()
+
+		w := enc.NewEncryptingWriter(errWriter{})
+		_, err := w.Write([]byte("hello"))
+		attest.Error(t, err)
+		attest.Error(t, w.Close())
+	})
+}
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
@@ -0,0 +1,442 @@
+package cry
+
+import (
+	"crypto/cipher"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/komuw/ong/internal/key"
+)
+
+// Some of the code here is inspired by:
+//   (a) https://github.com/paseto-standard/paseto-spec
+//   (b) https://www.rfc-editor.org/rfc/rfc7519 (JSON Web Token)
+//
+// Tokens have the format:
+//   - local:  ong.v1.local.<kid>.<base64(Enc.Encrypt(claims))>
+//   - public: ong.v1.public.<kid>.<base64(claims)>.<base64(ed25519 signature)>
+//
+// The signature of public tokens covers everything that precedes it, including the key ID.
+// Local tokens do not need to authenticate the key ID separately, since a different key ID selects a different key and thus decryption fails.
+
+const (
+	tokenPrefix  = "ong.v1."
+	tokenLocal   = "local"
+	tokenPublic  = "public"
+	maxTokenLen  = 8 * 1024
+	maxSaltCache = 100
+)
+
+var (
+	// ErrTokenExpired is returned when verifying a token whose expiry has passed.
+	ErrTokenExpired = errors.New("ong/cry: token has expired")
+	// ErrTokenNotYetValid is returned when verifying a token whose not-before time is in the future.
+	ErrTokenNotYetValid = errors.New("ong/cry: token is not yet valid")
+	// ErrTokenInvalid is returned when verifying a token that is malformed, has been tampered with or was created with an unknown key.
+	ErrTokenInvalid = errors.New("ong/cry: token is invalid")
+
+	kidRe = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+	// registeredClaims are the claims that have their own fields in [Claims].
+	registeredClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti"}
+)
+
+// Claims are the contents of a token.
+//
+// The registered claims are the ones defined in [RFC 7519].
+// Expiry is required, the other ones are optional.
+//
+// [RFC 7519]: https://www.rfc-editor.org/rfc/rfc7519#section-4.1
+type Claims struct {
+	// Issuer identifies who issued the token.
+	Issuer string
+	// Subject identifies who the token is about, usually a user or service.
+	Subject string
+	// Audience identifies the recipients that the token is intended for.
+	Audience []string
+	// Expiry is the time after which the token is no longer valid.
+	Expiry time.Time
+	// NotBefore is the time before which the token is not yet valid.
+	NotBefore time.Time
+	// IssuedAt is the time at which the token was issued.
+	IssuedAt time.Time
+	// ID is a unique identifier of the token.
+	ID string
+	// Custom holds any other, application specific, claims.
+	// Its keys should not clash with those of the registered claims.
+	Custom map[string]any
+}
+
+// MarshalJSON implements [json.Marshaler]
+func (c Claims) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(c.Custom)+len(registeredClaims))
+	for k, v := range c.Custom {
+		if slices.Contains(registeredClaims, k) {
+			return nil, fmt.Errorf("ong/cry: custom claim %q clashes with a registered claim", k)
+		}
+		m[k] = v
+	}
+
+	if c.Issuer != "" {
+		m["iss"] = c.Issuer
+	}
+	if c.Subject != "" {
+		m["sub"] = c.Subject
+	}
+	if len(c.Audience) > 0 {
+		m["aud"] = c.Audience
+	}
+	if !c.Expiry.IsZero() {
+		m["exp"] = c.Expiry.Unix()
+	}
+	if !c.NotBefore.IsZero() {
+		m["nbf"] = c.NotBefore.Unix()
+	}
+	if !c.IssuedAt.IsZero() {
+		m["iat"] = c.IssuedAt.Unix()
+	}
+	if c.ID != "" {
+		m["jti"] = c.ID
+	}
+
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON implements [json.Unmarshaler]
+func (c *Claims) UnmarshalJSON(b []byte) error {
+	var reg struct {
+		Issuer    string          `json:"iss"`
+		Subject   string          `json:"sub"`
+		Audience  json.RawMessage `json:"aud"`
+		Expiry    *int64          `json:"exp"`
+		NotBefore *int64          `json:"nbf"`
+		IssuedAt  *int64          `json:"iat"`
+		ID        string          `json:"jti"`
+	}
+	if err := json.Unmarshal(b, &reg); err != nil {
+		return err
+	}
+
+	custom := map[string]any{}
+	if err := json.Unmarshal(b, &custom); err != nil {
+		return err
+	}
+	for _, k := range registeredClaims {
+		delete(custom, k)
+	}
+
+	// aud can either be a single string or an array of strings.
+	var aud []string
+	if len(reg.Audience) > 0 && string(reg.Audience) != "null" {
+		var single string
+		if err := json.Unmarshal(reg.Audience, &single); err == nil {
+			aud = []string{single}
+		} else if err := json.Unmarshal(reg.Audience, &aud); err != nil {
+			return fmt.Errorf("ong/cry: invalid aud claim: %w", err)
+		}
+	}
+
+	unix := func(i *int64) time.Time {
+		if i == nil {
+			return time.Time{}
+		}
+		return time.Unix(*i, 0).UTC()
+	}
+
+	*c = Claims{
+		Issuer:    reg.Issuer,
+		Subject:   reg.Subject,
+		Audience:  aud,
+		Expiry:    unix(reg.Expiry),
+		NotBefore: unix(reg.NotBefore),
+		IssuedAt:  unix(reg.IssuedAt),
+		ID:        reg.ID,
+	}
+	if len(custom) > 0 {
+		c.Custom = custom
+	}
+
+	return nil
+}
+
+// TokenKey is a key used to issue and/or verify tokens.
+//
+// Use [LocalTokenKey], [PublicTokenKey] or [VerifyingTokenKey] to get a valid TokenKey.
+type TokenKey struct {
+	id      string
+	purpose string
+
+	// local
+	enc  Enc
+	aead *saltCache
+
+	// public
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+// String implements [fmt.Stringer]
+func (k TokenKey) String() string {
+	return fmt.Sprintf("TokenKey{id:%s, purpose:%s}", k.id, k.purpose)
+}
+
+// GoString implements [fmt.GoStringer]
+func (k TokenKey) GoString() string {
+	return k.String()
+}
+
+// ID returns the key ID.
+func (k TokenKey) ID() string {
+	return k.id
+}
+
+// LocalTokenKey returns a key for local tokens. These are encrypted and authenticated using [Enc] and thus
+// can only be issued and verified by parties that know secretKey.
+//
+// kid is the key ID. It is included in tokens, in the clear, so that verifiers can pick the right key when keys are rotated.
+// It should contain only alphanumeric characters, '-' or '_'.
+func LocalTokenKey(kid, secretKey string) (TokenKey, error) {
+	if !kidRe.MatchString(kid) {
+		return TokenKey{}, fmt.Errorf("ong/cry: invalid key ID %q", kid)
+	}
+	if err := key.IsSecure(secretKey); err != nil {
+		return TokenKey{}, err
+	}
+
+	return TokenKey{
+		id:      kid,
+		purpose: tokenLocal,
+		enc:     New(secretKey),
+		aead:    newSaltCache(),
+	}, nil
+}
+
+// PublicTokenKey returns a key for public tokens. These are signed using Ed25519, thus anyone with the public key can verify them,
+// but only the holder of privateKey can issue them.
+//
+// See [LocalTokenKey] for the meaning of kid.
+func PublicTokenKey(kid string, privateKey ed25519.PrivateKey) (TokenKey, error) {
+	if !kidRe.MatchString(kid) {
+		return TokenKey{}, fmt.Errorf("ong/cry: invalid key ID %q", kid)
+	}
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return TokenKey{}, errors.New("ong/cry: invalid ed25519 private key")
+	}
+
+	pub, _ := privateKey.Public().(ed25519.PublicKey)
+	return TokenKey{
+		id:      kid,
+		purpose: tokenPublic,
+		private: privateKey,
+		public:  pub,
+	}, nil
+}
+
+// VerifyingTokenKey returns a key that can only verify public tokens.
+// It is what services that consume, but do not issue, tokens should use.
+//
+// See [LocalTokenKey] for the meaning of kid.
+func VerifyingTokenKey(kid string, publicKey ed25519.PublicKey) (TokenKey, error) {
+	if !kidRe.MatchString(kid) {
+		return TokenKey{}, fmt.Errorf("ong/cry: invalid key ID %q", kid)
+	}
+	if len(publicKey) != ed25519.PublicKeySize {
+		return TokenKey{}, errors.New("ong/cry: invalid ed25519 public key")
+	}
+
+	return TokenKey{
+		id:      kid,
+		purpose: tokenPublic,
+		public:  publicKey,
+	}, nil
+}
+
+// IssueToken returns a token that contains claims, encrypted or signed using k.
+// The claims must have an Expiry. If IssuedAt is not set, the current time is used.
+func IssueToken(k TokenKey, c Claims) (string, error) {
+	if c.Expiry.IsZero() {
+		return "", errors.New("ong/cry: token has no expiry")
+	}
+	if c.IssuedAt.IsZero() {
+		c.IssuedAt = time.Now()
+	}
+
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	header := tokenPrefix + k.purpose + "." + k.id + "."
+	switch k.purpose {
+	case tokenLocal:
+		return header + base64.RawURLEncoding.EncodeToString(k.enc.Encrypt(string(payload))), nil
+	case tokenPublic:
+		if k.private == nil {
+			return "", errors.New("ong/cry: key can only be used to verify tokens")
+		}
+		signed := header + base64.RawURLEncoding.EncodeToString(payload)
+		sig := ed25519.Sign(k.private, []byte(signed))
+		return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+	default:
+		return "", errors.New("ong/cry: invalid token key")
+	}
+}
+
+// TokenVerifier verifies tokens issued by [IssueToken].
+//
+// Use [NewTokenVerifier] to get a valid TokenVerifier.
+type TokenVerifier struct {
+	keys     map[string]TokenKey
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+// NewTokenVerifier returns a [TokenVerifier] that accepts tokens issued using any of keys.
+//
+// If issuer is not empty, tokens need to have been issued by it. If audience is not empty, tokens need to be intended for it.
+// leeway is the tolerance for clock skew between the issuer and the verifier, it is applied to the expiry and not-before claims.
+func NewTokenVerifier(issuer, audience string, leeway time.Duration, keys ...TokenKey) (*TokenVerifier, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("ong/cry: no token keys provided")
+	}
+	if leeway < 0 {
+		return nil, errors.New("ong/cry: leeway cannot be negative")
+	}
+
+	m := map[string]TokenKey{}
+	for _, k := range keys {
+		if k.purpose == "" {
+			return nil, errors.New("ong/cry: invalid token key")
+		}
+		if _, ok := m[k.id]; ok {
+			return nil, fmt.Errorf("ong/cry: duplicate key ID %q", k.id)
+		}
+		m[k.id] = k
+	}
+
+	return &TokenVerifier{keys: m, issuer: issuer, audience: audience, leeway: leeway}, nil
+}
+
+// Verify checks that token is authentic and valid, and returns its claims.
+func (v *TokenVerifier) Verify(token string) (Claims, error) {
+	if len(token) > maxTokenLen || !strings.HasPrefix(token, tokenPrefix) {
+		return Claims{}, ErrTokenInvalid
+	}
+
+	parts := strings.Split(strings.TrimPrefix(token, tokenPrefix), ".")
+	if len(parts) < 3 {
+		return Claims{}, ErrTokenInvalid
+	}
+	purpose, kid := parts[0], parts[1]
+
+	k, ok := v.keys[kid]
+	if !ok || k.purpose != purpose {
+		return Claims{}, ErrTokenInvalid
+	}
+
+	var payload []byte
+	switch purpose {
+	case tokenLocal:
+		if len(parts) != 3 {
+			return Claims{}, ErrTokenInvalid
+		}
+		ct, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			return Claims{}, ErrTokenInvalid
+		}
+		payload, err = k.decrypt(ct)
+		if err != nil {
+			return Claims{}, ErrTokenInvalid
+		}
+	case tokenPublic:
+		if len(parts) != 4 {
+			return Claims{}, ErrTokenInvalid
+		}
+		sig, err := base64.RawURLEncoding.DecodeString(parts[3])
+		if err != nil {
+			return Claims{}, ErrTokenInvalid
+		}
+		signed := token[:strings.LastIndex(token, ".")]
+		if !ed25519.Verify(k.public, []byte(signed), sig) {
+			return Claims{}, ErrTokenInvalid
+		}
+		payload, err = base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			return Claims{}, ErrTokenInvalid
+		}
+	default:
+		return Claims{}, ErrTokenInvalid
+	}
+
+	var c Claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return Claims{}, ErrTokenInvalid
+	}
+
+	return c, v.validate(c)
+}
+
+// validate checks the registered claims.
+func (v *TokenVerifier) validate(c Claims) error {
+	now := time.Now()
+
+	if c.Expiry.IsZero() || now.After(c.Expiry.Add(v.leeway)) {
+		return ErrTokenExpired
+	}
+	if !c.NotBefore.IsZero() && now.Before(c.NotBefore.Add(-v.leeway)) {
+		return ErrTokenNotYetValid
+	}
+	if v.issuer != "" && c.Issuer != v.issuer {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrTokenInvalid, c.Issuer)
+	}
+	if v.audience != "" && !slices.Contains(c.Audience, v.audience) {
+		return fmt.Errorf("%w: token is not intended for audience %q", ErrTokenInvalid, v.audience)
+	}
+
+	return nil
+}
+
+// decrypt decrypts the contents of local tokens. See [decryptCached].
+func (k TokenKey) decrypt(encryptedMsg []byte) ([]byte, error) {
+	return decryptCached(k.enc, k.aead, encryptedMsg, nil)
+}
+
+// saltCache is a bounded cache of ciphers derived for a given salt.
+type saltCache struct {
+	mu sync.Mutex // protects m
+	// +checklocks:mu
+	m map[string]cipher.AEAD
+}
+
+func newSaltCache() *saltCache {
+	return &saltCache{m: map[string]cipher.AEAD{}}
+}
+
+func (s *saltCache) get(salt []byte) (cipher.AEAD, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.m[string(salt)]
+	return a, ok
+}
+
+// add should only be called after a successful decryption,
+// otherwise anyone could fill the cache with ciphers for salts of their choosing.
+func (s *saltCache) add(salt []byte, a cipher.AEAD) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.m) >= maxSaltCache {
+		s.m = map[string]cipher.AEAD{}
+	}
+	s.m[string(salt)] = a
+}
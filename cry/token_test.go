@@ -0,0 +1,246 @@
+package cry
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/komuw/ong/internal/tst"
+	"go.akshayshah.org/attest"
+)
+
+func TestClaims(t *testing.T) {
+	t.Parallel()
+
+	t.Run("roundtrip", func(t *testing.T) {
+		t.Parallel()
+
+		now := time.Unix(1_700_000_000, 0).UTC()
+		c := Claims{
+			Issuer:    "ong",
+			Subject:   "user-1",
+			Audience:  []string{"api"},
+			Expiry:    now.Add(time.Hour),
+			NotBefore: now,
+			IssuedAt:  now,
+			ID:        "abc",
+			Custom:    map[string]any{"role": "admin"},
+		}
+		b, err := json.Marshal(c)
+		attest.Ok(t, err)
+
+		var got Claims
+		attest.Ok(t, json.Unmarshal(b, &got))
+		attest.Equal(t, got, c)
+	})
+
+	t.Run("aud as string", func(t *testing.T) {
+		t.Parallel()
+
+		var got Claims
+		attest.Ok(t, json.Unmarshal([]byte(`{"aud":"api","exp":1}`), &got))
+		attest.Equal(t, got.Audience, []string{"api"})
+	})
+
+	t.Run("custom clashes", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := json.Marshal(Claims{Custom: map[string]any{"exp": 1}})
+		attest.Error(t, err)
+	})
+}
+
+func TestToken(t *testing.T) {
+	t.Parallel()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	attest.Ok(t, err)
+
+	t.Run("keys", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := LocalTokenKey("k1", "hi")
+		attest.Error(t, err)
+		_, err = LocalTokenKey("bad.kid", tst.SecretKey())
+		attest.Error(t, err)
+		_, err = PublicTokenKey("k1", priv[:10])
+		attest.Error(t, err)
+		_, err = VerifyingTokenKey("k1", pub[:10])
+		attest.Error(t, err)
+
+		k, err := LocalTokenKey("k1", tst.SecretKey())
+		attest.Ok(t, err)
+		attest.False(t, strings.Contains(k.String(), tst.SecretKey()))
+
+		_, err = NewTokenVerifier("", "", 0)
+		attest.Error(t, err)
+		_, err = NewTokenVerifier("", "", 0, k, k)
+		attest.Error(t, err)
+	})
+
+	t.Run("local and public", func(t *testing.T) {
+		t.Parallel()
+
+		local, err := LocalTokenKey("local-1", tst.SecretKey())
+		attest.Ok(t, err)
+		public, err := PublicTokenKey("public-1", priv)
+		attest.Ok(t, err)
+		verifying, err := VerifyingTokenKey("public-1", pub)
+		attest.Ok(t, err)
+
+		for _, tt := range []struct {
+			issue, verify TokenKey
+			prefix        string
+		}{
+			{local, local, "ong.v1.local.local-1."},
+			{public, public, "ong.v1.public.public-1."},
+			{public, verifying, "ong.v1.public.public-1."},
+		} {
+			c := Claims{Subject: "user-1", Expiry: time.Now().Add(time.Hour), Custom: map[string]any{"role": "admin"}}
+			tok, err := IssueToken(tt.issue, c)
+			attest.Ok(t, err)
+			attest.True(t, strings.HasPrefix(tok, tt.prefix))
+
+			v, err := NewTokenVerifier("", "", 0, tt.verify)
+			attest.Ok(t, err)
+			got, err := v.Verify(tok)
+			attest.Ok(t, err)
+			attest.Equal(t, got.Subject, "user-1")
+			attest.Equal(t, got.Custom["role"], "admin")
+			attest.False(t, got.IssuedAt.IsZero())
+
+			// tampering.
+			tampered := tok[:len(tok)-2] + "AA"
+			if tampered == tok {
+				tampered = tok[:len(tok)-2] + "BB"
+			}
+			_, err = v.Verify(tampered)
+			attest.True(t, errors.Is(err, ErrTokenInvalid))
+		}
+
+		// A verifying key cannot issue.
+		_, err = IssueToken(verifying, Claims{Expiry: time.Now().Add(time.Hour)})
+		attest.Error(t, err)
+		// Expiry is required.
+		_, err = IssueToken(local, Claims{})
+		attest.Error(t, err)
+	})
+
+	t.Run("token from another process", func(t *testing.T) {
+		t.Parallel()
+
+		// Each Enc has a different salt, mimic a token issued by another instance of the app.
+		issuer, err := LocalTokenKey("k1", tst.SecretKey())
+		attest.Ok(t, err)
+		verifier, err := LocalTokenKey("k1", tst.SecretKey())
+		attest.Ok(t, err)
+
+		tok, err := IssueToken(issuer, Claims{Expiry: time.Now().Add(time.Hour)})
+		attest.Ok(t, err)
+
+		v, err := NewTokenVerifier("", "", 0, verifier)
+		attest.Ok(t, err)
+		for range 3 {
+			_, err = v.Verify(tok)
+			attest.Ok(t, err)
+		}
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		t.Parallel()
+
+		oldKey, err := LocalTokenKey("old", tst.SecretKey())
+		attest.Ok(t, err)
+		newKey, err := LocalTokenKey("new", "some-other-Super-h@rd-password")
+		attest.Ok(t, err)
+
+		tok, err := IssueToken(oldKey, Claims{Expiry: time.Now().Add(time.Hour)})
+		attest.Ok(t, err)
+
+		v, err := NewTokenVerifier("", "", 0, newKey)
+		attest.Ok(t, err)
+		_, err = v.Verify(tok)
+		attest.True(t, errors.Is(err, ErrTokenInvalid))
+
+		v, err = NewTokenVerifier("", "", 0, newKey, oldKey)
+		attest.Ok(t, err)
+		_, err = v.Verify(tok)
+		attest.Ok(t, err)
+
+		// Same secret, different key ID.
+		sneaky, err := LocalTokenKey("new", tst.SecretKey())
+		attest.Ok(t, err)
+		tok, err = IssueToken(sneaky, Claims{Expiry: time.Now().Add(time.Hour)})
+		attest.Ok(t, err)
+		_, err = v.Verify(tok)
+		attest.True(t, errors.Is(err, ErrTokenInvalid))
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		t.Parallel()
+
+		k, err := PublicTokenKey("k1", priv)
+		attest.Ok(t, err)
+		now := time.Now()
+
+		for _, tt := range []struct {
+			name    string
+			c       Claims
+			leeway  time.Duration
+			wantErr error
+		}{
+			{"expired", Claims{Expiry: now.Add(-time.Minute)}, 0, ErrTokenExpired},
+			{"expired within leeway", Claims{Expiry: now.Add(-time.Minute)}, 2 * time.Minute, nil},
+			{"not yet valid", Claims{Expiry: now.Add(time.Hour), NotBefore: now.Add(time.Minute)}, 0, ErrTokenNotYetValid},
+			{"not yet valid within leeway", Claims{Expiry: now.Add(time.Hour), NotBefore: now.Add(time.Minute)}, 2 * time.Minute, nil},
+			{"wrong issuer", Claims{Expiry: now.Add(time.Hour), Issuer: "evil", Audience: []string{"api"}}, 0, ErrTokenInvalid},
+			{"wrong audience", Claims{Expiry: now.Add(time.Hour), Issuer: "ong", Audience: []string{"web"}}, 0, ErrTokenInvalid},
+			{"ok", Claims{Expiry: now.Add(time.Hour), Issuer: "ong", Audience: []string{"web", "api"}}, 0, nil},
+		} {
+			tok, err := IssueToken(k, tt.c)
+			attest.Ok(t, err)
+
+			issuer, audience := "", ""
+			if len(tt.c.Audience) > 0 {
+				issuer, audience = "ong", "api"
+			}
+			v, err := NewTokenVerifier(issuer, audience, tt.leeway, k)
+			attest.Ok(t, err)
+
+			_, err = v.Verify(tok)
+			if tt.wantErr == nil {
+				attest.Ok(t, err, attest.Sprintf("%s", tt.name))
+			} else {
+				attest.True(t, errors.Is(err, tt.wantErr), attest.Sprintf("%s: %v", tt.name, err))
+			}
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		t.Parallel()
+
+		k, err := PublicTokenKey("k1", priv)
+		attest.Ok(t, err)
+		v, err := NewTokenVerifier("", "", 0, k)
+		attest.Ok(t, err)
+
+		for _, tok := range []string{
+			"",
+			"garbage",
+			"ong.v1.",
+			"ong.v1.public.k1",
+			"ong.v1.public.k1.e30",
+			"ong.v1.public.k1.e30.!!!",
+			"ong.v1.local.k1.e30",
+			"ong.v2.public.k1.e30.e30",
+			strings.Repeat("a", maxTokenLen+1),
+		} {
+			_, err := v.Verify(tok)
+			attest.True(t, errors.Is(err, ErrTokenInvalid), attest.Sprintf("token: %s", tok))
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package errors
+
+import (
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+)
+
+var _ slog.LogValuer = &stackError{}
+
+// With returns err with the given key-value pairs attached to it, capturing a stack trace if err did not already have one.
+// The arguments are handled the same way as those of [slog.Logger.Log]; they can be alternating keys & values or [slog.Attr]s.
+//
+// The key-value pairs are not part of the error message, they are rendered when the error is logged. See [slog.LogValuer]
+// It returns nil if err is nil.
+func With(err error, args ...any) error {
+	if err == nil {
+		return nil
+	}
+
+	var se *stackError
+	if !As(err, &se) {
+		se = &stackError{stack: callers(3)}
+	}
+
+	inner := err
+	if e, ok := err.(*stackError); ok {
+		inner = e.err
+	}
+
+	return &stackError{
+		err:    inner,
+		stack:  se.stack,
+		attrs:  append(slices.Clip(se.attrs), argsToAttrs(args)...),
+		joined: se.joined,
+	}
+}
+
+// LogValue implements [slog.LogValuer]
+// It renders the error message, the key-value pairs added using [With] and the stack trace.
+// Errors that were combined using [Join] are each rendered with their own stack trace.
+func (e *stackError) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(e.attrs)+2)
+	attrs = append(attrs, slog.String("msg", e.Error()))
+	attrs = append(attrs, e.attrs...)
+
+	if len(e.joined) > 0 {
+		errs := make([]slog.Attr, 0, len(e.joined))
+		for i, je := range e.joined {
+			errs = append(errs, slog.Any(strconv.Itoa(i), je))
+		}
+		attrs = append(attrs, slog.Attr{Key: "errors", Value: slog.GroupValue(errs...)})
+		return slog.GroupValue(attrs...)
+	}
+
+	return slog.GroupValue(append(attrs, slog.Any("stack", e.frames()))...)
+}
+
+// argsToAttrs converts args, which are alternating keys & values or [slog.Attr]s, into attributes.
+func argsToAttrs(args []any) []slog.Attr {
+	r := slog.NewRecord(time.Time{}, 0, "", 0)
+	r.Add(args...)
+
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return attrs
+}
@@ -0,0 +1,142 @@
+package errors
+
+import (
+	"bytes"
+	"encoding/json"
+	stdErrors "errors"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"go.akshayshah.org/attest"
+)
+
+func TestWith(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil", func(t *testing.T) {
+		t.Parallel()
+
+		attest.Zero(t, With(nil, "userID", 1))
+	})
+
+	t.Run("adds attributes", func(t *testing.T) {
+		t.Parallel()
+
+		err := foo()
+		err2 := With(err, "userID", 42, slog.String("role", "admin"))
+		attest.Equal(t, err2.Error(), err.Error())
+		attest.True(t, Is(err2, err))
+		attest.Equal(t, StackTrace(err2), StackTrace(err)) // the stack trace is kept.
+
+		sterr, ok := err2.(*stackError)
+		attest.True(t, ok)
+		attest.Equal(t, len(sterr.attrs), 2)
+		attest.Equal(t, sterr.attrs[0].Key, "userID")
+		attest.Equal(t, sterr.attrs[1].Key, "role")
+
+		// The original error is not modified.
+		attest.Equal(t, len(err.(*stackError).attrs), 0)
+
+		err3 := With(err2, "requestID", "abc")
+		attest.Equal(t, len(err3.(*stackError).attrs), 3)
+		attest.Equal(t, len(sterr.attrs), 2)
+	})
+
+	t.Run("adds stack", func(t *testing.T) {
+		t.Parallel()
+
+		err := With(stdErrors.New("plain"), "userID", 42)
+		attest.Equal(t, err.Error(), "plain")
+		frames := StackFrames(err)
+		attest.NotZero(t, len(frames))
+		attest.Subsequence(t, frames[0].Function, "TestWith")
+		attest.Subsequence(t, frames[0].File, "attrs_test.go")
+	})
+
+	t.Run("wrapped", func(t *testing.T) {
+		t.Parallel()
+
+		inner := With(New("inner"), "a", 1)
+		err := With(fmt.Errorf("outer: %w", inner), "b", 2)
+		attest.Equal(t, err.Error(), "outer: inner")
+		attest.True(t, Is(err, inner))
+		attest.Equal(t, len(err.(*stackError).attrs), 2)
+		attest.Equal(t, StackTrace(err), StackTrace(inner))
+	})
+}
+
+func TestStackFrames(t *testing.T) {
+	t.Parallel()
+
+	attest.Zero(t, StackFrames(nil))
+	attest.Zero(t, StackFrames(stdErrors.New("plain")))
+
+	err := hello()
+	frames := StackFrames(err)
+	attest.True(t, len(frames) >= 4)
+	for i, name := range []string{"errors.foo", "errors.bar", "errors.hello", "errors.TestStackFrames"} {
+		attest.Subsequence(t, frames[i].Function, name)
+		attest.NotZero(t, frames[i].Line)
+	}
+	attest.Subsequence(t, frames[0].File, "errors_test.go")
+	attest.Subsequence(t, frames[3].File, "attrs_test.go")
+
+	// frames of wrapped errors are found.
+	attest.Equal(t, StackFrames(fmt.Errorf("wrapped: %w", err)), frames)
+}
+
+func TestLogValue(t *testing.T) {
+	t.Parallel()
+
+	w := &bytes.Buffer{}
+	l := slog.New(slog.NewJSONHandler(w, nil))
+	l.Error("failed", "err", With(New("bad"), "userID", 42))
+
+	var m map[string]any
+	attest.Ok(t, json.Unmarshal(w.Bytes(), &m))
+	e, ok := m["err"].(map[string]any)
+	attest.True(t, ok, attest.Sprintf("log: %s", w.String()))
+	attest.Equal(t, e["msg"], "bad")
+	attest.Equal(t, e["userID"], 42.0)
+
+	stack, ok := e["stack"].([]any)
+	attest.True(t, ok)
+	first, ok := stack[0].(map[string]any)
+	attest.True(t, ok)
+	attest.Subsequence(t, first["function"].(string), "TestLogValue")
+	attest.Subsequence(t, first["file"].(string), "attrs_test.go")
+	attest.NotZero(t, first["line"])
+}
+
+func TestJoinKeepsStacks(t *testing.T) {
+	t.Parallel()
+
+	err1 := New("hello")
+	err2 := hello()
+	err3 := Join(err1, nil, err2)
+
+	// Each error is formatted with its own stack trace.
+	extended := fmt.Sprintf("%+v", err3)
+	attest.Equal(t, extended, fmt.Sprintf("%+v\n%+v", err1, err2))
+
+	// And logged with its own stack trace.
+	w := &bytes.Buffer{}
+	slog.New(slog.NewJSONHandler(w, nil)).Error("failed", "err", err3)
+	var m map[string]any
+	attest.Ok(t, json.Unmarshal(w.Bytes(), &m))
+	e, ok := m["err"].(map[string]any)
+	attest.True(t, ok, attest.Sprintf("log: %s", w.String()))
+	errs, ok := e["errors"].(map[string]any)
+	attest.True(t, ok, attest.Sprintf("log: %s", w.String()))
+	attest.Equal(t, len(errs), 2)
+	for k, msg := range map[string]string{"0": "hello", "1": "error in foo"} {
+		je, ok := errs[k].(map[string]any)
+		attest.True(t, ok)
+		attest.Equal(t, je["msg"], any(msg))
+		attest.NotZero(t, je["stack"])
+	}
+
+	// StackFrames returns the frames of the first error.
+	attest.Equal(t, StackFrames(err3), StackFrames(err1))
+}
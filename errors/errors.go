@@ -5,6 +5,7 @@ import (
 	stdErrors "errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"runtime"
 	"strings"
 )
@@ -18,6 +19,22 @@ import (
 type stackError struct {
 	stack []uintptr
 	err   error
+	// attrs are the key-value pairs added using [With].
+	attrs []slog.Attr
+	// joined are the errors that were combined using [Join], if any.
+	joined []error
+}
+
+// Frame is a single function call in a stack trace.
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// String implements [fmt.Stringer]
+func (f Frame) String() string {
+	return fmt.Sprintf("%s:%d", f.File, f.Line)
 }
 
 func (e *stackError) Error() string {
@@ -76,32 +93,45 @@ func wrap(err error, skip int) *stackError {
 		}
 	}
 
+	return &stackError{
+		err:   err,
+		stack: callers(skip + 1),
+	}
+}
+
+// callers returns the program counters of the calling goroutine's stack.
+// skip 2 identifies the caller of callers.
+func callers(skip int) []uintptr {
 	// limit stack size to 64 call depth.
 	// `pkgsite/derrors` limits it to 16K(16 * 1024)
 	// https://github.com/golang/pkgsite/blob/035bfc02f3faa0221e0edf90b0a21d3619c95fdd/internal/derrors/derrors.go#L261-L264
 	stack := [64]uintptr{}
 	// skip 0 identifies the frame for `runtime.Callers` itself and
-	// skip 1 identifies the caller of `runtime.Callers`(ie of `wrap`).
+	// skip 1 identifies the caller of `runtime.Callers`(ie of `callers`).
 	n := runtime.Callers(skip, stack[:])
-
-	return &stackError{
-		err:   err,
-		stack: stack[:n],
-	}
+	return stack[:n]
 }
 
-func (e *stackError) getStackTrace() string {
-	var trace strings.Builder
-	frames := runtime.CallersFrames(e.stack[:])
+func (e *stackError) frames() []Frame {
+	frames := []Frame{}
+	fs := runtime.CallersFrames(e.stack[:])
 	for {
-		frame, more := frames.Next()
+		frame, more := fs.Next()
 		if !strings.Contains(frame.File, "runtime/") { // we cant use something like "go/src/runtime/" since it will break for programs built using `go build -trimpath`
-			trace.WriteString(fmt.Sprintf("\n%s:%d", frame.File, frame.Line))
+			frames = append(frames, Frame{Function: frame.Function, File: frame.File, Line: frame.Line})
 		}
 		if !more {
 			break
 		}
 	}
+	return frames
+}
+
+func (e *stackError) getStackTrace() string {
+	var trace strings.Builder
+	for _, f := range e.frames() {
+		trace.WriteString("\n" + f.String())
+	}
 	return trace.String()
 }
 
@@ -110,6 +140,15 @@ func (e *stackError) Format(f fmt.State, verb rune) {
 	switch verb {
 	case 'v':
 		if f.Flag('+') {
+			if len(e.joined) > 0 {
+				for i, je := range e.joined {
+					if i > 0 {
+						_, _ = io.WriteString(f, "\n")
+					}
+					_, _ = fmt.Fprintf(f, "%+v", je)
+				}
+				return
+			}
 			_, _ = io.WriteString(f, e.Error())
 			_, _ = io.WriteString(f, e.getStackTrace())
 			return
@@ -148,3 +187,13 @@ func StackTrace(err error) string {
 
 	return ""
 }
+
+// StackFrames returns the frames of the stack trace contained in err, if any.
+// For errors created by [Join], these are the frames of the first error.
+func StackFrames(err error) []Frame {
+	var se *stackError
+	if !As(err, &se) {
+		return nil
+	}
+	return se.frames()
+}
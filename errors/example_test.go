@@ -2,6 +2,7 @@ package errors_test
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"slices"
 
@@ -50,3 +51,11 @@ func ExampleDwrap() {
 	e := fetchUser("Emmy")
 	fmt.Printf("%+#v", e)
 }
+
+func ExampleWith() {
+	err := errors.With(login("badGuy"), "user", "badGuy", "attempt", 3)
+
+	// The attributes and stack frames are rendered as nested JSON.
+	l := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	l.Error("login failed", "err", err)
+}
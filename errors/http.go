@@ -0,0 +1,103 @@
+package errors
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+var (
+	_ slog.LogValuer = &httpError{}
+	_ fmt.Formatter  = &httpError{}
+)
+
+// httpError is an error that carries a HTTP status code and a message that is safe to show to clients.
+type httpError struct {
+	err           error // always has a stack trace.
+	status        int
+	publicMessage string
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap unpacks wrapped errors.
+func (e *httpError) Unwrap() error {
+	return e.err
+}
+
+// Format implements the fmt.Formatter interface
+// It formats the same way as the wrapped error. See [New]
+func (e *httpError) Format(f fmt.State, verb rune) {
+	if ef, ok := e.err.(fmt.Formatter); ok {
+		ef.Format(f, verb)
+		return
+	}
+	_, _ = io.WriteString(f, e.Error())
+}
+
+// LogValue implements [slog.LogValuer]
+// It renders the status code and public message in addition to what the wrapped error renders. See [With]
+func (e *httpError) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("msg", e.Error()),
+		slog.Int("status", e.status),
+	}
+	if e.publicMessage != "" {
+		attrs = append(attrs, slog.String("publicMessage", e.publicMessage))
+	}
+
+	// The stack may be further down the chain, eg if err was wrapped using [fmt.Errorf] before being passed to [WithStatus].
+	var se *stackError
+	if As(e.err, &se) {
+		for _, a := range se.LogValue().Group() {
+			if a.Key != "msg" {
+				attrs = append(attrs, a)
+			}
+		}
+	}
+
+	return slog.GroupValue(attrs...)
+}
+
+// WithStatus returns err annotated with the HTTP status code that should be sent to clients and a message that is safe to show them.
+// The message of err itself is never shown to clients, it is only logged. publicMessage can be empty.
+// It also captures a stack trace if err did not already have one.
+// It returns nil if err is nil.
+//
+// Use [Status] & [PublicMessage] to retrieve them.
+// Handlers created using [github.com/komuw/ong/mux.HandlerFunc] use them to render errors.
+func WithStatus(err error, status int, publicMessage string) error {
+	if err == nil {
+		return nil
+	}
+
+	var se *stackError
+	if !As(err, &se) {
+		err = &stackError{err: err, stack: callers(3)}
+	}
+
+	return &httpError{err: err, status: status, publicMessage: publicMessage}
+}
+
+// Status returns the HTTP status code that was added to err using [WithStatus].
+// If err has been annotated more than once, the outermost status code is returned.
+// It returns 0 if err has no status code.
+func Status(err error) int {
+	var he *httpError
+	if As(err, &he) {
+		return he.status
+	}
+	return 0
+}
+
+// PublicMessage returns the message, that is safe to show to clients, which was added to err using [WithStatus].
+// It returns an empty string if err has no such message.
+func PublicMessage(err error) string {
+	var he *httpError
+	if As(err, &he) {
+		return he.publicMessage
+	}
+	return ""
+}
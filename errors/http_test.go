@@ -0,0 +1,107 @@
+package errors
+
+import (
+	"bytes"
+	"encoding/json"
+	stdErrors "errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"go.akshayshah.org/attest"
+)
+
+func TestWithStatus(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil", func(t *testing.T) {
+		t.Parallel()
+
+		attest.Zero(t, WithStatus(nil, http.StatusNotFound, "not found"))
+	})
+
+	t.Run("status and message", func(t *testing.T) {
+		t.Parallel()
+
+		err := New("user 42 not in db")
+		err2 := WithStatus(err, http.StatusNotFound, "no such user")
+		attest.Equal(t, err2.Error(), "user 42 not in db")
+		attest.True(t, Is(err2, err))
+		attest.Equal(t, Status(err2), http.StatusNotFound)
+		attest.Equal(t, PublicMessage(err2), "no such user")
+		attest.Equal(t, StackTrace(err2), StackTrace(err)) // the stack trace is kept.
+
+		// survives further wrapping.
+		err3 := fmt.Errorf("handler: %w", err2)
+		attest.Equal(t, Status(err3), http.StatusNotFound)
+		attest.Equal(t, PublicMessage(err3), "no such user")
+		attest.Equal(t, Status(With(err2, "userID", 42)), http.StatusNotFound)
+	})
+
+	t.Run("adds stack trace", func(t *testing.T) {
+		t.Parallel()
+
+		err := WithStatus(stdErrors.New("bad input"), http.StatusBadRequest, "")
+		attest.Subsequence(t, StackTrace(err), "errors/http_test.go")
+		attest.Subsequence(t, fmt.Sprintf("%+v", err), "errors/http_test.go")
+		attest.Equal(t, fmt.Sprintf("%v", err), "bad input")
+	})
+
+	t.Run("no status", func(t *testing.T) {
+		t.Parallel()
+
+		err := New("bad")
+		attest.Zero(t, Status(err))
+		attest.Zero(t, PublicMessage(err))
+		attest.Zero(t, Status(nil))
+	})
+
+	t.Run("outermost wins", func(t *testing.T) {
+		t.Parallel()
+
+		err := WithStatus(New("bad"), http.StatusBadRequest, "bad")
+		err = WithStatus(err, http.StatusConflict, "conflict")
+		attest.Equal(t, Status(err), http.StatusConflict)
+		attest.Equal(t, PublicMessage(err), "conflict")
+	})
+
+	t.Run("log value", func(t *testing.T) {
+		t.Parallel()
+
+		w := &bytes.Buffer{}
+		l := slog.New(slog.NewJSONHandler(w, nil))
+		l.Error("failed", "err", WithStatus(With(New("bad"), "userID", 42), http.StatusTeapot, "teapot"))
+
+		var m map[string]any
+		attest.Ok(t, json.Unmarshal(w.Bytes(), &m))
+		e, ok := m["err"].(map[string]any)
+		attest.True(t, ok, attest.Sprintf("log: %s", w.String()))
+		attest.Equal(t, e["msg"], "bad")
+		attest.Equal(t, e["status"], 418.0)
+		attest.Equal(t, e["publicMessage"], "teapot")
+		attest.Equal(t, e["userID"], 42.0)
+		stack, ok := e["stack"].([]any)
+		attest.True(t, ok)
+		attest.NotZero(t, len(stack))
+	})
+	t.Run("log value of error wrapped by stdlib", func(t *testing.T) {
+		t.Parallel()
+
+		w := &bytes.Buffer{}
+		l := slog.New(slog.NewJSONHandler(w, nil))
+		err := fmt.Errorf("load user: %w", With(New("db down"), "userID", 42))
+		l.Error("failed", "err", WithStatus(err, http.StatusServiceUnavailable, "try later"))
+
+		var m map[string]any
+		attest.Ok(t, json.Unmarshal(w.Bytes(), &m))
+		e, ok := m["err"].(map[string]any)
+		attest.True(t, ok, attest.Sprintf("log: %s", w.String()))
+		attest.Equal(t, e["msg"], "load user: db down")
+		attest.Equal(t, e["status"], 503.0)
+		attest.Equal(t, e["userID"], 42.0)
+		stack, ok := e["stack"].([]any)
+		attest.True(t, ok, attest.Sprintf("log: %s", w.String()))
+		attest.NotZero(t, len(stack))
+	})
+}
@@ -18,30 +18,34 @@ import (
 // A non-nil error returned by Join implements the Unwrap() error method.
 // Unwrap returns an error whose text is the concatenation of each of the errs texts.
 //
-// It only returns the stack trace of the first error.
+// Each of the errs keeps its own stack trace. They are all rendered when the error is formatted using `%+v`, or logged.
+// However, [StackTrace] & [StackFrames] only return the stack trace of the first error.
 //
 // Note that this function is equivalent to the one in standard library mainly in spirit.
 // This is not a direct replacement of the standard library one.
 func Join(errs ...error) error {
-	n := 0
+	joined := []error{}
 	msgs := []string{}
 	for _, err := range errs {
 		if err != nil {
-			n++
+			joined = append(joined, err)
 			msgs = append(msgs, err.Error())
 		}
 	}
-	if n == 0 {
+	if len(joined) == 0 {
 		return nil
 	}
 
+	e := &stackError{
+		err:    stdErrors.New(strings.Join(msgs, "\n")),
+		joined: joined,
+	}
 	if ef, ok := errs[0].(*stackError); ok {
 		// If the first error was already a stack error, use its stacktrace.
-		return &stackError{
-			err:   stdErrors.New(strings.Join(msgs, "\n")),
-			stack: ef.stack,
-		}
+		e.stack = ef.stack
+	} else {
+		e.stack = callers(3)
 	}
 
-	return wrap(stdErrors.New(strings.Join(msgs, "\n")), 3)
+	return e
 }
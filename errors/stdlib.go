@@ -3,6 +3,7 @@ package errors
 import (
 	stdErrors "errors"
 	"fmt"
+	"log/slog"
 )
 
 // As is a pass through to the same func from the standard library errors package.
@@ -25,9 +26,11 @@ func Errorf(format string, a ...any) error {
 	err := fmt.Errorf(format, a...)
 
 	var stack []uintptr
+	var attrs []slog.Attr
 	for _, e := range a {
 		if ef, ok := e.(*stackError); ok {
 			stack = ef.stack
+			attrs = ef.attrs
 		}
 	}
 
@@ -35,6 +38,7 @@ func Errorf(format string, a ...any) error {
 		return &stackError{
 			err:   err,
 			stack: stack,
+			attrs: attrs,
 		}
 	}
 
@@ -145,11 +145,12 @@ func (a app) check(msg string) http.HandlerFunc {
 }
 
 // login handler showcases the use of:
+// - html forms that are decoded & validated.
 // - csrf tokens.
 // - csp tokens.
 // - encrypted cookies
 // - hashing passwords.
-func (a app) login(secretKey string) http.HandlerFunc {
+func (a app) login(kr *cry.Keyring) mux.HandlerFunc {
 	tmpl, err := template.New("myTpl").Parse(`<!DOCTYPE html>
 <html>
 <head>
@@ -188,15 +189,19 @@ func (a app) login(secretKey string) http.HandlerFunc {
 	</script>
 
 	<h2>Welcome to awesome website.</h2>
+	{{range .Flashes}}<p>{{.}}</p>{{end}}
 	<form method="POST">
 	<label>First Name:</label><br>
-	<input type="text" id="firstName" name="firstName"><br>
+	<input type="text" id="firstName" name="firstName" value="{{.Values.FirstName}}"><br>
+	{{with .Errors.firstName}}<small>{{.}}</small><br>{{end}}
 	<label>Email:</label><br>
-	<input type="text" id="email" name="email"><br>
+	<input type="text" id="email" name="email" value="{{.Values.Email}}"><br>
+	{{with .Errors.email}}<small>{{.}}</small><br>{{end}}
 	<label>Password:</label><br>
 	<input type="password" id="password" name="password"><br>
-	
-	<input type="hidden" id="{{.CsrfTokenName}}" name="{{.CsrfTokenName}}" value="{{.CsrfTokenValue}}"><br>
+	{{with .Errors.password}}<small>{{.}}</small><br>{{end}}
+
+	{{.CsrfField}}
 	<input type="submit">
 	</form>
 
@@ -206,75 +211,71 @@ func (a app) login(secretKey string) http.HandlerFunc {
 		panic(err)
 	}
 
+	type loginForm struct {
+		FirstName string `form:"firstName" validate:"required,maxlen=50"`
+		Email     string `form:"email" validate:"required,regex=^[^@ ]+@[^@ ]+$"`
+		Password  string `form:"password,secret" validate:"required,minlen=8"`
+	}
+
 	type User struct {
 		Email string
 		Name  string
 	}
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		reqL := log.WithID(r.Context(), a.l)
-
-		if r.Method != http.MethodPost {
-			data := struct {
-				CsrfTokenName  string
-				CsrfTokenValue string
-				CspNonceValue  string
-			}{
-				CsrfTokenName:  middleware.CsrfTokenFormName,
-				CsrfTokenValue: middleware.GetCsrfToken(r.Context()),
-				CspNonceValue:  middleware.GetCspNonce(r.Context()),
-			}
-
-			if errE := tmpl.Execute(w, data); errE != nil {
-				http.Error(w, errE.Error(), http.StatusInternalServerError)
-				return
-			}
-			return
-		}
-
-		if errP := r.ParseForm(); errP != nil {
-			http.Error(w, errP.Error(), http.StatusInternalServerError)
-			return
+	render := func(w io.Writer, r *http.Request, fs mux.FormState[loginForm]) error {
+		data := struct {
+			mux.FormState[loginForm]
+			CspNonceValue string
+			Flashes       []string
+		}{
+			FormState:     fs,
+			CspNonceValue: middleware.GetCspNonce(r.Context()),
+			Flashes:       sess.Flashes(r),
 		}
+		return tmpl.Execute(w, data)
+	}
 
-		email := r.FormValue("email")
-		firstName := r.FormValue("firstName")
-		password := r.FormValue("password")
+	submit := func(w http.ResponseWriter, r *http.Request, form loginForm) (string, error) {
+		reqL := log.WithID(r.Context(), a.l)
 
-		u := &User{Email: email, Name: firstName}
+		u := &User{Email: form.Email, Name: form.FirstName}
 
 		s, errM := json.Marshal(u)
 		if errM != nil {
-			http.Error(w, errM.Error(), http.StatusInternalServerError)
-			return
+			return "", errM
 		}
 
 		cookieName := "example_session_cookie"
-		c, errM := cookie.GetEncrypted(r, cookieName, secretKey)
+		c, errM := cookie.GetEncrypted(r, cookieName, kr)
 		reqL.Info("login handler log cookie",
 			"err", errM,
 			"cookie", c,
 		)
 
-		cookie.SetEncrypted(
+		if err := cookie.SetEncrypted(
 			r,
 			w,
 			cookieName,
 			string(s),
 			"localhost",
 			23*24*time.Hour,
-			secretKey,
-		)
+			kr,
+		); err != nil {
+			reqL.Error("login handler set cookie", "err", err)
+		}
 
 		existingPasswdHash := a.db.Get("passwd")
-		if e := cry.Eql(password, existingPasswdHash); e != nil {
+		if e := cry.Eql(form.Password, existingPasswdHash); e != nil {
 			// passwd did not exist before.
-			hashedPasswd := cry.Hash(password)
+			hashedPasswd := cry.Hash(form.Password)
 			a.db.Set("passwd", hashedPasswd)
 		}
 
-		_, _ = fmt.Fprintf(w, "you have submitted: %s", r.Form)
+		sess.AddFlash(r, "you have logged in as: "+form.Email)
+		return "", nil
 	}
+
+	return mux.Form(render, submit)
 }
 
 // handleFileServer handler showcases the use of:
@@ -17,13 +17,15 @@ func main() {
 
 	api := NewApp(myDB{map[string]string{}}, l)
 
-	basicAuth, err := middleware.BasicAuth(api.handleFileServer(), "user", "some-long-1passwd")
+	opts := config.WithOpts("localhost", 65081, secretKey, config.DirectIpStrategy, l)
+
+	basicAuth, err := middleware.BasicAuth(api.handleFileServer(), "user", "some-long-1passwd", opts.RejectFunc)
 	if err != nil {
 		panic(err)
 	}
 
 	mx := mux.New(
-		config.WithOpts("localhost", 65081, secretKey, config.DirectIpStrategy, l),
+		opts,
 		nil,
 		mux.NewRoute(
 			"/health",
@@ -43,7 +45,7 @@ func main() {
 		mux.NewRoute(
 			"login",
 			mux.MethodAll,
-			api.login(secretKey),
+			api.login(opts.Keyring),
 		),
 		mux.NewRoute(
 			"panic",
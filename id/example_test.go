@@ -2,6 +2,7 @@ package id_test
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/komuw/ong/id"
 )
@@ -18,3 +19,32 @@ func ExampleRandom() {
 	}
 	fmt.Println(s)
 }
+
+func ExampleUUID7() {
+	u := id.UUID7()
+	created, _ := u.Time()
+	fmt.Println(u.Version(), time.Since(created) < time.Minute)
+
+	// Output:
+	// 7 true
+}
+
+func ExampleParseUUID() {
+	u, err := id.ParseUUID("017F22E2-79B0-7CC3-98C4-DC0C0C07398F")
+	if err != nil {
+		panic(err)
+	}
+	created, _ := u.Time()
+	fmt.Println(u, created)
+
+	// Output:
+	// 017f22e2-79b0-7cc3-98c4-dc0c0c07398f 2022-02-22 19:22:22 +0000 UTC
+}
+
+func ExampleNewULID() {
+	a, b := id.NewULID(), id.NewULID()
+	fmt.Println(len(a.String()), a.String() < b.String())
+
+	// Output:
+	// 26 true
+}
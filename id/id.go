@@ -42,7 +42,7 @@ const alphabet = "ABEGHNQRTadeghnqrt2345789"
 // New returns a new random string consisting of a legible character set.
 // It is not suitable for cryptographic uses.
 //
-// Also see [UUID4] and [UUID8]
+// Also see [UUID4], [UUID7] and [NewULID]
 func New() string {
 	return Random(16)
 }
@@ -51,7 +51,7 @@ func New() string {
 // If n < 1 or significantly large, it is set to reasonable bounds.
 // It is not suitable for cryptographic uses.
 //
-// Also see [UUID4] and [UUID8]
+// Also see [UUID4], [UUID7] and [NewULID]
 func Random(n int) string {
 	if n < 1 {
 		n = 1
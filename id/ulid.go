@@ -0,0 +1,199 @@
+package id
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Spec: https://github.com/ulid/spec
+
+// crockford is the base32 alphabet used by ULIDs. It excludes I, L, O & U to avoid confusion and abuse.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const (
+	ulidLen = 26
+	// maxULIDTime is the largest timestamp that fits in the 48bits of a ULID.
+	maxULIDTime = 1<<48 - 1
+)
+
+var (
+	_ encoding.TextMarshaler   = ULID{}
+	_ encoding.TextUnmarshaler = &ULID{}
+	_ sql.Scanner              = &ULID{}
+	_ driver.Valuer            = ULID{}
+
+	// ulids makes sure that ULIDs generated by [NewULID], in the same process, are monotonic.
+	ulids = &ulidGen{} //nolint:gochecknoglobals
+
+	// crockfordDec maps a character to its value in the crockford alphabet. Invalid characters map to 0xff.
+	crockfordDec = func() [256]byte { //nolint:gochecknoglobals
+		var d [256]byte
+		for i := range d {
+			d[i] = 0xff
+		}
+		for i := range len(crockford) {
+			d[crockford[i]] = byte(i)
+			d[crockford[i]|0x20] = byte(i) // lowercase.
+		}
+		return d
+	}()
+)
+
+// ULID is a universally unique lexicographically sortable identifier.
+// It is 128bits long, like a [UUID], but its text form is a shorter 26 character string that sorts in the order in which ULIDs were generated.
+//
+// It implements [encoding.TextMarshaler] & [encoding.TextUnmarshaler], so it is marshaled to JSON as a string,
+// and [sql.Scanner] & [driver.Valuer] so that it can be used directly with [database/sql].
+//
+// Also see [NewULID], [ParseULID] and [UUID7]
+type ULID [16]byte
+
+// NewULID generates a [ULID].
+// Its first 48bits are the unix timestamp in milliseconds, followed by 80 random bits.
+// ULIDs generated by the same process within the same millisecond are monotonic; the random bits of the previous ULID are incremented.
+// Like [UUID7], it is suitable as a database primary key but it leaks the object's creation time. See [ULID.Time]
+//
+// It panics on error.
+func NewULID() ULID {
+	return ulids.next()
+}
+
+// ParseULID parses s, which should be the 26 character text form of a [ULID].
+// Parsing is case-insensitive.
+func ParseULID(s string) (ULID, error) {
+	errInvalid := fmt.Errorf("ong/id: invalid ULID %q", s)
+	if len(s) != ulidLen {
+		return ULID{}, errInvalid
+	}
+	// The first character can only encode 3bits, anything larger would overflow 128bits.
+	if crockfordDec[s[0]] > 7 {
+		return ULID{}, errInvalid
+	}
+
+	var u ULID
+	// Decode 5bits at a time, from the most significant.
+	for i := range ulidLen {
+		v := crockfordDec[s[i]]
+		if v == 0xff {
+			return ULID{}, errInvalid
+		}
+		// shift u left by 5bits and add v.
+		carry := v
+		for j := len(u) - 1; j >= 0; j-- {
+			x := uint16(u[j])<<5 | uint16(carry)
+			u[j] = byte(x)
+			carry = byte(x >> 8)
+		}
+	}
+
+	return u, nil
+}
+
+// String returns the 26 character text form of u.
+func (u ULID) String() string {
+	var b [ulidLen]byte
+	// Encode 5bits at a time, from the least significant.
+	v := u
+	for i := ulidLen - 1; i >= 0; i-- {
+		b[i] = crockford[v[len(v)-1]&0x1f]
+		// shift v right by 5bits.
+		for j := len(v) - 1; j >= 0; j-- {
+			v[j] >>= 5
+			if j > 0 {
+				v[j] |= v[j-1] << 3
+			}
+		}
+	}
+	return string(b[:])
+}
+
+// Bytes returns the bytes that underly the ULID.
+func (u ULID) Bytes() []byte {
+	return u[:]
+}
+
+// Time returns the time at which u was generated, with millisecond precision.
+func (u ULID) Time() time.Time {
+	return time.UnixMilli(getMillis(u[:])).UTC()
+}
+
+// MarshalText implements [encoding.TextMarshaler]
+func (u ULID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText implements [encoding.TextUnmarshaler]
+func (u *ULID) UnmarshalText(b []byte) error {
+	v, err := ParseULID(string(b))
+	if err != nil {
+		return err
+	}
+	*u = v
+	return nil
+}
+
+// Value implements [driver.Valuer]
+func (u ULID) Value() (driver.Value, error) {
+	return u.String(), nil
+}
+
+// Scan implements [sql.Scanner]
+// src can be the 16 bytes of a ULID, as stored in binary columns, or its text form.
+func (u *ULID) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		if len(v) == len(u) {
+			copy(u[:], v)
+			return nil
+		}
+		return u.UnmarshalText(v)
+	case string:
+		return u.UnmarshalText([]byte(v))
+	default:
+		return fmt.Errorf("ong/id: cannot scan %T into ULID", src)
+	}
+}
+
+// ulidGen generates monotonic ULIDs.
+type ulidGen struct {
+	mu sync.Mutex // protects last
+	// +checklocks:mu
+	last ULID
+}
+
+func (g *ulidGen) next() ULID {
+	ms := time.Now().UnixMilli()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	lastMs := getMillis(g.last[:])
+	if ms > lastMs && ms <= maxULIDTime {
+		var u ULID
+		_, _ = rand.Read(u[6:]) // it panics internally on error
+		putMillis(u[:], ms)
+		g.last = u
+		return u
+	}
+
+	// Same millisecond, or the clock went backwards; increment the random bits of the previous ULID.
+	u := g.last
+	for i := len(u) - 1; i >= 6; i-- {
+		u[i]++
+		if u[i] != 0 {
+			g.last = u
+			return u
+		}
+	}
+
+	// The random bits have overflowed, borrow the next millisecond.
+	_, _ = rand.Read(u[6:]) // it panics internally on error
+	putMillis(u[:], lastMs+1)
+	g.last = u
+	return u
+}
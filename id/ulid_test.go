@@ -0,0 +1,128 @@
+package id
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.akshayshah.org/attest"
+)
+
+func TestULID(t *testing.T) {
+	t.Parallel()
+
+	t.Run("succeds", func(t *testing.T) {
+		t.Parallel()
+
+		before := time.Now().UTC().Truncate(time.Millisecond)
+		u := NewULID()
+		after := time.Now().UTC()
+
+		attest.NotZero(t, u)
+		attest.Equal(t, len(u.String()), ulidLen)
+		attest.False(t, u.Time().Before(before))
+		attest.False(t, u.Time().After(after))
+	})
+
+	t.Run("is monotonic", func(t *testing.T) {
+		t.Parallel()
+
+		n := 10_000
+		s := make([]string, 0, n)
+		for range n {
+			s = append(s, NewULID().String())
+		}
+		attest.True(t, slices.IsSorted(s))
+		attest.Equal(t, len(slices.Compact(s)), n)
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		t.Parallel()
+
+		g := &ulidGen{}
+		far := time.Now().Add(time.Hour).UnixMilli()
+		putMillis(g.last[:], far)
+		for i := 6; i < len(g.last); i++ {
+			g.last[i] = 0xff
+		}
+
+		prev := g.last
+
+		u := g.next()
+		attest.Equal(t, u.Time().UnixMilli(), far+1)
+		attest.True(t, u.String() > prev.String())
+	})
+
+	t.Run("parse", func(t *testing.T) {
+		t.Parallel()
+
+		// The timestamp is from the example in https://github.com/ulid/spec
+		s := "01ARYZ6S41TSV4RRFFQ69G5FAV"
+		u, err := ParseULID(s)
+		attest.Ok(t, err)
+		attest.Equal(t, u.String(), s)
+		attest.Equal(t, u.Time().UnixMilli(), 1469918176385)
+
+		got, err := ParseULID(strings.ToLower(s))
+		attest.Ok(t, err)
+		attest.Equal(t, got, u)
+
+		largest, err := ParseULID("7ZZZZZZZZZZZZZZZZZZZZZZZZZ")
+		attest.Ok(t, err)
+		attest.Equal(t, largest, ULID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+
+		for _, bad := range []string{
+			"",
+			"01ARYZ6S41TSV4RRFFQ69G5FA",
+			"01ARYZ6S41TSV4RRFFQ69G5FAVV",
+			"01ARYZ6S41TSV4RRFFQ69G5FAU", // U is not in the alphabet.
+			"80000000000000000000000000", // overflows 128bits.
+		} {
+			_, err := ParseULID(bad)
+			attest.Error(t, err, attest.Sprintf("input: %s", bad))
+		}
+
+		for range 10 {
+			n := NewULID()
+			got, err := ParseULID(n.String())
+			attest.Ok(t, err)
+			attest.Equal(t, got, n)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+
+		type order struct {
+			ID ULID `json:"id"`
+		}
+		o := order{ID: NewULID()}
+		b, err := json.Marshal(o)
+		attest.Ok(t, err)
+		attest.Equal(t, string(b), `{"id":"`+o.ID.String()+`"}`)
+
+		var got order
+		attest.Ok(t, json.Unmarshal(b, &got))
+		attest.Equal(t, got, o)
+	})
+
+	t.Run("sql", func(t *testing.T) {
+		t.Parallel()
+
+		u := NewULID()
+		v, err := u.Value()
+		attest.Ok(t, err)
+		attest.Equal(t, v.(string), u.String())
+
+		for _, src := range []any{u.String(), []byte(u.String()), u.Bytes()} {
+			var got ULID
+			attest.Ok(t, got.Scan(src))
+			attest.Equal(t, got, u)
+		}
+
+		var got ULID
+		attest.Error(t, got.Scan(42))
+	})
+}
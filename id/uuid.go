@@ -2,7 +2,13 @@ package id
 
 import (
 	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/hex"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -14,6 +20,17 @@ import (
 const (
 	version4 byte = 4
 	version7 byte = 7
+	version8 byte = 8
+)
+
+var (
+	_ encoding.TextMarshaler   = UUID{}
+	_ encoding.TextUnmarshaler = &UUID{}
+	_ sql.Scanner              = &UUID{}
+	_ driver.Valuer            = UUID{}
+
+	// v7 makes sure that UUIDs generated by [UUID7], in the same process, are monotonic.
+	v7 = &monotonic{} //nolint:gochecknoglobals
 )
 
 // RFC's:
@@ -21,7 +38,10 @@ const (
 //   uuidv7: https://datatracker.ietf.org/doc/html/draft-ietf-uuidrev-rfc4122bis
 
 // UUID represents a universally unique identifier.
-// Also see [UUID4] and [UUID8]
+// Also see [UUID4], [UUID7], [UUID8] and [ParseUUID]
+//
+// It implements [encoding.TextMarshaler] & [encoding.TextUnmarshaler], so it is marshaled to JSON as a string,
+// and [sql.Scanner] & [driver.Valuer] so that it can be used directly with [database/sql].
 //
 // [unique]: https://en.wikipedia.org/wiki/Universally_unique_identifier
 type UUID [16]byte
@@ -83,6 +103,38 @@ func UUID4() UUID {
 	return uuid
 }
 
+// UUID7 generates a version 7 [UUID].
+// Its first 48bits are the unix timestamp in milliseconds, followed by a counter. Thus UUIDs generated by the same process are monotonic,
+// even within the same millisecond. This makes them suitable as database primary keys, since they have good index locality.
+// On the other hand, this means that it leaks the object's creation time unlike [UUID4]. See [UUID.Time]
+//
+// Also see [UUID4], [UUID8] and [NewULID]
+//
+// It panics on error.
+func UUID7() UUID {
+	var uuid UUID
+
+	// Layout:
+	// https://www.rfc-editor.org/rfc/rfc9562#section-5.7
+	//
+	// | unix_ts_ms     | version | rand_a   | variant | rand_b   |
+	// | 48bits(6bytes) | 4bits   | 12bits   | 2bits   | 62bits   |
+	// | 0 - 47         | 48 - 51 | 52 - 63  | 64 - 65 | 66 - 127 |
+	//
+	// rand_a is used as a counter, see: https://www.rfc-editor.org/rfc/rfc9562#section-6.2 (Method 1)
+	_, _ = rand.Read(uuid[:]) // it panics internally on error
+
+	ms, seq := v7.next()
+	putMillis(uuid[:], ms)
+	uuid[6] = byte(seq >> 8)
+	uuid[7] = byte(seq)
+
+	uuid.setVersion(version7)
+	uuid.setVariant()
+
+	return uuid
+}
+
 // UUID8 generates a version 8 [UUID].
 // Version 8 [provides] an RFC-compatible format for experimental/specific use cases.
 //
@@ -130,9 +182,146 @@ func UUID8() UUID {
 	uuid[5] = byte(unix_ts_ms)
 
 	// 3. Override first 4bits of uuid[6]
-	uuid.setVersion(version7)
+	uuid.setVersion(version8)
 	// 4. Override first 2bits of uuid[8]
 	uuid.setVariant()
 
 	return uuid
 }
+
+// ParseUUID parses s, which should be in the form `xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx`, into a [UUID].
+// The forms `urn:uuid:xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx` and `xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx` are also accepted.
+// Parsing is case-insensitive.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	errInvalid := fmt.Errorf("ong/id: invalid UUID %q", s)
+
+	if len(s) == 45 && strings.EqualFold(s[:9], "urn:uuid:") {
+		s = s[9:]
+	}
+	switch len(s) {
+	case 36:
+		if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+			return UUID{}, errInvalid
+		}
+		s = s[:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	case 32:
+	default:
+		return UUID{}, errInvalid
+	}
+
+	if _, err := hex.Decode(u[:], []byte(s)); err != nil {
+		return UUID{}, errInvalid
+	}
+
+	return u, nil
+}
+
+// Version returns the version of u.
+func (u UUID) Version() byte {
+	return u[6] >> 4
+}
+
+// Time returns the time at which u was generated, with millisecond precision.
+// It returns false if u is not a version 7 [UUID], since other versions do not have a timestamp that can be extracted.
+func (u UUID) Time() (time.Time, bool) {
+	if u.Version() != version7 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(getMillis(u[:])).UTC(), true
+}
+
+// MarshalText implements [encoding.TextMarshaler]
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText implements [encoding.TextUnmarshaler]
+func (u *UUID) UnmarshalText(b []byte) error {
+	v, err := ParseUUID(string(b))
+	if err != nil {
+		return err
+	}
+	*u = v
+	return nil
+}
+
+// Value implements [driver.Valuer]
+func (u UUID) Value() (driver.Value, error) {
+	return u.String(), nil
+}
+
+// Scan implements [sql.Scanner]
+// src can be the 16 bytes of a UUID, as stored in binary columns, or its text form.
+func (u *UUID) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		if len(v) == len(u) {
+			copy(u[:], v)
+			return nil
+		}
+		return u.UnmarshalText(v)
+	case string:
+		return u.UnmarshalText([]byte(v))
+	default:
+		return fmt.Errorf("ong/id: cannot scan %T into UUID", src)
+	}
+}
+
+// monotonic makes sure that the time-ordered IDs generated in a process never go backwards,
+// even if they are generated within the same millisecond or the clock is adjusted backwards.
+type monotonic struct {
+	mu sync.Mutex // protects last & seq
+	// +checklocks:mu
+	last int64
+	// +checklocks:mu
+	seq uint16
+}
+
+// maxSeq is the largest value of the 12bit counter of a [UUID7].
+const maxSeq = 1<<12 - 1
+
+// next returns the unix timestamp in milliseconds, and the counter, to use for a [UUID7].
+func (m *monotonic) next() (int64, uint16) {
+	ms := time.Now().UnixMilli()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if ms > m.last {
+		m.last = ms
+		// Start at a random value, with the leftmost bit unset so as to leave room for the counter to grow.
+		m.seq = randSeq()
+		return m.last, m.seq
+	}
+
+	m.seq++
+	if m.seq > maxSeq {
+		// The counter has overflowed, borrow the next millisecond.
+		m.last++
+		m.seq = randSeq()
+	}
+
+	return m.last, m.seq
+}
+
+func randSeq() uint16 {
+	var b [2]byte
+	_, _ = rand.Read(b[:]) // it panics internally on error
+	return (uint16(b[0])<<8 | uint16(b[1])) & (maxSeq >> 1)
+}
+
+// putMillis writes the 48bit big-endian unix timestamp ms to the first 6bytes of b.
+func putMillis(b []byte, ms int64) {
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+}
+
+// getMillis reads the 48bit big-endian unix timestamp from the first 6bytes of b.
+func getMillis(b []byte) int64 {
+	return int64(b[0])<<40 | int64(b[1])<<32 | int64(b[2])<<24 | int64(b[3])<<16 | int64(b[4])<<8 | int64(b[5])
+}
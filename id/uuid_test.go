@@ -1,8 +1,13 @@
 package id
 
 import (
+	"encoding/json"
+	"slices"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"go.akshayshah.org/attest"
 )
@@ -73,4 +78,141 @@ func TestUuid(t *testing.T) {
 		attest.Equal(t, first, s[0])
 		attest.Equal(t, last, s[9])
 	})
+	t.Run("uuid8 version", func(t *testing.T) {
+		t.Parallel()
+
+		attest.Equal(t, UUID8().Version(), version8)
+		attest.Equal(t, UUID4().Version(), version4)
+		_, ok := UUID8().Time()
+		attest.False(t, ok)
+	})
+
+	t.Run("uuid7", func(t *testing.T) {
+		t.Parallel()
+
+		before := time.Now().UTC().Truncate(time.Millisecond)
+		v7 := UUID7()
+		after := time.Now().UTC()
+
+		attest.Equal(t, v7.Version(), version7)
+		attest.Equal(t, v7[8]>>6, byte(0x02)) // variant.
+		got, ok := v7.Time()
+		attest.True(t, ok)
+		attest.False(t, got.Before(before))
+		attest.False(t, got.After(after))
+	})
+
+	t.Run("uuid7 is monotonic", func(t *testing.T) {
+		t.Parallel()
+
+		// More than the counter can hold in a millisecond.
+		n := 3 * maxSeq
+		s := make([]string, 0, n)
+		for range n {
+			s = append(s, UUID7().String())
+		}
+		attest.True(t, slices.IsSorted(s))
+		attest.Equal(t, len(slices.Compact(s)), n)
+	})
+
+	t.Run("uuid7 concurrency", func(t *testing.T) {
+		t.Parallel()
+
+		var mu sync.Mutex
+		seen := map[UUID]bool{}
+		wg := &sync.WaitGroup{}
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 500 {
+					u := UUID7()
+					mu.Lock()
+					seen[u] = true
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		attest.Equal(t, len(seen), 8*500)
+	})
+
+	t.Run("parse", func(t *testing.T) {
+		t.Parallel()
+
+		// Test vector from https://www.rfc-editor.org/rfc/rfc9562#appendix-A.6
+		s := "017f22e2-79b0-7cc3-98c4-dc0c0c07398f"
+		for _, in := range []string{
+			s,
+			strings.ToUpper(s),
+			"urn:uuid:" + s,
+			strings.ReplaceAll(s, "-", ""),
+		} {
+			u, err := ParseUUID(in)
+			attest.Ok(t, err, attest.Sprintf("input: %s", in))
+			attest.Equal(t, u.String(), s)
+		}
+
+		u, err := ParseUUID(s)
+		attest.Ok(t, err)
+		attest.Equal(t, u.Version(), version7)
+		got, ok := u.Time()
+		attest.True(t, ok)
+		attest.Equal(t, got.UnixMilli(), 1645557742000)
+
+		for _, bad := range []string{
+			"",
+			"017f22e2-79b0-7cc3-98c4-dc0c0c07398",
+			"017f22e2_79b0_7cc3_98c4_dc0c0c07398f",
+			"017f22e2-79b0-7cc3-98c4-dc0c0c07398g",
+			"urn:uuid:017f22e279b07cc398c4dc0c0c07398f",
+		} {
+			_, err := ParseUUID(bad)
+			attest.Error(t, err, attest.Sprintf("input: %s", bad))
+		}
+
+		for range 10 {
+			v4 := UUID4()
+			got, err := ParseUUID(v4.String())
+			attest.Ok(t, err)
+			attest.Equal(t, got, v4)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+
+		type user struct {
+			ID UUID `json:"id"`
+		}
+		u := user{ID: UUID7()}
+		b, err := json.Marshal(u)
+		attest.Ok(t, err)
+		attest.Equal(t, string(b), `{"id":"`+u.ID.String()+`"}`)
+
+		var got user
+		attest.Ok(t, json.Unmarshal(b, &got))
+		attest.Equal(t, got, u)
+
+		attest.Error(t, json.Unmarshal([]byte(`{"id":"not-a-uuid"}`), &got))
+	})
+
+	t.Run("sql", func(t *testing.T) {
+		t.Parallel()
+
+		u := UUID7()
+		v, err := u.Value()
+		attest.Ok(t, err)
+		attest.Equal(t, v.(string), u.String())
+
+		for _, src := range []any{u.String(), []byte(u.String()), u.Bytes()} {
+			var got UUID
+			attest.Ok(t, got.Scan(src))
+			attest.Equal(t, got, u)
+		}
+
+		var got UUID
+		attest.Error(t, got.Scan(42))
+		attest.Error(t, got.Scan("not-a-uuid"))
+	})
 }
@@ -18,6 +18,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/komuw/ong/internal/ometrics"
+
 	"golang.org/x/net/idna"
 )
 
@@ -387,8 +389,10 @@ func (m *manager) getCert(ctx context.Context, domain string) (cert *tls.Certifi
 
 		c, errB := m.fromAcme(ctx, domain)
 		if errB != nil {
+			ometrics.AcmeRenewals.Inc("failure")
 			return nil, errB
 		}
+		ometrics.AcmeRenewals.Inc("success")
 
 		cert = c
 	}
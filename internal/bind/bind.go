@@ -0,0 +1,138 @@
+package bind
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	durationType        = reflect.TypeFor[time.Duration]()
+)
+
+// Values sets the fields of the struct pointed to by dst, that have the struct tag named tag, using get.
+// get returns the values for the name in the struct tag, eg `query:"page"`. Fields without values are left as they are.
+// Any options after the name in the struct tag, eg `form:"password,secret"`, are ignored.
+//
+// The supported field types are strings, bools, integers, floats, [time.Duration], implementations of [encoding.TextUnmarshaler]
+// and pointers & slices of those. All the values are used for slices, only the first one otherwise.
+//
+// It returns [FieldErrors] if some values cannot be converted to the type of their field.
+// It returns any other error if dst is not a pointer to a struct or a field has an unsupported type.
+func Values(dst any, tag string, get func(name string) []string) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ong/bind: %T is not a pointer to a struct", dst)
+	}
+	v = v.Elem()
+	t := v.Type()
+
+	var fe FieldErrors
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		name, ok := sf.Tag.Lookup(tag)
+		name, _, _ = strings.Cut(name, ",") // drop options, eg `form:"password,secret"`
+		if !ok || name == "" || name == "-" || !sf.IsExported() {
+			continue
+		}
+		vals := get(name)
+		if len(vals) == 0 {
+			continue
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Slice && !fv.Addr().Type().Implements(textUnmarshalerType) {
+			s := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+			for j, val := range vals {
+				msg, err := set(s.Index(j), val)
+				if err != nil {
+					return fmt.Errorf("ong/bind: field %s of %s: %w", sf.Name, t, err)
+				}
+				if msg != "" {
+					fe = append(fe, FieldError{Field: name, Message: msg})
+					break
+				}
+			}
+			fv.Set(s)
+			continue
+		}
+
+		msg, err := set(fv, vals[0])
+		if err != nil {
+			return fmt.Errorf("ong/bind: field %s of %s: %w", sf.Name, t, err)
+		}
+		if msg != "" {
+			fe = append(fe, FieldError{Field: name, Message: msg})
+		}
+	}
+
+	if len(fe) > 0 {
+		return fe
+	}
+	return nil
+}
+
+// set converts val to the type of v and sets it.
+// It returns a message, that is safe to show clients, if val cannot be converted.
+func set(v reflect.Value, val string) (string, error) {
+	if v.Kind() == reflect.Pointer {
+		p := reflect.New(v.Type().Elem())
+		msg, err := set(p.Elem(), val)
+		if msg == "" && err == nil {
+			v.Set(p)
+		}
+		return msg, err
+	}
+
+	if v.Addr().Type().Implements(textUnmarshalerType) {
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(val)); err != nil {
+			return "has an invalid format", nil
+		}
+		return "", nil
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return "must be a duration, like 1m30s", nil
+		}
+		v.SetInt(int64(d))
+		return "", nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return "must be true or false", nil
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return "must be an integer", nil
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return "must be a positive integer", nil
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return "must be a number", nil
+		}
+		v.SetFloat(n)
+	default:
+		return "", fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return "", nil
+}
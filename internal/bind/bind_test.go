@@ -0,0 +1,119 @@
+package bind
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/komuw/ong/id"
+	"go.akshayshah.org/attest"
+)
+
+func TestValues(t *testing.T) {
+	t.Parallel()
+
+	type query struct {
+		Name     string        `query:"name"`
+		Page     int           `query:"page"`
+		Limit    uint8         `query:"limit"`
+		Ratio    float64       `query:"ratio"`
+		Active   bool          `query:"active"`
+		Timeout  time.Duration `query:"timeout"`
+		Tags     []string      `query:"tag"`
+		IDs      []int         `query:"id"`
+		Optional *int          `query:"optional"`
+		UUID     id.UUID       `query:"uuid"`
+		Ignored  string        `query:"-"`
+		NoTag    string
+	}
+
+	get := func(q url.Values) func(string) []string {
+		return func(name string) []string { return q[name] }
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		u := id.UUID4()
+		q := url.Values{
+			"name":     {"jane", "ignored"},
+			"page":     {"-2"},
+			"limit":    {"250"},
+			"ratio":    {"0.5"},
+			"active":   {"true"},
+			"timeout":  {"1m30s"},
+			"tag":      {"a", "b"},
+			"id":       {"1", "2", "3"},
+			"optional": {"7"},
+			"uuid":     {u.String()},
+			"Ignored":  {"x"},
+			"NoTag":    {"x"},
+		}
+		dst := query{Name: "default", Ignored: "kept"}
+		attest.Ok(t, Values(&dst, "query", get(q)))
+
+		seven := 7
+		attest.Equal(t, dst, query{
+			Name:     "jane",
+			Page:     -2,
+			Limit:    250,
+			Ratio:    0.5,
+			Active:   true,
+			Timeout:  90 * time.Second,
+			Tags:     []string{"a", "b"},
+			IDs:      []int{1, 2, 3},
+			Optional: &seven,
+			UUID:     u,
+			Ignored:  "kept",
+		})
+	})
+
+	t.Run("missing values", func(t *testing.T) {
+		t.Parallel()
+
+		dst := query{Name: "default"}
+		attest.Ok(t, Values(&dst, "query", get(url.Values{})))
+		attest.Equal(t, dst, query{Name: "default"})
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		t.Parallel()
+
+		q := url.Values{
+			"page":    {"one"},
+			"limit":   {"256"},
+			"active":  {"yes please"},
+			"timeout": {"1 minute"},
+			"id":      {"1", "two"},
+			"uuid":    {"not-a-uuid"},
+		}
+		var dst query
+		err := Values(&dst, "query", get(q))
+		attest.Equal(t, err, error(FieldErrors{
+			{Field: "page", Message: "must be an integer"},
+			{Field: "limit", Message: "must be a positive integer"},
+			{Field: "active", Message: "must be true or false"},
+			{Field: "timeout", Message: "must be a duration, like 1m30s"},
+			{Field: "id", Message: "must be an integer"},
+			{Field: "uuid", Message: "has an invalid format"},
+		}))
+	})
+
+	t.Run("bad destination", func(t *testing.T) {
+		t.Parallel()
+
+		var dst query
+		attest.Error(t, Values(dst, "query", get(url.Values{})))
+		n := 3
+		attest.Error(t, Values(&n, "query", get(url.Values{})))
+
+		type unsupported struct {
+			M map[string]string `query:"m"`
+		}
+		var u unsupported
+		err := Values(&u, "query", get(url.Values{"m": {"x"}}))
+		attest.Error(t, err)
+		_, ok := err.(FieldErrors)
+		attest.False(t, ok)
+	})
+}
@@ -0,0 +1,256 @@
+// Package bind decodes request values into structs and validates them.
+package bind
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// regexes caches the compiled regular expressions of `regex` validation rules.
+var regexes sync.Map //nolint:gochecknoglobals
+
+// FieldError is a validation failure of a single field.
+type FieldError struct {
+	// Field is the name of the field, as known to clients. For example, its json name.
+	// Nested fields are separated by a dot, eg `address.city` or `items[0].name`
+	Field string `json:"field"`
+	// Message describes the failure. It is safe to show to clients.
+	Message string `json:"message"`
+}
+
+// FieldErrors are the validation failures of a struct.
+type FieldErrors []FieldError
+
+func (fe FieldErrors) Error() string {
+	s := make([]string, 0, len(fe))
+	for _, e := range fe {
+		s = append(s, e.Field+": "+e.Message)
+	}
+	return "ong/bind: invalid fields; " + strings.Join(s, ", ")
+}
+
+// Validate checks the fields of the struct v, which may be a pointer, against the rules in their `validate` struct tags.
+// It returns [FieldErrors] if any field is invalid. It returns any other error if a rule is malformed.
+//
+// The rules are comma separated. They are:
+//
+//	required      the field should not be the zero value.
+//	min=N, max=N  the number should be within the range.
+//	minlen=N      the string(counted in characters), slice or map should have at least N items.
+//	maxlen=N      the string, slice or map should have at most N items.
+//	regex=R       the string should match the regular expression R. This rule should be the last one since R can contain commas.
+//
+// Fields that are empty strings, slices or maps, or nil pointers, are only checked by the required rule.
+// Numbers are checked by min & max even if they are zero; use a pointer for optional numbers. Nested structs are validated too.
+func Validate(v any) error {
+	var fe FieldErrors
+	if err := validate(reflect.ValueOf(v), "", &fe); err != nil {
+		return err
+	}
+	if len(fe) > 0 {
+		return fe
+	}
+	return nil
+}
+
+func validate(v reflect.Value, prefix string, fe *FieldErrors) error {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	t := v.Type()
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		name := prefix + FieldName(sf)
+
+		if rules, ok := sf.Tag.Lookup("validate"); ok {
+			msg, err := check(fv, rules)
+			if err != nil {
+				return fmt.Errorf("ong/bind: field %s of %s: %w", sf.Name, t, err)
+			}
+			if msg != "" {
+				*fe = append(*fe, FieldError{Field: name, Message: msg})
+				continue
+			}
+		}
+
+		// nested structs.
+		switch indirect(fv.Type()).Kind() {
+		case reflect.Struct:
+			if err := validate(fv, name+".", fe); err != nil {
+				return err
+			}
+		case reflect.Slice, reflect.Array:
+			if indirect(fv.Type().Elem()).Kind() != reflect.Struct {
+				continue
+			}
+			for j := range fv.Len() {
+				if err := validate(fv.Index(j), fmt.Sprintf("%s[%d].", name, j), fe); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// check validates v against rules. It returns a message describing the first rule that failed, if any.
+func check(v reflect.Value, rules string) (string, error) {
+	if v.IsZero() && hasRule(rules, "required") {
+		return "is required", nil
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			// An optional field that was not provided.
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	// Empty strings & collections are only checked by the required rule, whereas zero numbers are still checked by min & max.
+	empty := v.IsZero()
+
+	for rules != "" {
+		var rule string
+		if strings.HasPrefix(rules, "regex=") {
+			rule, rules = rules, ""
+		} else {
+			rule, rules, _ = strings.Cut(rules, ",")
+		}
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		switch name {
+		case "", "required":
+			continue
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return "", fmt.Errorf("bad %s rule: %w", name, err)
+			}
+			n, ok := number(v)
+			if !ok {
+				return "", fmt.Errorf("%s rule used on a non-number", name)
+			}
+			if name == "min" && n < limit {
+				return "must be at least " + arg, nil
+			}
+			if name == "max" && n > limit {
+				return "must be at most " + arg, nil
+			}
+		case "minlen", "maxlen":
+			limit, err := strconv.Atoi(arg)
+			if err != nil {
+				return "", fmt.Errorf("bad %s rule: %w", name, err)
+			}
+			if empty {
+				continue
+			}
+			var n int
+			unit := "items"
+			switch v.Kind() {
+			case reflect.String:
+				n = utf8.RuneCountInString(v.String())
+				unit = "characters"
+			case reflect.Slice, reflect.Array, reflect.Map:
+				n = v.Len()
+			default:
+				return "", fmt.Errorf("%s rule used on a %s", name, v.Kind())
+			}
+			if name == "minlen" && n < limit {
+				return fmt.Sprintf("must have at least %d %s", limit, unit), nil
+			}
+			if name == "maxlen" && n > limit {
+				return fmt.Sprintf("must have at most %d %s", limit, unit), nil
+			}
+		case "regex":
+			re, err := compile(arg)
+			if err != nil {
+				return "", err
+			}
+			if v.Kind() != reflect.String {
+				return "", fmt.Errorf("regex rule used on a %s", v.Kind())
+			}
+			if empty {
+				continue
+			}
+			if !re.MatchString(v.String()) {
+				return "has an invalid format", nil
+			}
+		default:
+			return "", fmt.Errorf("unknown validation rule %q", name)
+		}
+	}
+
+	return "", nil
+}
+
+func hasRule(rules, rule string) bool {
+	for r := range strings.SplitSeq(rules, ",") {
+		r = strings.TrimSpace(r)
+		if r == rule {
+			return true
+		}
+		if strings.HasPrefix(r, "regex=") {
+			return false
+		}
+	}
+	return false
+}
+
+func number(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+func compile(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexes.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("bad regex rule: %w", err)
+	}
+	regexes.Store(expr, re)
+	return re, nil
+}
+
+// FieldName returns the name by which clients know the struct field sf.
+// That is the name in its json, form, query or path struct tag, in that order, or else its Go name.
+func FieldName(sf reflect.StructField) string {
+	for _, tag := range []string{"json", "form", "query", "path"} {
+		if name, _, _ := strings.Cut(sf.Tag.Get(tag), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
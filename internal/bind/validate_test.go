@@ -0,0 +1,158 @@
+package bind
+
+import (
+	"testing"
+
+	"go.akshayshah.org/attest"
+)
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type item struct {
+	Name string `json:"name" validate:"minlen=2"`
+}
+
+type person struct {
+	Name     string   `json:"name" validate:"required,minlen=2,maxlen=5"`
+	Age      int      `json:"age" validate:"min=18,max=120"`
+	Score    *float64 `json:"score" validate:"required,max=1.5"`
+	Email    string   `json:"email" validate:"regex=^[a-z]+@[a-z]+\\.com$"`
+	Tags     []string `json:"tags" validate:"maxlen=2"`
+	Nickname string   `form:"nick_name" validate:"maxlen=3"`
+	Address  address  `json:"address"`
+	Items    []item   `json:"items"`
+	internal string
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	score := 1.0
+	valid := func() person {
+		return person{
+			Name:    "jane",
+			Age:     30,
+			Score:   &score,
+			Email:   "jane@example.com",
+			Tags:    []string{"a"},
+			Address: address{City: "Nairobi"},
+			Items:   []item{{Name: "pen"}},
+		}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		t.Parallel()
+
+		p := valid()
+		attest.Ok(t, Validate(p))
+		attest.Ok(t, Validate(&p))
+	})
+
+	t.Run("optional fields", func(t *testing.T) {
+		t.Parallel()
+
+		p := valid()
+		p.Email = ""
+		p.Tags = nil
+		p.Nickname = ""
+		attest.Ok(t, Validate(p))
+	})
+
+	t.Run("zero numbers", func(t *testing.T) {
+		t.Parallel()
+
+		p := valid()
+		p.Age = 0
+		err := Validate(p)
+		attest.Error(t, err)
+		fe, ok := err.(FieldErrors)
+		attest.True(t, ok)
+		attest.Equal(t, fe, FieldErrors{{Field: "age", Message: "must be at least 18"}})
+
+		type order struct {
+			Qty      int  `json:"qty" validate:"min=1"`
+			Discount *int `json:"discount" validate:"min=1,max=50"`
+		}
+		zero := 0
+		attest.Error(t, Validate(order{Qty: 0}))
+		attest.Ok(t, Validate(order{Qty: 1}))
+		// An optional number that is not provided is not checked.
+		attest.Ok(t, Validate(order{Qty: 1, Discount: nil}))
+		attest.Error(t, Validate(order{Qty: 1, Discount: &zero}))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		bigScore := 2.0
+		p := person{
+			Name:     "j",
+			Age:      7,
+			Score:    &bigScore,
+			Email:    "jane@Example.com,",
+			Tags:     []string{"a", "b", "c"},
+			Nickname: "janey",
+			Items:    []item{{Name: "pen"}, {Name: "x"}},
+		}
+		err := Validate(p)
+		attest.Error(t, err)
+
+		fe, ok := err.(FieldErrors)
+		attest.True(t, ok)
+		attest.Equal(t, fe, FieldErrors{
+			{Field: "name", Message: "must have at least 2 characters"},
+			{Field: "age", Message: "must be at least 18"},
+			{Field: "score", Message: "must be at most 1.5"},
+			{Field: "email", Message: "has an invalid format"},
+			{Field: "tags", Message: "must have at most 2 items"},
+			{Field: "nick_name", Message: "must have at most 3 characters"},
+			{Field: "address.city", Message: "is required"},
+			{Field: "items[1].name", Message: "must have at least 2 characters"},
+		})
+		attest.Subsequence(t, err.Error(), "address.city: is required")
+	})
+
+	t.Run("required", func(t *testing.T) {
+		t.Parallel()
+
+		p := valid()
+		p.Name = ""
+		p.Score = nil
+		attest.Equal(t, Validate(p), error(FieldErrors{
+			{Field: "name", Message: "is required"},
+			{Field: "score", Message: "is required"},
+		}))
+	})
+
+	t.Run("bad rules", func(t *testing.T) {
+		t.Parallel()
+
+		type unknown struct {
+			Name string `validate:"nope"`
+		}
+		err := Validate(unknown{Name: "a"})
+		attest.Error(t, err)
+		_, ok := err.(FieldErrors)
+		attest.False(t, ok)
+		attest.Subsequence(t, err.Error(), `unknown validation rule "nope"`)
+
+		type notNumber struct {
+			Name string `validate:"min=1"`
+		}
+		attest.Error(t, Validate(notNumber{Name: "a"}))
+
+		type badRegex struct {
+			Name string `validate:"regex=[a-"`
+		}
+		attest.Error(t, Validate(badRegex{Name: "a"}))
+	})
+
+	t.Run("not a struct", func(t *testing.T) {
+		t.Parallel()
+
+		attest.Ok(t, Validate(3))
+		attest.Ok(t, Validate((*person)(nil)))
+	})
+}
@@ -56,7 +56,7 @@ func TestNewRoute(t *testing.T) {
 	)
 	attest.Ok(t, err)
 
-	basicAuth, err := middleware.BasicAuth(someMuxHandler("msg"), "some-user", "some-very-very-h1rd-passwd")
+	basicAuth, err := middleware.BasicAuth(someMuxHandler("msg"), "some-user", "some-very-very-h1rd-passwd", nil)
 	attest.Ok(t, err)
 
 	// succeds
@@ -8,6 +8,8 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+
+	"github.com/komuw/ong/internal/octx"
 )
 
 // Some of the code here is inspired by(or taken from):
@@ -54,9 +56,7 @@ func NewRoute(
 	handler http.Handler,
 ) (Route, error) {
 	h := getfunc(handler)
-	if strings.Contains(h, "ong/middleware/") &&
-		!strings.Contains(h, "ong/middleware.BasicAuth") {
-		// BasicAuth is allowed.
+	if strings.Contains(h, "ong/middleware/") && !isExportedMiddleware(h) {
 		return Route{}, errors.New("ong/mux: the handler should not be wrapped with ong middleware")
 	}
 
@@ -68,6 +68,23 @@ func NewRoute(
 	}, nil
 }
 
+// isExportedMiddleware reports whether the handler named h was created by one of the ong middlewares that are allowed to be used in a [Route].
+func isExportedMiddleware(h string) bool {
+	// These are the middlewares that are meant to be applied to individual routes.
+	allowed := []string{
+		"ong/middleware.BasicAuth",
+		"ong/middleware.Idempotency",
+		"ong/middleware.Cache",
+		"ong/middleware.Authenticate",
+	}
+	for _, a := range allowed {
+		if strings.Contains(h, a) {
+			return true
+		}
+	}
+	return false
+}
+
 func (r Route) match(ctx context.Context, segs []string) (context.Context, bool) {
 	if len(r.segments) == 1 && r.segments[0] == "*" {
 		// The router is allowed to handle all request paths
@@ -166,6 +183,8 @@ func (r *router) serveHTTP(w http.ResponseWriter, req *http.Request) {
 	segs := pathSegments(req.URL.Path)
 	for _, rt := range r.routes {
 		if ctx, ok := rt.match(req.Context(), segs); ok {
+			// The route pattern is used by ong/middleware as a metrics label.
+			ctx = context.WithValue(ctx, octx.RouteCtxKey, rt.pattern)
 			rt.wrappingHandler.ServeHTTP(w, req.WithContext(ctx))
 			return
 		}
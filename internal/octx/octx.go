@@ -5,6 +5,8 @@ type (
 	logContextKeyType        string
 	fingerPrintKeyType       string
 	antiReplayContextKeyType string
+	traceContextKeyType      string
+	routeContextKeyType      string
 )
 
 const (
@@ -19,4 +21,14 @@ const (
 	//
 	// [replay attacks]: https://en.wikipedia.org/wiki/Replay_attack
 	AntiReplayCtxKey = antiReplayContextKeyType("antiReplayContextKeyType")
+
+	// TraceCtxKey is the name of the context key used to store the [W3C Trace Context].
+	// It is used primarily by `ong/log`, `ong/client` and `ong/middleware` packages
+	//
+	// [W3C Trace Context]: https://www.w3.org/TR/trace-context/
+	TraceCtxKey = traceContextKeyType("traceContextKeyType")
+
+	// RouteCtxKey is the name of the context key used to store the pattern of the route that matched a request.
+	// It is used primarily by `ong/mux` and `ong/middleware` packages
+	RouteCtxKey = routeContextKeyType("routeContextKeyType")
 )
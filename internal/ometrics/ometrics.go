@@ -0,0 +1,45 @@
+// Package ometrics houses the metrics that are recorded by ong itself.
+package ometrics
+
+import (
+	"github.com/komuw/ong/metrics"
+)
+
+var (
+	// Requests is the number of http requests handled, by route pattern, method and status code.
+	Requests = mustCounter("ong_http_requests_total", "Number of http requests handled.", "route", "method", "code")
+	// RequestDuration is the latency of http requests, by route pattern, method and status code.
+	RequestDuration = mustHistogram("ong_http_request_duration_seconds", "Latency of http requests in seconds.", "route", "method", "code")
+
+	// RateLimited is the number of requests rejected by the rate limiter.
+	RateLimited = mustCounter("ong_ratelimited_total", "Number of http requests rejected by the rate limiter.")
+	// LoadShed is the number of requests rejected by the load shedder.
+	LoadShed = mustCounter("ong_loadshed_total", "Number of http requests rejected by the load shedder.")
+	// CsrfFailures is the number of requests that failed csrf validation.
+	CsrfFailures = mustCounter("ong_csrf_failures_total", "Number of http requests that failed csrf validation.")
+	// CorsRejections is the number of cross-origin requests whose origin, method or headers were not allowed.
+	CorsRejections = mustCounter("ong_cors_rejections_total", "Number of cross-origin http requests that were not allowed.")
+	// Panics is the number of panics recovered from.
+	Panics = mustCounter("ong_recovered_panics_total", "Number of panics recovered from in http handlers.")
+	// AcmeRenewals is the number of certificates requested from an ACME server, by result(success/failure).
+	AcmeRenewals = mustCounter("ong_acme_renewals_total", "Number of tls certificates requested from an ACME server.", "result")
+	// OldKeyDecryptions is the number of successful decryptions & signature verifications that used an old(non-primary) key of a keyring, by key ID.
+	// Once it stops increasing for a key, that key can be removed from the keyring.
+	OldKeyDecryptions = mustCounter("ong_cry_old_key_decryptions_total", "Number of decryptions and signature verifications that used an old secret key.", "key_id")
+)
+
+func mustCounter(name, help string, labels ...string) *metrics.Counter {
+	c, err := metrics.NewCounter(name, help, labels...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func mustHistogram(name, help string, labels ...string) *metrics.Histogram {
+	h, err := metrics.NewHistogram(name, help, metrics.DefaultBuckets, labels...)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
@@ -0,0 +1,201 @@
+// Package tracectx implements [W3C Trace Context] propagation.
+//
+// [W3C Trace Context]: https://www.w3.org/TR/trace-context/
+package tracectx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/komuw/ong/internal/octx"
+)
+
+const (
+	// ParentHeader is the name of the traceparent http header.
+	ParentHeader = "traceparent"
+	// StateHeader is the name of the tracestate http header.
+	StateHeader = "tracestate"
+
+	// version of the traceparent format that is generated.
+	version = "00"
+	// sampled is the trace-flags bit that indicates that the caller may have recorded trace data.
+	sampled = byte(0x01)
+	// maxStateMembers is the maximum number of list-members in tracestate.
+	// https://www.w3.org/TR/trace-context/#tracestate-header-field-values
+	maxStateMembers = 32
+	// maxStateLen is the maximum length of tracestate that we propagate.
+	maxStateLen = 512
+)
+
+// Trace is the trace context of a request.
+type Trace struct {
+	// TraceID identifies the whole trace. It is shared by all the spans in a trace.
+	TraceID [16]byte
+	// SpanID identifies the current span(operation) within the trace.
+	SpanID [8]byte
+	// ParentID is the SpanID of the caller, if any.
+	ParentID [8]byte
+	// Flags are the trace-flags, eg sampled.
+	Flags byte
+	// State is vendor-specific trace data, it is propagated as is.
+	State string
+}
+
+// New returns a Trace that starts a new trace.
+func New() Trace {
+	t := Trace{Flags: sampled}
+	_, _ = rand.Read(t.TraceID[:])
+	_, _ = rand.Read(t.SpanID[:])
+	return t
+}
+
+// Child returns a Trace for a new span whose parent is t.
+func (t Trace) Child() Trace {
+	c := Trace{TraceID: t.TraceID, ParentID: t.SpanID, Flags: t.Flags, State: t.State}
+	_, _ = rand.Read(c.SpanID[:])
+	return c
+}
+
+// TraceIDString returns the hex encoded TraceID.
+func (t Trace) TraceIDString() string {
+	return hex.EncodeToString(t.TraceID[:])
+}
+
+// SpanIDString returns the hex encoded SpanID.
+func (t Trace) SpanIDString() string {
+	return hex.EncodeToString(t.SpanID[:])
+}
+
+// Traceparent returns the value of the traceparent header for t.
+func (t Trace) Traceparent() string {
+	return version + "-" + t.TraceIDString() + "-" + t.SpanIDString() + "-" + hex.EncodeToString([]byte{t.Flags})
+}
+
+// Parse parses the traceparent & tracestate header values.
+// The returned Trace has the caller's span as its ParentID and a newly generated SpanID.
+// It returns false if traceparent is not valid.
+func Parse(traceparent, tracestate string) (Trace, bool) {
+	// https://www.w3.org/TR/trace-context/#traceparent-header-field-values
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	const length = 55
+
+	tp := strings.TrimSpace(traceparent)
+	if len(tp) < length {
+		return Trace{}, false
+	}
+	ver, err := hex.DecodeString(tp[0:2])
+	if err != nil || !isLowerHex(tp[0:2]) || ver[0] == 0xff {
+		return Trace{}, false
+	}
+	if ver[0] == 0x00 && len(tp) != length {
+		return Trace{}, false
+	}
+	if len(tp) > length && tp[length] != '-' {
+		// Future versions may append fields, but they have to be delimited.
+		return Trace{}, false
+	}
+	if tp[2] != '-' || tp[35] != '-' || tp[52] != '-' {
+		return Trace{}, false
+	}
+
+	t := Trace{}
+	traceID, spanID, flags := tp[3:35], tp[36:52], tp[53:55]
+	if !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) {
+		return Trace{}, false
+	}
+	if _, err := hex.Decode(t.TraceID[:], []byte(traceID)); err != nil {
+		return Trace{}, false
+	}
+	if _, err := hex.Decode(t.SpanID[:], []byte(spanID)); err != nil {
+		return Trace{}, false
+	}
+	f, err := hex.DecodeString(flags)
+	if err != nil {
+		return Trace{}, false
+	}
+	if t.TraceID == [16]byte{} || t.SpanID == [8]byte{} {
+		return Trace{}, false
+	}
+	t.Flags = f[0]
+	t.State = parseState(tracestate)
+
+	return t.Child(), true
+}
+
+// FromRequest returns the Trace of an incoming request.
+// If the request has no valid traceparent header, a new trace is started.
+func FromRequest(r *http.Request) Trace {
+	if t, ok := Parse(r.Header.Get(ParentHeader), strings.Join(r.Header.Values(StateHeader), ",")); ok {
+		return t
+	}
+	return New()
+}
+
+// Inject sets the trace context headers of an outgoing request.
+func (t Trace) Inject(h http.Header) {
+	h.Set(ParentHeader, t.Traceparent())
+	if t.State != "" {
+		h.Set(StateHeader, t.State)
+	} else {
+		h.Del(StateHeader)
+	}
+}
+
+// Set returns a new context that contains t.
+func Set(ctx context.Context, t Trace) context.Context {
+	return context.WithValue(ctx, octx.TraceCtxKey, t)
+}
+
+// Get returns the Trace stored in ctx, if any.
+func Get(ctx context.Context) (Trace, bool) {
+	if ctx == nil {
+		return Trace{}, false
+	}
+	if vCtx := ctx.Value(octx.TraceCtxKey); vCtx != nil {
+		if t, ok := vCtx.(Trace); ok {
+			return t, true
+		}
+	}
+	return Trace{}, false
+}
+
+// parseState drops the tracestate list-members that are empty or exceed the limits.
+// https://www.w3.org/TR/trace-context/#tracestate-limits
+func parseState(s string) string {
+	members := []string{}
+	for _, m := range strings.Split(s, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		if k, v, ok := strings.Cut(m, "="); !ok || k == "" || v == "" {
+			// The whole header is invalid.
+			return ""
+		}
+		members = append(members, m)
+	}
+	if len(members) > maxStateMembers {
+		return ""
+	}
+
+	st := strings.Join(members, ",")
+	for len(st) > maxStateLen && len(members) > 0 {
+		// Remove from the right, those are the oldest entries.
+		members = members[:len(members)-1]
+		st = strings.Join(members, ",")
+	}
+	return st
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(('0' <= c && c <= '9') || ('a' <= c && c <= 'f')) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,139 @@
+package tracectx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.akshayshah.org/attest"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid", func(t *testing.T) {
+		t.Parallel()
+
+		tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		tr, ok := Parse(tp, "congo=t61rcWkgMzE")
+		attest.True(t, ok)
+		attest.Equal(t, tr.TraceIDString(), "4bf92f3577b34da6a3ce929d0e0e4736")
+		attest.Equal(t, tr.Flags, 0x01)
+		attest.Equal(t, tr.State, "congo=t61rcWkgMzE")
+		// A new span is created, whose parent is the caller.
+		attest.NotEqual(t, tr.SpanIDString(), "00f067aa0ba902b7")
+		attest.Equal(t, tr.ParentID, [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7})
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tp := range []string{
+			"",
+			"garbage",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",          // missing flags
+			"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",       // uppercase
+			"00-00000000000000000000000000000000-00f067aa0ba902b7-01",       // zero trace-id
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",       // zero span-id
+			"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",       // invalid version
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", // version 00 has no extra fields
+			"0x-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",       // not hex
+			"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01",       // bad delimiter
+			"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01extra",  // undelimited extra fields
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0g",       // bad flags
+			"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",       // bad trace-id
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bz-01",       // bad span-id
+			strings.Repeat("0", 55), // all zeros
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-", // version 00 with trailing dash
+		} {
+			_, ok := Parse(tp, "")
+			attest.False(t, ok, attest.Sprintf("traceparent: %s", tp))
+		}
+	})
+
+	t.Run("future version", func(t *testing.T) {
+		t.Parallel()
+
+		tr, ok := Parse("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-the-future-holds", "")
+		attest.True(t, ok)
+		attest.Equal(t, tr.TraceIDString(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	})
+
+	t.Run("tracestate", func(t *testing.T) {
+		t.Parallel()
+
+		tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+		tr, _ := Parse(tp, " rojo=00f067aa0ba902b7 , ,congo=t61rcWkgMzE")
+		attest.Equal(t, tr.State, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE")
+
+		tr, _ = Parse(tp, "rojo")
+		attest.Zero(t, tr.State)
+
+		many := []string{}
+		for i := 0; i < maxStateMembers+1; i++ {
+			many = append(many, "k=v")
+		}
+		tr, _ = Parse(tp, strings.Join(many, ","))
+		attest.Zero(t, tr.State)
+
+		tr, _ = Parse(tp, "a="+strings.Repeat("x", 300)+",b="+strings.Repeat("y", 300))
+		attest.Equal(t, tr.State, "a="+strings.Repeat("x", 300))
+	})
+}
+
+func TestTrace(t *testing.T) {
+	t.Parallel()
+
+	t.Run("new", func(t *testing.T) {
+		t.Parallel()
+
+		a, b := New(), New()
+		attest.NotEqual(t, a.TraceID, b.TraceID)
+		attest.NotEqual(t, a.TraceID, [16]byte{})
+		attest.NotEqual(t, a.SpanID, [8]byte{})
+
+		tr, ok := Parse(a.Traceparent(), "")
+		attest.True(t, ok)
+		attest.Equal(t, tr.TraceID, a.TraceID)
+		attest.Equal(t, tr.ParentID, a.SpanID)
+	})
+
+	t.Run("child", func(t *testing.T) {
+		t.Parallel()
+
+		p := New()
+		p.State = "k=v"
+		c := p.Child()
+		attest.Equal(t, c.TraceID, p.TraceID)
+		attest.Equal(t, c.ParentID, p.SpanID)
+		attest.NotEqual(t, c.SpanID, p.SpanID)
+		attest.Equal(t, c.State, p.State)
+	})
+
+	t.Run("from request", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		a := FromRequest(req)
+		attest.NotEqual(t, a.TraceID, [16]byte{})
+
+		a.Inject(req.Header)
+		b := FromRequest(req)
+		attest.Equal(t, b.TraceID, a.TraceID)
+	})
+
+	t.Run("context", func(t *testing.T) {
+		t.Parallel()
+
+		_, ok := Get(context.Background())
+		attest.False(t, ok)
+
+		a := New()
+		b, ok := Get(Set(context.Background(), a))
+		attest.True(t, ok)
+		attest.Equal(t, b, a)
+	})
+}
@@ -12,6 +12,7 @@ import (
 	ongErrors "github.com/komuw/ong/errors"
 	"github.com/komuw/ong/id"
 	"github.com/komuw/ong/internal/octx"
+	"github.com/komuw/ong/internal/tracectx"
 )
 
 const (
@@ -20,6 +21,10 @@ const (
 
 	// logIdFieldName is the name under which a logID will be logged as.
 	logIDFieldName = "logID"
+	// traceIDFieldName is the name under which a W3C trace-id will be logged as.
+	traceIDFieldName = "traceID"
+	// spanIDFieldName is the name under which a W3C span-id will be logged as.
+	spanIDFieldName = "spanID"
 )
 
 // GetId gets a logId either from the provided context or auto-generated.
@@ -42,6 +47,29 @@ func getId(ctx context.Context) (string, bool) {
 	return id.New(), false
 }
 
+// GetTraceId returns the [W3C Trace Context] trace-id stored in ctx.
+// It returns an empty string if ctx has no trace context.
+// The trace context is added to the request context by [github.com/komuw/ong/middleware].
+//
+// [W3C Trace Context]: https://www.w3.org/TR/trace-context/
+func GetTraceId(ctx context.Context) string {
+	if t, ok := tracectx.Get(ctx); ok {
+		return t.TraceIDString()
+	}
+	return ""
+}
+
+// GetSpanId returns the [W3C Trace Context] span-id stored in ctx.
+// It returns an empty string if ctx has no trace context.
+//
+// [W3C Trace Context]: https://www.w3.org/TR/trace-context/
+func GetSpanId(ctx context.Context) string {
+	if t, ok := tracectx.Get(ctx); ok {
+		return t.SpanIDString()
+	}
+	return ""
+}
+
 // New returns an [slog.Logger]
 // The logger is backed by an [slog.Handler] that stores log messages into a [circular buffer].
 // Those log messages are only flushed to the underlying io.Writer when a message with level >= [slog.LevelError] is logged.
@@ -210,11 +238,25 @@ func (h *handler) Handle(ctx context.Context, r slog.Record) error {
 						{Key: logIDFieldName, Value: slog.StringValue(theID)},
 					}
 
+					// Add trace context
+					if t, ok := tracectx.Get(v.ctx); ok {
+						newAttrs = append(
+							newAttrs,
+							slog.Attr{Key: traceIDFieldName, Value: slog.StringValue(t.TraceIDString())},
+							slog.Attr{Key: spanIDFieldName, Value: slog.StringValue(t.SpanIDString())},
+						)
+					}
+
 					// Add stackTraces
+					// Errors created by ong/errors implement [slog.LogValuer] and render their own attributes & stack trace.
+					// Other errors that wrap them, say using [fmt.Errorf], do not; so their stack trace is added here.
 					v.r.Attrs(func(a slog.Attr) bool {
 						if e, ok := a.Value.Any().(error); ok {
-							if stack := ongErrors.StackTrace(e); stack != "" {
-								newAttrs = append(newAttrs, slog.Attr{Key: "stack", Value: slog.StringValue(stack)})
+							if _, ok := e.(slog.LogValuer); ok {
+								return true
+							}
+							if frames := ongErrors.StackFrames(e); len(frames) > 0 {
+								newAttrs = append(newAttrs, slog.Any("stack", frames))
 								return false // Stop iteration. This assumes that the log fields had only one error.
 							}
 						}
@@ -14,6 +14,7 @@ import (
 
 	ongErrors "github.com/komuw/ong/errors"
 	"github.com/komuw/ong/internal/octx"
+	"github.com/komuw/ong/internal/tracectx"
 
 	"go.akshayshah.org/attest"
 	"go.uber.org/goleak"
@@ -184,10 +185,29 @@ func TestLogger(t *testing.T) {
 
 			attest.Subsequence(t, w.String(), logIDFieldName)
 			attest.Subsequence(t, w.String(), "stack")
-			attest.Subsequence(t, w.String(), "log_test.go:182") // stacktrace added.
+			attest.Subsequence(t, w.String(), `log_test.go","line":184`) // stacktrace added.
 		}
 	})
 
+	t.Run("trace context added", func(t *testing.T) {
+		t.Parallel()
+
+		w := &bytes.Buffer{}
+		l := New(context.Background(), w, 3)
+
+		tr := tracectx.New()
+		ctx := tracectx.Set(context.Background(), tr)
+		attest.Equal(t, GetTraceId(ctx), tr.TraceIDString())
+		attest.Equal(t, GetSpanId(ctx), tr.SpanIDString())
+		attest.Zero(t, GetTraceId(context.Background()))
+
+		l.InfoContext(ctx, "hello world")
+		l.ErrorContext(ctx, "some-err")
+
+		attest.Subsequence(t, w.String(), fmt.Sprintf("%q:%q", traceIDFieldName, tr.TraceIDString()))
+		attest.Subsequence(t, w.String(), fmt.Sprintf("%q:%q", spanIDFieldName, tr.SpanIDString()))
+	})
+
 	t.Run("logs are rotated", func(t *testing.T) {
 		t.Parallel()
 
@@ -388,7 +408,7 @@ func TestLogger(t *testing.T) {
 			stdLogger.Println(msg)
 			attest.Subsequence(t, w.String(), msg)
 			attest.Subsequence(t, w.String(), `log_test.go`)
-			attest.Subsequence(t, w.String(), `log_test.go:388`)
+			attest.Subsequence(t, w.String(), `log_test.go:408`)
 			attest.True(t, LevelImmediate < 0) // otherwise it will trigger `log.handler` to flush all logs, which we dont want.
 		}
 	})
@@ -645,3 +665,35 @@ func TestGrouping(t *testing.T) {
 		)
 	}
 }
+
+func TestErrorAttrs(t *testing.T) {
+	t.Parallel()
+
+	w := &bytes.Buffer{}
+	l := New(context.Background(), w, 3)
+
+	err := ongErrors.With(ongErrors.New("bad"), "userID", 42)
+	l.Error("some-ong-err", "err", err)
+
+	var m map[string]any
+	attest.Ok(t, json.Unmarshal(w.Bytes(), &m))
+	e, ok := m["err"].(map[string]any)
+	attest.True(t, ok, attest.Sprintf("log: %s", w.String()))
+	attest.Equal(t, e["msg"], "bad")
+	attest.Equal(t, e["userID"], 42.0)
+	stack, ok := e["stack"].([]any)
+	attest.True(t, ok)
+	attest.NotZero(t, len(stack))
+	_, ok = m["stack"]
+	attest.False(t, ok) // the stack is nested in the error.
+
+	// errors that wrap ong errors still get a stack trace.
+	w.Reset()
+	l.Error("some-wrapped-err", "err", fmt.Errorf("wrapped: %w", ongErrors.New("bad")))
+	m = nil
+	attest.Ok(t, json.Unmarshal(w.Bytes(), &m))
+	attest.Equal(t, m["err"], "wrapped: bad")
+	stack, ok = m["stack"].([]any)
+	attest.True(t, ok)
+	attest.NotZero(t, len(stack))
+}
@@ -0,0 +1,50 @@
+package metrics_test
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/komuw/ong/metrics"
+)
+
+func ExampleNewCounter() {
+	signups, err := metrics.NewCounter("myapp_signups_total", "Number of user signups.", "plan")
+	if err != nil {
+		panic(err)
+	}
+
+	signups.Inc("free")
+	signups.Inc("premium")
+
+	fmt.Println(signups.Value("free"))
+
+	// Output: 1
+}
+
+func ExampleNewHistogram() {
+	dbLatency, err := metrics.NewHistogram(
+		"myapp_db_query_duration_seconds",
+		"Latency of database queries.",
+		metrics.DefaultBuckets,
+		"query",
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	start := time.Now()
+	// run query.
+	dbLatency.Observe(time.Since(start).Seconds(), "get_user")
+
+	// Output:
+}
+
+func ExampleHandler() {
+	// [github.com/komuw/ong/server.Run] already serves the metrics on `/debug/metrics`.
+	// Use Handler if you want to serve them elsewhere.
+	mx := http.NewServeMux()
+	mx.Handle("/metrics", metrics.Handler())
+
+	// Output:
+}
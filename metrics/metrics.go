@@ -0,0 +1,373 @@
+// Package metrics provides counters and histograms that are exposed in the [Prometheus text format].
+//
+// ong records some metrics of its own, like the number and latency of http requests handled by its middlewares.
+// Applications can register their own metrics using [NewCounter] and [NewHistogram].
+//
+// [Prometheus text format]: https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxSeries is the maximum number of label combinations that a metric can have.
+	// Observations for any further label combinations are dropped.
+	// This guards against unbounded memory growth if labels are, say, derived from user input.
+	maxSeries = 10_000
+
+	// labelSep separates label values in a series key.
+	labelSep = "\xff"
+
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// DefaultBuckets are the default histogram buckets.
+// They are tailored to measure the latency, in seconds, of http requests.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	// https://prometheus.io/docs/concepts/data_model/#metric-names-and-labels
+	metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRe  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// defaultRegistry holds all the metrics.
+	defaultRegistry = &registry{metrics: map[string]metric{}}
+)
+
+// metric is implemented by [Counter] and [Histogram].
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+type registry struct {
+	mu sync.Mutex // protects metrics
+	// +checklocks:mu
+	metrics map[string]metric
+}
+
+func (r *registry) register(name, help string, labels []string, m metric) error {
+	if !metricNameRe.MatchString(name) {
+		return fmt.Errorf("ong/metrics: invalid metric name %q", name)
+	}
+	for _, l := range labels {
+		if !labelNameRe.MatchString(l) || strings.HasPrefix(l, "__") || l == "le" {
+			return fmt.Errorf("ong/metrics: invalid label name %q for metric %q", l, name)
+		}
+	}
+	if help == "" {
+		return fmt.Errorf("ong/metrics: metric %q has no help text", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.metrics[name]; ok {
+		return fmt.Errorf("ong/metrics: metric %q is already registered", name)
+	}
+	r.metrics[name] = m
+
+	return nil
+}
+
+func (r *registry) write(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for n := range r.metrics {
+		names = append(names, n)
+	}
+	ms := make([]metric, 0, len(names))
+	slices.Sort(names)
+	for _, n := range names {
+		ms = append(ms, r.metrics[n])
+	}
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range ms {
+		m.write(bw)
+	}
+	writeRuntime(bw)
+
+	return bw.Flush()
+}
+
+// Write writes all the registered metrics, plus Go runtime metrics, to w in the [Prometheus text format].
+//
+// [Prometheus text format]: https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+func Write(w io.Writer) error {
+	return defaultRegistry.write(w)
+}
+
+// Handler returns a [http.HandlerFunc] that serves all the metrics in the [Prometheus text format].
+// [github.com/komuw/ong/server.Run] serves it on the `/debug/metrics` endpoint.
+//
+// [Prometheus text format]: https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+func Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		if err := Write(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Counter is a metric whose value only ever goes up, eg; the number of requests served.
+// A Counter has zero or more labels, each combination of label values is a separate series.
+//
+// Use [NewCounter] to get a valid Counter.
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu sync.Mutex // protects values
+	// +checklocks:mu
+	values map[string]float64
+}
+
+// NewCounter creates and registers a [Counter] with the given name, help text & label names.
+// It returns an error if the name or labels are invalid, or if a metric with the same name is already registered.
+func NewCounter(name, help string, labels ...string) (*Counter, error) {
+	c := &Counter{name: name, help: help, labels: labels, values: map[string]float64{}}
+	if err := defaultRegistry.register(name, help, labels, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Inc increments the counter by 1.
+// See [Counter.Add]
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the counter.
+// labelValues should be given in the same order as the label names the counter was created with.
+// Missing label values are treated as empty strings and extra ones are ignored.
+// Negative values of v are ignored, since a counter can only go up.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 || math.IsNaN(v) {
+		return
+	}
+	key := seriesKey(c.labels, labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.values[key]; !ok && len(c.values) >= maxSeries {
+		return
+	}
+	c.values[key] = c.values[key] + v
+}
+
+// Value returns the current value of the counter for the given label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := seriesKey(c.labels, labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	keys := sortedKeys(c.values)
+	vals := make([]float64, 0, len(keys))
+	for _, k := range keys {
+		vals = append(vals, c.values[k])
+	}
+	c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for i, k := range keys {
+		writeSample(w, c.name, labelPairs(c.labels, k), vals[i])
+	}
+}
+
+// Histogram is a metric that samples observations(eg; request durations) and counts them in configurable buckets.
+// A Histogram has zero or more labels, each combination of label values is a separate series.
+//
+// Use [NewHistogram] to get a valid Histogram.
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu sync.Mutex // protects series
+	// +checklocks:mu
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // non-cumulative count per bucket.
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram creates and registers a [Histogram] with the given name, help text, buckets & label names.
+// buckets are the upper bounds of the buckets, if empty [DefaultBuckets] are used.
+// It returns an error if the name, labels or buckets are invalid, or if a metric with the same name is already registered.
+func NewHistogram(name, help string, buckets []float64, labels ...string) (*Histogram, error) {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = slices.Clone(buckets)
+	if !sort.Float64sAreSorted(buckets) {
+		return nil, fmt.Errorf("ong/metrics: buckets of histogram %q are not sorted in increasing order", name)
+	}
+	for i, b := range buckets {
+		if math.IsNaN(b) || (i > 0 && b == buckets[i-1]) {
+			return nil, fmt.Errorf("ong/metrics: histogram %q has invalid bucket %v", name, b)
+		}
+	}
+	if math.IsInf(buckets[len(buckets)-1], +1) {
+		// The +Inf bucket is always added.
+		buckets = buckets[:len(buckets)-1]
+	}
+
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogramSeries{}}
+	if err := defaultRegistry.register(name, help, labels, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Observe adds a single observation v to the histogram.
+// labelValues should be given in the same order as the label names the histogram was created with.
+// Missing label values are treated as empty strings and extra ones are ignored.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	if math.IsNaN(v) {
+		return
+	}
+	key := seriesKey(h.labels, labelValues)
+	i := sort.SearchFloat64s(h.buckets, v) // first bucket whose upper bound is >= v
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		if len(h.series) >= maxSeries {
+			return
+		}
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[key] = s
+	}
+	s.counts[i] = s.counts[i] + 1
+	s.sum = s.sum + v
+	s.count = s.count + 1
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	type snapshot struct {
+		key string
+		histogramSeries
+	}
+
+	h.mu.Lock()
+	keys := sortedKeys(h.series)
+	snaps := make([]snapshot, 0, len(keys))
+	for _, k := range keys {
+		s := h.series[k]
+		snaps = append(snaps, snapshot{k, histogramSeries{counts: slices.Clone(s.counts), sum: s.sum, count: s.count}})
+	}
+	h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, s := range snaps {
+		pairs := labelPairs(h.labels, s.key)
+		cumulative := uint64(0)
+		for i, c := range s.counts {
+			cumulative = cumulative + c
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = formatFloat(h.buckets[i])
+			}
+			writeSample(w, h.name+"_bucket", append(slices.Clone(pairs), [2]string{"le", le}), float64(cumulative))
+		}
+		writeSample(w, h.name+"_sum", pairs, s.sum)
+		writeSample(w, h.name+"_count", pairs, float64(s.count))
+	}
+}
+
+func seriesKey(labels, labelValues []string) string {
+	if len(labelValues) == len(labels) {
+		return strings.Join(labelValues, labelSep)
+	}
+	vals := make([]string, len(labels))
+	copy(vals, labelValues)
+	return strings.Join(vals, labelSep)
+}
+
+func labelPairs(labels []string, key string) [][2]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	vals := strings.Split(key, labelSep)
+	pairs := make([][2]string, 0, len(labels))
+	for i, l := range labels {
+		pairs = append(pairs, [2]string{l, vals[i]})
+	}
+	return pairs
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	_, _ = w.WriteString("# HELP " + name + " " + helpEscaper.Replace(help) + "\n")
+	_, _ = w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func writeSample(w *bufio.Writer, name string, pairs [][2]string, v float64) {
+	_, _ = w.WriteString(name)
+	if len(pairs) > 0 {
+		_ = w.WriteByte('{')
+		for i, p := range pairs {
+			if i > 0 {
+				_ = w.WriteByte(',')
+			}
+			_, _ = w.WriteString(p[0] + `="` + labelEscaper.Replace(p[1]) + `"`)
+		}
+		_ = w.WriteByte('}')
+	}
+	_ = w.WriteByte(' ')
+	_, _ = w.WriteString(formatFloat(v))
+	_ = w.WriteByte('\n')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
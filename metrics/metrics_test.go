@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go.akshayshah.org/attest"
+)
+
+func TestCounter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := NewCounter("test_counter_success_total", "Some help.", "method", "code")
+		attest.Ok(t, err)
+
+		c.Inc("GET", "200")
+		c.Inc("GET", "200")
+		c.Add(3, "POST", "500")
+		c.Add(-1, "POST", "500") // ignored.
+
+		attest.Equal(t, c.Value("GET", "200"), 2)
+		attest.Equal(t, c.Value("POST", "500"), 3)
+		attest.Equal(t, c.Value("PUT", "200"), 0)
+
+		w := &bytes.Buffer{}
+		attest.Ok(t, Write(w))
+		attest.Subsequence(t, w.String(), "# HELP test_counter_success_total Some help.\n# TYPE test_counter_success_total counter\n")
+		attest.Subsequence(t, w.String(), `test_counter_success_total{method="GET",code="200"} 2`+"\n")
+		attest.Subsequence(t, w.String(), `test_counter_success_total{method="POST",code="500"} 3`+"\n")
+	})
+
+	t.Run("no labels", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := NewCounter("test_counter_no_labels_total", "Some help.")
+		attest.Ok(t, err)
+		c.Inc()
+
+		w := &bytes.Buffer{}
+		attest.Ok(t, Write(w))
+		attest.Subsequence(t, w.String(), "test_counter_no_labels_total 1\n")
+	})
+
+	t.Run("label values are escaped", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := NewCounter("test_counter_escape_total", "Some\nhelp.", "path")
+		attest.Ok(t, err)
+		c.Inc("a\"b\\c\nd")
+
+		w := &bytes.Buffer{}
+		attest.Ok(t, Write(w))
+		attest.Subsequence(t, w.String(), `# HELP test_counter_escape_total Some\nhelp.`)
+		attest.Subsequence(t, w.String(), `test_counter_escape_total{path="a\"b\\c\nd"} 1`)
+	})
+
+	t.Run("missing label values", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := NewCounter("test_counter_missing_total", "Some help.", "a", "b")
+		attest.Ok(t, err)
+		c.Inc("x")
+		c.Inc("x", "", "extra")
+		attest.Equal(t, c.Value("x", ""), 2)
+	})
+
+	t.Run("bounded series", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := NewCounter("test_counter_bounded_total", "Some help.", "id")
+		attest.Ok(t, err)
+		for i := 0; i < maxSeries+10; i++ {
+			c.Inc(fmt.Sprint(i))
+		}
+		c.mu.Lock()
+		n := len(c.values)
+		c.mu.Unlock()
+		attest.Equal(t, n, maxSeries)
+	})
+
+	t.Run("concurrency safe", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := NewCounter("test_counter_concurrency_total", "Some help.", "code")
+		attest.Ok(t, err)
+
+		wg := &sync.WaitGroup{}
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.Inc("200")
+				_ = Write(io.Discard)
+			}()
+		}
+		wg.Wait()
+		attest.Equal(t, c.Value("200"), 20)
+	})
+}
+
+func TestHistogram(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		h, err := NewHistogram("test_histogram_success_seconds", "Some help.", []float64{0.1, 1}, "route")
+		attest.Ok(t, err)
+
+		h.Observe(0.05, "/a")
+		h.Observe(0.1, "/a")
+		h.Observe(0.5, "/a")
+		h.Observe(5, "/a")
+
+		w := &bytes.Buffer{}
+		attest.Ok(t, Write(w))
+		attest.Subsequence(t, w.String(), "# TYPE test_histogram_success_seconds histogram\n")
+		attest.Subsequence(t, w.String(), `test_histogram_success_seconds_bucket{route="/a",le="0.1"} 2
+test_histogram_success_seconds_bucket{route="/a",le="1"} 3
+test_histogram_success_seconds_bucket{route="/a",le="+Inf"} 4
+test_histogram_success_seconds_sum{route="/a"} 5.65
+test_histogram_success_seconds_count{route="/a"} 4
+`)
+	})
+
+	t.Run("bad buckets", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewHistogram("test_histogram_bad_buckets", "Some help.", []float64{1, 0.5})
+		attest.Error(t, err)
+
+		_, err = NewHistogram("test_histogram_bad_buckets", "Some help.", []float64{1, 1})
+		attest.Error(t, err)
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	t.Run("duplicate", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewCounter("test_registry_duplicate_total", "Some help.")
+		attest.Ok(t, err)
+
+		_, err = NewCounter("test_registry_duplicate_total", "Some help.")
+		attest.Error(t, err)
+		attest.Subsequence(t, err.Error(), "already registered")
+	})
+
+	t.Run("invalid names", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewCounter("1bad", "Some help.")
+		attest.Error(t, err)
+
+		_, err = NewCounter("test_registry_bad_label_total", "Some help.", "bad-label")
+		attest.Error(t, err)
+
+		_, err = NewHistogram("test_registry_le_label", "Some help.", nil, "le")
+		attest.Error(t, err)
+
+		_, err = NewCounter("test_registry_no_help_total", "")
+		attest.Error(t, err)
+	})
+
+	t.Run("handler", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/debug/metrics", nil)
+		Handler().ServeHTTP(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		rb, err := io.ReadAll(res.Body)
+		attest.Ok(t, err)
+
+		attest.Equal(t, res.StatusCode, http.StatusOK)
+		attest.Equal(t, res.Header.Get("Content-Type"), contentType)
+		attest.Subsequence(t, string(rb), "go_goroutines ")
+		attest.Subsequence(t, string(rb), "go_gc_cycles_total ")
+		attest.Subsequence(t, string(rb), `go_info{version="go`)
+	})
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"bufio"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// startTime is the time at which the process started, approximately.
+var startTime = time.Now()
+
+// writeRuntime writes metrics about the Go runtime & garbage collector.
+// The metric names follow the ones used by the Prometheus Go client, so that existing dashboards work.
+func writeRuntime(w *bufio.Writer) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	gauge := func(name, help string, v float64) {
+		writeHeader(w, name, help, "gauge")
+		writeSample(w, name, nil, v)
+	}
+	counter := func(name, help string, v float64) {
+		writeHeader(w, name, help, "counter")
+		writeSample(w, name, nil, v)
+	}
+
+	{
+		writeHeader(w, "go_info", "Information about the Go environment.", "gauge")
+		writeSample(w, "go_info", [][2]string{{"version", runtime.Version()}}, 1)
+	}
+	gauge("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	gauge("go_gomaxprocs", "Value of GOMAXPROCS.", float64(runtime.GOMAXPROCS(0)))
+	gauge("go_memory_limit_bytes", "Value of the Go runtime soft memory limit, GOMEMLIMIT.", float64(debug.SetMemoryLimit(-1)))
+
+	counter("go_gc_cycles_total", "Number of completed GC cycles.", float64(ms.NumGC))
+	counter("go_gc_pause_seconds_total", "Cumulative time spent in GC stop-the-world pauses.", float64(ms.PauseTotalNs)/float64(time.Second))
+	gauge("go_gc_cpu_fraction", "Fraction of this program's available CPU time used by the GC since the program started.", ms.GCCPUFraction)
+	gauge("go_memstats_next_gc_bytes", "Heap size target for the next GC cycle.", float64(ms.NextGC))
+
+	counter("go_memstats_alloc_bytes_total", "Cumulative bytes allocated for heap objects.", float64(ms.TotalAlloc))
+	counter("go_memstats_mallocs_total", "Cumulative count of heap objects allocated.", float64(ms.Mallocs))
+	counter("go_memstats_frees_total", "Cumulative count of heap objects freed.", float64(ms.Frees))
+	gauge("go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", float64(ms.HeapAlloc))
+	gauge("go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.", float64(ms.HeapInuse))
+	gauge("go_memstats_heap_idle_bytes", "Bytes in idle heap spans.", float64(ms.HeapIdle))
+	gauge("go_memstats_heap_released_bytes", "Bytes of physical memory returned to the OS.", float64(ms.HeapReleased))
+	gauge("go_memstats_heap_objects", "Number of allocated heap objects.", float64(ms.HeapObjects))
+	gauge("go_memstats_stack_inuse_bytes", "Bytes in stack spans.", float64(ms.StackInuse))
+	gauge("go_memstats_sys_bytes", "Total bytes of memory obtained from the OS.", float64(ms.Sys))
+
+	gauge("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", float64(startTime.Unix()))
+}
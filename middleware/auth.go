@@ -1,41 +1,59 @@
 package middleware
 
 import (
+	"context"
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/cry"
+	"github.com/komuw/ong/id"
 	"github.com/komuw/ong/internal/key"
 )
 
 // BasicAuth is a middleware that protects wrappedHandler using basic authentication.
-func BasicAuth(wrappedHandler http.Handler, user, passwd string) (http.HandlerFunc, error) {
+// It accepts a single user, see [Authenticate] for more authentication schemes.
+// The rejections are rendered using rf, see [config.RejectFunc]. If rf is nil, they are rendered as problem+json or html.
+func BasicAuth(wrappedHandler http.Handler, user, passwd string, rf config.RejectFunc) (http.HandlerFunc, error) {
 	if err := key.IsSecure(passwd); err != nil {
 		return nil, err
 	}
 
 	// See: https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/WWW-Authenticate
 	realm := `enter username and password` // Shouldn't contain 'weird' chars otherwise may break mobile browsers; https://github.com/komuw/ong/pull/457
-	e := func(w http.ResponseWriter) {
-		errMsg := `Basic realm=` + realm
-		w.Header().Set("WWW-Authenticate", errMsg)
-		w.Header().Set(ongMiddlewareErrorHeader, errMsg)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	e := func(w http.ResponseWriter, r *http.Request, reason error) {
+		w.Header().Set(authHeader, `Basic realm=`+realm)
+		reject(w, r, rf, config.Rejection{
+			Kind:   config.RejectionAuth,
+			Status: http.StatusUnauthorized,
+			Reason: reason,
+		})
 	}
 
 	f := func(w http.ResponseWriter, r *http.Request) {
 		u, p, ok := r.BasicAuth()
 		if u == "" || p == "" || !ok {
-			e(w)
+			e(w, r, ErrNoCredentials)
 			return
 		}
 
 		if subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 {
-			e(w)
+			e(w, r, errBasicAuthInvalid)
 			return
 		}
 
 		if subtle.ConstantTimeCompare([]byte(p), []byte(passwd)) != 1 {
-			e(w)
+			e(w, r, errBasicAuthInvalid)
 			return
 		}
 
@@ -44,3 +62,423 @@ func BasicAuth(wrappedHandler http.Handler, user, passwd string) (http.HandlerFu
 
 	return f, nil
 }
+
+const (
+	authHeader          = "WWW-Authenticate"
+	principalLogField   = "principal"
+	maxAuthDelay        = 5 * time.Minute
+	authFailuresForget  = 15 * time.Minute
+	defaultAPIKeyHeader = "X-Api-Key"
+	// tokenPrefix is the prefix of tokens issued by [cry.IssueToken].
+	tokenPrefix = "ong.v1."
+)
+
+// ErrNoCredentials is returned by an [Authenticator] if the request does not contain any credentials for that scheme.
+var ErrNoCredentials = errors.New("ong/middleware/auth: no credentials")
+
+var errBasicAuthInvalid = errors.New("ong/middleware/auth: invalid username or password")
+
+// Principal is the identity of an authenticated client.
+type Principal struct {
+	// ID identifies the client, eg the username of a BasicAuth user.
+	ID string
+	// Scheme is the authentication scheme that was used, eg; Basic, Bearer or ApiKey.
+	Scheme string
+
+	// claims are set if the client was authenticated using a token issued by [cry.IssueToken].
+	claims *cry.Claims
+}
+
+// Authenticator authenticates http requests using a particular scheme.
+//
+// See [NewBasicAuthenticator], [NewBearerAuthenticator], [NewAPIKeyAuthenticator] & [NewTokenAuthenticator]
+type Authenticator interface {
+	// Authenticate returns the [Principal] that made the request.
+	// It should return [ErrNoCredentials] if r does not contain credentials for this scheme,
+	// and any other error if the credentials are invalid.
+	Authenticate(r *http.Request) (Principal, error)
+	// Challenge is the value of the WWW-Authenticate response header sent when authentication fails.
+	// It can be empty, if the scheme has no such challenge.
+	Challenge() string
+}
+
+type principalCtxKeyType string
+
+const (
+	// principalCtxKey is used to store the authenticated principal.
+	principalCtxKey = principalCtxKeyType("principalCtxKey")
+	// principalHolderCtxKey is used to pass the principal up to the [logger] middleware.
+	principalHolderCtxKey = principalCtxKeyType("principalHolderCtxKey")
+)
+
+// principalHolder is added to the request context by the [logger] middleware.
+// It is filled in by [Authenticate] so that the logger, which wraps it, can log the principal.
+type principalHolder struct {
+	p atomic.Pointer[Principal]
+}
+
+// Authenticate is a middleware that protects wrappedHandler using one or more authentication schemes.
+//
+// The schemes are tried in the order given, the first one to find credentials in the request decides the outcome.
+// On success, the authenticated [Principal] is added to the request context and can be fetched using [GetPrincipal].
+// It is also included in the logs of the request.
+// On failure, a http 401 with a WWW-Authenticate header for each scheme is returned.
+//
+// Clients that fail authentication are throttled; each consecutive failure doubles the period, starting at one second,
+// during which the client's requests are rejected with a http 429.
+// The rejections are rendered using rf, see [config.RejectFunc]. If rf is nil, they are rendered as problem+json or html.
+func Authenticate(wrappedHandler http.Handler, rf config.RejectFunc, auths ...Authenticator) http.HandlerFunc {
+	th := newAuthThrottle()
+
+	challenge := func(w http.ResponseWriter) {
+		for _, a := range auths {
+			if c := a.Challenge(); c != "" {
+				w.Header().Add(authHeader, c)
+			}
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		th.reSize()
+		client := ClientIP(r)
+
+		if wait := th.wait(client); wait > 0 {
+			reject(w, r, rf, config.Rejection{
+				Kind:   config.RejectionThrottle,
+				Status: http.StatusTooManyRequests,
+				// Round up, so that clients do not retry too early.
+				RetryAfter: time.Duration(math.Ceil(wait.Seconds())) * time.Second,
+				Reason:     fmt.Errorf("ong/middleware/auth: too many failed authentication attempts, retry after %s", wait),
+			})
+			return
+		}
+
+		for _, a := range auths {
+			p, err := a.Authenticate(r)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			if err != nil {
+				th.fail(client)
+				challenge(w)
+				reject(w, r, rf, config.Rejection{
+					Kind:   config.RejectionAuth,
+					Status: http.StatusUnauthorized,
+					Reason: err,
+				})
+				return
+			}
+
+			th.succeed(client)
+			ctx := context.WithValue(r.Context(), principalCtxKey, p)
+			if ph, ok := ctx.Value(principalHolderCtxKey).(*principalHolder); ok {
+				ph.p.Store(&p)
+			}
+			wrappedHandler.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		// No credentials at all. This is not counted as a failure since it is what
+		// browsers do before prompting the user for credentials.
+		challenge(w)
+		reject(w, r, rf, config.Rejection{
+			Kind:   config.RejectionAuth,
+			Status: http.StatusUnauthorized,
+			Reason: ErrNoCredentials,
+		})
+	}
+}
+
+// GetPrincipal returns the [Principal] that was authenticated by the [Authenticate] middleware.
+func GetPrincipal(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalCtxKey).(Principal)
+	return p, ok
+}
+
+// basicAuthenticator is an [Authenticator] for the Basic scheme.
+type basicAuthenticator struct {
+	users  map[string]string
+	realm  string
+	hasher *cry.Hasher
+	// dummyHash is used for unknown users so that their response time is similar to that of known users.
+	dummyHash string
+}
+
+// NewBasicAuthenticator returns an [Authenticator] for [Basic authentication].
+// users is a map of username to the hash of their password.
+// The hashes are verified using h, see [cry.Hasher.Verify]; so they can be in any format that h knows about, including
+// those produced by [cry.Hash] & [cry.Hasher.Hash]. If h is nil, a [cry.Hasher] with the default parameters is used.
+//
+// [Basic authentication]: https://datatracker.ietf.org/doc/html/rfc7617
+func NewBasicAuthenticator(users map[string]string, h *cry.Hasher) (Authenticator, error) {
+	if len(users) == 0 {
+		return nil, errors.New("ong/middleware/auth: no users provided")
+	}
+	for u, hash := range users {
+		if u == "" || strings.Contains(u, ":") {
+			return nil, fmt.Errorf("ong/middleware/auth: invalid username %q", u)
+		}
+		// Hashes are either in the PHC string format, ie `$<id>$...`, or the format of cry.Hash, ie `version$salt$key`.
+		if !strings.HasPrefix(hash, "$") && len(strings.Split(hash, "$")) != 3 {
+			return nil, fmt.Errorf("ong/middleware/auth: password of user %q is not a hash", u)
+		}
+	}
+
+	if h == nil {
+		var err error
+		if h, err = cry.NewHasher(0, 0, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return basicAuthenticator{
+		users:     maps.Clone(users),
+		realm:     "enter username and password",
+		hasher:    h,
+		dummyHash: h.Hash(id.Random(16)),
+	}, nil
+}
+
+func (b basicAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	u, p, ok := r.BasicAuth()
+	if !ok {
+		return Principal{}, ErrNoCredentials
+	}
+
+	h, known := b.users[u]
+	if !known {
+		h = b.dummyHash
+	}
+	if err := b.hasher.Verify(p, h); err != nil || !known {
+		return Principal{}, errBasicAuthInvalid
+	}
+
+	return Principal{ID: u, Scheme: "Basic"}, nil
+}
+
+func (b basicAuthenticator) Challenge() string {
+	return `Basic realm="` + b.realm + `", charset="UTF-8"`
+}
+
+// HashKey returns the hash of an API key or bearer token, for use with [NewAPIKeyAuthenticator] & [NewBearerAuthenticator].
+// It is safe to persist the result in your database instead of storing the actual key.
+//
+// Unlike passwords, keys and tokens are expected to be long and random, thus a fast hash(sha256) is used.
+func HashKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// keyAuthenticator is an [Authenticator] for keys whose hashes are known.
+type keyAuthenticator struct {
+	keys      map[string]string // hash of key to principal ID.
+	scheme    string
+	challenge string
+	extract   func(r *http.Request) string
+}
+
+func (k keyAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	key := k.extract(r)
+	if key == "" {
+		return Principal{}, ErrNoCredentials
+	}
+
+	pid, ok := k.keys[HashKey(key)]
+	if !ok {
+		return Principal{}, fmt.Errorf("ong/middleware/auth: invalid %s credentials", strings.ToLower(k.scheme))
+	}
+
+	return Principal{ID: pid, Scheme: k.scheme}, nil
+}
+
+func (k keyAuthenticator) Challenge() string {
+	return k.challenge
+}
+
+// NewBearerAuthenticator returns an [Authenticator] for [Bearer tokens] sent in the Authorization header.
+// tokens is a map of the hash of a token, as produced by [HashKey], to the ID of the principal that owns it.
+//
+// [Bearer tokens]: https://datatracker.ietf.org/doc/html/rfc6750
+func NewBearerAuthenticator(tokens map[string]string) (Authenticator, error) {
+	if err := checkKeys(tokens); err != nil {
+		return nil, err
+	}
+
+	return keyAuthenticator{
+		keys:      maps.Clone(tokens),
+		scheme:    "Bearer",
+		challenge: `Bearer realm="api"`,
+		extract:   bearerToken,
+	}, nil
+}
+
+// bearerToken returns the bearer token in the Authorization header of r, if any.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get(authorizationHeader), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// NewAPIKeyAuthenticator returns an [Authenticator] for API keys sent in the header named header, or the url query parameter named queryParam.
+// If header is empty, "X-Api-Key" is used. If queryParam is empty, keys in the url query are not accepted.
+// Note that url query parameters may end up in access logs of proxies, prefer headers.
+//
+// keys is a map of the hash of a key, as produced by [HashKey], to the ID of the principal that owns it.
+func NewAPIKeyAuthenticator(header, queryParam string, keys map[string]string) (Authenticator, error) {
+	if err := checkKeys(keys); err != nil {
+		return nil, err
+	}
+	if header == "" {
+		header = defaultAPIKeyHeader
+	}
+
+	return keyAuthenticator{
+		keys:   maps.Clone(keys),
+		scheme: "ApiKey",
+		extract: func(r *http.Request) string {
+			if k := r.Header.Get(header); k != "" {
+				return k
+			}
+			if queryParam != "" {
+				return r.URL.Query().Get(queryParam)
+			}
+			return ""
+		},
+	}, nil
+}
+
+// tokenAuthenticator is an [Authenticator] for bearer tokens issued by [cry.IssueToken].
+type tokenAuthenticator struct {
+	v *cry.TokenVerifier
+}
+
+// NewTokenAuthenticator returns an [Authenticator] for bearer tokens, issued by [cry.IssueToken], that are sent in the Authorization header.
+// The ID of the authenticated [Principal] is the subject of the token and its claims can be fetched using [GetClaims].
+//
+// Bearer tokens that were not issued by [cry.IssueToken] are treated as missing credentials,
+// so that this can be combined with [NewBearerAuthenticator] in [Authenticate].
+func NewTokenAuthenticator(v *cry.TokenVerifier) (Authenticator, error) {
+	if v == nil {
+		return nil, errors.New("ong/middleware/auth: token verifier cannot be nil")
+	}
+	return tokenAuthenticator{v: v}, nil
+}
+
+func (t tokenAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	token := bearerToken(r)
+	if token == "" || !strings.HasPrefix(token, tokenPrefix) {
+		return Principal{}, ErrNoCredentials
+	}
+
+	c, err := t.v.Verify(token)
+	if err != nil {
+		return Principal{}, fmt.Errorf("ong/middleware/auth: %w", err)
+	}
+
+	return Principal{ID: c.Subject, Scheme: "Bearer", claims: &c}, nil
+}
+
+func (t tokenAuthenticator) Challenge() string {
+	return `Bearer realm="api"`
+}
+
+// VerifyToken is a middleware that only lets through requests that have a valid bearer token, issued by [cry.IssueToken].
+// The claims of the token can be fetched using [GetClaims].
+//
+// It is a shorthand for using [Authenticate] with [NewTokenAuthenticator].
+func VerifyToken(wrappedHandler http.Handler, v *cry.TokenVerifier, rf config.RejectFunc) (http.HandlerFunc, error) {
+	a, err := NewTokenAuthenticator(v)
+	if err != nil {
+		return nil, err
+	}
+	return Authenticate(wrappedHandler, rf, a), nil
+}
+
+// GetClaims returns the claims of the token that was verified by the [VerifyToken] middleware, or by [Authenticate] using [NewTokenAuthenticator].
+func GetClaims(ctx context.Context) (cry.Claims, bool) {
+	p, ok := GetPrincipal(ctx)
+	if !ok || p.claims == nil {
+		return cry.Claims{}, false
+	}
+	return *p.claims, true
+}
+
+func checkKeys(keys map[string]string) error {
+	if len(keys) == 0 {
+		return errors.New("ong/middleware/auth: no keys provided")
+	}
+	for h, pid := range keys {
+		if _, err := hex.DecodeString(h); err != nil || len(h) != 2*sha256.Size {
+			return fmt.Errorf("ong/middleware/auth: key of principal %q is not a hash produced by HashKey", pid)
+		}
+	}
+	return nil
+}
+
+// authThrottle tracks failed authentication attempts per client.
+type authThrottle struct {
+	mu sync.Mutex // protects clients
+	// +checklocks:mu
+	clients map[string]*authFailures
+}
+
+type authFailures struct {
+	count    int
+	lastFail time.Time
+	until    time.Time
+}
+
+func newAuthThrottle() *authThrottle {
+	return &authThrottle{clients: map[string]*authFailures{}}
+}
+
+// wait returns how long the client has to wait before it can attempt to authenticate again.
+func (a *authThrottle) wait(client string) time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, ok := a.clients[client]
+	if !ok {
+		return 0
+	}
+	return time.Until(f.until)
+}
+
+func (a *authThrottle) fail(client string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	f, ok := a.clients[client]
+	if !ok || now.Sub(f.lastFail) > authFailuresForget {
+		f = &authFailures{}
+		a.clients[client] = f
+	}
+	f.count = f.count + 1
+	f.lastFail = now
+
+	// 1s, 2s, 4s, 8s, ...
+	delay := maxAuthDelay
+	if f.count <= 20 {
+		delay = min(time.Second<<(f.count-1), maxAuthDelay)
+	}
+	f.until = now.Add(delay)
+}
+
+func (a *authThrottle) succeed(client string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.clients, client)
+}
+
+func (a *authThrottle) reSize() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.clients) < 10_000 {
+		return
+	}
+	a.clients = map[string]*authFailures{}
+}
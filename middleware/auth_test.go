@@ -8,6 +8,12 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/cry"
+	"github.com/komuw/ong/id"
+	"github.com/komuw/ong/internal/tst"
 
 	"go.akshayshah.org/attest"
 )
@@ -23,14 +29,14 @@ func TestBasicAuth(t *testing.T) {
 
 	{
 		// small passwd errors.
-		_, err := BasicAuth(protectedHandler("hello"), "user", strings.Repeat("a", 8))
+		_, err := BasicAuth(protectedHandler("hello"), "user", strings.Repeat("a", 8), nil)
 		attest.Error(t, err)
 	}
 
 	msg := "hello"
 	user := "some-user"
 	passwd := "some-long-p1sswd"
-	wrappedHandler, errA := BasicAuth(protectedHandler(msg), user, passwd)
+	wrappedHandler, errA := BasicAuth(protectedHandler(msg), user, passwd, nil)
 	attest.Ok(t, errA)
 
 	tests := []struct {
@@ -84,12 +90,54 @@ func TestBasicAuth(t *testing.T) {
 		})
 	}
 
+	t.Run("rejection", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req.SetBasicAuth(user, "fakePasswd")
+		wrappedHandler.ServeHTTP(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+
+		rb, err := io.ReadAll(res.Body)
+		attest.Ok(t, err)
+		attest.Equal(t, res.StatusCode, http.StatusUnauthorized)
+		attest.Equal(t, res.Header.Get(authHeader), "Basic realm=enter username and password")
+		attest.Equal(t, res.Header.Get(ctHeader), problemContentType)
+		attest.Subsequence(t, string(rb), "Authentication is required.")
+		attest.False(t, strings.Contains(string(rb), "ong/"))
+		attest.Zero(t, res.Header.Get(ongMiddlewareErrorHeader))
+	})
+
+	t.Run("custom reject func", func(t *testing.T) {
+		t.Parallel()
+
+		var got config.Rejection
+		rf := func(w http.ResponseWriter, r *http.Request, rj config.Rejection) {
+			got = rj
+			w.WriteHeader(rj.Status)
+		}
+		h, err := BasicAuth(protectedHandler(msg), user, passwd, rf)
+		attest.Ok(t, err)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/someUri", nil))
+
+		res := rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusUnauthorized)
+		attest.Equal(t, got.Kind, config.RejectionAuth)
+		attest.ErrorIs(t, got.Reason, ErrNoCredentials)
+	})
+
 	t.Run("concurrency safe", func(t *testing.T) {
 		t.Parallel()
 
 		// for this concurrency test, we have to re-use the same newWrappedHandler
 		// so that state is shared and thus we can see if there is any state which is not handled correctly.
-		newWrappedHandler, err := BasicAuth(protectedHandler(msg), user, passwd)
+		newWrappedHandler, err := BasicAuth(protectedHandler(msg), user, passwd, nil)
 		attest.Ok(t, err)
 
 		runhandler := func() {
@@ -119,3 +167,347 @@ func TestBasicAuth(t *testing.T) {
 		wg.Wait()
 	})
 }
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	msg := "hello"
+	user, passwd := "some-user", "some-long-p1sswd"
+	token, apiKey := "some-bearer-token", "some-api-key"
+
+	hasher, err := cry.NewHasher(1, 1024, 1)
+	attest.Ok(t, err)
+	basic, err := NewBasicAuthenticator(
+		map[string]string{
+			user:    cry.Hash(passwd),
+			"other": cry.Hash("other-passwd"),
+			"phc":   hasher.Hash(passwd), // argon2id in the PHC string format.
+		},
+		hasher,
+	)
+	attest.Ok(t, err)
+	bearer, err := NewBearerAuthenticator(map[string]string{HashKey(token): "service-a"})
+	attest.Ok(t, err)
+	apiKeys, err := NewAPIKeyAuthenticator("", "api_key", map[string]string{HashKey(apiKey): "service-b"})
+	attest.Ok(t, err)
+
+	principalHandler := func() http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			p, ok := GetPrincipal(r.Context())
+			if !ok {
+				panic("no principal")
+			}
+			fmt.Fprint(w, p.Scheme+":"+p.ID)
+		}
+	}
+
+	send := func(h http.Handler, modify func(r *http.Request)) *http.Response {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req.RemoteAddr = fmt.Sprintf("%s:80", id.Random(8)) // each request is from a different client.
+		if modify != nil {
+			modify(req)
+		}
+		h.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+
+	t.Run("constructors", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewBasicAuthenticator(nil, nil)
+		attest.Error(t, err)
+		_, err = NewBasicAuthenticator(map[string]string{user: passwd}, nil)
+		attest.Error(t, err)
+		_, err = NewBasicAuthenticator(map[string]string{"a:b": cry.Hash(passwd)}, nil)
+		attest.Error(t, err)
+		_, err = NewBasicAuthenticator(map[string]string{user: cry.Hash(passwd)}, nil)
+		attest.Ok(t, err)
+		_, err = NewBearerAuthenticator(map[string]string{token: "service-a"})
+		attest.Error(t, err)
+		_, err = NewAPIKeyAuthenticator("", "", nil)
+		attest.Error(t, err)
+	})
+
+	tests := []struct {
+		name      string
+		modify    func(r *http.Request)
+		wantCode  int
+		wantBody  string
+		challenge bool
+	}{
+		{
+			name:      "no credentials",
+			wantCode:  http.StatusUnauthorized,
+			challenge: true,
+		},
+		{
+			name:     "basic",
+			modify:   func(r *http.Request) { r.SetBasicAuth(user, passwd) },
+			wantCode: http.StatusOK,
+			wantBody: "Basic:" + user,
+		},
+		{
+			name:     "basic phc hash",
+			modify:   func(r *http.Request) { r.SetBasicAuth("phc", passwd) },
+			wantCode: http.StatusOK,
+			wantBody: "Basic:phc",
+		},
+		{
+			name:      "basic phc hash wrong password",
+			modify:    func(r *http.Request) { r.SetBasicAuth("phc", "other-passwd") },
+			wantCode:  http.StatusUnauthorized,
+			challenge: true,
+		},
+		{
+			name:      "basic wrong password",
+			modify:    func(r *http.Request) { r.SetBasicAuth(user, "other-passwd") },
+			wantCode:  http.StatusUnauthorized,
+			challenge: true,
+		},
+		{
+			name:      "basic unknown user",
+			modify:    func(r *http.Request) { r.SetBasicAuth("unknown", passwd) },
+			wantCode:  http.StatusUnauthorized,
+			challenge: true,
+		},
+		{
+			name:     "bearer",
+			modify:   func(r *http.Request) { r.Header.Set(authorizationHeader, "Bearer "+token) },
+			wantCode: http.StatusOK,
+			wantBody: "Bearer:service-a",
+		},
+		{
+			name:      "bearer invalid",
+			modify:    func(r *http.Request) { r.Header.Set(authorizationHeader, "Bearer "+apiKey) },
+			wantCode:  http.StatusUnauthorized,
+			challenge: true,
+		},
+		{
+			name:     "api key header",
+			modify:   func(r *http.Request) { r.Header.Set(defaultAPIKeyHeader, apiKey) },
+			wantCode: http.StatusOK,
+			wantBody: "ApiKey:service-b",
+		},
+		{
+			name:     "api key query",
+			modify:   func(r *http.Request) { r.URL.RawQuery = "api_key=" + apiKey },
+			wantCode: http.StatusOK,
+			wantBody: "ApiKey:service-b",
+		},
+		{
+			name:      "api key invalid",
+			modify:    func(r *http.Request) { r.Header.Set(defaultAPIKeyHeader, token) },
+			wantCode:  http.StatusUnauthorized,
+			challenge: true,
+		},
+	}
+
+	wrappedHandler := Authenticate(principalHandler(), nil, basic, bearer, apiKeys)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			res := send(wrappedHandler, tt.modify)
+			defer res.Body.Close()
+			rb, err := io.ReadAll(res.Body)
+			attest.Ok(t, err)
+
+			attest.Equal(t, res.StatusCode, tt.wantCode)
+			if tt.wantBody != "" {
+				attest.Equal(t, string(rb), tt.wantBody)
+			}
+			if tt.wantCode == http.StatusUnauthorized {
+				// Internal errors are not sent to the client.
+				attest.Equal(t, res.Header.Get(ctHeader), problemContentType)
+				attest.False(t, strings.Contains(string(rb), "ong/"))
+				attest.Zero(t, res.Header.Get(ongMiddlewareErrorHeader))
+			}
+			if tt.challenge {
+				attest.Equal(t, res.Header.Values(authHeader), []string{`Basic realm="enter username and password", charset="UTF-8"`, `Bearer realm="api"`})
+			}
+		})
+	}
+
+	t.Run("throttled", func(t *testing.T) {
+		t.Parallel()
+
+		h := Authenticate(protectedHandler(msg), nil, bearer)
+		fromClient := func(auth string) func(r *http.Request) {
+			return func(r *http.Request) {
+				r.RemoteAddr = "1.2.3.4:80"
+				r.Header.Set(authorizationHeader, auth)
+			}
+		}
+
+		res := send(h, fromClient("Bearer wrong"))
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusUnauthorized)
+
+		// Even valid credentials are rejected while throttled.
+		res = send(h, fromClient("Bearer "+token))
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusTooManyRequests)
+		attest.Equal(t, res.Header.Get(retryAfterHeader), "1")
+		rb, err := io.ReadAll(res.Body)
+		attest.Ok(t, err)
+		attest.Subsequence(t, string(rb), "Too many failed authentication attempts")
+		attest.False(t, strings.Contains(string(rb), "ong/"))
+
+		time.Sleep(1100 * time.Millisecond)
+		res = send(h, fromClient("Bearer wrong"))
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusUnauthorized)
+
+		// The delay has doubled.
+		res = send(h, fromClient("Bearer "+token))
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusTooManyRequests)
+		attest.Equal(t, res.Header.Get(retryAfterHeader), "2")
+
+		// Other clients are not affected.
+		res = send(h, func(r *http.Request) { r.Header.Set(authorizationHeader, "Bearer "+token) })
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusOK)
+	})
+
+	t.Run("custom reject func", func(t *testing.T) {
+		t.Parallel()
+
+		kinds := []config.RejectionKind{}
+		rf := func(w http.ResponseWriter, r *http.Request, rj config.Rejection) {
+			kinds = append(kinds, rj.Kind)
+			w.WriteHeader(rj.Status)
+		}
+		h := Authenticate(protectedHandler(msg), rf, bearer)
+		fromClient := func(auth string) func(r *http.Request) {
+			return func(r *http.Request) {
+				r.RemoteAddr = "5.6.7.8:80"
+				r.Header.Set(authorizationHeader, auth)
+			}
+		}
+
+		res := send(h, fromClient("Bearer wrong"))
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusUnauthorized)
+		attest.Equal(t, res.Header.Values(authHeader), []string{`Bearer realm="api"`})
+
+		res = send(h, fromClient("Bearer "+token))
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusTooManyRequests)
+		attest.Equal(t, kinds, []config.RejectionKind{config.RejectionAuth, config.RejectionThrottle})
+	})
+
+	t.Run("principal is logged", func(t *testing.T) {
+		t.Parallel()
+
+		var fields []any
+		h := logger(
+			Authenticate(protectedHandler(msg), nil, bearer),
+			func(_ http.Request, _ http.Header, _ int, flds []any) { fields = flds },
+			nil,
+		)
+
+		res := send(h, func(r *http.Request) { r.Header.Set(authorizationHeader, "Bearer "+token) })
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusOK)
+		attest.Subsequence(t, fmt.Sprint(fields), principalLogField+" Bearer:service-a")
+	})
+}
+
+func TestVerifyToken(t *testing.T) {
+	t.Parallel()
+
+	k, err := cry.LocalTokenKey("k1", tst.SecretKey())
+	attest.Ok(t, err)
+	v, err := cry.NewTokenVerifier("ong", "", time.Second, k)
+	attest.Ok(t, err)
+
+	claimsHandler := func() http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			c, ok := GetClaims(r.Context())
+			if !ok {
+				panic("no claims")
+			}
+			fmt.Fprint(w, c.Subject+":"+fmt.Sprint(c.Custom["role"]))
+		}
+	}
+
+	send := func(h http.Handler, authorization string) *http.Response {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req.RemoteAddr = fmt.Sprintf("%s:80", id.Random(8))
+		if authorization != "" {
+			req.Header.Set(authorizationHeader, authorization)
+		}
+		h.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+
+	t.Run("nil verifier", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := VerifyToken(claimsHandler(), nil, nil)
+		attest.Error(t, err)
+	})
+
+	t.Run("valid token", func(t *testing.T) {
+		t.Parallel()
+
+		token, err := cry.IssueToken(k, cry.Claims{Issuer: "ong", Subject: "user-1", Expiry: time.Now().Add(time.Minute), Custom: map[string]any{"role": "admin"}})
+		attest.Ok(t, err)
+
+		h, err := VerifyToken(claimsHandler(), v, nil)
+		attest.Ok(t, err)
+		res := send(h, "Bearer "+token)
+		defer res.Body.Close()
+
+		rb, err := io.ReadAll(res.Body)
+		attest.Ok(t, err)
+		attest.Equal(t, res.StatusCode, http.StatusOK)
+		attest.Equal(t, string(rb), "user-1:admin")
+	})
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		t.Parallel()
+
+		expired, err := cry.IssueToken(k, cry.Claims{Issuer: "ong", Expiry: time.Now().Add(-time.Minute)})
+		attest.Ok(t, err)
+		wrongIssuer, err := cry.IssueToken(k, cry.Claims{Issuer: "evil", Expiry: time.Now().Add(time.Minute)})
+		attest.Ok(t, err)
+
+		h, err := VerifyToken(claimsHandler(), v, nil)
+		attest.Ok(t, err)
+		for _, authz := range []string{"", "Bearer " + expired, "Bearer " + wrongIssuer, "Bearer ong.v1.local.k1.garbage"} {
+			res := send(h, authz)
+			defer res.Body.Close()
+			attest.Equal(t, res.StatusCode, http.StatusUnauthorized, attest.Sprintf("authorization: %s", authz))
+			attest.Equal(t, res.Header.Get(authHeader), `Bearer realm="api"`)
+		}
+	})
+
+	t.Run("combined with opaque bearer tokens", func(t *testing.T) {
+		t.Parallel()
+
+		ta, err := NewTokenAuthenticator(v)
+		attest.Ok(t, err)
+		bearer, err := NewBearerAuthenticator(map[string]string{HashKey("opaque-token"): "service-a"})
+		attest.Ok(t, err)
+
+		h := Authenticate(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				p, _ := GetPrincipal(r.Context())
+				_, hasClaims := GetClaims(r.Context())
+				fmt.Fprintf(w, "%s %v", p.ID, hasClaims)
+			}),
+			nil, ta, bearer,
+		)
+
+		res := send(h, "Bearer opaque-token")
+		defer res.Body.Close()
+		rb, err := io.ReadAll(res.Body)
+		attest.Ok(t, err)
+		attest.Equal(t, res.StatusCode, http.StatusOK)
+		attest.Equal(t, string(rb), "service-a false")
+	})
+}
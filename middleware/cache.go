@@ -0,0 +1,705 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Some of the code here is inspired by:
+//   (a) https://www.rfc-editor.org/rfc/rfc9111 (HTTP Caching)
+//   (b) https://www.rfc-editor.org/rfc/rfc9110#name-conditional-requests
+//   (c) https://www.rfc-editor.org/rfc/rfc5861 (stale-while-revalidate)
+//   (d) https://www.rfc-editor.org/rfc/rfc9211 (Cache-Status)
+
+const (
+	// DefaultCacheSize is the maximum number of bytes that a [CacheStore] holds, by default.
+	DefaultCacheSize = 32 * 1024 * 1024 // 32MB
+
+	cacheControlHeader    = "Cache-Control"
+	cacheStatusHeader     = "Cache-Status"
+	ageHeader             = "Age"
+	etagHeader            = "ETag"
+	lastModifiedHeader    = "Last-Modified"
+	ifNoneMatchHeader     = "If-None-Match"
+	ifModifiedSinceHeader = "If-Modified-Since"
+	cacheStatusName       = "ong"
+)
+
+// Cache is a middleware that caches responses to http GET and HEAD requests in memory.
+//
+// It follows the semantics of [RFC 9111] for a shared cache:
+//   - Only responses with an explicit freshness lifetime, via the `s-maxage` or `max-age` Cache-Control directives, are stored.
+//     Responses that are `private`, `no-store`, `no-cache` or that set cookies are not.
+//     Neither are responses whose body contains the csp nonce of the request, see [GetCspNonce], since each response gets a new nonce.
+//   - Stale responses are served for the duration of the `stale-while-revalidate` directive, while being refreshed in the background.
+//   - The `Vary` response header is obeyed, including on `Cookie` which is added by the csrf middleware.
+//   - Requests with `Cache-Control: no-cache` or `no-store` bypass the cache.
+//
+// Additionally, responses get an ETag computed automatically from their body(if they did not set one) and conditional requests,
+// using `If-None-Match` or `If-Modified-Since`, are answered with a http 304(Not Modified).
+//
+// If store is nil, a [CacheStore] of size [DefaultCacheSize] is used.
+//
+// [RFC 9111]: https://www.rfc-editor.org/rfc/rfc9111
+func Cache(wrappedHandler http.Handler, store *CacheStore) http.HandlerFunc {
+	if store == nil {
+		store = NewCacheStore(DefaultCacheSize)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			wrappedHandler.ServeHTTP(w, r)
+			return
+		}
+
+		reqCC := parseCacheControl(r.Header.Values(cacheControlHeader))
+		if _, ok := reqCC["no-store"]; ok {
+			wrappedHandler.ServeHTTP(w, r)
+			return
+		}
+
+		key := cacheKey(r)
+		_, noCache := reqCC["no-cache"]
+		if maxAge, ok := reqCC["max-age"]; ok && maxAge == "0" {
+			noCache = true
+		}
+
+		if !noCache {
+			if e, stale := store.get(key, r); e != nil {
+				if stale {
+					store.stale.Add(1)
+					store.revalidate(e, wrappedHandler, r)
+				} else {
+					store.hits.Add(1)
+				}
+				e.serve(w, r, stale)
+				return
+			}
+		}
+		store.misses.Add(1)
+
+		if r.Method == http.MethodHead {
+			// We do not have the body of a HEAD response, so we cannot store it.
+			wrappedHandler.ServeHTTP(w, r)
+			return
+		}
+
+		crw := newCacheRW(w, store.maxEntrySize())
+		wrappedHandler.ServeHTTP(crw, r)
+		if crw.passthrough {
+			// The response has already been sent.
+			return
+		}
+
+		e := crw.entry()
+		if store.put(key, r, e) {
+			w.Header().Set(cacheStatusHeader, cacheStatusName+"; fwd=miss; stored")
+		} else {
+			w.Header().Set(cacheStatusHeader, cacheStatusName+"; fwd=miss")
+		}
+		crw.finish(r, e)
+	}
+}
+
+// CacheStats are the counters of a [CacheStore].
+type CacheStats struct {
+	// Hits is the number of requests that were served fresh responses from the cache.
+	Hits uint64
+	// Stale is the number of requests that were served stale responses from the cache, while they were being revalidated.
+	Stale uint64
+	// Misses is the number of requests that could not be served from the cache.
+	Misses uint64
+	// Entries is the number of responses in the cache.
+	Entries int
+	// Bytes is the approximate size in bytes of the responses in the cache.
+	Bytes int64
+}
+
+// CacheStore is a bounded-memory, least recently used(LRU), store of http responses used by [Cache].
+//
+// Use [NewCacheStore] to get a valid CacheStore.
+type CacheStore struct {
+	maxBytes int64
+
+	hits   atomic.Uint64
+	stale  atomic.Uint64
+	misses atomic.Uint64
+
+	mu sync.Mutex // protects all the fields below.
+	// +checklocks:mu
+	bytes int64
+	// +checklocks:mu
+	lru *list.List // of *cacheEntry, most recently used at the front.
+	// +checklocks:mu
+	entries map[string]*list.Element
+	// vary holds, for each primary key, the request header names that its responses vary on.
+	// +checklocks:mu
+	vary map[string]*cacheVariants
+}
+
+// cacheVariants are the responses that are stored for a primary cache key.
+type cacheVariants struct {
+	// names are the request header names that the responses vary on.
+	names []string
+	// count is the number of responses stored. The variants are removed once it drops to zero.
+	count int
+}
+
+// NewCacheStore returns a [CacheStore] that holds upto maxBytes of responses.
+// If maxBytes is less than 1, [DefaultCacheSize] is used instead.
+func NewCacheStore(maxBytes int64) *CacheStore {
+	if maxBytes < 1 {
+		maxBytes = DefaultCacheSize
+	}
+	return &CacheStore{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		vary:     map[string]*cacheVariants{},
+	}
+}
+
+// Stats returns the counters of the store.
+func (s *CacheStore) Stats() CacheStats {
+	s.mu.Lock()
+	entries, b := len(s.entries), s.bytes
+	s.mu.Unlock()
+
+	return CacheStats{
+		Hits:    s.hits.Load(),
+		Stale:   s.stale.Load(),
+		Misses:  s.misses.Load(),
+		Entries: entries,
+		Bytes:   b,
+	}
+}
+
+// maxEntrySize is the largest response body that will be stored.
+func (s *CacheStore) maxEntrySize() int {
+	return int(s.maxBytes / 8)
+}
+
+// get returns the entry for request r, if any, and whether it is stale.
+func (s *CacheStore) get(key string, r *http.Request) (*cacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.vary[key]
+	if !ok {
+		return nil, false
+	}
+
+	el, ok := s.entries[variantKey(key, v.names, r)]
+	if !ok {
+		return nil, false
+	}
+	e, _ := el.Value.(*cacheEntry)
+
+	age := time.Since(e.storedAt)
+	if age <= e.freshFor {
+		s.lru.MoveToFront(el)
+		return e, false
+	}
+	if age <= e.freshFor+e.staleFor {
+		s.lru.MoveToFront(el)
+		return e, true
+	}
+
+	// expired.
+	s.remove(el)
+	return nil, false
+}
+
+// put stores the entry e for request r, if it is storable.
+func (s *CacheStore) put(key string, r *http.Request, e *cacheEntry) bool {
+	if !e.storable(r) {
+		return false
+	}
+
+	names := e.varyNames()
+	if slices.Contains(names, "*") {
+		return false
+	}
+
+	size := e.size()
+	if size > int64(s.maxEntrySize()) {
+		return false
+	}
+	e.primaryKey = key
+	e.key = variantKey(key, names, r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.entries[e.key]; ok {
+		s.remove(old)
+	}
+	if old, ok := s.vary[key]; ok && !slices.Equal(old.names, names) {
+		// The resource now varies differently, the old variants are useless.
+		for k, el := range s.entries {
+			if strings.HasPrefix(k, key+"\x00") {
+				s.remove(el)
+			}
+		}
+	}
+
+	v, ok := s.vary[key]
+	if !ok {
+		v = &cacheVariants{names: names}
+		s.vary[key] = v
+	}
+	v.count = v.count + 1
+	s.entries[e.key] = s.lru.PushFront(e)
+	s.bytes = s.bytes + size
+
+	for s.bytes > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+
+	return true
+}
+
+// remove is a private api(thus needs no locking). It should only be called by methods that already hold the lock.
+// +checklocksignore
+func (s *CacheStore) remove(el *list.Element) {
+	e, _ := s.lru.Remove(el).(*cacheEntry)
+	delete(s.entries, e.key)
+	s.bytes = s.bytes - e.size()
+
+	if v, ok := s.vary[e.primaryKey]; ok {
+		v.count = v.count - 1
+		if v.count <= 0 {
+			delete(s.vary, e.primaryKey)
+		}
+	}
+}
+
+// revalidate refreshes the entry e in the background.
+// Only one revalidation per entry is in flight at any one time.
+func (s *CacheStore) revalidate(e *cacheEntry, wrappedHandler http.Handler, r *http.Request) {
+	if !e.revalidating.CompareAndSwap(false, true) {
+		return
+	}
+
+	req := r.Clone(context.WithoutCancel(r.Context()))
+	req.Method = http.MethodGet
+	req.Header.Del(ifNoneMatchHeader)
+	req.Header.Del(ifModifiedSinceHeader)
+	key := cacheKey(req)
+
+	go func() {
+		defer e.revalidating.Store(false)
+
+		rec := &cacheRecorder{header: http.Header{}}
+		crw := newCacheRW(rec, s.maxEntrySize())
+		wrappedHandler.ServeHTTP(crw, req)
+		if crw.passthrough {
+			return
+		}
+		_ = s.put(key, req, crw.entry())
+	}()
+}
+
+// cacheEntry is a stored http response.
+type cacheEntry struct {
+	primaryKey   string
+	key          string
+	code         int
+	header       http.Header
+	body         []byte
+	storedAt     time.Time
+	lastModified time.Time
+	freshFor     time.Duration
+	staleFor     time.Duration
+	cc           map[string]string // response Cache-Control directives.
+	revalidating atomic.Bool
+}
+
+func (e *cacheEntry) size() int64 {
+	n := len(e.key) + len(e.body)
+	for k, v := range e.header {
+		n = n + len(k)
+		for _, vv := range v {
+			n = n + len(vv)
+		}
+	}
+	return int64(n)
+}
+
+func (e *cacheEntry) varyNames() []string {
+	names := []string{}
+	for _, v := range e.header.Values(varyHeader) {
+		for _, n := range strings.Split(v, ",") {
+			n = http.CanonicalHeaderKey(strings.TrimSpace(n))
+			if n != "" && !slices.Contains(names, n) {
+				names = append(names, n)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// storable reports whether the response can be stored by a shared cache.
+// See: https://www.rfc-editor.org/rfc/rfc9111#section-3
+func (e *cacheEntry) storable(r *http.Request) bool {
+	// status codes that are heuristically cacheable: https://www.rfc-editor.org/rfc/rfc9110#section-15.1
+	cacheable := []int{200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501}
+	if !slices.Contains(cacheable, e.code) {
+		return false
+	}
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := e.cc[d]; ok {
+			return false
+		}
+	}
+	if len(e.header.Values(setCookieHeader)) > 0 {
+		return false
+	}
+	if nonce := GetCspNonce(r.Context()); nonce != "" && bytes.Contains(e.body, []byte(nonce)) {
+		// The csp middleware sends a new nonce with each response, which would not match the nonce in a cached body.
+		// Thus, pages that use the nonce(eg in their script tags) are never cached.
+		return false
+	}
+	if e.freshFor <= 0 {
+		// We only store responses with explicit freshness.
+		return false
+	}
+
+	if r.Header.Get(authorizationHeader) != "" {
+		// https://www.rfc-editor.org/rfc/rfc9111#section-3.5
+		_, public := e.cc["public"]
+		_, sMaxAge := e.cc["s-maxage"]
+		_, mustRevalidate := e.cc["must-revalidate"]
+		if !public && !sMaxAge && !mustRevalidate {
+			return false
+		}
+	}
+
+	return true
+}
+
+// serve writes the entry to w, answering conditional requests.
+func (e *cacheEntry) serve(w http.ResponseWriter, r *http.Request, stale bool) {
+	maps.Copy(w.Header(), e.header)
+	w.Header().Set(ageHeader, strconv.Itoa(int(time.Since(e.storedAt).Seconds())))
+	if stale {
+		w.Header().Set(cacheStatusHeader, cacheStatusName+"; hit; fwd=stale")
+	} else {
+		w.Header().Set(cacheStatusHeader, cacheStatusName+"; hit")
+	}
+
+	if notModified(r, e) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(e.code)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(e.body)
+	}
+}
+
+// notModified reports whether the conditional request r can be answered with a http 304.
+// See: https://www.rfc-editor.org/rfc/rfc9110#section-13.2.2
+func notModified(r *http.Request, e *cacheEntry) bool {
+	if e.code != http.StatusOK {
+		return false
+	}
+
+	if inm := r.Header.Get(ifNoneMatchHeader); inm != "" {
+		etag := e.header.Get(etagHeader)
+		if etag == "" {
+			return false
+		}
+		for _, t := range strings.Split(inm, ",") {
+			t = strings.TrimSpace(t)
+			// If-None-Match uses the weak comparison function.
+			if t == "*" || strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get(ifModifiedSinceHeader); ims != "" {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		return !e.lastModified.Truncate(time.Second).After(t)
+	}
+
+	return false
+}
+
+// cacheKey returns the primary cache key of r.
+func cacheKey(r *http.Request) string {
+	return r.Host + r.URL.RequestURI()
+}
+
+// variantKey returns the key of the response to r, given the request header names that the response varies on.
+func variantKey(key string, names []string, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	b.WriteString("\x00")
+	for _, n := range names {
+		b.WriteString(n)
+		b.WriteString(":")
+		b.WriteString(strings.Join(r.Header.Values(n), ","))
+		b.WriteString("\x00")
+	}
+	return b.String()
+}
+
+// parseCacheControl parses Cache-Control directives.
+// Directive names are lowercased and quotes are stripped from values.
+func parseCacheControl(headers []string) map[string]string {
+	cc := map[string]string{}
+	for _, h := range headers {
+		for _, d := range strings.Split(h, ",") {
+			d = strings.TrimSpace(d)
+			if d == "" {
+				continue
+			}
+			name, val, _ := strings.Cut(d, "=")
+			cc[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(val), `"`)
+		}
+	}
+	return cc
+}
+
+func ccSeconds(cc map[string]string, directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// etagOf computes a strong ETag from body.
+func etagOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// cacheRW provides an http.ResponseWriter interface, which buffers the response so that it can be cached.
+//
+// If the response grows larger than limit, or is streamed, buffering stops and the response is passed through.
+type cacheRW struct {
+	http.ResponseWriter
+	// initialHeader is the header as it was before the wrapped handler was called.
+	// It is used to only store the headers that were set by the wrapped handler.
+	initialHeader http.Header
+	code          int
+	body          bytes.Buffer
+	limit         int
+	passthrough   bool
+}
+
+var (
+	// make sure we support http optional interfaces.
+	// https://github.com/komuw/ong/issues/15
+	// https://blog.merovius.de/2017/07/30/the-trouble-with-optional-interfaces.html
+	_ http.ResponseWriter = &cacheRW{}
+	_ http.Flusher        = &cacheRW{}
+	_ http.Hijacker       = &cacheRW{}
+	_ http.Pusher         = &cacheRW{}
+	_ io.ReaderFrom       = &cacheRW{}
+	_ httpRespCtrler      = &cacheRW{}
+)
+
+func newCacheRW(w http.ResponseWriter, limit int) *cacheRW {
+	return &cacheRW{
+		ResponseWriter: w,
+		initialHeader:  w.Header().Clone(),
+		limit:          limit,
+	}
+}
+
+// WriteHeader records the status code.
+func (crw *cacheRW) WriteHeader(statusCode int) {
+	if crw.passthrough {
+		crw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if crw.code == 0 {
+		crw.code = statusCode
+	}
+}
+
+// Write buffers the body.
+func (crw *cacheRW) Write(b []byte) (int, error) {
+	if crw.code == 0 {
+		crw.code = http.StatusOK
+	}
+	if crw.passthrough {
+		return crw.ResponseWriter.Write(b)
+	}
+	if crw.body.Len()+len(b) > crw.limit {
+		if err := crw.startPassthrough(); err != nil {
+			return 0, err
+		}
+		return crw.ResponseWriter.Write(b)
+	}
+	return crw.body.Write(b)
+}
+
+// startPassthrough sends what has been buffered so far and stops buffering.
+func (crw *cacheRW) startPassthrough() error {
+	if crw.passthrough {
+		return nil
+	}
+	crw.passthrough = true
+	if crw.code == 0 {
+		crw.code = http.StatusOK
+	}
+	crw.ResponseWriter.WriteHeader(crw.code)
+	_, err := crw.ResponseWriter.Write(crw.body.Bytes())
+	crw.body.Reset()
+	return err
+}
+
+// entry returns the buffered response as a cacheEntry.
+func (crw *cacheRW) entry() *cacheEntry {
+	now := time.Now()
+	code := crw.code
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	h := http.Header{}
+	for k, v := range crw.Header() {
+		if k == ongMiddlewareErrorHeader || k == cacheStatusHeader {
+			continue
+		}
+		if k == varyHeader {
+			// Vary is also set by other middlewares(eg csrf) and needs to be kept.
+			h[k] = slices.Clone(v)
+			continue
+		}
+		if old, ok := crw.initialHeader[k]; ok && slices.Equal(old, v) {
+			continue
+		}
+		h[k] = slices.Clone(v)
+	}
+
+	if code == http.StatusOK && h.Get(etagHeader) == "" {
+		h.Set(etagHeader, etagOf(crw.body.Bytes()))
+		crw.Header().Set(etagHeader, h.Get(etagHeader))
+	}
+
+	lastModified := now
+	if lm := h.Get(lastModifiedHeader); lm != "" {
+		if t, err := http.ParseTime(lm); err == nil {
+			lastModified = t
+		}
+	}
+
+	cc := parseCacheControl(h.Values(cacheControlHeader))
+	// This is a shared cache, so s-maxage takes precedence over max-age.
+	// https://www.rfc-editor.org/rfc/rfc9111#section-5.2.2.10
+	freshFor, ok := ccSeconds(cc, "s-maxage")
+	if !ok {
+		freshFor, _ = ccSeconds(cc, "max-age")
+	}
+	staleFor, _ := ccSeconds(cc, "stale-while-revalidate")
+	_, mustRevalidate := cc["must-revalidate"]
+	_, proxyRevalidate := cc["proxy-revalidate"]
+	if mustRevalidate || proxyRevalidate {
+		staleFor = 0
+	}
+
+	return &cacheEntry{
+		code:         code,
+		header:       h,
+		body:         slices.Clone(crw.body.Bytes()),
+		storedAt:     now,
+		lastModified: lastModified,
+		freshFor:     freshFor,
+		staleFor:     staleFor,
+		cc:           cc,
+	}
+}
+
+// finish writes the buffered response, answering conditional requests.
+func (crw *cacheRW) finish(r *http.Request, e *cacheEntry) {
+	if notModified(r, e) {
+		crw.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	crw.ResponseWriter.WriteHeader(e.code)
+	_, _ = crw.ResponseWriter.Write(crw.body.Bytes())
+}
+
+// Flush implements http.Flusher
+func (crw *cacheRW) Flush() {
+	// Streamed responses are not cached.
+	_ = crw.startPassthrough()
+	if fw, ok := crw.ResponseWriter.(http.Flusher); ok {
+		fw.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker
+func (crw *cacheRW) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	crw.passthrough = true
+	if hj, ok := crw.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, fmt.Errorf("ong/middleware/cache: http.Hijacker interface is not supported")
+}
+
+// Push implements http.Pusher
+func (crw *cacheRW) Push(target string, opts *http.PushOptions) error {
+	if p, ok := crw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return fmt.Errorf("ong/middleware/cache: http.Pusher interface is not supported")
+}
+
+// ReadFrom implements io.ReaderFrom
+// It is necessary for the sendfile syscall
+// https://github.com/caddyserver/caddy/pull/5022
+// https://github.com/caddyserver/caddy/blob/v2.7.4/modules/caddyhttp/responsewriter.go#L45-L49
+func (crw *cacheRW) ReadFrom(src io.Reader) (n int64, err error) {
+	// Go through Write so that the body is buffered.
+	return io.Copy(struct{ io.Writer }{crw}, src)
+}
+
+// Unwrap implements http.ResponseController.
+// It returns the underlying ResponseWriter,
+// which is necessary for http.ResponseController to work correctly.
+func (crw *cacheRW) Unwrap() http.ResponseWriter {
+	// Since the caller is going to interact with the underlying writer directly, stop buffering.
+	_ = crw.startPassthrough()
+	return crw.ResponseWriter
+}
+
+// cacheRecorder is a minimal http.ResponseWriter used for background revalidation.
+type cacheRecorder struct {
+	header http.Header
+}
+
+func (c *cacheRecorder) Header() http.Header         { return c.header }
+func (c *cacheRecorder) Write(b []byte) (int, error) { return len(b), nil }
+func (c *cacheRecorder) WriteHeader(int)             {}
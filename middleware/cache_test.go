@@ -0,0 +1,423 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.akshayshah.org/attest"
+)
+
+func someCacheHandler(count *atomic.Int64, cacheControl string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := count.Add(1)
+		if cacheControl != "" {
+			w.Header().Set(cacheControlHeader, cacheControl)
+		}
+		fmt.Fprintf(w, "hello %d", n)
+	}
+}
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	send := func(h http.Handler, method string, hdrs ...string) (*http.Response, string) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/someUri", nil)
+		for i := 0; i+1 < len(hdrs); i = i + 2 {
+			req.Header.Add(hdrs[i], hdrs[i+1])
+		}
+		h.ServeHTTP(rec, req)
+		res := rec.Result()
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		return res, string(b)
+	}
+
+	t.Run("caches fresh responses", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		store := NewCacheStore(DefaultCacheSize)
+		wrappedHandler := Cache(someCacheHandler(count, "max-age=60"), store)
+
+		for i := 0; i < 4; i++ {
+			res, body := send(wrappedHandler, http.MethodGet)
+			attest.Equal(t, res.StatusCode, http.StatusOK)
+			attest.Equal(t, body, "hello 1")
+			attest.NotZero(t, res.Header.Get(etagHeader))
+			if i == 0 {
+				attest.Subsequence(t, res.Header.Get(cacheStatusHeader), "fwd=miss; stored")
+			} else {
+				attest.Equal(t, res.Header.Get(cacheStatusHeader), "ong; hit")
+				attest.Equal(t, res.Header.Get(ageHeader), "0")
+			}
+		}
+		attest.Equal(t, count.Load(), 1)
+
+		stats := store.Stats()
+		attest.Equal(t, stats.Hits, 3)
+		attest.Equal(t, stats.Misses, 1)
+		attest.Equal(t, stats.Entries, 1)
+		attest.True(t, stats.Bytes > 0)
+	})
+
+	t.Run("uncacheable responses", func(t *testing.T) {
+		t.Parallel()
+
+		for _, cc := range []string{"", "no-store", "private, max-age=60", "no-cache, max-age=60", "max-age=0"} {
+			count := &atomic.Int64{}
+			wrappedHandler := Cache(someCacheHandler(count, cc), nil)
+
+			for i := 0; i < 3; i++ {
+				res, _ := send(wrappedHandler, http.MethodGet)
+				attest.Equal(t, res.StatusCode, http.StatusOK)
+			}
+			attest.Equal(t, count.Load(), 3, attest.Sprintf("cache-control: %s", cc))
+		}
+	})
+
+	t.Run("set-cookie is not cached", func(t *testing.T) {
+		t.Parallel()
+
+		count := 0
+		wrappedHandler := Cache(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				count = count + 1
+				w.Header().Set(cacheControlHeader, "max-age=60")
+				http.SetCookie(w, &http.Cookie{Name: "name", Value: "value"})
+			}),
+			nil,
+		)
+
+		for i := 0; i < 2; i++ {
+			_, _ = send(wrappedHandler, http.MethodGet)
+		}
+		attest.Equal(t, count, 2)
+	})
+
+	t.Run("only headers set by handler are cached", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Cache(someCacheHandler(count, "max-age=60"), nil)
+
+		outer := func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "csrf", Value: fmt.Sprint(time.Now().UnixNano())})
+			w.Header().Add(varyHeader, clientCookieHeader)
+			wrappedHandler.ServeHTTP(w, r)
+		}
+
+		_, _ = send(http.HandlerFunc(outer), http.MethodGet, clientCookieHeader, "a=b")
+		res, body := send(wrappedHandler, http.MethodGet, clientCookieHeader, "a=b")
+		attest.Equal(t, body, "hello 1")
+		attest.Zero(t, res.Header.Get(setCookieHeader))
+		attest.Equal(t, res.Header.Get(varyHeader), clientCookieHeader)
+		attest.Equal(t, count.Load(), 1)
+	})
+
+	t.Run("vary", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Cache(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := count.Add(1)
+				w.Header().Set(cacheControlHeader, "max-age=60")
+				w.Header().Set(varyHeader, "Accept-Language")
+				fmt.Fprintf(w, "%s %d", r.Header.Get("Accept-Language"), n)
+			}),
+			nil,
+		)
+
+		_, body := send(wrappedHandler, http.MethodGet, "Accept-Language", "en")
+		attest.Equal(t, body, "en 1")
+		_, body = send(wrappedHandler, http.MethodGet, "Accept-Language", "fr")
+		attest.Equal(t, body, "fr 2")
+		_, body = send(wrappedHandler, http.MethodGet, "Accept-Language", "en")
+		attest.Equal(t, body, "en 1")
+		_, body = send(wrappedHandler, http.MethodGet, "Accept-Language", "fr")
+		attest.Equal(t, body, "fr 2")
+		attest.Equal(t, count.Load(), 2)
+	})
+
+	t.Run("csp nonce", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Cache(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := count.Add(1)
+				w.Header().Set(cacheControlHeader, "max-age=60")
+				fmt.Fprintf(w, `<script nonce="%s">hello %d</script>`, GetCspNonce(r.Context()), n)
+			}),
+			nil,
+		)
+
+		for i := 0; i < 2; i++ {
+			nonce := fmt.Sprintf("nonce-%d", i)
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+			req = req.WithContext(context.WithValue(req.Context(), cspCtxKey, nonce))
+			wrappedHandler.ServeHTTP(rec, req)
+			res := rec.Result()
+			defer res.Body.Close()
+			b, err := io.ReadAll(res.Body)
+			attest.Ok(t, err)
+			// Each response has the nonce of its own request.
+			attest.Subsequence(t, string(b), nonce)
+		}
+		attest.Equal(t, count.Load(), 2)
+	})
+
+	t.Run("request no-cache", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Cache(someCacheHandler(count, "max-age=60"), nil)
+
+		_, _ = send(wrappedHandler, http.MethodGet)
+		_, body := send(wrappedHandler, http.MethodGet, cacheControlHeader, "no-cache")
+		attest.Equal(t, body, "hello 2")
+		_, body = send(wrappedHandler, http.MethodGet)
+		attest.Equal(t, body, "hello 2")
+		attest.Equal(t, count.Load(), 2)
+	})
+
+	t.Run("conditional requests", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Cache(someCacheHandler(count, "max-age=60"), nil)
+
+		res, _ := send(wrappedHandler, http.MethodGet)
+		etag := res.Header.Get(etagHeader)
+		attest.NotZero(t, etag)
+
+		res, body := send(wrappedHandler, http.MethodGet, ifNoneMatchHeader, etag)
+		attest.Equal(t, res.StatusCode, http.StatusNotModified)
+		attest.Zero(t, body)
+
+		res, _ = send(wrappedHandler, http.MethodGet, ifNoneMatchHeader, `"some-other-etag"`)
+		attest.Equal(t, res.StatusCode, http.StatusOK)
+
+		res, _ = send(wrappedHandler, http.MethodGet, ifModifiedSinceHeader, time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+		attest.Equal(t, res.StatusCode, http.StatusNotModified)
+
+		res, _ = send(wrappedHandler, http.MethodGet, ifModifiedSinceHeader, time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+		attest.Equal(t, res.StatusCode, http.StatusOK)
+		attest.Equal(t, count.Load(), 1)
+	})
+
+	t.Run("etag of uncached responses", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Cache(someCacheHandler(count, "no-store"), nil)
+
+		res, _ := send(wrappedHandler, http.MethodGet)
+		etag := res.Header.Get(etagHeader)
+		attest.NotZero(t, etag)
+
+		// The response body changes, so the etag does not match.
+		res, _ = send(wrappedHandler, http.MethodGet, ifNoneMatchHeader, etag)
+		attest.Equal(t, res.StatusCode, http.StatusOK)
+		attest.Equal(t, count.Load(), 2)
+	})
+
+	t.Run("stale-while-revalidate", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		store := NewCacheStore(DefaultCacheSize)
+		wrappedHandler := Cache(someCacheHandler(count, "max-age=1, stale-while-revalidate=60"), store)
+
+		_, body := send(wrappedHandler, http.MethodGet)
+		attest.Equal(t, body, "hello 1")
+
+		time.Sleep(1100 * time.Millisecond)
+		res, body := send(wrappedHandler, http.MethodGet)
+		attest.Equal(t, body, "hello 1")
+		attest.Subsequence(t, res.Header.Get(cacheStatusHeader), "fwd=stale")
+
+		// wait for background revalidation.
+		for i := 0; i < 100 && count.Load() < 2; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		for i := 0; i < 100; i++ {
+			_, body = send(wrappedHandler, http.MethodGet)
+			if body != "hello 1" {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		attest.Equal(t, body, "hello 2")
+		attest.Equal(t, count.Load(), 2)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Cache(someCacheHandler(count, "max-age=1"), nil)
+
+		_, body := send(wrappedHandler, http.MethodGet)
+		attest.Equal(t, body, "hello 1")
+
+		time.Sleep(1100 * time.Millisecond)
+		_, body = send(wrappedHandler, http.MethodGet)
+		attest.Equal(t, body, "hello 2")
+	})
+
+	t.Run("head", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Cache(someCacheHandler(count, "max-age=60"), nil)
+
+		_, _ = send(wrappedHandler, http.MethodGet)
+		res, body := send(wrappedHandler, http.MethodHead)
+		attest.Equal(t, res.StatusCode, http.StatusOK)
+		attest.Zero(t, body)
+		attest.Equal(t, count.Load(), 1)
+	})
+
+	t.Run("unsafe methods", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Cache(someCacheHandler(count, "max-age=60"), nil)
+
+		for i := 0; i < 2; i++ {
+			_, _ = send(wrappedHandler, http.MethodPost)
+		}
+		attest.Equal(t, count.Load(), 2)
+	})
+
+	t.Run("authorization", func(t *testing.T) {
+		t.Parallel()
+
+		{
+			count := &atomic.Int64{}
+			wrappedHandler := Cache(someCacheHandler(count, "max-age=60"), nil)
+			for i := 0; i < 2; i++ {
+				_, _ = send(wrappedHandler, http.MethodGet, authorizationHeader, "Bearer token")
+			}
+			attest.Equal(t, count.Load(), 2)
+		}
+
+		{
+			count := &atomic.Int64{}
+			wrappedHandler := Cache(someCacheHandler(count, "public, max-age=60"), nil)
+			for i := 0; i < 2; i++ {
+				_, _ = send(wrappedHandler, http.MethodGet, authorizationHeader, "Bearer token")
+			}
+			attest.Equal(t, count.Load(), 1)
+		}
+	})
+
+	t.Run("large responses are streamed", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		store := NewCacheStore(8 * 1024)
+		large := strings.Repeat("a", 2*1024)
+		wrappedHandler := Cache(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				count.Add(1)
+				w.Header().Set(cacheControlHeader, "max-age=60")
+				_, _ = io.WriteString(w, large)
+			}),
+			store,
+		)
+
+		for i := 0; i < 2; i++ {
+			res, body := send(wrappedHandler, http.MethodGet)
+			attest.Equal(t, res.StatusCode, http.StatusOK)
+			attest.Equal(t, body, large)
+		}
+		attest.Equal(t, count.Load(), 2)
+		attest.Equal(t, store.Stats().Entries, 0)
+	})
+}
+
+func TestCacheStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("evicts least recently used", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewCacheStore(4000)
+		count := &atomic.Int64{}
+		wrappedHandler := Cache(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				count.Add(1)
+				w.Header().Set(cacheControlHeader, "max-age=60")
+				_, _ = io.WriteString(w, strings.Repeat("a", 200))
+			}),
+			store,
+		)
+
+		for i := 0; i < 20; i++ {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/uri-%d", i), nil)
+			wrappedHandler.ServeHTTP(rec, req)
+		}
+
+		stats := store.Stats()
+		attest.True(t, stats.Bytes <= 4000)
+		attest.True(t, stats.Entries < 20)
+		attest.True(t, stats.Entries > 0)
+
+		// The most recent one is still cached.
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/uri-19", nil)
+		wrappedHandler.ServeHTTP(rec, req)
+		attest.Equal(t, count.Load(), 20)
+
+		// The oldest one is not.
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, "/uri-0", nil)
+		wrappedHandler.ServeHTTP(rec, req)
+		attest.Equal(t, count.Load(), 21)
+	})
+
+	t.Run("evicted variants are forgotten", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewCacheStore(4000)
+		wrappedHandler := Cache(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(cacheControlHeader, "max-age=60")
+				w.Header().Set(varyHeader, "Accept-Language")
+				_, _ = io.WriteString(w, strings.Repeat("a", 200))
+			}),
+			store,
+		)
+
+		for i := 0; i < 200; i++ {
+			for _, lang := range []string{"en", "fr"} {
+				rec := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/uri-%d", i), nil)
+				req.Header.Set("Accept-Language", lang)
+				wrappedHandler.ServeHTTP(rec, req)
+			}
+		}
+
+		stats := store.Stats()
+		attest.True(t, stats.Entries < 400)
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		// Only the keys that still have responses in the store are kept.
+		attest.True(t, len(store.vary) <= stats.Entries)
+		for _, v := range store.vary {
+			attest.True(t, v.count > 0)
+		}
+	})
+}
@@ -6,6 +6,8 @@ import (
 	"slices"
 	"strings"
 	"time"
+
+	"github.com/komuw/ong/internal/ometrics"
 )
 
 // Some of the code here is inspired(or taken from) by:
@@ -132,14 +134,17 @@ func handlePreflight(
 
 	allow, allowAll := isOriginAllowed(origin, allowedOrigins, allowedWildcardOrigins)
 	if !allow {
+		ometrics.CorsRejections.Inc()
 		return
 	}
 
 	if !isMethodAllowed(reqMethod, allowedMethods) {
+		ometrics.CorsRejections.Inc()
 		return
 	}
 
 	if !areHeadersAllowed(reqHeader, allowedHeaders) {
+		ometrics.CorsRejections.Inc()
 		return
 	}
 
@@ -207,10 +212,12 @@ func handleActualRequest(
 
 	allow, allowAll := isOriginAllowed(origin, allowedOrigins, allowedWildcardOrigins)
 	if !allow {
+		ometrics.CorsRejections.Inc()
 		return
 	}
 
 	if !isMethodAllowed(reqMethod, allowedMethods) {
+		ometrics.CorsRejections.Inc()
 		return
 	}
 
@@ -8,13 +8,13 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/komuw/ong/config"
 	"github.com/komuw/ong/cookie"
 	"github.com/komuw/ong/cry"
 	"github.com/komuw/ong/id"
+	"github.com/komuw/ong/internal/ometrics"
 )
 
 // Some of the code here is inspired by(or taken from):
@@ -27,8 +27,6 @@ var (
 	errCsrfTokenNotFound    = errors.New("ong/middleware/csrf: token not found")
 	errCsrfTokenExpired     = errors.New("ong/middleware/csrf: token is expired")
 	errCsrfTokenWrongFormat = errors.New("ong/middleware/csrf: token wrong format")
-	once                    sync.Once //nolint:gochecknoglobals
-	enc                     cry.Enc   //nolint:gochecknoglobals
 )
 
 type csrfContextKey string
@@ -64,21 +62,39 @@ const (
 // csrf is a middleware that provides protection against Cross Site Request Forgeries.
 //
 // If a csrf token is not provided(or is not valid), when it ought to have been; this middleware will issue a http GET redirect to the same url.
+// co are the attributes of the csrf cookie. The redirect is rendered using rf.
 func csrf(
 	wrappedHandler http.Handler,
-	secretKey string,
+	kr *cry.Keyring,
 	domain string,
+	co cookie.Opts,
 	csrfTokenDuration time.Duration,
+	rf config.RejectFunc,
 ) http.HandlerFunc {
-	once.Do(func() {
-		enc = cry.New(secretKey)
-	})
 	msgToEncrypt := id.Random(16)
+	co.JsAccess = true // the csrf cookie needs to be accessible to javascript.
+	cookieName := co.Name(csrfCookieName)
+	cookieDomain := domain
+	if co.HostOnly {
+		cookieDomain = ""
+	}
 
 	if csrfTokenDuration < 1*time.Second { // is measured in seconds.
 		csrfTokenDuration = config.DefaultCsrfCookieDuration
 	}
 
+	// redirect rejects the request with a redirect to the same url.
+	redirect := func(w http.ResponseWriter, r *http.Request, reason error) {
+		w.Header().Set("Location", r.URL.String())
+		reject(w, r, rf, config.Rejection{
+			Kind: config.RejectionCsrf,
+			// http 303(StatusSeeOther) is guaranteed by the spec to always use http GET.
+			// https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/303
+			Status: http.StatusSeeOther,
+			Reason: reason,
+		})
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		// - https://docs.djangoproject.com/en/4.0/ref/csrf/
 		// - https://github.com/django/django/blob/4.0.5/django/middleware/csrf.py
@@ -98,7 +114,7 @@ func csrf(
 			break
 		default:
 			// For POST requests, we insist on a CSRF cookie, and in this way we can avoid all CSRF attacks, including login CSRF.
-			actualToken := getToken(r)
+			actualToken := getToken(r, cookieName)
 
 			ct, _, err := mime.ParseMediaType(r.Header.Get(ctHeader))
 			if err == nil &&
@@ -117,7 +133,7 @@ func csrf(
 				break
 			}
 
-			tokVal, errN := enc.DecryptDecode(actualToken)
+			tokVal, errN := kr.DecryptDecode(actualToken)
 			if errN != nil {
 				// We should redirect the request since it means that the server is not aware of such a token.
 				// It shoulbe be a temporary redirect to the same page but this time send a http GET request.
@@ -128,40 +144,33 @@ func csrf(
 				//   -d "firstName=john&csrftoken=bogusToken" https://localhost:65081/login/
 				// Do NOT use `-X POST`, see: https://stackoverflow.com/a/41890653/2768067
 				//
-				cookie.Delete(w, csrfCookieName, domain)
-				w.Header().Set(ongMiddlewareErrorHeader, errCsrfTokenNotFound.Error())
-				http.Redirect(
-					w,
-					r,
-					r.URL.String(),
-					// http 303(StatusSeeOther) is guaranteed by the spec to always use http GET.
-					// https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/303
-					http.StatusSeeOther,
-				)
+				ometrics.CsrfFailures.Inc()
+				cookie.Delete(w, cookieName, cookieDomain)
+				redirect(w, r, errCsrfTokenNotFound)
 				return
 			}
 
 			res := strings.Split(tokVal, sep)
 			if len(res) != 2 {
-				cookie.Delete(w, csrfCookieName, domain)
-				w.Header().Set(ongMiddlewareErrorHeader, errCsrfTokenWrongFormat.Error())
-				http.Redirect(w, r, r.URL.String(), http.StatusSeeOther)
+				ometrics.CsrfFailures.Inc()
+				cookie.Delete(w, cookieName, cookieDomain)
+				redirect(w, r, errCsrfTokenWrongFormat)
 				return
 			}
 
 			expires, errP := strconv.ParseInt(res[1], 10, 64)
 			if errP != nil {
-				cookie.Delete(w, csrfCookieName, domain)
-				w.Header().Set(ongMiddlewareErrorHeader, errP.Error())
-				http.Redirect(w, r, r.URL.String(), http.StatusSeeOther)
+				ometrics.CsrfFailures.Inc()
+				cookie.Delete(w, cookieName, cookieDomain)
+				redirect(w, r, errP)
 				return
 			}
 
 			diff := expires - time.Now().UTC().Unix()
 			if diff <= 0 {
-				cookie.Delete(w, csrfCookieName, domain)
-				w.Header().Set(ongMiddlewareErrorHeader, errCsrfTokenExpired.Error())
-				http.Redirect(w, r, r.URL.String(), http.StatusSeeOther)
+				ometrics.CsrfFailures.Inc()
+				cookie.Delete(w, cookieName, cookieDomain)
+				redirect(w, r, errCsrfTokenExpired)
 				return
 			}
 		}
@@ -187,19 +196,19 @@ func csrf(
 			time.Now().UTC().Add(csrfTokenDuration).Unix(),
 			10,
 		)
-		tokenToIssue := enc.EncryptEncode(
+		tokenToIssue := kr.EncryptEncode(
 			// see: https://github.com/golang/net/blob/v0.8.0/xsrftoken/xsrf.go#L33-L46
 			fmt.Sprintf("%s%s%s", msgToEncrypt, sep, expires),
 		)
 
 		// 3. create cookie
-		cookie.Set(
+		_ = cookie.SetOpts( // co is validated by [config.New]
 			w,
-			csrfCookieName,
+			cookieName,
 			tokenToIssue,
 			domain,
 			csrfTokenDuration,
-			true, // accessible to javascript
+			co,
 		)
 
 		// 4. set cookie header
@@ -231,10 +240,10 @@ func GetCsrfToken(c context.Context) string {
 }
 
 // getToken tries to fetch a csrf token from the incoming request r.
-// It tries to fetch from cookies, http-forms, headers in that order.
-func getToken(r *http.Request) (actualToken string) {
+// It tries to fetch from the cookie called cookieName, http-forms, headers in that order.
+func getToken(r *http.Request, cookieName string) (actualToken string) {
 	fromCookie := func() string {
-		c, err := r.Cookie(csrfCookieName)
+		c, err := r.Cookie(cookieName)
 		if err != nil {
 			return ""
 		}
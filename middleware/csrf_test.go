@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/cookie"
 	"github.com/komuw/ong/cry"
 	"github.com/komuw/ong/id"
 	"github.com/komuw/ong/internal/tst"
@@ -26,7 +27,7 @@ func TestGetToken(t *testing.T) {
 		t.Parallel()
 
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
-		tok := getToken(req)
+		tok := getToken(req, csrfCookieName)
 		attest.Zero(t, tok)
 	})
 
@@ -42,7 +43,7 @@ func TestGetToken(t *testing.T) {
 			Secure:   true,  // https only.
 			SameSite: http.SameSiteStrictMode,
 		})
-		tok := getToken(req)
+		tok := getToken(req, csrfCookieName)
 		attest.Zero(t, tok)
 	})
 
@@ -59,7 +60,7 @@ func TestGetToken(t *testing.T) {
 			Secure:   true,  // https only.
 			SameSite: http.SameSiteStrictMode,
 		})
-		got := getToken(req)
+		got := getToken(req, csrfCookieName)
 		attest.Equal(t, got, want)
 	})
 
@@ -69,7 +70,7 @@ func TestGetToken(t *testing.T) {
 		want := id.Random(csrfBytesTokenLength)
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
 		req.Header.Set(CsrfHeader, want)
-		got := getToken(req)
+		got := getToken(req, csrfCookieName)
 		attest.Equal(t, got, want)
 	})
 
@@ -81,7 +82,7 @@ func TestGetToken(t *testing.T) {
 		err := req.ParseForm()
 		attest.Ok(t, err)
 		req.Form.Add(CsrfTokenFormName, want)
-		got := getToken(req)
+		got := getToken(req, csrfCookieName)
 		attest.Equal(t, got, want)
 	})
 
@@ -105,7 +106,7 @@ func TestGetToken(t *testing.T) {
 		attest.Ok(t, err)
 		req.Form.Add(CsrfTokenFormName, formToken)
 
-		got := getToken(req)
+		got := getToken(req, csrfCookieName)
 		attest.Equal(t, got, cookieToken)
 	})
 }
@@ -127,7 +128,7 @@ func TestCsrf(t *testing.T) {
 
 		msg := "hello"
 		domain := "example.com"
-		wrappedHandler := csrf(someCsrfHandler(msg), tst.SecretKey(), domain, config.DefaultCsrfCookieDuration)
+		wrappedHandler := csrf(someCsrfHandler(msg), testKeyring(t), domain, cookie.Opts{}, config.DefaultCsrfCookieDuration, nil)
 
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
@@ -143,12 +144,47 @@ func TestCsrf(t *testing.T) {
 		attest.Equal(t, string(rb), msg)
 	})
 
+	t.Run("cookie attributes", func(t *testing.T) {
+		t.Parallel()
+
+		msg := "hello"
+		domain := "example.com"
+		kr := testKeyring(t)
+		o := cookie.Opts{HostOnly: true, SameSite: http.SameSiteLaxMode}
+		wrappedHandler := csrf(someCsrfHandler(msg), kr, domain, o, config.DefaultCsrfCookieDuration, nil)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		wrappedHandler.ServeHTTP(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+
+		attest.Equal(t, res.StatusCode, http.StatusOK)
+		attest.Equal(t, len(res.Cookies()), 1)
+		c := res.Cookies()[0]
+		attest.Equal(t, c.Name, "__Host-"+csrfCookieName)
+		attest.Equal(t, c.Domain, "")
+		attest.Equal(t, c.SameSite, http.SameSiteLaxMode)
+		attest.False(t, c.HttpOnly)
+
+		// The token is read from the prefixed cookie.
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodPost, "/someUri", nil)
+		req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		wrappedHandler.ServeHTTP(rec, req)
+
+		res = rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusOK)
+	})
+
 	t.Run("fetch token from GET requests", func(t *testing.T) {
 		t.Parallel()
 
 		msg := "hello"
 		domain := "example.com"
-		wrappedHandler := csrf(someCsrfHandler(msg), tst.SecretKey(), domain, config.DefaultCsrfCookieDuration)
+		wrappedHandler := csrf(someCsrfHandler(msg), testKeyring(t), domain, cookie.Opts{}, config.DefaultCsrfCookieDuration, nil)
 
 		reqCsrfTok := id.Random(csrfBytesTokenLength)
 		rec := httptest.NewRecorder()
@@ -179,7 +215,7 @@ func TestCsrf(t *testing.T) {
 
 		msg := "hello"
 		domain := "example.com"
-		wrappedHandler := csrf(someCsrfHandler(msg), tst.SecretKey(), domain, config.DefaultCsrfCookieDuration)
+		wrappedHandler := csrf(someCsrfHandler(msg), testKeyring(t), domain, cookie.Opts{}, config.DefaultCsrfCookieDuration, nil)
 
 		reqCsrfTok := id.Random(csrfBytesTokenLength)
 		rec := httptest.NewRecorder()
@@ -203,7 +239,7 @@ func TestCsrf(t *testing.T) {
 
 		msg := "hello"
 		domain := "example.com"
-		wrappedHandler := csrf(someCsrfHandler(msg), tst.SecretKey(), domain, config.DefaultCsrfCookieDuration)
+		wrappedHandler := csrf(someCsrfHandler(msg), testKeyring(t), domain, cookie.Opts{}, config.DefaultCsrfCookieDuration, nil)
 
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
@@ -225,7 +261,7 @@ func TestCsrf(t *testing.T) {
 
 		msg := "hello"
 		domain := "example.com"
-		wrappedHandler := csrf(someCsrfHandler(msg), tst.SecretKey(), domain, config.DefaultCsrfCookieDuration)
+		wrappedHandler := csrf(someCsrfHandler(msg), testKeyring(t), domain, cookie.Opts{}, config.DefaultCsrfCookieDuration, nil)
 
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
@@ -266,7 +302,7 @@ func TestCsrf(t *testing.T) {
 
 		msg := "hello"
 		domain := "example.com"
-		wrappedHandler := csrf(someCsrfHandler(msg), tst.SecretKey(), domain, config.DefaultCsrfCookieDuration)
+		wrappedHandler := csrf(someCsrfHandler(msg), testKeyring(t), domain, cookie.Opts{}, config.DefaultCsrfCookieDuration, nil)
 
 		reqCsrfTok := id.Random(csrfBytesTokenLength * 2)
 		rec := httptest.NewRecorder()
@@ -295,7 +331,7 @@ func TestCsrf(t *testing.T) {
 
 		msg := "hello"
 		domain := "example.com"
-		wrappedHandler := csrf(someCsrfHandler(msg), tst.SecretKey(), domain, config.DefaultCsrfCookieDuration)
+		wrappedHandler := csrf(someCsrfHandler(msg), testKeyring(t), domain, cookie.Opts{}, config.DefaultCsrfCookieDuration, nil)
 
 		key := tst.SecretKey()
 		enc2 := cry.New(key)
@@ -368,7 +404,7 @@ func TestCsrf(t *testing.T) {
 
 		msg := "hello"
 		domain := "example.com"
-		wrappedHandler := csrf(someCsrfHandler(msg), tst.SecretKey(), domain, config.DefaultCsrfCookieDuration)
+		wrappedHandler := csrf(someCsrfHandler(msg), testKeyring(t), domain, cookie.Opts{}, config.DefaultCsrfCookieDuration, nil)
 
 		rec := httptest.NewRecorder()
 		postMsg := "my name is John"
@@ -397,7 +433,7 @@ func TestCsrf(t *testing.T) {
 		domain := "example.com"
 		// for this concurrency test, we have to re-use the same wrappedHandler
 		// so that state is shared and thus we can see if there is any state which is not handled correctly.
-		wrappedHandler := csrf(someCsrfHandler(msg), tst.SecretKey(), domain, config.DefaultCsrfCookieDuration)
+		wrappedHandler := csrf(someCsrfHandler(msg), testKeyring(t), domain, cookie.Opts{}, config.DefaultCsrfCookieDuration, nil)
 
 		key := tst.SecretKey()
 		enc2 := cry.New(key)
@@ -477,3 +513,12 @@ func TestCsrf(t *testing.T) {
 		}
 	})
 }
+
+// testKeyring returns a keyring that can be used in tests.
+func testKeyring(t testing.TB) *cry.Keyring {
+	t.Helper()
+
+	kr, err := cry.NewKeyring(tst.SecretKey())
+	attest.Ok(t, err)
+	return kr
+}
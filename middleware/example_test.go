@@ -7,8 +7,10 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/cry"
 	"github.com/komuw/ong/log"
 	"github.com/komuw/ong/middleware"
 )
@@ -94,3 +96,107 @@ func ExampleWithOpts() {
 
 	// Output:
 }
+
+func ExampleIdempotency() {
+	l := log.New(context.Background(), os.Stdout, 100)
+	opts := config.WithOpts("example.com", 443, "super-h@rd-Pas1word", config.DirectIpStrategy, l)
+
+	createOrder := http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, "order created\n")
+		},
+	)
+
+	// Retried requests that carry the same `Idempotency-Key` header will get the first response replayed.
+	handler := middleware.Post(
+		middleware.Idempotency(createOrder, middleware.NewIdempotencyStore(middleware.DefaultIdempotencyKeyDuration), opts.RejectFunc),
+		opts,
+	)
+	_ = handler // use handler
+
+	// Output:
+}
+
+func ExampleCache() {
+	l := log.New(context.Background(), os.Stdout, 100)
+	opts := config.WithOpts("example.com", 443, "super-h@rd-Pas1word", config.DirectIpStrategy, l)
+
+	products := http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			// Only responses with an explicit freshness lifetime are cached.
+			w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=30")
+			_, _ = io.WriteString(w, "list of products\n")
+		},
+	)
+
+	store := middleware.NewCacheStore(middleware.DefaultCacheSize)
+	handler := middleware.Get(middleware.Cache(products, store), opts)
+	_ = handler // use handler
+
+	_ = store.Stats() // hits, misses, etc.
+
+	// Output:
+}
+
+func ExampleAuthenticate() {
+	l := log.New(context.Background(), os.Stdout, 100)
+	opts := config.WithOpts("example.com", 443, "super-h@rd-Pas1word", config.DirectIpStrategy, l)
+
+	// The passwords, tokens & keys are stored hashed. eg, in your database.
+	hasher, err := cry.NewHasher(0, 0, 0)
+	if err != nil {
+		panic(err)
+	}
+	basic, err := middleware.NewBasicAuthenticator(map[string]string{"admin": hasher.Hash("some-long-p1sswd")}, hasher)
+	if err != nil {
+		panic(err)
+	}
+	apiKeys, err := middleware.NewAPIKeyAuthenticator("X-Api-Key", "", map[string]string{middleware.HashKey("some-random-api-key"): "billing-service"})
+	if err != nil {
+		panic(err)
+	}
+
+	reports := http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			p, _ := middleware.GetPrincipal(r.Context())
+			_, _ = fmt.Fprintf(w, "reports for %s\n", p.ID)
+		},
+	)
+
+	handler := middleware.Get(middleware.Authenticate(reports, opts.RejectFunc, basic, apiKeys), opts)
+	_ = handler // use handler
+
+	// Output:
+}
+
+func ExampleVerifyToken() {
+	l := log.New(context.Background(), os.Stdout, 100)
+	opts := config.WithOpts("example.com", 443, "super-h@rd-Pas1word", config.DirectIpStrategy, l)
+
+	// The tokens are issued by another service, using cry.IssueToken.
+	k, err := cry.LocalTokenKey("2024-01", "some-other-Super-h@rd-password")
+	if err != nil {
+		panic(err)
+	}
+	v, err := cry.NewTokenVerifier("auth.example.com", "api.example.com", 30*time.Second, k)
+	if err != nil {
+		panic(err)
+	}
+
+	profile := http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			c, _ := middleware.GetClaims(r.Context())
+			_, _ = fmt.Fprintf(w, "profile of %s\n", c.Subject)
+		},
+	)
+
+	h, err := middleware.VerifyToken(profile, v, opts.RejectFunc)
+	if err != nil {
+		panic(err)
+	}
+	handler := middleware.Get(h, opts)
+	_ = handler // use handler
+
+	// Output:
+}
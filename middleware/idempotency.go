@@ -0,0 +1,541 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/id"
+	"github.com/komuw/ong/sess"
+)
+
+// Some of the code here is inspired by:
+//   (a) https://datatracker.ietf.org/doc/draft-ietf-httpapi-idempotency-key-header/
+//   (b) https://stripe.com/docs/api/idempotent_requests
+
+type idempotencyContextKey string
+
+const (
+	// IdempotencyKeyHeader is the name of the http header that clients use to supply an idempotency key.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotencyKeyFormName is the name of the html form field that browsers can use to supply an idempotency key.
+	// The value to use for it can be fetched using [GetIdempotencyKey]
+	IdempotencyKeyFormName = "idempotency_key"
+	// IdempotentReplayedHeader is set(with a value of "true") on responses that have been replayed by [Idempotency].
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	// DefaultIdempotencyKeyDuration is the duration that responses recorded by [Idempotency] are kept for, by default.
+	// [stripe] uses 24hrs.
+	//
+	// [stripe]: https://stripe.com/docs/api/idempotent_requests
+	DefaultIdempotencyKeyDuration = 24 * time.Hour
+
+	idempotencyCtxKey = idempotencyContextKey("idempotencyContextKey")
+	setCookieHeader   = "Set-Cookie"
+	// maxIdempotencyKeyLen is the maximum length of an idempotency key that we accept.
+	maxIdempotencyKeyLen = 255
+	// maxIdempotentBodySize is the largest response body that we will record.
+	// Responses larger than this are not recorded, and hence not replayed.
+	maxIdempotentBodySize = 1 * 1024 * 1024 // 1MB
+	// maxIdempotencyItems is the maximum number of keys in a memory store.
+	maxIdempotencyItems = 10_000
+	// idempotencyStoreFullRetry is how long clients are asked to wait when the store is full.
+	idempotencyStoreFullRetry = 5 * time.Second
+)
+
+var (
+	// ErrIdempotencyInFlight is returned by an [IdempotencyStore] when a request with the same idempotency key is still being processed.
+	ErrIdempotencyInFlight = errors.New("ong/middleware/idempotency: a request with the same idempotency key is in progress")
+	// ErrIdempotencyMismatch is returned by an [IdempotencyStore] when an idempotency key is reused for a different request.
+	ErrIdempotencyMismatch = errors.New("ong/middleware/idempotency: idempotency key has been used for a different request")
+	// ErrIdempotencyStoreFull is returned by an [IdempotencyStore] when it has no room for a new key.
+	ErrIdempotencyStoreFull = errors.New("ong/middleware/idempotency: idempotency store is full")
+
+	errIdempotencyKeyTooLong = fmt.Errorf("ong/middleware/idempotency: idempotency key is longer than %d", maxIdempotencyKeyLen)
+)
+
+// IdempotentResponse is a http response that has been recorded by [Idempotency].
+type IdempotentResponse struct {
+	Code   int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore is the storage used by [Idempotency] to record responses.
+//
+// Implementations should be safe for concurrent use.
+// Use [NewIdempotencyStore] to get an in-memory implementation.
+type IdempotencyStore interface {
+	// Begin marks key as in-flight.
+	// fingerprint identifies the request that is using key. It is used to detect the reuse of key for a different request.
+	//
+	// If a response has already been recorded for key, it is returned.
+	// If key is in-flight, [ErrIdempotencyInFlight] is returned.
+	// If key was used with a different fingerprint, [ErrIdempotencyMismatch] is returned.
+	// If there is no room for key, [ErrIdempotencyStoreFull] is returned.
+	// Otherwise, key is reserved and a nil response & nil error are returned.
+	Begin(key, fingerprint string) (*IdempotentResponse, error)
+	// Complete records res as the response for key.
+	Complete(key string, res IdempotentResponse) error
+	// Abort releases key, so that a later request with the same key can be processed afresh.
+	Abort(key string) error
+}
+
+// Idempotency is a middleware that implements [idempotency keys] for http POST, PUT, PATCH and DELETE requests.
+//
+// Requests that carry an idempotency key, either in the [IdempotencyKeyHeader] header or the [IdempotencyKeyFormName] form field,
+// have their first response(status, headers & body) recorded in store.
+// Retries that use the same key get that recorded response replayed, without wrappedHandler being called.
+// A duplicate request that arrives while the first one is still being processed gets a http 409(Conflict) response.
+// A key that is reused for a different request gets a http 422(Unprocessable Entity) response.
+// If store is full, the request gets a http 503(Service Unavailable) response.
+//
+// Keys are scoped to the client; the authenticated [Principal] if any, else the http session if any, else the [ClientIP].
+// Responses with a http status code of 5xx are not recorded, so that they can be retried.
+// The Set-Cookie headers of responses are not recorded, and hence not replayed.
+// Requests with other http methods, or without an idempotency key, are passed through as is.
+// For http GET requests, a new key is added to the request context. It can be fetched using [GetIdempotencyKey] and embedded in html forms.
+//
+// If store is nil, an in-memory store with a duration of [DefaultIdempotencyKeyDuration] is used.
+// The rejections are rendered using rf, see [config.RejectFunc]. If rf is nil, they are rendered as problem+json or html.
+//
+// [idempotency keys]: https://datatracker.ietf.org/doc/draft-ietf-httpapi-idempotency-key-header/
+func Idempotency(wrappedHandler http.Handler, store IdempotencyStore, rf config.RejectFunc) http.HandlerFunc {
+	if store == nil {
+		store = NewIdempotencyStore(DefaultIdempotencyKeyDuration)
+	}
+
+	unsafeMethods := []string{
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodPatch,
+		http.MethodDelete,
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			r = r.WithContext(context.WithValue(r.Context(), idempotencyCtxKey, id.Random(32)))
+			wrappedHandler.ServeHTTP(w, r)
+			return
+		}
+
+		if !slices.Contains(unsafeMethods, r.Method) {
+			wrappedHandler.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := getIdempotencyKey(r)
+		if err != nil {
+			reject(w, r, rf, config.Rejection{
+				Kind:   config.RejectionIdempotency,
+				Status: http.StatusBadRequest,
+				Reason: err,
+			})
+			return
+		}
+		if key == "" {
+			wrappedHandler.ServeHTTP(w, r)
+			return
+		}
+
+		fPrint, err := idempotencyFingerprint(r)
+		if err != nil {
+			reject(w, r, rf, config.Rejection{
+				Kind:   config.RejectionIdempotency,
+				Status: http.StatusBadRequest,
+				Reason: fmt.Errorf("ong/middleware/idempotency: unable to read request body: %w", err),
+			})
+			return
+		}
+
+		// Keys are scoped to the client, http method and path.
+		// This way, a key used on one endpoint does not affect another one, and a client cannot replay the response of another client.
+		storeKey := idempotencyScope(r) + " " + r.Method + " " + r.URL.Path + " " + key
+
+		res, err := store.Begin(storeKey, fPrint)
+		if err != nil {
+			code := http.StatusInternalServerError
+			retryAfter := time.Duration(0)
+			switch {
+			case errors.Is(err, ErrIdempotencyInFlight):
+				code = http.StatusConflict
+			case errors.Is(err, ErrIdempotencyMismatch):
+				code = http.StatusUnprocessableEntity
+			case errors.Is(err, ErrIdempotencyStoreFull):
+				code = http.StatusServiceUnavailable
+				retryAfter = idempotencyStoreFullRetry
+			}
+			reject(w, r, rf, config.Rejection{
+				Kind:       config.RejectionIdempotency,
+				Status:     code,
+				RetryAfter: retryAfter,
+				Reason:     err,
+			})
+			return
+		}
+
+		if res != nil {
+			// Replay.
+			maps.Copy(w.Header(), res.Header)
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			w.WriteHeader(res.Code)
+			_, _ = w.Write(res.Body)
+			return
+		}
+
+		irw := newIdempotencyRW(w)
+		completed := false
+		defer func() {
+			// If the handler panics or the request is cancelled, we need to release the key.
+			// That way the client can retry.
+			if !completed {
+				_ = store.Abort(storeKey)
+			}
+		}()
+
+		wrappedHandler.ServeHTTP(irw, r)
+
+		if got, ok := irw.result(); ok && r.Context().Err() == nil {
+			if errC := store.Complete(storeKey, got); errC == nil {
+				completed = true
+			}
+		}
+	}
+}
+
+// GetIdempotencyKey returns a new idempotency key that was added to the http GET request in question by [Idempotency].
+// It can be embedded in html forms using the [IdempotencyKeyFormName] field name.
+// It returns an empty string if no key is found.
+func GetIdempotencyKey(c context.Context) string {
+	if v := c.Value(idempotencyCtxKey); v != nil {
+		if s, ok := v.(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// getIdempotencyKey tries to fetch an idempotency key from the incoming request r.
+// It tries to fetch from headers then http-forms in that order.
+func getIdempotencyKey(r *http.Request) (string, error) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		ct := r.Header.Get(ctHeader)
+		if strings.HasPrefix(ct, formUrlEncoded) || strings.HasPrefix(ct, multiformData) {
+			key = r.FormValue(IdempotencyKeyFormName) // calls ParseMultipartForm and ParseForm if necessary
+		}
+	}
+
+	if len(key) > maxIdempotencyKeyLen {
+		return "", errIdempotencyKeyTooLong
+	}
+
+	return key, nil
+}
+
+// idempotencyScope returns a value that identifies the client that made the request r.
+// It is the authenticated principal if any, else the http session if any, else the client IP address.
+func idempotencyScope(r *http.Request) string {
+	if p, ok := GetPrincipal(r.Context()); ok {
+		return "principal:" + p.Scheme + ":" + p.ID
+	}
+	if id := sess.ID(r); id != "" {
+		return "session:" + id
+	}
+	return "ip:" + ClientIP(r)
+}
+
+// idempotencyFingerprint returns a hash that identifies the request r.
+// The request body is read and then restored so that it can be read again by other handlers.
+func idempotencyFingerprint(r *http.Request) (string, error) {
+	h := sha256.New()
+	_, _ = io.WriteString(h, r.Method)
+	_, _ = io.WriteString(h, r.URL.Path)
+
+	if r.Form != nil {
+		// The body has already been consumed while parsing the form.
+		_, _ = io.WriteString(h, r.Form.Encode())
+	} else if r.Body != nil && r.Body != http.NoBody {
+		// Note: We also limit max body size using `http.MaxBytesHandler`
+		// See: ong/server
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return "", err
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(b))
+		_, _ = h.Write(b)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// idempotencyRW provides an http.ResponseWriter interface, which records the response.
+type idempotencyRW struct {
+	http.ResponseWriter
+	// initialHeader is the header as it was before the wrapped handler was called.
+	// It is used to only record the headers that were set by the wrapped handler.
+	initialHeader http.Header
+	recordHeader  http.Header
+	code          int
+	body          bytes.Buffer
+	tooLarge      bool
+	streamed      bool
+}
+
+var (
+	// make sure we support http optional interfaces.
+	// https://github.com/komuw/ong/issues/15
+	// https://blog.merovius.de/2017/07/30/the-trouble-with-optional-interfaces.html
+	_ http.ResponseWriter = &idempotencyRW{}
+	_ http.Flusher        = &idempotencyRW{}
+	_ http.Hijacker       = &idempotencyRW{}
+	_ http.Pusher         = &idempotencyRW{}
+	_ io.ReaderFrom       = &idempotencyRW{}
+	_ httpRespCtrler      = &idempotencyRW{}
+)
+
+func newIdempotencyRW(w http.ResponseWriter) *idempotencyRW {
+	return &idempotencyRW{
+		ResponseWriter: w,
+		initialHeader:  w.Header().Clone(),
+	}
+}
+
+// WriteHeader records the status code & headers.
+func (irw *idempotencyRW) WriteHeader(statusCode int) {
+	if irw.code == 0 {
+		irw.code = statusCode
+		irw.recordHeader = http.Header{}
+		for k, v := range irw.Header() {
+			if k == ongMiddlewareErrorHeader || k == setCookieHeader {
+				// Cookies, like session cookies, belong to the client that made the first request and are thus never replayed.
+				continue
+			}
+			if old, ok := irw.initialHeader[k]; ok && slices.Equal(old, v) {
+				continue
+			}
+			irw.recordHeader[k] = slices.Clone(v)
+		}
+	}
+	irw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records the body.
+func (irw *idempotencyRW) Write(b []byte) (int, error) {
+	if irw.code == 0 {
+		irw.WriteHeader(http.StatusOK)
+	}
+
+	if !irw.tooLarge {
+		if irw.body.Len()+len(b) > maxIdempotentBodySize {
+			irw.tooLarge = true
+			irw.body.Reset()
+		} else {
+			irw.body.Write(b)
+		}
+	}
+
+	return irw.ResponseWriter.Write(b)
+}
+
+// result returns the recorded response and true if the response should be stored.
+func (irw *idempotencyRW) result() (IdempotentResponse, bool) {
+	code := irw.code
+	if code == 0 {
+		// The handler did not write anything.
+		code = http.StatusOK
+		irw.recordHeader = http.Header{}
+	}
+
+	if irw.tooLarge || irw.streamed || code >= http.StatusInternalServerError {
+		return IdempotentResponse{}, false
+	}
+
+	return IdempotentResponse{
+		Code:   code,
+		Header: irw.recordHeader,
+		Body:   slices.Clone(irw.body.Bytes()),
+	}, true
+}
+
+// Flush implements http.Flusher
+func (irw *idempotencyRW) Flush() {
+	// Streamed responses are not recorded.
+	irw.streamed = true
+	if fw, ok := irw.ResponseWriter.(http.Flusher); ok {
+		fw.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker
+func (irw *idempotencyRW) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	irw.streamed = true
+	if hj, ok := irw.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, fmt.Errorf("ong/middleware/idempotency: http.Hijacker interface is not supported")
+}
+
+// Push implements http.Pusher
+func (irw *idempotencyRW) Push(target string, opts *http.PushOptions) error {
+	if p, ok := irw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return fmt.Errorf("ong/middleware/idempotency: http.Pusher interface is not supported")
+}
+
+// ReadFrom implements io.ReaderFrom
+// It is necessary for the sendfile syscall
+// https://github.com/caddyserver/caddy/pull/5022
+// https://github.com/caddyserver/caddy/blob/v2.7.4/modules/caddyhttp/responsewriter.go#L45-L49
+func (irw *idempotencyRW) ReadFrom(src io.Reader) (n int64, err error) {
+	// Go through Write so that the body is recorded.
+	return io.Copy(struct{ io.Writer }{irw}, src)
+}
+
+// Unwrap implements http.ResponseController.
+// It returns the underlying ResponseWriter,
+// which is necessary for http.ResponseController to work correctly.
+func (irw *idempotencyRW) Unwrap() http.ResponseWriter {
+	return irw.ResponseWriter
+}
+
+// NewIdempotencyStore returns an in-memory [IdempotencyStore].
+// Recorded responses are kept for the duration ttl. If ttl is less than 1second, [DefaultIdempotencyKeyDuration] is used instead.
+//
+// The store holds at most 10_000 keys. When it is full, the expired responses are removed, then the oldest ones.
+// Keys that are in-flight are never removed; if all the keys are in-flight, [ErrIdempotencyStoreFull] is returned.
+func NewIdempotencyStore(ttl time.Duration) IdempotencyStore {
+	if ttl < 1*time.Second {
+		ttl = DefaultIdempotencyKeyDuration
+	}
+	return newMemIdempotencyStore(ttl, maxIdempotencyItems)
+}
+
+func newMemIdempotencyStore(ttl time.Duration, maxItems int) *memIdempotencyStore {
+	return &memIdempotencyStore{
+		ttl:  ttl,
+		max:  maxItems,
+		m:    map[string]*idempotencyEntry{},
+		done: list.New(),
+	}
+}
+
+type idempotencyEntry struct {
+	fingerprint string
+	res         *IdempotentResponse // nil if in-flight.
+	expiresAt   time.Time
+	// el is the element of this entry in memIdempotencyStore.done. It is nil if in-flight.
+	el *list.Element
+}
+
+// memIdempotencyStore is an in-memory [IdempotencyStore].
+type memIdempotencyStore struct {
+	ttl time.Duration
+	max int
+
+	mu sync.Mutex // protects m & done
+	// +checklocks:mu
+	m map[string]*idempotencyEntry
+	// done holds the keys of the recorded responses in the order that they were recorded, the most recent at the front.
+	// Since they all have the same ttl, that is also the order in which they expire.
+	// +checklocks:mu
+	done *list.List
+}
+
+func (s *memIdempotencyStore) Begin(key, fingerprint string) (*IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	if e, ok := s.m[key]; ok {
+		if now.Before(e.expiresAt) {
+			if e.fingerprint != fingerprint {
+				return nil, ErrIdempotencyMismatch
+			}
+			if e.res == nil {
+				return nil, ErrIdempotencyInFlight
+			}
+			res := *e.res
+			res.Header = e.res.Header.Clone()
+			return &res, nil
+		}
+		s.remove(key, e)
+	}
+
+	// Remove the expired responses at the back, then make room if the store is full.
+	for el := s.done.Back(); el != nil; el = s.done.Back() {
+		k := el.Value.(string)
+		e := s.m[k]
+		if now.Before(e.expiresAt) {
+			break
+		}
+		s.remove(k, e)
+	}
+	for len(s.m) >= s.max && s.done.Len() > 0 {
+		k := s.done.Back().Value.(string)
+		s.remove(k, s.m[k])
+	}
+	if len(s.m) >= s.max {
+		// All the keys are in-flight.
+		// Each response can be upto maxIdempotentBodySize, so we cannot afford to keep growing.
+		return nil, ErrIdempotencyStoreFull
+	}
+
+	s.m[key] = &idempotencyEntry{fingerprint: fingerprint, expiresAt: now.Add(s.ttl)}
+	return nil, nil
+}
+
+func (s *memIdempotencyStore) Complete(key string, res IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.m[key]
+	if !ok {
+		return errors.New("ong/middleware/idempotency: key not found")
+	}
+	e.res = &res
+	e.expiresAt = time.Now().UTC().Add(s.ttl)
+	if e.el == nil {
+		e.el = s.done.PushFront(key)
+	} else {
+		s.done.MoveToFront(e.el)
+	}
+
+	return nil
+}
+
+func (s *memIdempotencyStore) Abort(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.m[key]; ok && e.res == nil {
+		s.remove(key, e)
+	}
+
+	return nil
+}
+
+// remove deletes the entry e of key.
+//
+// +checklocks:s.mu
+func (s *memIdempotencyStore) remove(key string, e *idempotencyEntry) {
+	if e.el != nil {
+		s.done.Remove(e.el)
+	}
+	delete(s.m, key)
+}
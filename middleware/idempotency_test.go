@@ -0,0 +1,453 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/komuw/ong/config"
+	"go.akshayshah.org/attest"
+)
+
+func someIdempotencyHandler(count *atomic.Int64, started, block chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if block != nil {
+			close(started)
+			<-block
+		}
+		n := count.Add(1)
+
+		b, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(b), "fail") {
+			http.Error(w, "failed", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/orders/%d", n))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "order %d", n)
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	t.Parallel()
+
+	send := func(h http.Handler, method, key, body string) *http.Response {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/orders", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		h.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+
+	t.Run("replays response", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Idempotency(someIdempotencyHandler(count, nil, nil), nil, nil)
+
+		var first string
+		for i := 0; i < 3; i++ {
+			res := send(wrappedHandler, http.MethodPost, "key-1", "item=book")
+			defer res.Body.Close()
+
+			rb, err := io.ReadAll(res.Body)
+			attest.Ok(t, err)
+			attest.Equal(t, res.StatusCode, http.StatusCreated)
+			attest.Equal(t, res.Header.Get("Location"), "/orders/1")
+			if i == 0 {
+				first = string(rb)
+				attest.Zero(t, res.Header.Get(IdempotentReplayedHeader))
+			} else {
+				attest.Equal(t, string(rb), first)
+				attest.Equal(t, res.Header.Get(IdempotentReplayedHeader), "true")
+			}
+		}
+		attest.Equal(t, count.Load(), 1)
+	})
+
+	t.Run("no key", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Idempotency(someIdempotencyHandler(count, nil, nil), nil, nil)
+
+		for i := 0; i < 3; i++ {
+			res := send(wrappedHandler, http.MethodPost, "", "item=book")
+			defer res.Body.Close()
+			attest.Equal(t, res.StatusCode, http.StatusCreated)
+		}
+		attest.Equal(t, count.Load(), 3)
+	})
+
+	t.Run("safe methods are not recorded", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Idempotency(someIdempotencyHandler(count, nil, nil), nil, nil)
+
+		for i := 0; i < 3; i++ {
+			res := send(wrappedHandler, http.MethodGet, "key-1", "")
+			defer res.Body.Close()
+			attest.Equal(t, res.StatusCode, http.StatusCreated)
+		}
+		attest.Equal(t, count.Load(), 3)
+	})
+
+	t.Run("key reused for different request", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Idempotency(someIdempotencyHandler(count, nil, nil), nil, nil)
+
+		res := send(wrappedHandler, http.MethodPost, "key-1", "item=book")
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusCreated)
+
+		res2 := send(wrappedHandler, http.MethodPost, "key-1", "item=pen")
+		defer res2.Body.Close()
+		attest.Equal(t, res2.StatusCode, http.StatusUnprocessableEntity)
+		attest.Equal(t, count.Load(), 1)
+	})
+
+	t.Run("server errors are not recorded", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Idempotency(someIdempotencyHandler(count, nil, nil), nil, nil)
+
+		for i := 0; i < 2; i++ {
+			res := send(wrappedHandler, http.MethodPost, "key-1", "fail")
+			defer res.Body.Close()
+			attest.Equal(t, res.StatusCode, http.StatusInternalServerError)
+		}
+		attest.Equal(t, count.Load(), 2)
+	})
+
+	t.Run("form key", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Idempotency(someIdempotencyHandler(count, nil, nil), nil, nil)
+
+		var key string
+		{
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			Idempotency(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					key = GetIdempotencyKey(r.Context())
+				}),
+				nil,
+				nil,
+			).ServeHTTP(rec, req)
+			attest.NotZero(t, key)
+		}
+
+		for i := 0; i < 2; i++ {
+			rec := httptest.NewRecorder()
+			form := url.Values{IdempotencyKeyFormName: {key}, "item": {"book"}}
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(form.Encode()))
+			req.Header.Set(ctHeader, formUrlEncoded)
+			wrappedHandler.ServeHTTP(rec, req)
+
+			res := rec.Result()
+			defer res.Body.Close()
+			attest.Equal(t, res.StatusCode, http.StatusCreated)
+		}
+		attest.Equal(t, count.Load(), 1)
+	})
+
+	t.Run("concurrent duplicate", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		started := make(chan struct{})
+		block := make(chan struct{})
+		wrappedHandler := Idempotency(someIdempotencyHandler(count, started, block), nil, nil)
+
+		var first *http.Response
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			first = send(wrappedHandler, http.MethodPost, "key-1", "item=book")
+		}()
+
+		// Wait for the first request to be in-flight.
+		<-started
+		res := send(wrappedHandler, http.MethodPost, "key-1", "item=book")
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusConflict)
+
+		close(block)
+		wg.Wait()
+		defer first.Body.Close()
+		attest.Equal(t, first.StatusCode, http.StatusCreated)
+		attest.Equal(t, count.Load(), 1)
+	})
+
+	t.Run("panic releases key", func(t *testing.T) {
+		t.Parallel()
+
+		count := 0
+		wrappedHandler := Idempotency(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				count = count + 1
+				if count == 1 {
+					panic("bad")
+				}
+				w.WriteHeader(http.StatusCreated)
+			}),
+			nil,
+			nil,
+		)
+
+		func() {
+			defer func() { _ = recover() }()
+			_ = send(wrappedHandler, http.MethodPost, "key-1", "item=book")
+		}()
+
+		res := send(wrappedHandler, http.MethodPost, "key-1", "item=book")
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusCreated)
+		attest.Equal(t, count, 2)
+	})
+
+	t.Run("key too long", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Idempotency(someIdempotencyHandler(count, nil, nil), nil, nil)
+
+		res := send(wrappedHandler, http.MethodPost, strings.Repeat("a", maxIdempotencyKeyLen+1), "item=book")
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusBadRequest)
+		attest.Equal(t, count.Load(), 0)
+
+		// Internal errors are not sent to the client.
+		rb, err := io.ReadAll(res.Body)
+		attest.Ok(t, err)
+		attest.Equal(t, res.Header.Get(ctHeader), problemContentType)
+		attest.Subsequence(t, string(rb), "The idempotency key is invalid.")
+		attest.False(t, strings.Contains(string(rb), "ong/"))
+		attest.Zero(t, res.Header.Get(ongMiddlewareErrorHeader))
+	})
+
+	t.Run("full store", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		store := newMemIdempotencyStore(DefaultIdempotencyKeyDuration, 1)
+		_, err := store.Begin("some-other-request", "f")
+		attest.Ok(t, err)
+		wrappedHandler := Idempotency(someIdempotencyHandler(count, nil, nil), store, nil)
+
+		res := send(wrappedHandler, http.MethodPost, "key-1", "item=book")
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusServiceUnavailable)
+		attest.Equal(t, res.Header.Get(retryAfterHeader), "5")
+		attest.Equal(t, count.Load(), 0)
+	})
+
+	t.Run("custom reject func", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		var got config.Rejection
+		rf := func(w http.ResponseWriter, r *http.Request, rj config.Rejection) {
+			got = rj
+			w.WriteHeader(rj.Status)
+		}
+		wrappedHandler := Idempotency(someIdempotencyHandler(count, nil, nil), nil, rf)
+
+		res := send(wrappedHandler, http.MethodPost, "key-1", "item=book")
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusCreated)
+
+		res2 := send(wrappedHandler, http.MethodPost, "key-1", "item=pen")
+		defer res2.Body.Close()
+		attest.Equal(t, res2.StatusCode, http.StatusUnprocessableEntity)
+		attest.Equal(t, got.Kind, config.RejectionIdempotency)
+		attest.ErrorIs(t, got.Reason, ErrIdempotencyMismatch)
+		attest.Equal(t, count.Load(), 1)
+	})
+
+	t.Run("keys are scoped to the client", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Idempotency(someIdempotencyHandler(count, nil, nil), nil, nil)
+
+		sendFrom := func(remoteAddr string, p *Principal) *http.Response {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("item=book"))
+			req.RemoteAddr = remoteAddr
+			req.Header.Set(IdempotencyKeyHeader, "key-1")
+			if p != nil {
+				req = req.WithContext(context.WithValue(req.Context(), principalCtxKey, *p))
+			}
+			wrappedHandler.ServeHTTP(rec, req)
+			return rec.Result()
+		}
+
+		res := sendFrom("198.51.100.1:80", nil)
+		defer res.Body.Close()
+		attest.Equal(t, res.Header.Get("Location"), "/orders/1")
+
+		// Another client using the same key does not get the response of the first one.
+		res2 := sendFrom("198.51.100.2:80", nil)
+		defer res2.Body.Close()
+		attest.Equal(t, res2.Header.Get("Location"), "/orders/2")
+		attest.Zero(t, res2.Header.Get(IdempotentReplayedHeader))
+
+		res3 := sendFrom("198.51.100.1:80", nil)
+		defer res3.Body.Close()
+		attest.Equal(t, res3.Header.Get("Location"), "/orders/1")
+		attest.Equal(t, res3.Header.Get(IdempotentReplayedHeader), "true")
+
+		// An authenticated client is identified by its principal, not its IP address.
+		alice := &Principal{ID: "alice", Scheme: "Basic"}
+		res4 := sendFrom("198.51.100.1:80", alice)
+		defer res4.Body.Close()
+		attest.Equal(t, res4.Header.Get("Location"), "/orders/3")
+
+		res5 := sendFrom("198.51.100.9:80", alice)
+		defer res5.Body.Close()
+		attest.Equal(t, res5.Header.Get("Location"), "/orders/3")
+		attest.Equal(t, res5.Header.Get(IdempotentReplayedHeader), "true")
+		attest.Equal(t, count.Load(), 3)
+	})
+
+	t.Run("cookies are not replayed", func(t *testing.T) {
+		t.Parallel()
+
+		count := &atomic.Int64{}
+		wrappedHandler := Idempotency(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				count.Add(1)
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret-of-first-client"})
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, "created")
+			}),
+			nil,
+			nil,
+		)
+
+		res := send(wrappedHandler, http.MethodPost, "key-1", "item=book")
+		defer res.Body.Close()
+		attest.Equal(t, len(res.Cookies()), 1)
+
+		res2 := send(wrappedHandler, http.MethodPost, "key-1", "item=book")
+		defer res2.Body.Close()
+		rb, err := io.ReadAll(res2.Body)
+		attest.Ok(t, err)
+		attest.Equal(t, res2.StatusCode, http.StatusCreated)
+		attest.Equal(t, string(rb), "created")
+		attest.Equal(t, res2.Header.Get(IdempotentReplayedHeader), "true")
+		attest.Equal(t, len(res2.Cookies()), 0)
+		attest.Equal(t, count.Load(), 1)
+	})
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("expiry", func(t *testing.T) {
+		t.Parallel()
+
+		s := NewIdempotencyStore(1 * time.Second)
+
+		res, err := s.Begin("k", "f")
+		attest.Ok(t, err)
+		attest.Zero(t, res)
+
+		err = s.Complete("k", IdempotentResponse{Code: http.StatusOK})
+		attest.Ok(t, err)
+
+		res, err = s.Begin("k", "f")
+		attest.Ok(t, err)
+		attest.Equal(t, res.Code, http.StatusOK)
+
+		time.Sleep(1100 * time.Millisecond)
+		res, err = s.Begin("k", "f")
+		attest.Ok(t, err)
+		attest.Zero(t, res)
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		t.Parallel()
+
+		s := NewIdempotencyStore(DefaultIdempotencyKeyDuration)
+
+		_, err := s.Begin("k", "f")
+		attest.Ok(t, err)
+
+		_, err = s.Begin("k", "f")
+		attest.Error(t, err)
+		attest.ErrorIs(t, err, ErrIdempotencyInFlight)
+
+		attest.Ok(t, s.Abort("k"))
+
+		_, err = s.Begin("k", "f")
+		attest.Ok(t, err)
+	})
+	t.Run("full store evicts oldest responses", func(t *testing.T) {
+		t.Parallel()
+
+		s := newMemIdempotencyStore(DefaultIdempotencyKeyDuration, 3)
+
+		for _, k := range []string{"a", "b"} {
+			_, err := s.Begin(k, "f")
+			attest.Ok(t, err)
+			attest.Ok(t, s.Complete(k, IdempotentResponse{Code: http.StatusCreated}))
+		}
+		_, err := s.Begin("inflight", "f")
+		attest.Ok(t, err)
+
+		// Makes room by removing "a", the oldest response.
+		_, err = s.Begin("c", "f")
+		attest.Ok(t, err)
+
+		res, err := s.Begin("b", "f")
+		attest.Ok(t, err)
+		attest.Equal(t, res.Code, http.StatusCreated)
+
+		_, err = s.Begin("inflight", "f")
+		attest.ErrorIs(t, err, ErrIdempotencyInFlight)
+
+		// "a" was removed, so it is processed afresh. That removes "b".
+		res, err = s.Begin("a", "f")
+		attest.Ok(t, err)
+		attest.Zero(t, res)
+		_, err = s.Begin("b", "f")
+		attest.ErrorIs(t, err, ErrIdempotencyStoreFull)
+	})
+
+	t.Run("full of in-flight keys", func(t *testing.T) {
+		t.Parallel()
+
+		s := newMemIdempotencyStore(DefaultIdempotencyKeyDuration, 2)
+		_, err := s.Begin("a", "f")
+		attest.Ok(t, err)
+		_, err = s.Begin("b", "f")
+		attest.Ok(t, err)
+
+		_, err = s.Begin("c", "f")
+		attest.ErrorIs(t, err, ErrIdempotencyStoreFull)
+
+		attest.Ok(t, s.Abort("a"))
+		_, err = s.Begin("c", "f")
+		attest.Ok(t, err)
+	})
+}
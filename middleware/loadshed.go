@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/internal/ometrics"
 )
 
 // Some of the code here is inspired by:
@@ -27,12 +28,14 @@ const (
 
 // loadShedder is a middleware that sheds load based on http response latencies.
 // It does not take into account latencies for requests to the pprof endpoints.
+// Requests that are shed are rendered using rf.
 func loadShedder(
 	wrappedHandler http.Handler,
 	loadShedSamplingPeriod time.Duration,
 	loadShedMinSampleSize int,
 	loadShedBreachLatency time.Duration,
 	loadShedPercentile float64,
+	rf config.RejectFunc,
 ) http.HandlerFunc {
 	// lq should not be a global variable, we want it to be per handler.
 	// This is because different handlers(URIs) could have different latencies and we want each to be loadshed independently.
@@ -89,14 +92,14 @@ func loadShedder(
 		pctl := lq.getPercentile(loadShedPercentile, loadShedMinSampleSize)
 		if pctl.Milliseconds() > loadShedBreachLatency.Milliseconds() && !sendProbe {
 			// drop request
-			err := fmt.Errorf("ong/middleware/loadshed: server is overloaded, retry after %s", retryAfter)
-			w.Header().Set(ongMiddlewareErrorHeader, fmt.Sprintf("%s. %vPercentile: %s. loadShedBreachLatency: %s", err.Error(), loadShedPercentile, pctl, loadShedBreachLatency))
-			w.Header().Set(retryAfterHeader, fmt.Sprintf("%d", int(retryAfter.Seconds()))) // header should be in seconds(decimal-integer).
-			http.Error(
-				w,
-				err.Error(),
-				http.StatusServiceUnavailable,
-			)
+			ometrics.LoadShed.Inc()
+			reject(w, r, rf, config.Rejection{
+				Kind:       config.RejectionLoadShed,
+				Status:     http.StatusServiceUnavailable,
+				RetryAfter: retryAfter,
+				Reason: fmt.Errorf("ong/middleware/loadshed: server is overloaded, retry after %s. %vPercentile: %s. loadShedBreachLatency: %s",
+					retryAfter, loadShedPercentile, pctl, loadShedBreachLatency),
+			})
 			return
 		}
 
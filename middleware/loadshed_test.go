@@ -42,6 +42,7 @@ func TestLoadShedder(t *testing.T) {
 			config.DefaultLoadShedMinSampleSize,
 			config.DefaultLoadShedBreachLatency,
 			99,
+			nil,
 		)
 
 		rec := httptest.NewRecorder()
@@ -71,6 +72,7 @@ func TestLoadShedder(t *testing.T) {
 			config.DefaultLoadShedMinSampleSize,
 			config.DefaultLoadShedBreachLatency,
 			99,
+			nil,
 		)
 
 		runhandler := func() {
@@ -276,6 +278,7 @@ func BenchmarkLoadShedder(b *testing.B) {
 		config.DefaultLoadShedMinSampleSize,
 		config.DefaultLoadShedBreachLatency,
 		99,
+		nil,
 	)
 
 	rec := httptest.NewRecorder()
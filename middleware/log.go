@@ -2,14 +2,18 @@ package middleware
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
 	mathRand "math/rand/v2"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/komuw/ong/internal/octx"
+	"github.com/komuw/ong/internal/ometrics"
 	"github.com/komuw/ong/log"
 )
 
@@ -30,6 +34,12 @@ func logger(
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		lrw := &logRW{ResponseWriter: w}
+		panicked := true
+		ph := &principalHolder{}
+		eh := &errorHolder{}
+		ctx := context.WithValue(r.Context(), principalHolderCtxKey, ph)
+		ctx = context.WithValue(ctx, errorHolderCtxKey, eh)
+		r = r.WithContext(ctx)
 
 		defer func() {
 			flds := []any{
@@ -45,6 +55,20 @@ func logger(
 				extra := []any{"ongError", ongError}
 				flds = append(flds, extra...)
 			}
+			if e := eh.rejection.Load(); e != nil {
+				// Set by [reject].
+				extra := []any{"ongError", (*e).Error()}
+				flds = append(flds, extra...)
+			}
+			if p := ph.p.Load(); p != nil {
+				extra := []any{principalLogField, p.Scheme + ":" + p.ID}
+				flds = append(flds, extra...)
+			}
+			if e := eh.err.Load(); e != nil {
+				// Set by [WriteError]. The logger renders its stack trace.
+				extra := []any{"error", *e}
+				flds = append(flds, extra...)
+			}
 
 			// Remove header so that users dont see it.
 			//
@@ -56,10 +80,38 @@ func logger(
 			lrw.Header().Del(ongMiddlewareErrorHeader)
 
 			logFunc(*r, w.Header().Clone(), lrw.code, flds)
+
+			{ // record metrics.
+				code := lrw.code
+				if panicked {
+					// The recoverer middleware will respond with a http 500.
+					code = http.StatusInternalServerError
+				} else if code == 0 {
+					code = http.StatusOK
+				}
+				route := routePattern(r)
+				ometrics.Requests.Inc(route, r.Method, strconv.Itoa(code))
+				ometrics.RequestDuration.Observe(time.Since(start).Seconds(), route, r.Method, strconv.Itoa(code))
+			}
 		}()
 
 		wrappedHandler.ServeHTTP(lrw, r)
+		panicked = false
+	}
+}
+
+// routePattern returns the pattern of the route that matched r, to be used as a metrics label.
+// Using the pattern rather than the path keeps the number of metric series bounded.
+func routePattern(r *http.Request) string {
+	if p, ok := r.Context().Value(octx.RouteCtxKey).(string); ok && p != "" {
+		// Set by [github.com/komuw/ong/mux]
+		return p
+	}
+	if r.Pattern != "" {
+		// Set by [http.ServeMux]
+		return r.Pattern
 	}
+	return "unknown"
 }
 
 // logRW provides an http.ResponseWriter interface, which logs requests/responses.
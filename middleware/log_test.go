@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"github.com/komuw/ong/id"
+	"github.com/komuw/ong/internal/octx"
+	"github.com/komuw/ong/internal/ometrics"
 	"github.com/komuw/ong/log"
 
 	"go.akshayshah.org/attest"
@@ -236,6 +238,35 @@ func TestLogMiddleware(t *testing.T) {
 		attest.Zero(t, logOutput.String())
 	})
 
+	t.Run("metrics", func(t *testing.T) {
+		t.Parallel()
+
+		route := "/metrics-test-" + id.New() + "/:id/"
+		wrappedHandler := logger(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost {
+					panic("bad")
+				}
+				w.WriteHeader(http.StatusAccepted)
+			}),
+			nil,
+			getLogger(&bytes.Buffer{}),
+		)
+
+		for _, method := range []string{http.MethodGet, http.MethodGet, http.MethodPost} {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(method, "/someUri", nil)
+			req = req.WithContext(context.WithValue(req.Context(), octx.RouteCtxKey, route))
+			func() {
+				defer func() { _ = recover() }()
+				wrappedHandler.ServeHTTP(rec, req)
+			}()
+		}
+
+		attest.Equal(t, ometrics.Requests.Value(route, http.MethodGet, "202"), 2)
+		attest.Equal(t, ometrics.Requests.Value(route, http.MethodPost, "500"), 1)
+	})
+
 	t.Run("concurrency safe", func(t *testing.T) {
 		t.Parallel()
 
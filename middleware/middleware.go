@@ -4,7 +4,7 @@
 // The middlewares [All], [Get], [Post], [Head], [Put] & [Delete] wrap other internal middleware.
 // The effect of this is that the aforementioned middleware, in addition to their specialised functionality, will:
 //
-//  1. Add logID for traceability.
+//  1. Add logID for traceability and join(or start) a W3C trace context.
 //  2. Add the "real" client IP address to the request context.
 //  3. Add client TLS fingerprint to the request context.
 //  4. Recover from panics in the wrappedHandler.
@@ -19,6 +19,9 @@
 //  13. Provide protection against Cross Site Request Forgeries(CSRF).
 //  14. Attempt to provide protection against form re-submission when a user reloads an already submitted web form.
 //  15. Implement http sessions.
+//
+// Some middlewares, like [BasicAuth], [Authenticate], [VerifyToken], [Idempotency] and [Cache], are not part of the default ones.
+// They are meant to be applied to individual handlers, where needed.
 package middleware
 
 import (
@@ -52,7 +55,7 @@ func allDefaultMiddlewares(
 ) http.HandlerFunc {
 	domain := o.Domain
 	httpsPort := o.HttpsPort
-	secretKey := o.SecretKey
+	kr := o.Keyring
 	strategy := o.Strategy
 
 	// logger
@@ -81,6 +84,13 @@ func allDefaultMiddlewares(
 	// session
 	sessionCookieDuration := o.SessionCookieDuration
 	SessionAntiReplayFunc := o.SessionAntiReplayFunc
+	sessionStore := o.SessionStore
+
+	// cookies
+	cookieOpts := o.CookieOpts
+
+	// rejections
+	rf := o.RejectFunc
 
 	// The way the middlewares are layered is:
 	// 1.  trace on outer most since we need to add logID's earliest for use by inner middlewares.
@@ -142,16 +152,20 @@ func allDefaultMiddlewares(
 														// reloadProtector(
 														session(
 															wrappedHandler,
-															string(secretKey),
+															kr,
+															sessionStore,
 															domain,
+															cookieOpts,
 															sessionCookieDuration,
 															SessionAntiReplayFunc,
 														),
 														// 	domain,
 														// ),
-														string(secretKey),
+														kr,
 														domain,
+														cookieOpts,
 														csrfTokenDuration,
+														rf,
 													),
 													allowedOrigins,
 													allowedMethods,
@@ -164,14 +178,17 @@ func allDefaultMiddlewares(
 											),
 											httpsPort,
 											domain,
+											rf,
 										),
 									),
 									loadShedSamplingPeriod,
 									loadShedMinSampleSize,
 									loadShedBreachLatency,
 									loadShedPercentile,
+									rf,
 								),
 								rateLimit,
+								rf,
 							),
 						),
 						logFunc,
@@ -179,6 +196,7 @@ func allDefaultMiddlewares(
 					),
 					logFunc,
 					l,
+					rf,
 				),
 			),
 			strategy,
@@ -208,25 +226,23 @@ func all(wrappedHandler http.Handler) http.HandlerFunc {
 // See the package documentation for the additional functionality provided by this middleware.
 func Get(wrappedHandler http.Handler, o config.Opts) http.HandlerFunc {
 	return allDefaultMiddlewares(
-		get(wrappedHandler),
+		get(wrappedHandler, o.RejectFunc),
 		o,
 	)
 }
 
-func get(wrappedHandler http.Handler) http.HandlerFunc {
+func get(wrappedHandler http.Handler, rf config.RejectFunc) http.HandlerFunc {
 	msg := "http method: %s not allowed. only allows http GET"
 	return func(w http.ResponseWriter, r *http.Request) {
 		// We do not need to allow `http.MethodOptions` here.
 		// This is coz, the cors middleware has already handled that for us and it comes before the Get middleware.
 		if r.Method != http.MethodGet {
-			errMsg := fmt.Sprintf(msg, r.Method)
-			w.Header().Set(ongMiddlewareErrorHeader, errMsg)
 			w.Header().Add(allowHeader, "GET")
-			http.Error(
-				w,
-				errMsg,
-				http.StatusMethodNotAllowed,
-			)
+			reject(w, r, rf, config.Rejection{
+				Kind:   config.RejectionMethod,
+				Status: http.StatusMethodNotAllowed,
+				Reason: fmt.Errorf(msg, r.Method),
+			})
 			return
 		}
 
@@ -239,23 +255,21 @@ func get(wrappedHandler http.Handler) http.HandlerFunc {
 // See the package documentation for the additional functionality provided by this middleware.
 func Post(wrappedHandler http.Handler, o config.Opts) http.HandlerFunc {
 	return allDefaultMiddlewares(
-		post(wrappedHandler),
+		post(wrappedHandler, o.RejectFunc),
 		o,
 	)
 }
 
-func post(wrappedHandler http.Handler) http.HandlerFunc {
+func post(wrappedHandler http.Handler, rf config.RejectFunc) http.HandlerFunc {
 	msg := "http method: %s not allowed. only allows http POST"
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			errMsg := fmt.Sprintf(msg, r.Method)
-			w.Header().Set(ongMiddlewareErrorHeader, errMsg)
 			w.Header().Add(allowHeader, "POST")
-			http.Error(
-				w,
-				errMsg,
-				http.StatusMethodNotAllowed,
-			)
+			reject(w, r, rf, config.Rejection{
+				Kind:   config.RejectionMethod,
+				Status: http.StatusMethodNotAllowed,
+				Reason: fmt.Errorf(msg, r.Method),
+			})
 			return
 		}
 
@@ -268,23 +282,21 @@ func post(wrappedHandler http.Handler) http.HandlerFunc {
 // See the package documentation for the additional functionality provided by this middleware.
 func Head(wrappedHandler http.Handler, o config.Opts) http.HandlerFunc {
 	return allDefaultMiddlewares(
-		head(wrappedHandler),
+		head(wrappedHandler, o.RejectFunc),
 		o,
 	)
 }
 
-func head(wrappedHandler http.Handler) http.HandlerFunc {
+func head(wrappedHandler http.Handler, rf config.RejectFunc) http.HandlerFunc {
 	msg := "http method: %s not allowed. only allows http HEAD"
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodHead {
-			errMsg := fmt.Sprintf(msg, r.Method)
-			w.Header().Set(ongMiddlewareErrorHeader, errMsg)
 			w.Header().Add(allowHeader, "HEAD")
-			http.Error(
-				w,
-				errMsg,
-				http.StatusMethodNotAllowed,
-			)
+			reject(w, r, rf, config.Rejection{
+				Kind:   config.RejectionMethod,
+				Status: http.StatusMethodNotAllowed,
+				Reason: fmt.Errorf(msg, r.Method),
+			})
 			return
 		}
 
@@ -297,23 +309,21 @@ func head(wrappedHandler http.Handler) http.HandlerFunc {
 // See the package documentation for the additional functionality provided by this middleware.
 func Put(wrappedHandler http.Handler, o config.Opts) http.HandlerFunc {
 	return allDefaultMiddlewares(
-		put(wrappedHandler),
+		put(wrappedHandler, o.RejectFunc),
 		o,
 	)
 }
 
-func put(wrappedHandler http.Handler) http.HandlerFunc {
+func put(wrappedHandler http.Handler, rf config.RejectFunc) http.HandlerFunc {
 	msg := "http method: %s not allowed. only allows http PUT"
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPut {
-			errMsg := fmt.Sprintf(msg, r.Method)
-			w.Header().Set(ongMiddlewareErrorHeader, errMsg)
 			w.Header().Add(allowHeader, "PUT")
-			http.Error(
-				w,
-				errMsg,
-				http.StatusMethodNotAllowed,
-			)
+			reject(w, r, rf, config.Rejection{
+				Kind:   config.RejectionMethod,
+				Status: http.StatusMethodNotAllowed,
+				Reason: fmt.Errorf(msg, r.Method),
+			})
 			return
 		}
 
@@ -326,24 +336,22 @@ func put(wrappedHandler http.Handler) http.HandlerFunc {
 // See the package documentation for the additional functionality provided by this middleware.
 func Delete(wrappedHandler http.Handler, o config.Opts) http.HandlerFunc {
 	return allDefaultMiddlewares(
-		deleteH(wrappedHandler),
+		deleteH(wrappedHandler, o.RejectFunc),
 		o,
 	)
 }
 
 // this is not called `delete` since that is a Go builtin func for deleting from maps.
-func deleteH(wrappedHandler http.Handler) http.HandlerFunc {
+func deleteH(wrappedHandler http.Handler, rf config.RejectFunc) http.HandlerFunc {
 	msg := "http method: %s not allowed. only allows http DELETE"
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodDelete {
-			errMsg := fmt.Sprintf(msg, r.Method)
-			w.Header().Set(ongMiddlewareErrorHeader, errMsg)
 			w.Header().Add(allowHeader, "DELETE")
-			http.Error(
-				w,
-				errMsg,
-				http.StatusMethodNotAllowed,
-			)
+			reject(w, r, rf, config.Rejection{
+				Kind:   config.RejectionMethod,
+				Status: http.StatusMethodNotAllowed,
+				Reason: fmt.Errorf(msg, r.Method),
+			})
 			return
 		}
 
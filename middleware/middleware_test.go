@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/cookie"
 	"github.com/komuw/ong/id"
 	"github.com/komuw/ong/internal/tst"
 	"github.com/komuw/ong/log"
@@ -57,7 +58,7 @@ func TestAllMiddleware(t *testing.T) {
 	l := log.New(context.Background(), &bytes.Buffer{}, 500)
 
 	msg := "hello world"
-	errMsg := "not allowed. only allows http"
+	errMsg := "The http method is not allowed."
 	tests := []struct {
 		name               string
 		middleware         func(wrappedHandler http.Handler, o config.Opts) http.HandlerFunc
@@ -488,6 +489,7 @@ func BenchmarkAllMiddlewares(b *testing.B) {
 		httpsPort,
 		l,
 		tst.SecretKey(),
+		nil,
 		config.DirectIpStrategy,
 		nil,
 		rateLimit,
@@ -503,6 +505,9 @@ func BenchmarkAllMiddlewares(b *testing.B) {
 		config.DefaultCsrfCookieDuration,
 		config.DefaultSessionCookieDuration,
 		config.DefaultSessionAntiReplayFunc,
+		nil,
+		cookie.Opts{},
+		nil,
 		20*1024*1024,
 		slog.LevelDebug,
 		1*time.Second,
@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/komuw/ong/errors"
+	"github.com/komuw/ong/internal/bind"
+	"github.com/komuw/ong/internal/octx"
+)
+
+const problemContentType = "application/problem+json"
+
+// FieldError is a validation failure of a single field of a request.
+type FieldError = bind.FieldError
+
+// FieldErrors are the validation failures of the fields of a request.
+// [WriteError] responds to them with a http 422 that lists each invalid field & why it is invalid.
+type FieldErrors = bind.FieldErrors
+
+type errorCtxKeyType string
+
+// errorHolderCtxKey is used to pass the error rendered by [WriteError] up to the [logger] middleware.
+const errorHolderCtxKey = errorCtxKeyType("errorHolderCtxKey")
+
+// errorHolder is added to the request context by the [logger] middleware.
+// It is filled in by [WriteError] & [reject] so that the logger, which wraps them, can log the errors.
+type errorHolder struct {
+	err atomic.Pointer[error]
+	// rejection is the reason why an ong middleware rejected the request.
+	rejection atomic.Pointer[error]
+}
+
+// problem is a [RFC 9457] problem details object.
+//
+// [RFC 9457]: https://www.rfc-editor.org/rfc/rfc9457.html
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// LogID is an extension member. It can be used by clients to refer to the request when reporting problems.
+	LogID string `json:"logID,omitempty"`
+	// RetryAfter is an extension member. It is the number of seconds that a client should wait before retrying.
+	RetryAfter int `json:"retryAfter,omitempty"`
+	// Errors is an extension member. It lists the fields of the request that are invalid.
+	Errors FieldErrors `json:"errors,omitempty"`
+}
+
+// WriteError responds to the request with err.
+//
+// The status code is the one added to err using [errors.WithStatus]. Otherwise; errors that wrap [fs.ErrNotExist] map to http 404,
+// [FieldErrors] to http 422, [fs.ErrPermission] to http 403, [http.MaxBytesError] to http 413, [context.DeadlineExceeded] to http 503 and any other error to http 500.
+// The response body is a [RFC 9457] problem+json document, or a html page if the client prefers html according to its Accept header.
+// Only the message added using [errors.WithStatus] and any [FieldErrors] are shown to the client, the message & stack trace of err are never sent.
+//
+// err is logged, together with its stack trace and the request's logID, by the ong [logger] middleware.
+// WriteError should not be called after the response headers have been written.
+//
+// [RFC 9457]: https://www.rfc-editor.org/rfc/rfc9457.html
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == nil {
+		return
+	}
+
+	if eh, ok := r.Context().Value(errorHolderCtxKey).(*errorHolder); ok {
+		eh.err.Store(&err)
+	}
+
+	p := newProblem(r, errorStatus(err), errors.PublicMessage(err))
+	var fe FieldErrors
+	if errors.As(err, &fe) {
+		p.Errors = fe
+	}
+	writeProblem(w, p, prefersHTML(r))
+}
+
+func newProblem(r *http.Request, code int, detail string) problem {
+	p := problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(code),
+		Status:   code,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	}
+	if id, ok := r.Context().Value(octx.LogCtxKey).(string); ok {
+		p.LogID = id
+	}
+	return p
+}
+
+// writeProblem writes p as a problem+json document, or as a html page if asHTML is true.
+func writeProblem(w http.ResponseWriter, p problem, asHTML bool) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set(xContentOptionsHeader, "nosniff")
+
+	if asHTML {
+		h.Set(ctHeader, "text/html; charset=utf-8")
+		w.WriteHeader(p.Status)
+		_, _ = fmt.Fprint(w, problemHTML(p))
+		return
+	}
+
+	b, errM := json.Marshal(p)
+	if errM != nil {
+		// Technically, this is unreachable since all the fields of problem are strings & ints.
+		b = []byte(`{"type":"about:blank","status":500}`)
+	}
+	h.Set(ctHeader, problemContentType)
+	w.WriteHeader(p.Status)
+	_, _ = w.Write(b)
+}
+
+// errorStatus returns the http status code that should be sent to clients for err.
+func errorStatus(err error) int {
+	if code := errors.Status(err); code >= 400 && code <= 599 {
+		return code
+	}
+
+	var (
+		mbe *http.MaxBytesError
+		fe  FieldErrors
+	)
+	switch {
+	case errors.As(err, &fe):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return http.StatusForbidden
+	case errors.As(err, &mbe):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// prefersHTML reports whether the client would rather get a html response than a json one.
+// Quality values are ignored, the media type that is listed first wins. Clients that do not mention html get json.
+func prefersHTML(r *http.Request) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, _ := strings.Cut(v, ";")
+		mt = strings.ToLower(strings.TrimSpace(mt))
+		switch {
+		case mt == "text/html" || mt == "application/xhtml+xml":
+			return true
+		case strings.HasSuffix(mt, "json"):
+			return false
+		}
+	}
+	return false
+}
+
+func problemHTML(p problem) string {
+	title := html.EscapeString(fmt.Sprintf("%d %s", p.Status, p.Title))
+	body := "<h1>" + title + "</h1>"
+	if p.Detail != "" {
+		body = body + "\n<p>" + html.EscapeString(p.Detail) + "</p>"
+	}
+	if len(p.Errors) > 0 {
+		body = body + "\n<ul>"
+		for _, e := range p.Errors {
+			body = body + "\n<li>" + html.EscapeString(e.Field) + " " + html.EscapeString(e.Message) + "</li>"
+		}
+		body = body + "\n</ul>"
+	}
+	if p.LogID != "" {
+		body = body + "\n<p><small>logID: " + html.EscapeString(p.LogID) + "</small></p>"
+	}
+
+	return `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>` + title + `</title>
+</head>
+<body>
+` + body + `
+</body>
+</html>
+`
+}
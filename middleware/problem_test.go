@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/komuw/ong/errors"
+	"github.com/komuw/ong/internal/octx"
+	"github.com/komuw/ong/log"
+
+	"go.akshayshah.org/attest"
+)
+
+func handlerThatErrs(err error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, err)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	t.Parallel()
+
+	t.Run("problem json", func(t *testing.T) {
+		t.Parallel()
+
+		err := errors.WithStatus(errors.New("user 42 not in table users"), http.StatusNotFound, "no such user")
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+		req = req.WithContext(context.WithValue(req.Context(), octx.LogCtxKey, "some-log-id"))
+		req.Header.Set("Accept", "application/json")
+		handlerThatErrs(err).ServeHTTP(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusNotFound)
+		attest.Equal(t, res.Header.Get(ctHeader), problemContentType)
+
+		var p problem
+		attest.Ok(t, json.NewDecoder(res.Body).Decode(&p))
+		attest.Equal(t, p, problem{
+			Type:     "about:blank",
+			Title:    "Not Found",
+			Status:   http.StatusNotFound,
+			Detail:   "no such user",
+			Instance: "/users/42",
+			LogID:    "some-log-id",
+		})
+	})
+
+	t.Run("html", func(t *testing.T) {
+		t.Parallel()
+
+		err := errors.WithStatus(errors.New("bad"), http.StatusBadRequest, "<script>alert(1)</script>")
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		handlerThatErrs(err).ServeHTTP(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		b, errR := io.ReadAll(res.Body)
+		attest.Ok(t, errR)
+		attest.Equal(t, res.StatusCode, http.StatusBadRequest)
+		attest.Equal(t, res.Header.Get(ctHeader), "text/html; charset=utf-8")
+		attest.Subsequence(t, string(b), "400 Bad Request")
+		attest.Subsequence(t, string(b), "&lt;script&gt;alert(1)&lt;/script&gt;")
+		attest.False(t, strings.Contains(string(b), "<script>"))
+	})
+
+	t.Run("internal details are not leaked", func(t *testing.T) {
+		t.Parallel()
+
+		err := fmt.Errorf("query failed: %w", errors.New("password=hunter2"))
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		handlerThatErrs(err).ServeHTTP(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		b, errR := io.ReadAll(res.Body)
+		attest.Ok(t, errR)
+		attest.Equal(t, res.StatusCode, http.StatusInternalServerError)
+		attest.Equal(t, res.Header.Get(ctHeader), problemContentType)
+		attest.False(t, strings.Contains(string(b), "hunter2"))
+		attest.False(t, strings.Contains(string(b), "problem_test.go"))
+	})
+
+	t.Run("status mapping", func(t *testing.T) {
+		t.Parallel()
+
+		_, errOpen := os.Open("/this/does/not/exist")
+		tests := []struct {
+			err  error
+			code int
+		}{
+			{errOpen, http.StatusNotFound},
+			{fs.ErrPermission, http.StatusForbidden},
+			{&http.MaxBytesError{Limit: 10}, http.StatusRequestEntityTooLarge},
+			{fmt.Errorf("db: %w", context.DeadlineExceeded), http.StatusServiceUnavailable},
+			{errors.New("bad"), http.StatusInternalServerError},
+			{errors.WithStatus(errors.New("bad"), 200, ""), http.StatusInternalServerError}, // not an error status.
+			{errors.WithStatus(errOpen, http.StatusGone, ""), http.StatusGone},
+		}
+		for _, tt := range tests {
+			attest.Equal(t, errorStatus(tt.err), tt.code, attest.Sprintf("err: %v", tt.err))
+		}
+	})
+
+	t.Run("field errors", func(t *testing.T) {
+		t.Parallel()
+
+		err := errors.Wrap(FieldErrors{
+			{Field: "title", Message: "is required"},
+			{Field: "pages", Message: "must be at least 1"},
+		})
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/books", nil)
+		handlerThatErrs(err).ServeHTTP(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusUnprocessableEntity)
+		attest.Equal(t, res.Header.Get(ctHeader), problemContentType)
+
+		var p problem
+		attest.Ok(t, json.NewDecoder(res.Body).Decode(&p))
+		attest.Equal(t, p.Errors, FieldErrors{
+			{Field: "title", Message: "is required"},
+			{Field: "pages", Message: "must be at least 1"},
+		})
+	})
+
+	t.Run("error is logged", func(t *testing.T) {
+		t.Parallel()
+
+		w := &bytes.Buffer{}
+		l := log.New(context.Background(), w, 500)
+		err := errors.WithStatus(errors.New("user 42 not in table users"), http.StatusConflict, "user exists")
+		h := logger(handlerThatErrs(err), nil, l)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+		h.ServeHTTP(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusConflict)
+		attest.Subsequence(t, w.String(), "user 42 not in table users")
+		attest.Subsequence(t, w.String(), "middleware/problem_test.go")
+		attest.Subsequence(t, w.String(), "logID")
+	})
+
+	t.Run("stack of error wrapped by stdlib is logged", func(t *testing.T) {
+		t.Parallel()
+
+		w := &bytes.Buffer{}
+		l := log.New(context.Background(), w, 500)
+		err := fmt.Errorf("load user: %w", errors.New("db down"))
+		err = errors.WithStatus(err, http.StatusServiceUnavailable, "try later")
+		h := logger(handlerThatErrs(err), nil, l)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+		h.ServeHTTP(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusServiceUnavailable)
+		attest.Subsequence(t, w.String(), "load user: db down")
+		attest.Subsequence(t, w.String(), `"stack"`)
+		attest.Subsequence(t, w.String(), "middleware/problem_test.go")
+	})
+}
+
+func TestPrefersHTML(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		accept string
+		html   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", false},
+		{"application/problem+json, text/html", false},
+		{"text/html", true},
+		{"TEXT/HTML; q=0.9, application/json", true},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		attest.Equal(t, prefersHTML(req), tt.html, attest.Sprintf("accept: %s", tt.accept))
+	}
+}
@@ -8,15 +8,18 @@ import (
 	"time"
 
 	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/internal/ometrics"
 )
 
 // Some of the code here is inspired by(or taken from):
 //   (a) https://github.com/komuw/naz/blob/v0.8.1/naz/ratelimiter.py whose license(MIT) can be found here: https://github.com/komuw/naz/blob/v0.8.1/LICENSE.txt
 
 // rateLimiter is a middleware that limits requests by IP address.
+// Requests that are rate limited are rendered using rf.
 func rateLimiter(
 	wrappedHandler http.Handler,
 	rateLimit float64,
+	rf config.RejectFunc,
 ) http.HandlerFunc {
 	rl := newRl()
 	const retryAfter = 15 * time.Minute
@@ -32,14 +35,13 @@ func rateLimiter(
 		tb := rl.get(host, rateLimit)
 
 		if !tb.allow() {
-			err := fmt.Errorf("ong/middleware/ratelimiter: rate limited, retry after %s", retryAfter)
-			w.Header().Set(ongMiddlewareErrorHeader, err.Error())
-			w.Header().Set(retryAfterHeader, fmt.Sprintf("%d", int(retryAfter.Seconds()))) // header should be in seconds(decimal-integer).
-			http.Error(
-				w,
-				err.Error(),
-				http.StatusTooManyRequests,
-			)
+			ometrics.RateLimited.Inc()
+			reject(w, r, rf, config.Rejection{
+				Kind:       config.RejectionRateLimit,
+				Status:     http.StatusTooManyRequests,
+				RetryAfter: retryAfter,
+				Reason:     fmt.Errorf("ong/middleware/ratelimiter: rate limited, retry after %s", retryAfter),
+			})
 			return
 		}
 
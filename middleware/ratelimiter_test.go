@@ -27,7 +27,7 @@ func TestRateLimiter(t *testing.T) {
 		t.Parallel()
 
 		msg := "hello"
-		wrappedHandler := rateLimiter(someRateLimiterHandler(msg), config.DefaultRateLimit)
+		wrappedHandler := rateLimiter(someRateLimiterHandler(msg), config.DefaultRateLimit, nil)
 
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
@@ -47,7 +47,7 @@ func TestRateLimiter(t *testing.T) {
 		t.Parallel()
 
 		msg := "hello"
-		wrappedHandler := rateLimiter(someRateLimiterHandler(msg), config.DefaultRateLimit)
+		wrappedHandler := rateLimiter(someRateLimiterHandler(msg), config.DefaultRateLimit, nil)
 
 		msgsDelivered := []int{}
 		start := time.Now().UTC()
@@ -83,7 +83,7 @@ func TestRateLimiter(t *testing.T) {
 		t.Parallel()
 
 		msg := "hello"
-		wrappedHandler := rateLimiter(someRateLimiterHandler(msg), config.DefaultRateLimit)
+		wrappedHandler := rateLimiter(someRateLimiterHandler(msg), config.DefaultRateLimit, nil)
 
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
@@ -106,7 +106,7 @@ func TestRateLimiter(t *testing.T) {
 		msg := "hello"
 		// for this concurrency test, we have to re-use the same wrappedHandler
 		// so that state is shared and thus we can see if there is any state which is not handled correctly.
-		wrappedHandler := rateLimiter(someRateLimiterHandler(msg), config.DefaultRateLimit)
+		wrappedHandler := rateLimiter(someRateLimiterHandler(msg), config.DefaultRateLimit, nil)
 
 		runhandler := func() {
 			rec := httptest.NewRecorder()
@@ -5,18 +5,21 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/komuw/ong/config"
 	"github.com/komuw/ong/errors"
+	"github.com/komuw/ong/internal/ometrics"
 )
 
 // Some of the code here is inspired(or taken from) by:
 //   (a) https://github.com/eliben/code-for-blog whose license(Unlicense) can be found here: https://github.com/eliben/code-for-blog/blob/464a32f686d7646ba3fc612c19dbb550ec8a05b1/LICENSE
 
 // recoverer is a middleware that recovers from panics in wrappedHandler.
-// When/if a panic occurs, it logs the stack trace and returns an InternalServerError response.
+// When/if a panic occurs, it logs the stack trace and returns an InternalServerError response that is rendered using rf.
 func recoverer(
 	wrappedHandler http.Handler,
 	logFunc func(r http.Request, response http.Header, statusCode int, fields []any),
 	l *slog.Logger,
+	rf config.RejectFunc,
 ) http.HandlerFunc {
 	code := http.StatusInternalServerError
 	status := http.StatusText(code)
@@ -29,6 +32,7 @@ func recoverer(
 		defer func() {
 			errR := recover()
 			if errR != nil {
+				ometrics.Panics.Inc()
 
 				flds := []any{
 					"clientIP", ClientIP(r),
@@ -52,20 +56,22 @@ func recoverer(
 				// 1xx class or the modified headers are trailers.
 				w.Header().Del(ongMiddlewareErrorHeader)
 
-				extra := []any{"error", fmt.Sprint(errR)}
+				reason := fmt.Errorf("%v", errR)
+				extra := []any{"error", reason.Error()}
 				if e, ok := errR.(error); ok {
-					extra = []any{"error", errors.Wrap(e)} // wrap with ong/errors so that the log will have a stacktrace.
+					reason = errors.Wrap(e) // wrap with ong/errors so that the log will have a stacktrace.
+					extra = []any{"error", reason}
 				}
 				flds = append(flds, extra...)
 
 				logFunc(*r, w.Header().Clone(), code, flds)
 
 				// respond.
-				http.Error(
-					w,
-					status,
-					code,
-				)
+				reject(w, r, rf, config.Rejection{
+					Kind:   config.RejectionPanic,
+					Status: code,
+					Reason: reason,
+				})
 			}
 		}()
 
@@ -56,7 +56,7 @@ func TestPanic(t *testing.T) {
 
 		logOutput := &bytes.Buffer{}
 		msg := "hello"
-		wrappedHandler := recoverer(handlerThatPanics(msg, false, nil), nil, getLogger(logOutput))
+		wrappedHandler := recoverer(handlerThatPanics(msg, false, nil), nil, getLogger(logOutput), nil)
 
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
@@ -73,7 +73,7 @@ func TestPanic(t *testing.T) {
 
 		logOutput := &bytes.Buffer{}
 		msg := "hello"
-		wrappedHandler := recoverer(handlerThatPanics(msg, true, nil), nil, getLogger(logOutput))
+		wrappedHandler := recoverer(handlerThatPanics(msg, true, nil), nil, getLogger(logOutput), nil)
 
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
@@ -103,7 +103,7 @@ func TestPanic(t *testing.T) {
 		msg := "hello"
 		errMsg := "99 problems"
 		err := errors.New(errMsg)
-		wrappedHandler := recoverer(handlerThatPanics(msg, false, err), nil, getLogger(logOutput))
+		wrappedHandler := recoverer(handlerThatPanics(msg, false, err), nil, getLogger(logOutput), nil)
 
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
@@ -131,7 +131,7 @@ func TestPanic(t *testing.T) {
 		t.Parallel()
 
 		logOutput := &bytes.Buffer{}
-		wrappedHandler := recoverer(anotherHandlerThatPanics(), nil, getLogger(logOutput))
+		wrappedHandler := recoverer(anotherHandlerThatPanics(), nil, getLogger(logOutput), nil)
 
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
@@ -140,7 +140,7 @@ func TestPanic(t *testing.T) {
 		res := rec.Result()
 		defer res.Body.Close()
 		attest.Equal(t, res.StatusCode, http.StatusInternalServerError)
-		attest.Subsequence(t, logOutput.String(), "middleware/recoverer_test.go:41") // line where panic happened.
+		attest.Subsequence(t, logOutput.String(), `middleware/recoverer_test.go","line":41`) // line where panic happened.
 	})
 
 	t.Run("concurrency safe", func(t *testing.T) {
@@ -152,7 +152,7 @@ func TestPanic(t *testing.T) {
 		err := errors.New(msg)
 		// for this concurrency test, we have to re-use the same wrappedHandler
 		// so that state is shared and thus we can see if there is any state which is not handled correctly.
-		wrappedHandler := recoverer(handlerThatPanics(msg, false, err), nil, getLogger(logOutput))
+		wrappedHandler := recoverer(handlerThatPanics(msg, false, err), nil, getLogger(logOutput), nil)
 
 		runhandler := func() {
 			rec := httptest.NewRecorder()
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"net/netip"
 	"strings"
+
+	"github.com/komuw/ong/config"
 )
 
 // httpsRedirector is a middleware that redirects http requests to https.
@@ -13,9 +15,10 @@ import (
 //
 // domain is the domain name of your website.
 // httpsPort is the tls port where http requests will be redirected to.
+// rf renders the response of requests whose HOST http header does not match domain.
 //
 // [DNS rebinding]: https://en.wikipedia.org/wiki/DNS_rebinding
-func httpsRedirector(wrappedHandler http.Handler, httpsPort uint16, domain string) http.HandlerFunc {
+func httpsRedirector(wrappedHandler http.Handler, httpsPort uint16, domain string, rf config.RejectFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		host, _ := getHostPort(r.Host)
 
@@ -66,13 +69,11 @@ func httpsRedirector(wrappedHandler http.Handler, httpsPort uint16, domain strin
 			// see; https://github.com/golang/go/blob/master/src/net/http/client.go#L1001-L1003
 			// We know that domain is kinda already canonical since [New] validates that. But host is not.
 			if !isDomainOrSubdomain(host, domain) {
-				err := fmt.Errorf("ong/middleware/redirect: the HOST http header has an unexpected value: %s", host)
-				w.Header().Set(ongMiddlewareErrorHeader, err.Error())
-				http.Error(
-					w,
-					err.Error(),
-					http.StatusNotFound,
-				)
+				reject(w, r, rf, config.Rejection{
+					Kind:   config.RejectionHost,
+					Status: http.StatusNotFound,
+					Reason: fmt.Errorf("ong/middleware/redirect: the HOST http header has an unexpected value: %s", host),
+				})
 				return
 			}
 		}
@@ -46,7 +46,7 @@ func TestHttpsRedirector(t *testing.T) {
 
 		msg := "hello world"
 		port := uint16(443)
-		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), port, "localhost")
+		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), port, "localhost", nil)
 
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
@@ -66,7 +66,7 @@ func TestHttpsRedirector(t *testing.T) {
 
 		msg := "hello world"
 		port := uint16(443)
-		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), port, "localhost")
+		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), port, "localhost", nil)
 
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
@@ -86,7 +86,7 @@ func TestHttpsRedirector(t *testing.T) {
 
 		msg := "hello you"
 		port := uint16(443)
-		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), port, "localhost")
+		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), port, "localhost", nil)
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest(http.MethodPost, "/someUri", nil)
 		req.Host = "localhost"
@@ -105,7 +105,7 @@ func TestHttpsRedirector(t *testing.T) {
 
 		msg := "hello world"
 		port := uint16(443)
-		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), port, "localhost")
+		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), port, "localhost", nil)
 
 		for _, uri := range []string{
 			"/someUri",
@@ -143,7 +143,7 @@ func TestHttpsRedirector(t *testing.T) {
 		msg := "hello world"
 		httpsPort := tst.GetPort()
 		domain := "localhost"
-		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), httpsPort, domain)
+		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), httpsPort, domain, nil)
 
 		ts, err := tst.TlsServer(wrappedHandler, domain, httpsPort)
 		attest.Ok(t, err)
@@ -170,7 +170,7 @@ func TestHttpsRedirector(t *testing.T) {
 		msg := "hello world"
 		httpsPort := tst.GetPort()
 		domain := "localhost"
-		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), httpsPort, domain)
+		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), httpsPort, domain, nil)
 
 		ts, err := tst.TlsServer(wrappedHandler, domain, httpsPort)
 		attest.Ok(t, err)
@@ -203,7 +203,7 @@ func TestHttpsRedirector(t *testing.T) {
 			uint16(88),
 			uint16(65535),
 		} {
-			wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), p, domain)
+			wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), p, domain, nil)
 			rec := httptest.NewRecorder()
 			req := httptest.NewRequest(http.MethodGet, uri, nil)
 			req.Host = domain
@@ -230,7 +230,7 @@ func TestHttpsRedirector(t *testing.T) {
 
 		httpsPort := tst.GetPort()
 		domain := "localhost"
-		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), httpsPort, domain)
+		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), httpsPort, domain, nil)
 
 		ts, errTls := tst.TlsServer(wrappedHandler, domain, httpsPort)
 		attest.Ok(t, errTls)
@@ -275,7 +275,7 @@ func TestHttpsRedirector(t *testing.T) {
 		msg := "hello world"
 		port := uint16(443)
 		domain := "localhost"
-		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), port, domain)
+		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), port, domain, nil)
 		ts := httptest.NewTLSServer(
 			wrappedHandler,
 		)
@@ -305,7 +305,7 @@ func TestHttpsRedirector(t *testing.T) {
 				name:         "bad host",
 				host:         "example.com",
 				expectedCode: http.StatusNotFound,
-				expectedMsg:  "has an unexpected value",
+				expectedMsg:  `"status":404`,
 			},
 		}
 		for _, tt := range tests {
@@ -340,7 +340,7 @@ func TestHttpsRedirector(t *testing.T) {
 		port := uint16(443)
 		// for this concurrency test, we have to re-use the same wrappedHandler
 		// so that state is shared and thus we can see if there is any state which is not handled correctly.
-		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), port, "localhost")
+		wrappedHandler := httpsRedirector(someHttpsRedirectorHandler(msg), port, "localhost", nil)
 
 		runhandler := func() {
 			rec := httptest.NewRecorder()
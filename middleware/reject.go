@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/komuw/ong/config"
+)
+
+var (
+	_ config.RejectFunc = RejectJSON
+	_ config.RejectFunc = RejectHTML
+)
+
+// reject responds to a request that has been rejected by one of the ong middlewares, using rf.
+// If rf is nil, [RejectJSON] or [RejectHTML] is used depending on the Accept header of the request.
+//
+// The reason for the rejection is logged by the [logger] middleware, it is never sent to the client.
+func reject(w http.ResponseWriter, r *http.Request, rf config.RejectFunc, rj config.Rejection) {
+	if rj.Reason != nil {
+		if eh, ok := r.Context().Value(errorHolderCtxKey).(*errorHolder); ok {
+			eh.rejection.Store(&rj.Reason)
+		}
+	}
+	if rj.RetryAfter > 0 {
+		w.Header().Set(retryAfterHeader, fmt.Sprintf("%d", int(rj.RetryAfter.Seconds()))) // header should be in seconds(decimal-integer).
+	}
+
+	if rf == nil {
+		rf = RejectJSON
+		if prefersHTML(r) {
+			rf = RejectHTML
+		}
+	}
+	rf(w, r, rj)
+}
+
+// RejectJSON is a [config.RejectFunc] that renders rejections as a [RFC 9457] problem+json document.
+// Only [config.Rejection.Message] is shown to the client.
+//
+// [RFC 9457]: https://www.rfc-editor.org/rfc/rfc9457.html
+func RejectJSON(w http.ResponseWriter, r *http.Request, rj config.Rejection) {
+	writeProblem(w, rejectionProblem(r, rj), false)
+}
+
+// RejectHTML is a [config.RejectFunc] that renders rejections as a html page.
+// Only [config.Rejection.Message] is shown to the client.
+func RejectHTML(w http.ResponseWriter, r *http.Request, rj config.Rejection) {
+	writeProblem(w, rejectionProblem(r, rj), true)
+}
+
+func rejectionProblem(r *http.Request, rj config.Rejection) problem {
+	p := newProblem(r, rj.Status, rj.Message())
+	p.RetryAfter = int(rj.RetryAfter.Seconds())
+	return p
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/komuw/ong/config"
+
+	"go.akshayshah.org/attest"
+)
+
+func TestReject(t *testing.T) {
+	t.Parallel()
+
+	rateLimited := func() config.Rejection {
+		return config.Rejection{
+			Kind:       config.RejectionRateLimit,
+			Status:     http.StatusTooManyRequests,
+			RetryAfter: 15 * time.Minute,
+			Reason:     errors.New("ong/middleware/ratelimiter: rate limited"),
+		}
+	}
+
+	t.Run("json by default", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		reject(rec, req, nil, rateLimited())
+
+		res := rec.Result()
+		defer res.Body.Close()
+		rb, err := io.ReadAll(res.Body)
+		attest.Ok(t, err)
+
+		attest.Equal(t, res.StatusCode, http.StatusTooManyRequests)
+		attest.Equal(t, res.Header.Get(ctHeader), problemContentType)
+		attest.Equal(t, res.Header.Get(retryAfterHeader), "900")
+		attest.False(t, strings.Contains(string(rb), "ong/"))
+		attest.Zero(t, res.Header.Get(ongMiddlewareErrorHeader))
+
+		var p problem
+		attest.Ok(t, json.Unmarshal(rb, &p))
+		attest.Equal(t, p.Detail, "Too many requests, retry after 15m0s.")
+		attest.Equal(t, p.RetryAfter, 900)
+	})
+
+	t.Run("html if preferred", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req.Header.Set("Accept", "text/html")
+		reject(rec, req, nil, rateLimited())
+
+		res := rec.Result()
+		defer res.Body.Close()
+		rb, err := io.ReadAll(res.Body)
+		attest.Ok(t, err)
+
+		attest.Equal(t, res.StatusCode, http.StatusTooManyRequests)
+		attest.Equal(t, res.Header.Get(ctHeader), "text/html; charset=utf-8")
+		attest.Subsequence(t, string(rb), "Too many requests, retry after 15m0s.")
+		attest.False(t, strings.Contains(string(rb), "ong/"))
+	})
+
+	t.Run("built-in renderers", func(t *testing.T) {
+		t.Parallel()
+
+		for _, rf := range []config.RejectFunc{RejectJSON, RejectHTML} {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+			req.Header.Set("Accept", "*/*")
+			reject(rec, req, rf, rateLimited())
+
+			res := rec.Result()
+			defer res.Body.Close()
+			attest.Equal(t, res.StatusCode, http.StatusTooManyRequests)
+		}
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		t.Parallel()
+
+		var got config.Rejection
+		rf := func(w http.ResponseWriter, r *http.Request, rj config.Rejection) {
+			got = rj
+			w.WriteHeader(rj.Status)
+			_, _ = io.WriteString(w, "slow down")
+		}
+		h := rateLimiter(someRateLimiterHandler("hello"), 1.0, rf)
+
+		var res *http.Response
+		for range 5 {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+			h.ServeHTTP(rec, req)
+			res = rec.Result()
+			defer res.Body.Close()
+			if res.StatusCode == http.StatusTooManyRequests {
+				break
+			}
+		}
+		rb, err := io.ReadAll(res.Body)
+		attest.Ok(t, err)
+
+		attest.Equal(t, res.StatusCode, http.StatusTooManyRequests)
+		attest.Equal(t, string(rb), "slow down")
+		attest.NotZero(t, res.Header.Get(retryAfterHeader))
+		attest.Equal(t, got.Kind, config.RejectionRateLimit)
+		attest.Equal(t, got.RetryAfter, 15*time.Minute)
+		attest.Subsequence(t, got.Reason.Error(), "ong/middleware/ratelimiter")
+	})
+
+	t.Run("reason is logged", func(t *testing.T) {
+		t.Parallel()
+
+		var fields []any
+		h := logger(
+			get(someMiddlewareTestHandler("hello"), nil),
+			func(_ http.Request, _ http.Header, _ int, flds []any) { fields = flds },
+			nil,
+		)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/someUri", nil)
+		h.ServeHTTP(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		rb, err := io.ReadAll(res.Body)
+		attest.Ok(t, err)
+
+		attest.Equal(t, res.StatusCode, http.StatusMethodNotAllowed)
+		attest.Equal(t, res.Header.Get(allowHeader), "GET")
+		attest.False(t, strings.Contains(string(rb), "only allows http GET"))
+		attest.Subsequence(t, fmt.Sprint(fields), "ongError http method: PUT not allowed. only allows http GET")
+	})
+}
@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/cookie"
+	"github.com/komuw/ong/cry"
 	"github.com/komuw/ong/sess"
 )
 
@@ -18,8 +20,10 @@ import (
 // This middleware works best when used together with the [sess] package.
 func session(
 	wrappedHandler http.Handler,
-	secretKey string,
+	kr *cry.Keyring,
+	store sess.Store,
 	domain string,
+	co cookie.Opts,
 	sessionCookieDuration time.Duration,
 	antiReplay func(r http.Request) string,
 ) http.HandlerFunc {
@@ -31,9 +35,9 @@ func session(
 		// 1. Set anti replay data.
 		// 2. Read from cookies and check for session cookie.
 		// 3. Get that cookie and save it to r.context
-		r = sess.Initialise(r, secretKey, antiReplay(*r))
+		r = sess.Initialise(r, kr, store, co, antiReplay(*r))
 
-		srw := newSessRW(w, r, domain, secretKey, sessionCookieDuration)
+		srw := newSessRW(w, r, domain, kr, store, sessionCookieDuration)
 
 		wrappedHandler.ServeHTTP(srw, r)
 	}
@@ -44,7 +48,8 @@ type sessRW struct {
 	http.ResponseWriter
 	r                     *http.Request
 	domain                string
-	secretKey             string
+	kr                    *cry.Keyring
+	store                 sess.Store
 	sessionCookieDuration time.Duration
 	written               bool
 }
@@ -66,42 +71,59 @@ func newSessRW(
 	w http.ResponseWriter,
 	r *http.Request,
 	domain string,
-	secretKey string,
+	kr *cry.Keyring,
+	store sess.Store,
 	sessionCookieDuration time.Duration,
 ) *sessRW {
 	return &sessRW{
 		ResponseWriter:        w,
 		r:                     r,
 		domain:                domain,
-		secretKey:             secretKey,
+		kr:                    kr,
+		store:                 store,
 		sessionCookieDuration: sessionCookieDuration,
 		written:               false,
 	}
 }
 
-// Write saves session data.
-func (srw *sessRW) Write(b []byte) (int, error) {
+// save writes the session to the response, if it has not already been written.
+func (srw *sessRW) save() {
 	// 3. Save session cookie to response.
 
 	// We have to call `sess.Save` here.
 	//
 	// According to: https://pkg.go.dev/net/http#ResponseWriter
 	// Changing the header map after a call to WriteHeader/Write has no effect unless in some specific cases.
-	// Thus, we call sess.Save here just before any call to `ResponseWriter.Write` goes through.
+	// Thus, we call sess.Save just before any call to `ResponseWriter.WriteHeader` or `ResponseWriter.Write` goes through.
 	if !srw.written {
 		sess.Save(
 			srw.r,
 			srw.ResponseWriter,
 			srw.domain,
 			srw.sessionCookieDuration,
-			srw.secretKey,
+			srw.kr,
+			srw.store,
 		)
 		srw.written = true
 	}
+}
 
+// Write saves session data.
+func (srw *sessRW) Write(b []byte) (int, error) {
+	srw.save()
 	return srw.ResponseWriter.Write(b)
 }
 
+// WriteHeader saves session data.
+// This is needed for responses that have no body, like redirects.
+func (srw *sessRW) WriteHeader(statusCode int) {
+	if statusCode >= http.StatusOK {
+		// Informational(1xx) responses are followed by the final response, which is the one that should carry the session.
+		srw.save()
+	}
+	srw.ResponseWriter.WriteHeader(statusCode)
+}
+
 // Flush implements http.Flusher
 func (srw *sessRW) Flush() {
 	if fw, ok := srw.ResponseWriter.(http.Flusher); ok {
@@ -130,6 +152,7 @@ func (srw *sessRW) Push(target string, opts *http.PushOptions) error {
 // https://github.com/caddyserver/caddy/pull/5022
 // https://github.com/caddyserver/caddy/blob/v2.7.4/modules/caddyhttp/responsewriter.go#L45-L49
 func (srw *sessRW) ReadFrom(src io.Reader) (n int64, err error) {
+	srw.save()
 	return io.Copy(srw.ResponseWriter, src)
 }
 
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"io"
@@ -8,10 +9,10 @@ import (
 	"net/http/httptest"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/komuw/ong/config"
 	"github.com/komuw/ong/cookie"
-	"github.com/komuw/ong/internal/tst"
 	"github.com/komuw/ong/sess"
 
 	"go.akshayshah.org/attest"
@@ -69,14 +70,16 @@ func TestSession(t *testing.T) {
 		t.Parallel()
 
 		msg := "hello"
-		secretKey := tst.SecretKey()
+		kr := testKeyring(t)
 		domain := "localhost"
 		key := "name"
 		value := "John Doe"
 		wrappedHandler := session(
 			someSessionHandler(msg, key, value),
-			secretKey,
+			kr,
+			nil,
 			domain,
+			cookie.Opts{},
 			config.DefaultSessionCookieDuration,
 			func(r http.Request) string { return r.RemoteAddr },
 		)
@@ -95,11 +98,136 @@ func TestSession(t *testing.T) {
 		attest.Equal(t, string(rb), msg)
 	})
 
+	t.Run("server-side store", func(t *testing.T) {
+		t.Parallel()
+
+		msg := "hello"
+		kr := testKeyring(t)
+		store := sess.NewMemoryStore(time.Hour, 0)
+		wrappedHandler := session(
+			someSessionHandler(msg, "name", "John Doe"),
+			kr,
+			store,
+			"localhost",
+			cookie.Opts{},
+			config.DefaultSessionCookieDuration,
+			func(r http.Request) string { return "" },
+		)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		wrappedHandler.ServeHTTP(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusOK)
+		attest.Equal(t, len(res.Cookies()), 1)
+
+		c, err := cookie.GetEncrypted(cookieRequest(res.Cookies()[0]), sess.CookieName, kr)
+		attest.Ok(t, err)
+		got, err := store.Get(context.Background(), c.Value)
+		attest.Ok(t, err)
+		attest.Equal(t, got.Values["name"], "John Doe")
+		attest.Equal(t, len(got.Values), len(bigMap())+1)
+	})
+
+	t.Run("cookie attributes", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		o := cookie.Opts{HostOnly: true, SameSite: http.SameSiteLaxMode}
+		wrappedHandler := session(
+			someSessionHandler("hello", "name", "John Doe"),
+			kr,
+			nil,
+			"localhost",
+			o,
+			config.DefaultSessionCookieDuration,
+			func(r http.Request) string { return "" },
+		)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		wrappedHandler.ServeHTTP(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusOK)
+		attest.Equal(t, len(res.Cookies()), 1)
+		c := res.Cookies()[0]
+		attest.Equal(t, c.Name, "__Host-"+sess.CookieName)
+		attest.Equal(t, c.Domain, "")
+		attest.Equal(t, c.SameSite, http.SameSiteLaxMode)
+
+		// The session is read from the prefixed cookie.
+		req = sess.Initialise(cookieRequest(c), kr, nil, o, "")
+		attest.Equal(t, sess.Get(req, "name"), "John Doe")
+	})
+
+	t.Run("redirect saves session", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		wrappedHandler := session(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sess.Regenerate(r)
+				sess.Set(r, "user", "john")
+				sess.AddFlash(r, "welcome.")
+				http.Redirect(w, r, "/home", http.StatusSeeOther)
+			}),
+			kr,
+			sess.NewMemoryStore(time.Hour, 0),
+			"localhost",
+			cookie.Opts{},
+			config.DefaultSessionCookieDuration,
+			func(r http.Request) string { return "" },
+		)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		wrappedHandler.ServeHTTP(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusSeeOther)
+		attest.Equal(t, len(res.Cookies()), 1)
+		attest.Equal(t, res.Cookies()[0].Name, sess.CookieName)
+	})
+
+	t.Run("destroy", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		wrappedHandler := session(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sess.Destroy(r)
+				w.WriteHeader(http.StatusNoContent)
+			}),
+			kr,
+			nil,
+			"localhost",
+			cookie.Opts{},
+			config.DefaultSessionCookieDuration,
+			func(r http.Request) string { return "" },
+		)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+		wrappedHandler.ServeHTTP(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, res.StatusCode, http.StatusNoContent)
+		attest.Equal(t, res.Header.Get("Clear-Site-Data"), `"cookies", "storage"`)
+		attest.Equal(t, len(res.Cookies()), 1)
+		attest.True(t, res.Cookies()[0].MaxAge < 0)
+	})
+
 	t.Run("middleware set succeds", func(t *testing.T) {
 		t.Parallel()
 
 		msg := "hello world wide."
-		secretKey := tst.SecretKey()
+		kr := testKeyring(t)
 		domain := "localhost"
 		key := "name"
 		value := "John Doe"
@@ -110,8 +238,10 @@ func TestSession(t *testing.T) {
 		}
 		wrappedHandler := session(
 			someSessionHandler(msg, key, value),
-			secretKey,
+			kr,
+			nil,
 			domain,
+			cookie.Opts{},
 			config.DefaultSessionCookieDuration,
 			antiReplayFunc,
 		)
@@ -157,7 +287,7 @@ func TestSession(t *testing.T) {
 				Value: res.Cookies()[0].Value,
 			})
 
-			c, errG := cookie.GetEncrypted(req2, sess.CookieName, secretKey)
+			c, errG := cookie.GetEncrypted(req2, sess.CookieName, kr)
 			attest.Ok(t, errG)
 			attest.Subsequence(t, c.Value, key)
 			attest.Subsequence(t, c.Value, value)
@@ -167,13 +297,15 @@ func TestSession(t *testing.T) {
 	t.Run("with template variables", func(t *testing.T) {
 		t.Parallel()
 
-		secretKey := tst.SecretKey()
+		kr := testKeyring(t)
 		domain := "localhost"
 		name := "John Doe"
 		wrappedHandler := session(
 			templateVarsHandler(t, name),
-			secretKey,
+			kr,
+			nil,
 			domain,
+			cookie.Opts{},
 			config.DefaultSessionCookieDuration,
 			func(r http.Request) string { return r.RemoteAddr },
 		)
@@ -200,7 +332,7 @@ func TestSession(t *testing.T) {
 		t.Parallel()
 
 		msg := "hello"
-		secretKey := tst.SecretKey()
+		kr := testKeyring(t)
 		domain := "localhost"
 		key := "name"
 		value := "John Doe"
@@ -208,8 +340,10 @@ func TestSession(t *testing.T) {
 		antiReplayFunc := func(r http.Request) string { return r.RemoteAddr }
 		wrappedHandler := session(
 			someSessionHandler(msg, key, value),
-			secretKey,
+			kr,
+			nil,
 			domain,
+			cookie.Opts{},
 			config.DefaultSessionCookieDuration,
 			antiReplayFunc,
 		)
@@ -239,7 +373,7 @@ func TestSession(t *testing.T) {
 				Value: res.Cookies()[0].Value,
 			})
 
-			c, errG := cookie.GetEncrypted(req2, sess.CookieName, secretKey)
+			c, errG := cookie.GetEncrypted(req2, sess.CookieName, kr)
 			attest.Ok(t, errG)
 			attest.Subsequence(t, c.Value, key)
 			attest.Subsequence(t, c.Value, value)
@@ -255,7 +389,7 @@ func TestSession(t *testing.T) {
 				Value: res.Cookies()[0].Value,
 			})
 
-			c, errG := cookie.GetEncrypted(req3, sess.CookieName, secretKey)
+			c, errG := cookie.GetEncrypted(req3, sess.CookieName, kr)
 			attest.Error(t, errG)
 			attest.Zero(t, c)
 			attest.Subsequence(t, errG.Error(), "mismatched anti replay value")
@@ -266,14 +400,16 @@ func TestSession(t *testing.T) {
 		t.Parallel()
 
 		msg := "hello"
-		secretKey := tst.SecretKey()
+		kr := testKeyring(t)
 		domain := "localhost"
 		key := "bothNames"
 		value := "John Doe Jnr"
 		wrappedHandler := session(
 			someSessionHandler(msg, key, value),
-			secretKey,
+			kr,
+			nil,
 			domain,
+			cookie.Opts{},
 			config.DefaultSessionCookieDuration,
 			func(r http.Request) string { return r.RemoteAddr },
 		)
@@ -304,3 +440,10 @@ func TestSession(t *testing.T) {
 		wg.Wait()
 	})
 }
+
+// cookieRequest returns a request that has the given cookie.
+func cookieRequest(c *http.Cookie) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+	req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	return req
+}
@@ -7,16 +7,23 @@ import (
 
 	"github.com/komuw/ong/cookie"
 	"github.com/komuw/ong/internal/octx"
+	"github.com/komuw/ong/internal/tracectx"
 	"github.com/komuw/ong/log"
 )
 
 const logIDKey = string(octx.LogCtxKey)
 
 // trace is a middleware that adds logID to request and response.
+// It also joins the [W3C Trace Context] of the request, if any, or else starts a new trace.
+//
+// [W3C Trace Context]: https://www.w3.org/TR/trace-context/
 func trace(wrappedHandler http.Handler, domain string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
+		// The trace & span IDs are available via [log.GetTraceId] & [log.GetSpanId]
+		ctx = tracectx.Set(ctx, tracectx.FromRequest(r))
+
 		// set cookie/headers/ctx for logID.
 		logID := getLogId(r)
 		ctx = context.WithValue(
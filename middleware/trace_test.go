@@ -12,6 +12,7 @@ import (
 
 	"github.com/komuw/ong/id"
 	"github.com/komuw/ong/internal/octx"
+	"github.com/komuw/ong/log"
 
 	"go.akshayshah.org/attest"
 )
@@ -171,6 +172,43 @@ func TestTraceMiddleware(t *testing.T) {
 		}
 	})
 
+	t.Run("trace context", func(t *testing.T) {
+		t.Parallel()
+
+		var traceID, spanID string
+		wrappedHandler := trace(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				traceID = log.GetTraceId(r.Context())
+				spanID = log.GetSpanId(r.Context())
+			}),
+			"example.com",
+		)
+
+		{
+			// joins an existing trace.
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+			req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			wrappedHandler.ServeHTTP(rec, req)
+
+			attest.Equal(t, traceID, "4bf92f3577b34da6a3ce929d0e0e4736")
+			attest.NotZero(t, spanID)
+			attest.NotEqual(t, spanID, "00f067aa0ba902b7")
+		}
+
+		{
+			// starts a new trace.
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+			req.Header.Set("traceparent", "not-valid")
+			wrappedHandler.ServeHTTP(rec, req)
+
+			attest.Equal(t, len(traceID), 32)
+			attest.NotEqual(t, traceID, "4bf92f3577b34da6a3ce929d0e0e4736")
+			attest.Equal(t, len(spanID), 16)
+		}
+	})
+
 	t.Run("re-uses logID", func(t *testing.T) {
 		t.Parallel()
 
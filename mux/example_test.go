@@ -3,10 +3,13 @@ package mux_test
 import (
 	"context"
 	"fmt"
+	"html/template"
+	"io"
 	"net/http"
 	"os"
 
 	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/errors"
 	"github.com/komuw/ong/log"
 	"github.com/komuw/ong/mux"
 )
@@ -72,3 +75,125 @@ func ExampleMuxer_Resolve() {
 	fmt.Println(mx.Resolve("login/"))
 	fmt.Println(mx.Resolve("https://localhost/books/SidneySheldon"))
 }
+
+func ExampleHandlerFunc() {
+	l := log.New(context.Background(), os.Stdout, 1000)
+
+	getBook := func(w http.ResponseWriter, r *http.Request) error {
+		id := mux.Param(r.Context(), "id")
+		if id != "1" {
+			// The client gets a http 404 with "no such book", the error message is only logged.
+			return errors.WithStatus(
+				errors.Errorf("book %s not found in table books", id),
+				http.StatusNotFound,
+				"no such book",
+			)
+		}
+		_, _ = fmt.Fprint(w, "The Sky Is Falling")
+		return nil
+	}
+
+	mx := mux.New(
+		config.WithOpts("localhost", 8080, "super-h@rd-Pas1word", config.DirectIpStrategy, l),
+		nil,
+		mux.NewRoute(
+			"/books/:id",
+			mux.MethodGet,
+			mux.HandlerFunc(getBook),
+		),
+	)
+
+	server := &http.Server{
+		Handler: mx,
+		Addr:    ":8080",
+	}
+	err := server.ListenAndServe()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func ExampleJSON() {
+	l := log.New(context.Background(), os.Stdout, 1000)
+
+	type createBookRequest struct {
+		Author string `path:"author" validate:"required"`
+		Title  string `json:"title" validate:"required,maxlen=100"`
+		Pages  int    `json:"pages" validate:"min=1"`
+	}
+	type createBookResponse struct {
+		ID string `json:"id"`
+	}
+
+	createBook := func(ctx context.Context, req createBookRequest) (createBookResponse, error) {
+		// req has already been decoded & validated.
+		// Invalid requests are rejected with a http 422 that lists the invalid fields.
+		return createBookResponse{ID: req.Author + "/" + req.Title}, nil
+	}
+
+	mx := mux.New(
+		config.WithOpts("localhost", 8080, "super-h@rd-Pas1word", config.DirectIpStrategy, l),
+		nil,
+		mux.NewRoute(
+			"/books/:author",
+			mux.MethodPost,
+			mux.JSON(createBook),
+		),
+	)
+
+	server := &http.Server{
+		Handler: mx,
+		Addr:    ":8080",
+	}
+	err := server.ListenAndServe()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func ExampleForm() {
+	l := log.New(context.Background(), os.Stdout, 1000)
+
+	type signup struct {
+		Email    string `form:"email" validate:"required,maxlen=100"`
+		Password string `form:"password,secret" validate:"required,minlen=8"`
+	}
+
+	tmpl := template.Must(template.New("signup").Parse(`
+	<form method="POST">
+		{{.CsrfField}}
+		<input type="email" name="email" value="{{.Values.Email}}">
+		{{with .Errors.email}}<p>{{.}}</p>{{end}}
+		<input type="password" name="password">
+		{{with .Errors.password}}<p>{{.}}</p>{{end}}
+		<input type="submit">
+	</form>`))
+
+	render := func(w io.Writer, r *http.Request, fs mux.FormState[signup]) error {
+		return tmpl.Execute(w, fs)
+	}
+	submit := func(w http.ResponseWriter, r *http.Request, form signup) (string, error) {
+		// form has already been decoded & validated.
+		// Invalid forms are rendered again, with the submitted values & errors.
+		return "/welcome", nil
+	}
+
+	mx := mux.New(
+		config.WithOpts("localhost", 8080, "super-h@rd-Pas1word", config.DirectIpStrategy, l),
+		nil,
+		mux.NewRoute(
+			"/signup",
+			mux.MethodAll,
+			mux.Form(render, submit),
+		),
+	)
+
+	server := &http.Server{
+		Handler: mx,
+		Addr:    ":8080",
+	}
+	err := server.ListenAndServe()
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,173 @@
+package mux
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/komuw/ong/errors"
+	"github.com/komuw/ong/internal/bind"
+	"github.com/komuw/ong/middleware"
+	"github.com/komuw/ong/sess"
+)
+
+// maxFormMemory is the maximum number of bytes of a multipart form that are kept in memory, the rest is stored in temporary files.
+// It is the same value that [http.Request.FormValue] uses.
+const maxFormMemory = 32 << 20
+
+// FormState is the state of a html form that is rendered by a [Form] handler.
+type FormState[T any] struct {
+	// Values are the values that were last submitted, or the zero value if the form has not been submitted.
+	// Fields whose form struct tag has the secret option, eg `form:"password,secret"`, are never preserved.
+	Values T
+	// Errors are the validation failures of the last submission, keyed by field name. See [middleware.FieldError]
+	// In templates, they can be used like; {{with .Errors.email}}<p>{{.}}</p>{{end}}
+	Errors map[string]string
+	// CsrfToken is the csrf token of the request. See [middleware.GetCsrfToken]
+	CsrfToken string
+}
+
+// CsrfField returns a hidden html input element that contains the csrf token.
+// It should be included in every html form, for example; <form method="POST">{{.CsrfField}} ...</form>
+func (f FormState[T]) CsrfField() template.HTML {
+	return template.HTML(fmt.Sprintf( // the token is escaped.
+		`<input type="hidden" name="%s" value="%s">`,
+		middleware.CsrfTokenFormName,
+		template.HTMLEscapeString(f.CsrfToken),
+	))
+}
+
+// formFlash is how the state of a form is carried, in the http session, across a post/redirect/get.
+type formFlash[T any] struct {
+	Values T
+	Errors map[string]string
+}
+
+// Form returns a http handler for a html form that is decoded into, and validated as, a T.
+//
+// For http GET requests(and any other method apart from POST), the form is rendered by calling render.
+// The output of render is sent with a http 200 and a text/html content type.
+//
+// For http POST requests, the url-encoded or multipart form is decoded into a T using the `form` struct tags of its fields
+// and then validated using the rules in its `validate` struct tags, see [JSON] for the supported rules. For example:
+//
+//	type Login struct {
+//		Email    string `form:"email" validate:"required,maxlen=100"`
+//		Password string `form:"password,secret" validate:"required,minlen=8"`
+//	}
+//
+// If the form is valid, submit is called. It returns the url that the client is redirected to, using a http 303.
+// An empty url redirects to the form itself. submit can set headers, like cookies, on w but it should not write the status code or body. submit can also return [middleware.FieldErrors], say if an email is already taken,
+// which are handled like validation failures. Any other error is rendered the same way as errors returned by a [HandlerFunc].
+//
+// If the form is invalid, the submitted values & the errors are stored in the http session and the client is redirected, using a http 303,
+// to the form. The next render of the form gets them in its [FormState], after which they are removed from the session.
+// If they cannot be stored in the session, say if sessions are not in use, the form is rendered right away with a http 422.
+//
+// Form panics if T is not a struct.
+func Form[T any](
+	render func(w io.Writer, r *http.Request, fs FormState[T]) error,
+	submit func(w http.ResponseWriter, r *http.Request, form T) (redirectURL string, err error),
+) HandlerFunc {
+	var zero T
+	if err := bind.Values(&zero, "form", func(string) []string { return nil }); err != nil {
+		panic(fmt.Errorf("ong/mux: %T should be a struct", zero))
+	}
+
+	serve := func(w http.ResponseWriter, r *http.Request, code int, fs FormState[T]) error {
+		fs.CsrfToken = middleware.GetCsrfToken(r.Context())
+		buf := &bytes.Buffer{}
+		if err := render(buf, r, fs); err != nil {
+			return errors.Wrap(err)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(code)
+		_, _ = buf.WriteTo(w)
+		return nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) error {
+		key := "ong.form:" + r.URL.Path
+
+		if r.Method != http.MethodPost {
+			flash, _ := sess.PopValue[formFlash[T]](r, key)
+			return serve(w, r, http.StatusOK, FormState[T]{Values: flash.Values, Errors: flash.Errors})
+		}
+
+		var form T
+		err := decodeForm(r, &form)
+		if err == nil {
+			var redirectURL string
+			redirectURL, err = submit(w, r, form)
+			if err == nil {
+				if redirectURL == "" {
+					redirectURL = r.URL.String()
+				}
+				http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+				return nil
+			}
+		}
+
+		var fe middleware.FieldErrors
+		if !errors.As(err, &fe) {
+			return err
+		}
+
+		flash := formFlash[T]{Values: scrub(form), Errors: make(map[string]string, len(fe))}
+		for _, e := range fe {
+			if _, ok := flash.Errors[e.Field]; !ok {
+				flash.Errors[e.Field] = e.Message
+			}
+		}
+		if errS := sess.SetValue(r, key, flash); errS == nil {
+			// post/redirect/get, so that reloading the page does not re-submit the form.
+			http.Redirect(w, r, r.URL.String(), http.StatusSeeOther)
+			return nil
+		}
+		return serve(w, r, http.StatusUnprocessableEntity, FormState[T]{Values: flash.Values, Errors: flash.Errors})
+	}
+}
+
+// decodeForm decodes the form of r into v and validates it.
+func decodeForm(r *http.Request, v any) error {
+	var err error
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "multipart/form-data" {
+		err = r.ParseMultipartForm(maxFormMemory)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return errors.Wrap(err) // rendered as a http 413.
+		}
+		return errors.WithStatus(err, http.StatusBadRequest, "The form is malformed.")
+	}
+
+	if err := bind.Values(v, "form", func(name string) []string { return r.PostForm[name] }); err != nil {
+		return errors.Wrap(err)
+	}
+	if err := bind.Validate(v); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// scrub returns a copy of form without the values of the fields that have the secret option in their form struct tag.
+func scrub[T any](form T) T {
+	v := reflect.ValueOf(&form).Elem()
+	t := v.Type()
+	for i := range t.NumField() {
+		_, opts, _ := strings.Cut(t.Field(i).Tag.Get("form"), ",")
+		if slices.Contains(strings.Split(opts, ","), "secret") && t.Field(i).IsExported() {
+			v.Field(i).SetZero()
+		}
+	}
+	return form
+}
@@ -0,0 +1,184 @@
+package mux
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/komuw/ong/cookie"
+	"github.com/komuw/ong/cry"
+	"github.com/komuw/ong/errors"
+	"github.com/komuw/ong/internal/tst"
+	"github.com/komuw/ong/middleware"
+	"github.com/komuw/ong/sess"
+	"go.akshayshah.org/attest"
+)
+
+type signup struct {
+	Email    string `form:"email" validate:"required,maxlen=20"`
+	Age      int    `form:"age" validate:"min=18"`
+	Password string `form:"password,secret" validate:"required,minlen=8"`
+}
+
+func TestForm(t *testing.T) {
+	t.Parallel()
+
+	tmpl := template.Must(template.New("signup").Parse(
+		`<form method="POST">{{.CsrfField}}` +
+			`<input name="email" value="{{.Values.Email}}">{{with .Errors.email}}<p>{{.}}</p>{{end}}` +
+			`<input name="age" value="{{.Values.Age}}">{{with .Errors.age}}<p>{{.}}</p>{{end}}` +
+			`<input name="password" value="{{.Values.Password}}">{{with .Errors.password}}<p>{{.}}</p>{{end}}` +
+			`</form>`,
+	))
+
+	var submitted signup
+	h := Form(
+		func(w io.Writer, r *http.Request, fs FormState[signup]) error {
+			return tmpl.Execute(w, fs)
+		},
+		func(w http.ResponseWriter, r *http.Request, form signup) (string, error) {
+			switch form.Email {
+			case "taken@example.com":
+				return "", middleware.FieldErrors{{Field: "email", Message: "is already registered"}}
+			case "down@example.com":
+				return "", errors.New("db is down")
+			}
+			submitted = form
+			return "/welcome", nil
+		},
+	)
+
+	kr, err := cry.NewKeyring(tst.SecretKey())
+	attest.Ok(t, err)
+	withSession := func(r *http.Request) *http.Request {
+		return sess.Initialise(r, kr, nil, cookie.Opts{}, "")
+	}
+	post := func(form url.Values) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	t.Run("render", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/signup", nil)
+		h.ServeHTTP(rec, withSession(req))
+
+		attest.Equal(t, rec.Code, http.StatusOK)
+		attest.Equal(t, rec.Header().Get("Content-Type"), "text/html; charset=utf-8")
+		attest.Subsequence(t, rec.Body.String(), `<input type="hidden" name="csrftoken" value="">`)
+		attest.False(t, strings.Contains(rec.Body.String(), "<p>"))
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		// Not parallel, since it checks submitted.
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, withSession(post(url.Values{"email": {"jane@example.com"}, "age": {"30"}, "password": {"hunter2hunter2"}})))
+
+		attest.Equal(t, rec.Code, http.StatusSeeOther)
+		attest.Equal(t, rec.Header().Get("Location"), "/welcome")
+		attest.Equal(t, submitted, signup{Email: "jane@example.com", Age: 30, Password: "hunter2hunter2"})
+	})
+
+	t.Run("post redirect get", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		req := withSession(post(url.Values{"email": {"jane@example.com"}, "age": {"7"}, "password": {"short"}}))
+		h.ServeHTTP(rec, req)
+		attest.Equal(t, rec.Code, http.StatusSeeOther)
+		attest.Equal(t, rec.Header().Get("Location"), "/signup")
+
+		// The next render has the submitted values & errors.
+		rec = httptest.NewRecorder()
+		get := httptest.NewRequest(http.MethodGet, "/signup", nil).WithContext(req.Context())
+		h.ServeHTTP(rec, get)
+		body := rec.Body.String()
+		attest.Equal(t, rec.Code, http.StatusOK)
+		attest.Subsequence(t, body, `<input name="email" value="jane@example.com">`)
+		attest.Subsequence(t, body, `<input name="age" value="7"><p>must be at least 18</p>`)
+		attest.Subsequence(t, body, `<input name="password" value=""><p>must have at least 8 characters</p>`)
+		attest.False(t, strings.Contains(body, "short"))
+
+		// Only once.
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, get)
+		attest.False(t, strings.Contains(rec.Body.String(), "<p>"))
+	})
+
+	t.Run("without sessions", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		req := post(url.Values{"email": {"taken@example.com"}, "age": {"old"}, "password": {"hunter2hunter2"}})
+		h.ServeHTTP(rec, req)
+
+		body := rec.Body.String()
+		attest.Equal(t, rec.Code, http.StatusUnprocessableEntity)
+		attest.Subsequence(t, body, `<input name="age" value="0"><p>must be an integer</p>`)
+		attest.False(t, strings.Contains(body, "hunter2"))
+	})
+
+	t.Run("submit errors", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, post(url.Values{"email": {"taken@example.com"}, "age": {"30"}, "password": {"hunter2hunter2"}}))
+		attest.Equal(t, rec.Code, http.StatusUnprocessableEntity)
+		attest.Subsequence(t, rec.Body.String(), `<input name="email" value="taken@example.com"><p>is already registered</p>`)
+
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, post(url.Values{"email": {"down@example.com"}, "age": {"30"}, "password": {"hunter2hunter2"}}))
+		attest.Equal(t, rec.Code, http.StatusInternalServerError)
+		attest.False(t, strings.Contains(rec.Body.String(), "db is down"))
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		t.Parallel()
+
+		body := &strings.Builder{}
+		mw := multipart.NewWriter(body)
+		attest.Ok(t, mw.WriteField("email", "mary@example.com"))
+		attest.Ok(t, mw.WriteField("age", "41"))
+		attest.Ok(t, mw.WriteField("password", "x"))
+		attest.Ok(t, mw.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(body.String()))
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		attest.Equal(t, rec.Code, http.StatusUnprocessableEntity)
+		attest.Subsequence(t, rec.Body.String(), `<input name="email" value="mary@example.com">`)
+		attest.Subsequence(t, rec.Body.String(), `<p>must have at least 8 characters</p>`)
+	})
+
+	t.Run("form should be a struct", func(t *testing.T) {
+		t.Parallel()
+
+		attest.Panics(t, func() {
+			_ = Form(
+				func(w io.Writer, r *http.Request, fs FormState[int]) error { return nil },
+				func(w http.ResponseWriter, r *http.Request, form int) (string, error) { return "", nil },
+			)
+		})
+	})
+}
+
+func TestFormStateCsrfField(t *testing.T) {
+	t.Parallel()
+
+	fs := FormState[signup]{CsrfToken: `a"><script>`}
+	attest.Equal(t,
+		fs.CsrfField(),
+		template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="a&#34;&gt;&lt;script&gt;">`, middleware.CsrfTokenFormName)),
+	)
+}
@@ -0,0 +1,22 @@
+package mux
+
+import (
+	"net/http"
+
+	"github.com/komuw/ong/middleware"
+)
+
+// HandlerFunc is a http handler that returns an error instead of writing error responses itself.
+// It implements [http.Handler] and can thus be used in [NewRoute].
+//
+// If it returns a non-nil error, the error is rendered to the client using [middleware.WriteError].
+// Use [github.com/komuw/ong/errors.WithStatus] to choose the status code & the message that the client gets.
+// The handler should not write to w before returning a non-nil error.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// ServeHTTP implements [http.Handler]
+func (f HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f(w, r); err != nil {
+		middleware.WriteError(w, r, err)
+	}
+}
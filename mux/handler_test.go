@@ -0,0 +1,56 @@
+package mux
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/komuw/ong/errors"
+	"go.akshayshah.org/attest"
+)
+
+func TestHandlerFunc(t *testing.T) {
+	t.Parallel()
+
+	msg := "hello"
+	h := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.URL.Query().Get("fail") != "" {
+			return errors.WithStatus(errors.New("book 7 is out of stock"), http.StatusConflict, "book unavailable")
+		}
+		_, _ = io.WriteString(w, msg)
+		return nil
+	})
+	_ = NewRoute("/books", MethodGet, h) // does not panic.
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/books", nil))
+		res := rec.Result()
+		defer res.Body.Close()
+
+		b, err := io.ReadAll(res.Body)
+		attest.Ok(t, err)
+		attest.Equal(t, res.StatusCode, http.StatusOK)
+		attest.Equal(t, string(b), msg)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/books?fail=yes", nil))
+		res := rec.Result()
+		defer res.Body.Close()
+
+		b, err := io.ReadAll(res.Body)
+		attest.Ok(t, err)
+		attest.Equal(t, res.StatusCode, http.StatusConflict)
+		attest.Equal(t, res.Header.Get("Content-Type"), "application/problem+json")
+		attest.Subsequence(t, string(b), "book unavailable")
+		attest.False(t, strings.Contains(string(b), "out of stock"))
+	})
+}
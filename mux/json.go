@@ -0,0 +1,155 @@
+package mux
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/komuw/ong/errors"
+	"github.com/komuw/ong/internal/bind"
+)
+
+// StatusCoder can be implemented by the responses of handlers created using [JSON] to choose their http status code.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// JSON returns a http handler that decodes & validates requests into Req, calls fn and encodes the Resp that it returns as JSON.
+//
+// The request body is decoded as JSON into Req. Unknown fields & trailing data are rejected.
+// The size of the body is limited by the maxBodyBytes option of [github.com/komuw/ong/config.New]; larger bodies are rejected with a http 413.
+// Then, fields of Req with a `path` struct tag are set from the path parameters of the route, see [Param],
+// and fields with a `query` struct tag are set from the url query. For example:
+//
+//	type GetBooks struct {
+//		Author string `path:"author" validate:"required"`
+//		Page   int    `query:"page" validate:"min=1,max=100"`
+//	}
+//
+// Finally, Req is validated using the rules in its `validate` struct tags. The rules are comma separated and are;
+// `required`, `min=N` & `max=N` for numbers, `minlen=N` & `maxlen=N` for the length of strings, slices & maps, and `regex=R` which should be the last rule.
+// Fields that are empty strings, slices or maps, or nil pointers, are only checked by the required rule.
+// Numbers are checked by min & max even if they are zero; use a pointer for optional numbers.
+// Requests that fail decoding get a http 400, those that fail binding or validation get a http 422 listing the invalid fields. See [middleware.FieldErrors]
+//
+// Resp is encoded with a http 200, unless it implements [StatusCoder].
+// If fn returns an error, it is rendered the same way as errors returned by a [HandlerFunc].
+//
+// JSON panics if Req is not a struct.
+func JSON[Req, Resp any](fn func(ctx context.Context, req Req) (Resp, error)) HandlerFunc {
+	var zero Req
+	if err := bind.Values(&zero, "path", func(string) []string { return nil }); err != nil {
+		panic(fmt.Errorf("ong/mux: %T should be a struct", zero))
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) error {
+		var req Req
+		if err := decodeJSON(r, &req); err != nil {
+			return err
+		}
+
+		ctx := r.Context()
+		if err := bind.Values(&req, "path", func(name string) []string {
+			if p := Param(ctx, name); p != "" {
+				return []string{p}
+			}
+			return nil
+		}); err != nil {
+			return errors.Wrap(err)
+		}
+		query := r.URL.Query()
+		if err := bind.Values(&req, "query", func(name string) []string { return query[name] }); err != nil {
+			return errors.Wrap(err)
+		}
+		if err := bind.Validate(&req); err != nil {
+			return errors.Wrap(err)
+		}
+
+		resp, err := fn(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		b, err := json.Marshal(resp)
+		if err != nil {
+			return errors.Wrap(err)
+		}
+		code := http.StatusOK
+		if sc, ok := any(resp).(StatusCoder); ok {
+			code = sc.StatusCode()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_, _ = w.Write(b)
+
+		return nil
+	}
+}
+
+// decodeJSON decodes the body of r, if any, into v.
+func decodeJSON(r *http.Request, v any) error {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mt != "application/json" && !strings.HasSuffix(mt, "+json")) {
+			return errors.WithStatus(
+				fmt.Errorf("ong/mux: unsupported content type %q", ct),
+				http.StatusUnsupportedMediaType,
+				"The request body should be json.",
+			)
+		}
+	}
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if errors.Is(err, io.EOF) {
+		// An empty body.
+		return nil
+	}
+	if err == nil {
+		if _, errT := dec.Token(); !errors.Is(errT, io.EOF) {
+			err = errors.New("ong/mux: request body has data after the json value")
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return errors.Wrap(err) // rendered as a http 413.
+	}
+	return errors.WithStatus(err, http.StatusBadRequest, decodeMessage(err))
+}
+
+// decodeMessage describes why decoding a json request body failed, in a way that is safe to show to clients.
+func decodeMessage(err error) string {
+	var (
+		se *json.SyntaxError
+		te *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &se):
+		return fmt.Sprintf("The request body has malformed json at position %d.", se.Offset)
+	case errors.As(err, &te):
+		if te.Field != "" {
+			return fmt.Sprintf("The field %s should be of type %s.", te.Field, te.Type)
+		}
+		return fmt.Sprintf("The request body should be of type %s.", te.Type)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "The request body has malformed json."
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// The encoding/json package has no exported error type for unknown fields.
+		return "The request body has an unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ") + "."
+	default:
+		return "The request body is invalid."
+	}
+}
@@ -0,0 +1,198 @@
+package mux
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/errors"
+	"github.com/komuw/ong/log"
+	"go.akshayshah.org/attest"
+)
+
+type createBook struct {
+	Title  string   `json:"title" validate:"required,maxlen=10"`
+	Pages  int      `json:"pages" validate:"min=1"`
+	Tags   []string `json:"tags"`
+	Notify bool     `query:"notify"`
+}
+
+type bookCreated struct {
+	Title  string `json:"title"`
+	Notify bool   `json:"notify"`
+}
+
+func (bookCreated) StatusCode() int { return http.StatusCreated }
+
+type getBook struct {
+	Author string `path:"author" validate:"required"`
+	Page   int    `query:"page" validate:"min=1,max=100"`
+}
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+
+	h := JSON(func(ctx context.Context, req createBook) (bookCreated, error) {
+		if req.Title == "fail" {
+			return bookCreated{}, errors.WithStatus(errors.New("db is down"), http.StatusServiceUnavailable, "try later")
+		}
+		return bookCreated{Title: req.Title, Notify: req.Notify}, nil
+	})
+
+	serve := func(t *testing.T, method, target, contentType, body string) (*http.Response, string) {
+		t.Helper()
+
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		res := rec.Result()
+		t.Cleanup(func() { _ = res.Body.Close() })
+
+		b, err := io.ReadAll(res.Body)
+		attest.Ok(t, err)
+		return res, string(b)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		res, body := serve(t, http.MethodPost, "/books?notify=true", "application/json; charset=utf-8", `{"title":"Dune","pages":412}`)
+		attest.Equal(t, res.StatusCode, http.StatusCreated)
+		attest.Equal(t, res.Header.Get("Content-Type"), "application/json")
+
+		var got bookCreated
+		attest.Ok(t, json.Unmarshal([]byte(body), &got))
+		attest.Equal(t, got, bookCreated{Title: "Dune", Notify: true})
+	})
+
+	t.Run("wrong content type", func(t *testing.T) {
+		t.Parallel()
+
+		res, body := serve(t, http.MethodPost, "/books", "text/plain", `{"title":"Dune","pages":412}`)
+		attest.Equal(t, res.StatusCode, http.StatusUnsupportedMediaType)
+		attest.Subsequence(t, body, "The request body should be json.")
+	})
+
+	t.Run("bad json", func(t *testing.T) {
+		t.Parallel()
+
+		tt := []struct {
+			name string
+			body string
+			msg  string
+		}{
+			{"unknown field", `{"title":"Dune","author":"Herbert"}`, `The request body has an unknown field \"author\".`},
+			{"wrong type", `{"title":"Dune","pages":"many"}`, "The field pages should be of type int."},
+			{"syntax", `{"title":"Dune",}`, "The request body has malformed json at position 17."},
+			{"truncated", `{"title":"Dune"`, "The request body has malformed json."},
+			{"trailing data", `{"title":"Dune","pages":1}{}`, "The request body is invalid."},
+		}
+		for _, tc := range tt {
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+
+				res, body := serve(t, http.MethodPost, "/books", "application/json", tc.body)
+				attest.Equal(t, res.StatusCode, http.StatusBadRequest)
+				attest.Subsequence(t, body, tc.msg)
+			})
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodPost, "/books", strings.NewReader(`{"title":"Dune","pages":412}`))
+		rec := httptest.NewRecorder()
+		req.Body = http.MaxBytesReader(rec, req.Body, 5)
+		h.ServeHTTP(rec, req)
+		attest.Equal(t, rec.Code, http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("invalid fields", func(t *testing.T) {
+		t.Parallel()
+
+		res, body := serve(t, http.MethodPost, "/books?notify=maybe", "application/json", `{"title":"Dune","pages":-1}`)
+		attest.Equal(t, res.StatusCode, http.StatusUnprocessableEntity)
+		attest.Equal(t, res.Header.Get("Content-Type"), "application/problem+json")
+		attest.Subsequence(t, body, `{"field":"notify","message":"must be true or false"}`)
+
+		res, body = serve(t, http.MethodPost, "/books", "", `{"pages":-1}`)
+		attest.Equal(t, res.StatusCode, http.StatusUnprocessableEntity)
+		attest.Subsequence(t, body, `"errors":[{"field":"title","message":"is required"},{"field":"pages","message":"must be at least 1"}]`)
+	})
+
+	t.Run("zero numbers are validated", func(t *testing.T) {
+		t.Parallel()
+
+		type order struct {
+			Qty int `json:"qty" validate:"min=1"`
+		}
+		h := JSON(func(ctx context.Context, req order) (order, error) {
+			return req, nil
+		})
+
+		for _, body := range []string{`{"qty":0}`, `{}`} {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)))
+			attest.Equal(t, rec.Code, http.StatusUnprocessableEntity, attest.Sprintf("body: %s", body))
+			attest.Subsequence(t, rec.Body.String(), `{"field":"qty","message":"must be at least 1"}`)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"qty":1}`)))
+		attest.Equal(t, rec.Code, http.StatusOK)
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		t.Parallel()
+
+		res, body := serve(t, http.MethodPost, "/books", "application/json", `{"title":"fail","pages":1}`)
+		attest.Equal(t, res.StatusCode, http.StatusServiceUnavailable)
+		attest.Subsequence(t, body, "try later")
+		attest.False(t, strings.Contains(body, "db is down"))
+	})
+
+	t.Run("path & query", func(t *testing.T) {
+		t.Parallel()
+
+		l := log.New(context.Background(), &bytes.Buffer{}, 500)
+		mx := New(
+			config.DevOpts(l, "secretKey12@34String"),
+			nil,
+			NewRoute(
+				"/books/:author",
+				MethodGet,
+				JSON(func(ctx context.Context, req getBook) (getBook, error) {
+					return req, nil
+				}),
+			),
+		)
+
+		rec := httptest.NewRecorder()
+		mx.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "https://localhost:65081/books/Herbert?page=2", nil))
+		attest.Equal(t, rec.Code, http.StatusOK)
+		attest.Equal(t, rec.Body.String(), `{"Author":"Herbert","Page":2}`)
+
+		rec = httptest.NewRecorder()
+		mx.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "https://localhost:65081/books/Herbert?page=200", nil))
+		attest.Equal(t, rec.Code, http.StatusUnprocessableEntity)
+		attest.Subsequence(t, rec.Body.String(), `{"field":"page","message":"must be at most 100"}`)
+	})
+
+	t.Run("request should be a struct", func(t *testing.T) {
+		t.Parallel()
+
+		attest.Panics(t, func() {
+			_ = JSON(func(ctx context.Context, req []string) (string, error) { return "", nil })
+		})
+	})
+}
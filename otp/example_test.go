@@ -0,0 +1,47 @@
+package otp_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/komuw/ong/otp"
+)
+
+func ExampleVerifier() {
+	// When the user enables two-factor authentication, generate a key for them and show its URI as a QR code.
+	k, err := otp.NewKey("Ong", "alice@example.com")
+	if err != nil {
+		panic(err)
+	}
+	_ = k.URI()
+
+	// Later on, verify the codes generated by their authenticator app.
+	v := otp.NewVerifier(1)
+	code := k.TOTP(time.Now())
+	fmt.Println(v.Verify(k, code))
+	// A code can only be used once.
+	fmt.Println(v.Verify(k, code))
+
+	// Output:
+	// <nil>
+	// ong/otp: code has already been used
+}
+
+func ExampleNewRecoveryCodes() {
+	codes, hashes, err := otp.NewRecoveryCodes(8)
+	if err != nil {
+		panic(err)
+	}
+	// Show the codes to the user, and persist only the hashes.
+
+	i, err := otp.VerifyRecoveryCode(codes[3], hashes)
+	if err != nil {
+		panic(err)
+	}
+	// Delete the used hash, so that the code cannot be used again.
+	hashes = append(hashes[:i], hashes[i+1:]...)
+
+	fmt.Println(i, len(hashes))
+
+	// Output: 3 7
+}
@@ -0,0 +1,233 @@
+// Package otp implements one-time passwords that can be used as a second authentication factor.
+// It supports both time-based([RFC 6238]) and counter-based([RFC 4226]) one-time passwords, as well as recovery codes.
+//
+// [RFC 6238]: https://www.rfc-editor.org/rfc/rfc6238
+// [RFC 4226]: https://www.rfc-editor.org/rfc/rfc4226
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // RFC 4226 & RFC 6238 use HMAC-SHA1 by default, and most authenticator apps only support it.
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithm is the hash function used to compute one-time passwords.
+type Algorithm string
+
+const (
+	// SHA1 is the default algorithm, it is the one that is supported by most authenticator apps.
+	SHA1 = Algorithm("SHA1")
+	// SHA256 uses HMAC-SHA256.
+	SHA256 = Algorithm("SHA256")
+	// SHA512 uses HMAC-SHA512.
+	SHA512 = Algorithm("SHA512")
+)
+
+const (
+	defaultDigits = 6
+	defaultPeriod = 30 * time.Second
+	// secretLen is the length of generated secrets. RFC 4226 recommends 160bits.
+	secretLen = 20
+)
+
+// b32 is the encoding used for secrets in provisioning URIs.
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding) //nolint:gochecknoglobals
+
+func (a Algorithm) hash() (func() hash.Hash, error) {
+	switch a {
+	case SHA1, "":
+		return sha1.New, nil
+	case SHA256:
+		return sha256.New, nil
+	case SHA512:
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("ong/otp: unknown algorithm %q", a)
+	}
+}
+
+// Key is the shared secret, and parameters, that are used to compute one-time passwords for an account.
+//
+// Persist it using [Key.URI] & [ParseURI]. Since it contains the secret, it should be stored encrypted; see [github.com/komuw/ong/cry].
+//
+// Use [NewKey] or [ParseURI] to get a valid Key.
+type Key struct {
+	secret  []byte
+	issuer  string
+	account string
+	algo    Algorithm
+	digits  int
+	period  time.Duration
+}
+
+// NewKey returns a [Key] with a new random secret, for the given account at issuer.
+// It uses SHA1, six digits and a period of thirty seconds; which is what most authenticator apps support.
+func NewKey(issuer, account string) (Key, error) {
+	if issuer == "" || account == "" {
+		return Key{}, errors.New("ong/otp: issuer and account should not be empty")
+	}
+	if strings.Contains(issuer, ":") || strings.Contains(account, ":") {
+		return Key{}, errors.New("ong/otp: issuer and account should not contain a colon")
+	}
+
+	secret := make([]byte, secretLen)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, err
+	}
+
+	return Key{
+		secret:  secret,
+		issuer:  issuer,
+		account: account,
+		algo:    SHA1,
+		digits:  defaultDigits,
+		period:  defaultPeriod,
+	}, nil
+}
+
+// ParseURI parses a key in the [otpauth URI format], as produced by [Key.URI].
+//
+// [otpauth URI format]: https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func ParseURI(uri string) (Key, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return Key{}, err
+	}
+	if u.Scheme != "otpauth" {
+		return Key{}, errors.New("ong/otp: scheme should be otpauth")
+	}
+	if u.Host != "totp" && u.Host != "hotp" {
+		return Key{}, fmt.Errorf("ong/otp: unsupported type %q", u.Host)
+	}
+
+	q := u.Query()
+	k := Key{
+		issuer: q.Get("issuer"),
+		algo:   Algorithm(strings.ToUpper(q.Get("algorithm"))),
+		digits: defaultDigits,
+		period: defaultPeriod,
+	}
+
+	label := strings.TrimPrefix(u.Path, "/")
+	if iss, acc, ok := strings.Cut(label, ":"); ok {
+		if k.issuer == "" {
+			k.issuer = iss
+		}
+		k.account = strings.TrimSpace(acc)
+	} else {
+		k.account = label
+	}
+
+	if k.algo == "" {
+		k.algo = SHA1
+	}
+	if _, err := k.algo.hash(); err != nil {
+		return Key{}, err
+	}
+
+	if d := q.Get("digits"); d != "" {
+		if k.digits, err = strconv.Atoi(d); err != nil || (k.digits != 6 && k.digits != 8) {
+			return Key{}, errors.New("ong/otp: digits should be 6 or 8")
+		}
+	}
+	if p := q.Get("period"); p != "" {
+		secs, errP := strconv.Atoi(p)
+		if errP != nil || secs < 1 {
+			return Key{}, errors.New("ong/otp: invalid period")
+		}
+		k.period = time.Duration(secs) * time.Second
+	}
+
+	k.secret, err = b32.DecodeString(strings.ToUpper(strings.TrimRight(q.Get("secret"), "=")))
+	if err != nil || len(k.secret) == 0 {
+		return Key{}, errors.New("ong/otp: invalid secret")
+	}
+
+	return k, nil
+}
+
+// String implements [fmt.Stringer]
+// It does not reveal the secret.
+func (k Key) String() string {
+	return fmt.Sprintf("Key{issuer:%s, account:%s, secret:<REDACTED>}", k.issuer, k.account)
+}
+
+// GoString implements [fmt.GoStringer]
+func (k Key) GoString() string {
+	return k.String()
+}
+
+// Issuer is the name of the service that the key belongs to.
+func (k Key) Issuer() string { return k.issuer }
+
+// Account is the name of the account that the key belongs to.
+func (k Key) Account() string { return k.account }
+
+// Secret is the base32 encoded secret of the key.
+// It is what users type into authenticator apps that are unable to scan a QR code of [Key.URI].
+func (k Key) Secret() string { return b32.EncodeToString(k.secret) }
+
+// URI returns the time-based [otpauth URI] of the key. It is usually shown to users as a QR code.
+//
+// [otpauth URI]: https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func (k Key) URI() string {
+	q := url.Values{}
+	q.Set("secret", k.Secret())
+	q.Set("issuer", k.issuer)
+	q.Set("algorithm", string(k.algo))
+	q.Set("digits", strconv.Itoa(k.digits))
+	q.Set("period", strconv.Itoa(int(k.period/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + k.issuer + ":" + k.account,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+// HOTP returns the counter-based one-time password of k at counter.
+func (k Key) HOTP(counter uint64) string {
+	h, err := k.algo.hash()
+	if err != nil {
+		// Keys are validated on creation.
+		panic(err)
+	}
+
+	mac := hmac.New(h, k.secret)
+	_ = binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+
+	// https://www.rfc-editor.org/rfc/rfc4226#section-5.4
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range k.digits {
+		mod = mod * 10
+	}
+
+	return fmt.Sprintf("%0*d", k.digits, code%mod)
+}
+
+// TOTP returns the time-based one-time password of k at time t.
+func (k Key) TOTP(t time.Time) string {
+	return k.HOTP(k.step(t))
+}
+
+// step is the number of periods since the unix epoch.
+func (k Key) step(t time.Time) uint64 {
+	return uint64(t.Unix()) / uint64(k.period/time.Second)
+}
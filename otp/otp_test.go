@@ -0,0 +1,128 @@
+package otp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.akshayshah.org/attest"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	// call flag.Parse() here if TestMain uses flags
+	goleak.VerifyTestMain(m)
+}
+
+func TestHOTP(t *testing.T) {
+	t.Parallel()
+
+	// https://www.rfc-editor.org/rfc/rfc4226#appendix-D
+	k := Key{secret: []byte("12345678901234567890"), algo: SHA1, digits: 6, period: defaultPeriod}
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for i, w := range want {
+		attest.Equal(t, k.HOTP(uint64(i)), w)
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	t.Parallel()
+
+	// https://www.rfc-editor.org/rfc/rfc6238#appendix-B
+	sha1Key := Key{secret: []byte("12345678901234567890"), algo: SHA1, digits: 8, period: defaultPeriod}
+	sha256Key := Key{secret: []byte("12345678901234567890123456789012"), algo: SHA256, digits: 8, period: defaultPeriod}
+	sha512Key := Key{secret: []byte("1234567890123456789012345678901234567890123456789012345678901234"), algo: SHA512, digits: 8, period: defaultPeriod}
+
+	tests := []struct {
+		unix   int64
+		sha1   string
+		sha256 string
+		sha512 string
+	}{
+		{59, "94287082", "46119246", "90693936"},
+		{1111111109, "07081804", "68084774", "25091201"},
+		{1234567890, "89005924", "91819424", "93441116"},
+		{20000000000, "65353130", "77737706", "47863826"},
+	}
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		attest.Equal(t, sha1Key.TOTP(at), tt.sha1)
+		attest.Equal(t, sha256Key.TOTP(at), tt.sha256)
+		attest.Equal(t, sha512Key.TOTP(at), tt.sha512)
+	}
+}
+
+func TestKey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("new", func(t *testing.T) {
+		t.Parallel()
+
+		k, err := NewKey("Ong", "alice@example.com")
+		attest.Ok(t, err)
+		attest.Equal(t, len(k.secret), secretLen)
+		attest.Equal(t, len(k.TOTP(time.Now())), 6)
+
+		k2, err := NewKey("Ong", "alice@example.com")
+		attest.Ok(t, err)
+		attest.NotEqual(t, k.Secret(), k2.Secret())
+
+		for _, tt := range [][2]string{{"", "alice"}, {"Ong", ""}, {"On:g", "alice"}} {
+			_, err := NewKey(tt[0], tt[1])
+			attest.Error(t, err)
+		}
+	})
+
+	t.Run("uri roundtrip", func(t *testing.T) {
+		t.Parallel()
+
+		k, err := NewKey("Ong", "alice@example.com")
+		attest.Ok(t, err)
+
+		uri := k.URI()
+		attest.True(t, strings.HasPrefix(uri, "otpauth://totp/Ong:alice@example.com?"))
+		attest.Subsequence(t, uri, "secret="+k.Secret())
+
+		got, err := ParseURI(uri)
+		attest.Ok(t, err)
+		attest.Equal(t, got.Issuer(), k.Issuer())
+		attest.Equal(t, got.Account(), k.Account())
+		attest.Equal(t, got.Secret(), k.Secret())
+		now := time.Now()
+		attest.Equal(t, got.TOTP(now), k.TOTP(now))
+	})
+
+	t.Run("parse", func(t *testing.T) {
+		t.Parallel()
+
+		k, err := ParseURI("otpauth://totp/ACME%20Co:john.doe@email.com?secret=HXDMVJECJJWSRB3HWIZR4IFUGFTMXBOZ&issuer=ACME%20Co&algorithm=SHA256&digits=8&period=60")
+		attest.Ok(t, err)
+		attest.Equal(t, k.Issuer(), "ACME Co")
+		attest.Equal(t, k.Account(), "john.doe@email.com")
+		attest.Equal(t, k.algo, SHA256)
+		attest.Equal(t, k.digits, 8)
+		attest.Equal(t, k.period, time.Minute)
+
+		for _, bad := range []string{
+			"https://totp/a:b?secret=HXDMVJECJJWSRB3H",
+			"otpauth://motp/a:b?secret=HXDMVJECJJWSRB3H",
+			"otpauth://totp/a:b?secret=",
+			"otpauth://totp/a:b?secret=!!!",
+			"otpauth://totp/a:b?secret=HXDMVJECJJWSRB3H&algorithm=MD5",
+			"otpauth://totp/a:b?secret=HXDMVJECJJWSRB3H&digits=7",
+			"otpauth://totp/a:b?secret=HXDMVJECJJWSRB3H&period=0",
+		} {
+			_, err := ParseURI(bad)
+			attest.Error(t, err, attest.Sprintf("uri: %s", bad))
+		}
+	})
+
+	t.Run("does not leak secret", func(t *testing.T) {
+		t.Parallel()
+
+		k, err := NewKey("Ong", "alice")
+		attest.Ok(t, err)
+		attest.False(t, strings.Contains(k.String(), k.Secret()))
+		attest.False(t, strings.Contains(k.GoString(), k.Secret()))
+	})
+}
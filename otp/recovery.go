@@ -0,0 +1,69 @@
+package otp
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+
+	"github.com/komuw/ong/cry"
+)
+
+const (
+	// recoveryAlphabet is the lowercase base32 alphabet.
+	recoveryAlphabet = "abcdefghijklmnopqrstuvwxyz234567"
+	recoveryCodeLen  = 10 // 50bits
+)
+
+// ErrNoRecoveryCode is returned when a recovery code does not match any of the hashes.
+var ErrNoRecoveryCode = errors.New("ong/otp: invalid recovery code")
+
+// NewRecoveryCodes returns n random recovery codes and their hashes, as produced by [cry.Hash].
+// The codes are to be shown to the user once, only the hashes should be persisted.
+// They are formatted as `xxxxx-xxxxx` for readability.
+func NewRecoveryCodes(n int) (codes, hashes []string, err error) {
+	if n < 1 {
+		return nil, nil, errors.New("ong/otp: n should be greater than zero")
+	}
+
+	codes = make([]string, 0, n)
+	hashes = make([]string, 0, n)
+	for range n {
+		b := make([]byte, recoveryCodeLen)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		for i := range b {
+			// 256 is a multiple of 32, so this is not biased.
+			b[i] = recoveryAlphabet[int(b[i])%len(recoveryAlphabet)]
+		}
+
+		code := string(b[:recoveryCodeLen/2]) + "-" + string(b[recoveryCodeLen/2:])
+		codes = append(codes, code)
+		hashes = append(hashes, cry.Hash(normaliseRecoveryCode(code)))
+	}
+
+	return codes, hashes, nil
+}
+
+// VerifyRecoveryCode checks code against the hashes produced by [NewRecoveryCodes].
+// It returns the index of the matching hash. Each code can only be used once, so the caller should delete that hash.
+// The check is case-insensitive and ignores spaces & dashes.
+func VerifyRecoveryCode(code string, hashes []string) (int, error) {
+	code = normaliseRecoveryCode(code)
+	if len(code) != recoveryCodeLen {
+		return -1, ErrNoRecoveryCode
+	}
+
+	for i, h := range hashes {
+		if cry.Eql(code, h) == nil {
+			return i, nil
+		}
+	}
+
+	return -1, ErrNoRecoveryCode
+}
+
+func normaliseRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,38 @@
+package otp
+
+import (
+	"strings"
+	"testing"
+
+	"go.akshayshah.org/attest"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	t.Parallel()
+
+	codes, hashes, err := NewRecoveryCodes(3)
+	attest.Ok(t, err)
+	attest.Equal(t, len(codes), 3)
+	attest.Equal(t, len(hashes), 3)
+	for _, c := range codes {
+		attest.Equal(t, len(c), recoveryCodeLen+1)
+		attest.Equal(t, c[recoveryCodeLen/2], '-')
+	}
+
+	i, err := VerifyRecoveryCode(codes[1], hashes)
+	attest.Ok(t, err)
+	attest.Equal(t, i, 1)
+
+	// case, spaces & dashes do not matter.
+	i, err = VerifyRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[2], "-", "")), hashes)
+	attest.Ok(t, err)
+	attest.Equal(t, i, 2)
+
+	_, err = VerifyRecoveryCode("aaaaa-aaaaa", hashes)
+	attest.ErrorIs(t, err, ErrNoRecoveryCode)
+	_, err = VerifyRecoveryCode("short", hashes)
+	attest.ErrorIs(t, err, ErrNoRecoveryCode)
+
+	_, _, err = NewRecoveryCodes(0)
+	attest.Error(t, err)
+}
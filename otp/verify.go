@@ -0,0 +1,139 @@
+package otp
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/komuw/ong/sess"
+)
+
+const (
+	// maxReplayCache is the maximum number of keys whose last used step is remembered.
+	maxReplayCache = 10_000
+	// pendingKey is the session key used to mark the second factor as pending.
+	pendingKey = "ong_otp_pending"
+)
+
+var (
+	// ErrInvalidCode is returned when a one-time password does not match.
+	ErrInvalidCode = errors.New("ong/otp: invalid code")
+	// ErrReplayedCode is returned when a one-time password, or an older one, has already been used.
+	ErrReplayedCode = errors.New("ong/otp: code has already been used")
+)
+
+// Verifier verifies time-based one-time passwords.
+// It remembers the codes that have been used so that each can only be used once.
+//
+// The memory is per Verifier. If your application runs multiple instances, route the users to the same instance or
+// use a shorter drift window to reduce the chances of a replay.
+//
+// Use [NewVerifier] to get a valid Verifier.
+type Verifier struct {
+	drift uint
+	now   func() time.Time
+
+	mu sync.Mutex // protects used
+	// +checklocks:mu
+	used map[[sha256.Size]byte]uint64 // key -> last used step.
+}
+
+// NewVerifier returns a [Verifier] that accepts codes that are up to drift periods before or after the current one.
+// This caters for clocks that are out of sync and for users that are slow to type. A drift of 1 is recommended by RFC 6238.
+func NewVerifier(drift uint) *Verifier {
+	return &Verifier{
+		drift: drift,
+		now:   time.Now,
+		used:  map[[sha256.Size]byte]uint64{},
+	}
+}
+
+// Verify checks that code is a valid time-based one-time password of k.
+// A code is rejected if it, or a code of a later period, has already been used with k.
+func (v *Verifier) Verify(k Key, code string) error {
+	if len(code) != k.digits {
+		return ErrInvalidCode
+	}
+
+	current := k.step(v.now())
+	for i := -int64(v.drift); i <= int64(v.drift); i++ {
+		step := uint64(int64(current) + i)
+		if subtle.ConstantTimeCompare([]byte(k.HOTP(step)), []byte(code)) == 1 {
+			return v.use(k, step, current)
+		}
+	}
+
+	return ErrInvalidCode
+}
+
+// use records that step has been used with k.
+func (v *Verifier) use(k Key, step, current uint64) error {
+	id := sha256.Sum256(k.secret)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if last, ok := v.used[id]; ok && step <= last {
+		return ErrReplayedCode
+	}
+
+	if len(v.used) >= maxReplayCache {
+		// Drop the entries that can no longer be replayed.
+		for i, last := range v.used {
+			if last+uint64(v.drift) < current {
+				delete(v.used, i)
+			}
+		}
+		if len(v.used) >= maxReplayCache {
+			v.used = map[[sha256.Size]byte]uint64{}
+		}
+	}
+	v.used[id] = step
+
+	return nil
+}
+
+// VerifyHOTP checks that code is a valid counter-based one-time password of k.
+// Codes for counters in the range [counter, counter+lookAhead] are accepted, since clients can generate codes that are never used.
+// On success, it returns the counter that should be persisted and used in the next verification.
+func VerifyHOTP(k Key, code string, counter uint64, lookAhead uint) (uint64, error) {
+	if len(code) != k.digits {
+		return counter, ErrInvalidCode
+	}
+
+	for i := range uint64(lookAhead) + 1 {
+		if subtle.ConstantTimeCompare([]byte(k.HOTP(counter+i)), []byte(code)) == 1 {
+			return counter + i + 1, nil
+		}
+	}
+
+	return counter, ErrInvalidCode
+}
+
+// SetPending marks the second factor of the current http session as pending.
+// Call it after the user has successfully used the first factor(say, a password), and then
+// use [Pending] to deny access until [Verifier.VerifySession] succeeds.
+// r ought to be a request that was created by [sess.Initialise]
+func SetPending(r *http.Request) {
+	sess.Set(r, pendingKey, "1")
+}
+
+// Pending reports whether the second factor of the current http session is pending.
+// r ought to be a request that was created by [sess.Initialise]
+func Pending(r *http.Request) bool {
+	return sess.Get(r, pendingKey) == "1"
+}
+
+// VerifySession is like [Verifier.Verify] except that, on success, it also clears the pending state of the current http session.
+// r ought to be a request that was created by [sess.Initialise]
+func (v *Verifier) VerifySession(r *http.Request, k Key, code string) error {
+	if err := v.Verify(k, code); err != nil {
+		return err
+	}
+
+	sess.Set(r, pendingKey, "")
+	return nil
+}
@@ -0,0 +1,126 @@
+package otp
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/komuw/ong/cookie"
+	"github.com/komuw/ong/cry"
+	"github.com/komuw/ong/internal/tst"
+	"github.com/komuw/ong/sess"
+	"go.akshayshah.org/attest"
+)
+
+func TestVerifier(t *testing.T) {
+	t.Parallel()
+
+	newKey := func(t *testing.T) Key {
+		t.Helper()
+		k, err := NewKey("Ong", "alice")
+		attest.Ok(t, err)
+		return k
+	}
+
+	t.Run("verify", func(t *testing.T) {
+		t.Parallel()
+
+		k := newKey(t)
+		v := NewVerifier(1)
+		attest.Ok(t, v.Verify(k, k.TOTP(time.Now())))
+	})
+
+	t.Run("drift", func(t *testing.T) {
+		t.Parallel()
+
+		k := newKey(t)
+		now := time.Now()
+		v := NewVerifier(1)
+		v.now = func() time.Time { return now }
+
+		attest.Ok(t, v.Verify(k, k.TOTP(now.Add(-k.period))))
+		attest.Ok(t, v.Verify(k, k.TOTP(now.Add(k.period))))
+
+		v2 := NewVerifier(1)
+		v2.now = func() time.Time { return now }
+		attest.ErrorIs(t, v2.Verify(k, k.TOTP(now.Add(-3*k.period))), ErrInvalidCode)
+		attest.ErrorIs(t, v2.Verify(k, k.TOTP(now.Add(3*k.period))), ErrInvalidCode)
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		t.Parallel()
+
+		k := newKey(t)
+		now := time.Now()
+		v := NewVerifier(1)
+		v.now = func() time.Time { return now }
+
+		code := k.TOTP(now)
+		attest.Ok(t, v.Verify(k, code))
+		attest.ErrorIs(t, v.Verify(k, code), ErrReplayedCode)
+		// an older code cannot be used after a newer one.
+		attest.ErrorIs(t, v.Verify(k, k.TOTP(now.Add(-k.period))), ErrReplayedCode)
+
+		// other keys are not affected.
+		other := newKey(t)
+		attest.Ok(t, v.Verify(other, other.TOTP(now)))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		k := newKey(t)
+		v := NewVerifier(1)
+		attest.ErrorIs(t, v.Verify(k, ""), ErrInvalidCode)
+		attest.ErrorIs(t, v.Verify(k, "12345"), ErrInvalidCode)
+		attest.ErrorIs(t, v.Verify(newKey(t), k.TOTP(time.Now())), ErrInvalidCode)
+	})
+}
+
+func TestVerifyHOTP(t *testing.T) {
+	t.Parallel()
+
+	k, err := NewKey("Ong", "alice")
+	attest.Ok(t, err)
+
+	next, err := VerifyHOTP(k, k.HOTP(5), 5, 0)
+	attest.Ok(t, err)
+	attest.Equal(t, next, uint64(6))
+
+	next, err = VerifyHOTP(k, k.HOTP(9), 6, 3)
+	attest.Ok(t, err)
+	attest.Equal(t, next, uint64(10))
+
+	// outside look ahead window.
+	next, err = VerifyHOTP(k, k.HOTP(20), 10, 3)
+	attest.ErrorIs(t, err, ErrInvalidCode)
+	attest.Equal(t, next, uint64(10))
+
+	// already used.
+	_, err = VerifyHOTP(k, k.HOTP(9), 10, 3)
+	attest.ErrorIs(t, err, ErrInvalidCode)
+}
+
+func TestVerifySession(t *testing.T) {
+	t.Parallel()
+
+	kr, err := cry.NewKeyring(tst.SecretKey())
+	attest.Ok(t, err)
+	req, err := http.NewRequest(http.MethodGet, "/someUri", nil)
+	attest.Ok(t, err)
+	req = sess.Initialise(req, kr, nil, cookie.Opts{}, "")
+
+	k, err := NewKey("Ong", "alice")
+	attest.Ok(t, err)
+	v := NewVerifier(1)
+
+	attest.False(t, Pending(req))
+	SetPending(req)
+	attest.True(t, Pending(req))
+
+	attest.Error(t, v.VerifySession(req, k, "abcdef"))
+	attest.True(t, Pending(req))
+
+	attest.Ok(t, v.VerifySession(req, k, k.TOTP(time.Now())))
+	attest.False(t, Pending(req))
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/komuw/ong/internal/finger"
 	"github.com/komuw/ong/internal/octx"
 	"github.com/komuw/ong/log"
+	"github.com/komuw/ong/metrics"
 	"github.com/komuw/ong/middleware"
 	"github.com/komuw/ong/mux"
 
@@ -33,6 +34,9 @@ import (
 // If the Opts supplied include a certificate and key, the server will accept https traffic and also automatically handle http->https redirect.
 // Likewise, if the Opts include an acmeEmail address, the server will accept https traffic and automatically handle http->https redirect.
 //
+// If h is a [mux.Muxer], pprof endpoints are added under `/debug/pprof` and [metrics] are served, in the Prometheus text format, at `/debug/metrics`.
+// Both are protected by basic authentication whose username and password are [config.Opts.SecretKey].
+//
 // The server shuts down cleanly after receiving any termination signal.
 func Run(h http.Handler, o config.Opts) error {
 	_ = automax.SetCpu()
@@ -67,6 +71,7 @@ func Run(h http.Handler, o config.Opts) error {
 					profHandler,
 					string(o.SecretKey),
 					string(o.SecretKey),
+					o.RejectFunc,
 				)
 				if errA != nil {
 					errJ = errors.Join(errJ, errA)
@@ -96,6 +101,29 @@ func Run(h http.Handler, o config.Opts) error {
 					return fmt.Errorf("ong/server: unable to add pprof handler: %w", errJ)
 				}
 			}
+
+			{ // 3. Add metrics route handler.
+				// It is protected by the same credentials as the pprof handler.
+				basicAuth, errA := middleware.BasicAuth(
+					metrics.Handler(),
+					string(o.SecretKey),
+					string(o.SecretKey),
+					o.RejectFunc,
+				)
+				if errA != nil {
+					return fmt.Errorf("ong/server: unable to add metrics handler: %w", errA)
+				}
+
+				if errB := m.Unwrap().AddRoute(
+					mux.NewRoute(
+						"/debug/metrics",
+						mux.MethodGet,
+						basicAuth,
+					),
+				); errB != nil {
+					return fmt.Errorf("ong/server: unable to add metrics handler: %w", errB)
+				}
+			}
 		}
 	}
 
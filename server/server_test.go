@@ -153,6 +153,27 @@ func TestServer(t *testing.T) {
 			attest.Equal(t, string(rb), msg)
 		}
 
+		{ // metrics endpoint requires authentication.
+			url := fmt.Sprintf("https://localhost:%d/debug/metrics", port)
+			res, err := client.Get(url)
+			attest.Ok(t, err)
+			defer res.Body.Close()
+			attest.Equal(t, res.StatusCode, http.StatusUnauthorized)
+
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			attest.Ok(t, err)
+			req.SetBasicAuth(tst.SecretKey(), tst.SecretKey())
+			res2, err := client.Do(req)
+			attest.Ok(t, err)
+			defer res2.Body.Close()
+			rb, err := io.ReadAll(res2.Body)
+			attest.Ok(t, err)
+
+			attest.Equal(t, res2.StatusCode, http.StatusOK, attest.Sprintf("body=%s", string(rb)))
+			attest.Subsequence(t, string(rb), `ong_http_requests_total{route="/api/",method="GET",code="200"}`)
+			attest.Subsequence(t, string(rb), "go_goroutines")
+		}
+
 		{ // http2.
 			tr2 := &http.Transport{
 				// since we are using self-signed certificates, we need to skip verification.
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"time"
 
 	"github.com/komuw/ong/config"
 	"github.com/komuw/ong/log"
@@ -45,3 +46,83 @@ func ExampleSetM() {
 
 	fmt.Println(res.Cookies()[0])
 }
+
+func ExampleNewMemoryStore() {
+	l := log.New(context.Background(), os.Stdout, 100)
+	opts := config.WithOpts("example.com", 443, "super-h@rd-Pas1word", config.DirectIpStrategy, l)
+	// Sessions are stored server-side, and the cookie only contains the session ID.
+	// They expire after 30minutes of inactivity, or after 12hours regardless.
+	store := sess.NewMemoryStore(30*time.Minute, 12*time.Hour)
+	opts.SessionStore = store
+
+	handler := middleware.Get(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sess.SetUserID(r, "user-123")
+			sess.Set(r, "favorite_color", "red")
+			fmt.Fprint(w, "welcome again.")
+		}),
+		opts,
+	)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/login", nil)
+	handler.ServeHTTP(rec, req)
+
+	sessions, err := store.List(context.Background(), "user-123")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(len(sessions))
+
+	// Log the user out of all their devices.
+	if err := sess.RevokeAll(context.Background(), store, "user-123"); err != nil {
+		panic(err)
+	}
+
+	// Output: 1
+}
+
+func ExampleRegenerate() {
+	// A login handler.
+	_ = func(w http.ResponseWriter, r *http.Request) {
+		// ... authenticate the user ...
+
+		// Prevent session fixation.
+		sess.Regenerate(r)
+		sess.SetUserID(r, "user-123")
+		sess.AddFlash(r, "Welcome back.")
+		http.Redirect(w, r, "/home", http.StatusSeeOther)
+	}
+
+	// A logout handler.
+	_ = func(w http.ResponseWriter, r *http.Request) {
+		sess.Destroy(r)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+
+	// The page that the user is redirected to.
+	_ = func(w http.ResponseWriter, r *http.Request) {
+		for _, msg := range sess.Flashes(r) {
+			fmt.Fprintln(w, msg)
+		}
+	}
+}
+
+func ExampleSetValue() {
+	type cart struct {
+		Items []string
+		Total int
+	}
+
+	_ = func(w http.ResponseWriter, r *http.Request) {
+		c, _ := sess.GetValue[cart](r, "cart")
+		c.Items = append(c.Items, "mango")
+		c.Total = c.Total + 3
+
+		if err := sess.SetValue(r, "cart", c); err != nil {
+			// The session no longer fits in a cookie.
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, "added to cart.")
+	}
+}
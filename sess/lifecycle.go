@@ -0,0 +1,100 @@
+package sess
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/komuw/ong/cookie"
+)
+
+const (
+	// flashKey is the session key under which flash messages are stored.
+	flashKey = "ong_flash"
+	// clearSiteDataHeader tells browsers to remove data that a site has stored.
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Clear-Site-Data
+	clearSiteDataHeader = "Clear-Site-Data"
+)
+
+// Regenerate moves the current http session to a new session ID, keeping its key-value pairs.
+// Call it whenever the privilege level of a user changes, like on login, to prevent [session fixation].
+// It only has an effect when sessions are backed by a [Store]; cookie-backed sessions are re-encrypted on every save and have no ID to fixate.
+// r ought to be a request that was created by [Initialise]
+//
+// [session fixation]: https://owasp.org/www-community/attacks/Session_fixation
+func Regenerate(r *http.Request) {
+	if st := getState(r); st != nil {
+		st.regenerate = true
+	}
+}
+
+// Destroy ends the current http session, say on logout.
+// All its key-value pairs are removed, the session cookie is deleted, and browsers are asked to clear the cookies & storage of the site using the Clear-Site-Data header.
+// When sessions are backed by a [Store], the session is also deleted from it.
+// Any key-value pairs added to the session after calling Destroy, in the same request, are discarded.
+// r ought to be a request that was created by [Initialise]
+func Destroy(r *http.Request) {
+	st := getState(r)
+	if st == nil {
+		return
+	}
+	st.destroyed = true
+
+	if s, ok := r.Context().Value(ctxKey).(M); ok {
+		clear(s)
+	}
+}
+
+// destroy is called by [Save] for sessions that have been destroyed.
+func destroy(r *http.Request, w http.ResponseWriter, domain string, store Store, st *state) {
+	if store != nil && st.id != "" {
+		_ = store.Delete(r.Context(), st.id)
+	}
+	st.id = ""
+	st.userID = ""
+
+	cookie.DeleteEncrypted(r, w, st.opts.Name(CookieName), domain, st.opts)
+	w.Header().Set(clearSiteDataHeader, `"cookies", "storage"`)
+}
+
+// AddFlash adds a one-time message to the current http session. It can be read, usually while rendering the next page, using [Flashes].
+// r ought to be a request that was created by [Initialise]
+func AddFlash(r *http.Request, msg string) {
+	s, ok := r.Context().Value(ctxKey).(M)
+	if !ok {
+		return
+	}
+
+	flashes := getFlashes(s)
+	flashes = append(flashes, msg)
+	b, err := json.Marshal(flashes)
+	if err != nil {
+		return
+	}
+	s[flashKey] = string(b)
+}
+
+// Flashes returns the messages added using [AddFlash], in the order they were added, and removes them from the current http session.
+// r ought to be a request that was created by [Initialise]
+func Flashes(r *http.Request) []string {
+	s, ok := r.Context().Value(ctxKey).(M)
+	if !ok {
+		return nil
+	}
+
+	flashes := getFlashes(s)
+	delete(s, flashKey)
+	return flashes
+}
+
+func getFlashes(s M) []string {
+	v, ok := s[flashKey]
+	if !ok {
+		return nil
+	}
+
+	var flashes []string
+	if err := json.Unmarshal([]byte(v), &flashes); err != nil {
+		return nil
+	}
+	return flashes
+}
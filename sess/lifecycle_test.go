@@ -0,0 +1,139 @@
+package sess
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/komuw/ong/cookie"
+	"go.akshayshah.org/attest"
+)
+
+// roundTrip returns a request that carries the session cookie, if any, that was set on rec.
+func roundTrip(t *testing.T, rec *httptest.ResponseRecorder) *http.Request {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+	res := rec.Result()
+	defer res.Body.Close()
+	for _, c := range res.Cookies() {
+		if c.Name == CookieName && c.MaxAge >= 0 {
+			req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		}
+	}
+	return req
+}
+
+func TestRegenerate(t *testing.T) {
+	t.Parallel()
+
+	kr := testKeyring(t)
+	store := NewMemoryStore(time.Hour, 0)
+
+	req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+	req = Initialise(req, kr, store, cookie.Opts{}, "")
+	Set(req, "name", "John")
+	rec := httptest.NewRecorder()
+	Save(req, rec, "localhost", time.Hour, kr, store)
+	oldID := ID(req)
+	attest.NotZero(t, oldID)
+
+	// login.
+	req2 := Initialise(roundTrip(t, rec), kr, store, cookie.Opts{}, "")
+	attest.Equal(t, ID(req2), oldID)
+	Regenerate(req2)
+	Set(req2, "user", "john")
+	rec2 := httptest.NewRecorder()
+	Save(req2, rec2, "localhost", time.Hour, kr, store)
+
+	newID := ID(req2)
+	attest.NotZero(t, newID)
+	attest.NotEqual(t, newID, oldID)
+
+	_, err := store.Get(context.Background(), oldID)
+	attest.ErrorIs(t, err, ErrNotFound)
+
+	req3 := Initialise(roundTrip(t, rec2), kr, store, cookie.Opts{}, "")
+	attest.Equal(t, ID(req3), newID)
+	attest.Equal(t, GetM(req3), M{"name": "John", "user": "john"})
+}
+
+func TestDestroy(t *testing.T) {
+	t.Parallel()
+
+	stores := map[string]Store{
+		"cookie": nil,
+		"store":  NewMemoryStore(time.Hour, 0),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			kr := testKeyring(t)
+
+			req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+			req = Initialise(req, kr, store, cookie.Opts{}, "")
+			Set(req, "name", "John")
+			rec := httptest.NewRecorder()
+			Save(req, rec, "localhost", time.Hour, kr, store)
+			oldID := ID(req)
+
+			// logout.
+			req2 := Initialise(roundTrip(t, rec), kr, store, cookie.Opts{}, "")
+			attest.Equal(t, Get(req2, "name"), "John")
+			Destroy(req2)
+			attest.Zero(t, Get(req2, "name"))
+			Set(req2, "ignored", "yes")
+			rec2 := httptest.NewRecorder()
+			Save(req2, rec2, "localhost", time.Hour, kr, store)
+
+			res := rec2.Result()
+			defer res.Body.Close()
+			attest.Equal(t, res.Header.Get(clearSiteDataHeader), `"cookies", "storage"`)
+			attest.Equal(t, len(res.Cookies()), 1)
+			attest.True(t, res.Cookies()[0].MaxAge < 0)
+
+			if store != nil {
+				_, err := store.Get(context.Background(), oldID)
+				attest.ErrorIs(t, err, ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestFlash(t *testing.T) {
+	t.Parallel()
+
+	stores := map[string]Store{
+		"cookie": nil,
+		"store":  NewMemoryStore(time.Hour, 0),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			kr := testKeyring(t)
+
+			req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+			req = Initialise(req, kr, store, cookie.Opts{}, "")
+			attest.Zero(t, Flashes(req))
+			AddFlash(req, "saved.")
+			AddFlash(req, "welcome back.")
+			rec := httptest.NewRecorder()
+			Save(req, rec, "localhost", time.Hour, kr, store)
+
+			// next page render.
+			req2 := Initialise(roundTrip(t, rec), kr, store, cookie.Opts{}, "")
+			attest.Equal(t, Flashes(req2), []string{"saved.", "welcome back."})
+			// they are only shown once.
+			attest.Zero(t, Flashes(req2))
+			rec2 := httptest.NewRecorder()
+			Save(req2, rec2, "localhost", time.Hour, kr, store)
+
+			req3 := Initialise(roundTrip(t, rec2), kr, store, cookie.Opts{}, "")
+			attest.Zero(t, Flashes(req3))
+		})
+	}
+}
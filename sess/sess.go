@@ -1,15 +1,18 @@
 // Package sess provides an implementation of http sessions that is backed by tamper-proof & encrypted cookies.
+// Sessions can also be stored server-side in a [Store], in which case the cookie only contains an opaque session ID.
 // This package should ideally be used together with the ong [github.com/komuw/ong/middleware] middlewares.
 package sess
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"maps"
 	"net/http"
 	"time"
 
 	"github.com/komuw/ong/cookie"
+	"github.com/komuw/ong/cry"
 )
 
 type (
@@ -19,12 +22,31 @@ type (
 )
 
 const (
-	ctxKey = sessionContextKeyType("ong-session-key")
+	ctxKey      = sessionContextKeyType("ong-session-key")
+	stateCtxKey = sessionContextKeyType("ong-session-state-key")
 	// CookieName is the name of the http cookie under which sessions are stored.
 	CookieName = "ong_sess"
 )
 
+// state is the metadata of the current http session.
+type state struct {
+	// id, userID & createdAt are only used when sessions are backed by a [Store].
+	id        string
+	userID    string
+	createdAt time.Time
+
+	// kr is only set when sessions are backed by cookies. It is used to check the size of the session cookie.
+	kr *cry.Keyring
+	// opts are the attributes of the session cookie.
+	opts       cookie.Opts
+	loaded     bool // whether the session was read from an existing cookie.
+	regenerate bool // set by [Regenerate]
+	destroyed  bool // set by [Destroy]
+}
+
 // Initialise returns a new http.Request (based on r) that has sessions properly setup.
+// If store is nil, the session is read from an encrypted cookie. Otherwise, the cookie only contains the session ID and the session is read from store.
+// o are the attributes of the session cookie; if o.HostOnly is true, the cookie name gets the __Host- prefix. See [cookie.Opts.Name].
 // If antiReplay is a non-empty string, it is used to try and mitigate against [replay attacks].
 // This mitigation not foolproof.
 //
@@ -33,17 +55,34 @@ const (
 //
 // [replay attacks]: https://en.wikipedia.org/wiki/Replay_attack
 // [ong middleware]: github.com/komuw/ong/middleware
-func Initialise(r *http.Request, secretKey, antiReplay string) *http.Request {
+func Initialise(r *http.Request, kr *cry.Keyring, store Store, o cookie.Opts, antiReplay string) *http.Request {
 	r = cookie.SetAntiReplay(r, antiReplay)
 
 	ctx := r.Context()
 	var sessVal M // should be per request.
 
-	c, err := cookie.GetEncrypted(r, CookieName, secretKey)
+	c, err := cookie.GetEncrypted(r, o.Name(CookieName), kr)
+	if store != nil {
+		st := &state{opts: o}
+		if err == nil && c.Value != "" {
+			if rec, errG := store.Get(ctx, c.Value); errG == nil {
+				st = &state{id: rec.ID, userID: rec.UserID, createdAt: rec.CreatedAt, opts: o}
+				sessVal = rec.Values
+			}
+		}
+		if sessVal == nil {
+			sessVal = M{}
+		}
+		ctx = context.WithValue(ctx, stateCtxKey, st)
+		ctx = context.WithValue(ctx, ctxKey, sessVal)
+		return r.WithContext(ctx)
+	}
+
+	loaded := false
 	if err == nil && c.Value != "" {
 		if errM := json.Unmarshal([]byte(c.Value), &sessVal); errM == nil {
 			ctx = context.WithValue(ctx, ctxKey, sessVal)
-			r = r.WithContext(ctx)
+			loaded = true
 		}
 	}
 
@@ -51,10 +90,10 @@ func Initialise(r *http.Request, secretKey, antiReplay string) *http.Request {
 		// The process above might have failed; maybe `json.Unmarshal` failed.
 		sessVal = M{}
 		ctx = context.WithValue(ctx, ctxKey, sessVal)
-		r = r.WithContext(ctx)
 	}
+	ctx = context.WithValue(ctx, stateCtxKey, &state{kr: kr, opts: o, loaded: loaded})
 
-	return r
+	return r.WithContext(ctx)
 }
 
 // Set adds the key-value pair to the current http session.
@@ -113,7 +152,38 @@ func GetM(r *http.Request) map[string]string {
 	return newMap
 }
 
+// SetUserID associates the current http session with the given user. This makes it possible to list & revoke the sessions of a user,
+// see [Store.List] & [RevokeAll].
+// It only has an effect when sessions are backed by a [Store].
+// r ought to be a request that was created by [Initialise]
+func SetUserID(r *http.Request, userID string) {
+	if st := getState(r); st != nil {
+		st.userID = userID
+	}
+}
+
+// ID returns the ID of the current http session. It can be used, say, to tell which of the sessions returned by [Store.List] is the current one.
+// It returns an empty string if sessions are not backed by a [Store] or the session has not been saved yet.
+// r ought to be a request that was created by [Initialise]
+func ID(r *http.Request) string {
+	if st := getState(r); st != nil {
+		return st.id
+	}
+	return ""
+}
+
+func getState(r *http.Request) *state {
+	if st, ok := r.Context().Value(stateCtxKey).(*state); ok {
+		return st
+	}
+	return nil
+}
+
 // Save writes(to http cookies) any key-value pairs that have already been added to the current http session.
+// If store is not nil, the key-value pairs are written to store instead and the cookie only contains the session ID.
+//
+// Each save renews the expiry of the session cookie to mAge from now, so sessions expire only after mAge of inactivity.
+// When sessions are backed by a store, it also renews their idle expiry.
 //
 // You do not need to call this function, if you are also using the ong [github.com/komuw/ong/middleware] middleware.
 // Those middleware do so automatically for you.
@@ -122,11 +192,32 @@ func Save(
 	w http.ResponseWriter,
 	domain string,
 	mAge time.Duration,
-	secretKey string,
+	kr *cry.Keyring,
+	store Store,
 ) {
+	if st := getState(r); st != nil && st.destroyed {
+		destroy(r, w, domain, store, st)
+		return
+	}
+
+	if store != nil {
+		saveToStore(r, w, domain, mAge, kr, store)
+		return
+	}
+
+	st := getState(r)
+	o := cookie.Opts{}
+	if st != nil {
+		o = st.opts
+	}
+
 	savedSess := GetM(r)
 	if len(savedSess) <= 0 {
 		// If GetM returns a zero-length map, then we do not have to write any session.
+		// However, if the session was emptied during this request(say, its flashes were read), the stale cookie has to be removed.
+		if st != nil && st.loaded {
+			cookie.DeleteEncrypted(r, w, o.Name(CookieName), domain, o)
+		}
 		return
 	}
 
@@ -136,13 +227,79 @@ func Save(
 		// This is because, at this point; we know for sure that savedSess is a non zero-length map[string]string
 		return
 	}
-	cookie.SetEncrypted(
+	// The only possible error is cookie.ErrTooLarge, which callers can detect beforehand using [Validate].
+	_ = cookie.SetEncryptedOpts(
 		r,
 		w,
-		CookieName,
+		o.Name(CookieName),
 		string(value),
 		domain,
 		mAge,
-		secretKey,
+		o,
+		kr,
 	)
 }
+
+func saveToStore(
+	r *http.Request,
+	w http.ResponseWriter,
+	domain string,
+	mAge time.Duration,
+	kr *cry.Keyring,
+	store Store,
+) {
+	st := getState(r)
+	if st == nil {
+		return
+	}
+	savedSess := GetM(r)
+	if len(savedSess) <= 0 && st.id == "" && st.userID == "" {
+		// There is no session to write.
+		return
+	}
+
+	now := time.Now()
+	if st.regenerate && st.id != "" {
+		// Prevent session fixation by moving the session to a new ID.
+		if err := store.Delete(r.Context(), st.id); err != nil {
+			return
+		}
+		st.id = ""
+	}
+	st.regenerate = false
+	if st.id == "" {
+		st.id = newID()
+		st.createdAt = now
+		if err := store.Create(r.Context(), newRecord(st, savedSess, now)); err != nil {
+			return
+		}
+	} else if err := store.Update(r.Context(), newRecord(st, savedSess, now)); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			// The session was revoked, or it expired, while this request was being handled.
+			// It should not be brought back, so remove its cookie.
+			cookie.DeleteEncrypted(r, w, st.opts.Name(CookieName), domain, st.opts)
+		}
+		return
+	}
+
+	_ = cookie.SetEncryptedOpts( // The session ID always fits in a cookie.
+		r,
+		w,
+		st.opts.Name(CookieName),
+		st.id,
+		domain,
+		mAge,
+		st.opts,
+		kr,
+	)
+}
+
+func newRecord(st *state, values M, now time.Time) Record {
+	return Record{
+		ID:         st.id,
+		UserID:     st.userID,
+		Values:     values,
+		CreatedAt:  st.createdAt,
+		LastSeenAt: now,
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/komuw/ong/cookie"
+	"github.com/komuw/ong/cry"
 	"github.com/komuw/ong/internal/tst"
 	"go.akshayshah.org/attest"
 	"go.uber.org/goleak"
@@ -16,6 +18,15 @@ func TestMain(m *testing.M) {
 	goleak.VerifyTestMain(m)
 }
 
+// testKeyring returns a keyring that can be used in tests.
+func testKeyring(t testing.TB) *cry.Keyring {
+	t.Helper()
+
+	kr, err := cry.NewKeyring(tst.SecretKey())
+	attest.Ok(t, err)
+	return kr
+}
+
 func TestSess(t *testing.T) {
 	t.Parallel()
 
@@ -24,7 +35,7 @@ func TestSess(t *testing.T) {
 
 		req, err := http.NewRequest(http.MethodGet, "/someUri", nil)
 		attest.Ok(t, err)
-		req = Initialise(req, tst.SecretKey(), "")
+		req = Initialise(req, testKeyring(t), nil, cookie.Opts{}, "")
 
 		res := req.Context().Value(ctxKey).(map[string]string)
 		attest.Equal(t, res, map[string]string{})
@@ -38,7 +49,7 @@ func TestSess(t *testing.T) {
 
 		req, err := http.NewRequest(http.MethodGet, "/someUri", nil)
 		attest.Ok(t, err)
-		req = Initialise(req, tst.SecretKey(), "")
+		req = Initialise(req, testKeyring(t), nil, cookie.Opts{}, "")
 
 		Set(req, k, v)
 		res := req.Context().Value(ctxKey).(map[string]string)
@@ -52,7 +63,7 @@ func TestSess(t *testing.T) {
 
 		req, err := http.NewRequest(http.MethodGet, "/someUri", nil)
 		attest.Ok(t, err)
-		req = Initialise(req, tst.SecretKey(), "")
+		req = Initialise(req, testKeyring(t), nil, cookie.Opts{}, "")
 
 		SetM(req, m)
 		res := req.Context().Value(ctxKey).(map[string]string)
@@ -66,7 +77,7 @@ func TestSess(t *testing.T) {
 		v := "John Keypoole"
 		req, err := http.NewRequest(http.MethodGet, "/someUri", nil)
 		attest.Ok(t, err)
-		req = Initialise(req, tst.SecretKey(), "")
+		req = Initialise(req, testKeyring(t), nil, cookie.Opts{}, "")
 
 		{
 			one := Get(req, k)
@@ -89,7 +100,7 @@ func TestSess(t *testing.T) {
 		m := M{"name": "John Doe", "age": "99"}
 		req, err := http.NewRequest(http.MethodGet, "/someUri", nil)
 		attest.Ok(t, err)
-		req = Initialise(req, tst.SecretKey(), "")
+		req = Initialise(req, testKeyring(t), nil, cookie.Opts{}, "")
 
 		{
 			one := GetM(req)
@@ -122,7 +133,7 @@ func TestSess(t *testing.T) {
 		req, err := http.NewRequest(http.MethodGet, "/someUri", nil)
 		attest.Ok(t, err)
 		rec := httptest.NewRecorder()
-		req = Initialise(req, tst.SecretKey(), "")
+		req = Initialise(req, testKeyring(t), nil, cookie.Opts{}, "")
 
 		{
 			SetM(req, m)
@@ -130,7 +141,7 @@ func TestSess(t *testing.T) {
 			attest.Equal(t, res, m)
 		}
 		{
-			Save(req, rec, "localhost", 2*time.Hour, tst.SecretKey())
+			Save(req, rec, "localhost", 2*time.Hour, testKeyring(t), nil)
 		}
 	})
 }
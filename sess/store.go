@@ -0,0 +1,447 @@
+package sess
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// idLen is the number of random bytes in a session ID.
+	idLen = 32
+	// maxMemorySessions is the maximum number of sessions in a memory store.
+	// Once it is reached, the sessions that have been idle the longest are removed to make room for new ones.
+	maxMemorySessions = 100_000
+	fileStoreExt      = ".json"
+	// fileStoreSweepInterval is how often a file store removes the files of expired sessions.
+	fileStoreSweepInterval = 5 * time.Minute
+)
+
+var (
+	// ErrNotFound is returned by a [Store] when a session does not exist or has expired.
+	ErrNotFound = errors.New("ong/sess: session not found")
+	// errExists is returned by a [Store] when creating a session whose ID is already in use.
+	errExists = errors.New("ong/sess: session already exists")
+)
+
+// idRegex matches session IDs produced by newID. It is used to make sure that IDs are safe to use as file names.
+var idRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{43}$`) //nolint:gochecknoglobals
+
+// Record is a session as persisted in a [Store].
+type Record struct {
+	// ID is the opaque, random, identifier of the session. It is the only thing that is stored in the session cookie.
+	ID string `json:"id"`
+	// UserID is the user that the session belongs to, if any. See [SetUserID].
+	UserID string `json:"user_id"`
+	// Values are the key-value pairs of the session.
+	Values M `json:"values"`
+	// CreatedAt is when the session was created.
+	CreatedAt time.Time `json:"created_at"`
+	// LastSeenAt is when the session was last used.
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// expired reports whether r has been idle for longer than idle, or has existed for longer than absolute.
+// A zero duration means no limit.
+func (r Record) expired(idle, absolute time.Duration, now time.Time) bool {
+	if idle > 0 && now.Sub(r.LastSeenAt) > idle {
+		return true
+	}
+	if absolute > 0 && now.Sub(r.CreatedAt) > absolute {
+		return true
+	}
+	return false
+}
+
+// Store persists sessions server-side. When sessions are backed by a Store, the session cookie only contains an opaque session ID.
+// This lifts the size limit of cookie-backed sessions, and makes it possible to list & revoke sessions.
+//
+// Implementations are responsible for expiring sessions and should be safe for concurrent use.
+// [NewMemoryStore] & [NewFileStore] are provided; other backends, like a database, can be used by implementing this interface.
+type Store interface {
+	// Get returns the session with the given id. It returns [ErrNotFound] if the session does not exist or has expired.
+	Get(ctx context.Context, id string) (Record, error)
+	// Create adds a new session. It returns an error if a session with the same ID already exists.
+	Create(ctx context.Context, rec Record) error
+	// Update replaces an existing session. It returns [ErrNotFound] if the session does not exist or has expired,
+	// so that a request which loaded a session before it was revoked, see [RevokeAll], cannot bring it back to life.
+	Update(ctx context.Context, rec Record) error
+	// Delete removes the session with the given id. It is not an error if the session does not exist.
+	Delete(ctx context.Context, id string) error
+	// List returns the active sessions of the user with the given userID.
+	List(ctx context.Context, userID string) ([]Record, error)
+}
+
+// RevokeAll deletes all the sessions of the user with the given userID, say after they change their password.
+// Use [Store.Delete] to revoke a single session.
+func RevokeAll(ctx context.Context, s Store, userID string) error {
+	recs, err := s.List(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, rec := range recs {
+		errs = append(errs, s.Delete(ctx, rec.ID))
+	}
+
+	return errors.Join(errs...)
+}
+
+// newID returns a random session ID.
+func newID() string {
+	b := make([]byte, idLen)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// memoryStore is a [Store] that keeps sessions in memory.
+type memoryStore struct {
+	idle     time.Duration
+	absolute time.Duration
+	max      int
+
+	mu sync.Mutex // protects m & lru
+	// +checklocks:mu
+	m map[string]*list.Element
+	// lru holds the sessions in the order that they were last saved, the most recent at the front.
+	// +checklocks:mu
+	lru *list.List
+}
+
+// NewMemoryStore returns a [Store] that keeps sessions in memory.
+// Sessions are lost when the application restarts, and are not shared between multiple instances of the application.
+//
+// A session expires if it is not used for idle, or once absolute has elapsed since it was created. A zero duration means no limit.
+// The store holds at most 100_000 sessions, after which the sessions that have been idle the longest are removed.
+func NewMemoryStore(idle, absolute time.Duration) Store {
+	return newMemoryStore(idle, absolute, maxMemorySessions)
+}
+
+func newMemoryStore(idle, absolute time.Duration, maxSessions int) *memoryStore {
+	return &memoryStore{
+		idle:     idle,
+		absolute: absolute,
+		max:      maxSessions,
+		m:        map[string]*list.Element{},
+		lru:      list.New(),
+	}
+}
+
+func (s *memoryStore) Get(_ context.Context, id string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.m[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	rec := e.Value.(Record)
+	if rec.expired(s.idle, s.absolute, time.Now()) {
+		s.remove(e)
+		return Record{}, ErrNotFound
+	}
+
+	rec.Values = maps.Clone(rec.Values)
+	return rec, nil
+}
+
+func (s *memoryStore) Create(_ context.Context, rec Record) error {
+	if rec.ID == "" {
+		return errors.New("ong/sess: session ID cannot be empty")
+	}
+	rec.Values = maps.Clone(rec.Values)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.m[rec.ID]; ok {
+		return errExists
+	}
+
+	// Remove the expired sessions at the back, then make room if the store is full.
+	// Each save moves a session to the front, so this is done in constant time for every session that is removed.
+	now := time.Now()
+	for e := s.lru.Back(); e != nil && e.Value.(Record).expired(s.idle, s.absolute, now); e = s.lru.Back() {
+		s.remove(e)
+	}
+	for s.lru.Len() > 0 && s.lru.Len() >= s.max {
+		s.remove(s.lru.Back())
+	}
+
+	s.m[rec.ID] = s.lru.PushFront(rec)
+	return nil
+}
+
+func (s *memoryStore) Update(_ context.Context, rec Record) error {
+	rec.Values = maps.Clone(rec.Values)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.m[rec.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if e.Value.(Record).expired(s.idle, s.absolute, time.Now()) {
+		s.remove(e)
+		return ErrNotFound
+	}
+
+	e.Value = rec
+	s.lru.MoveToFront(e)
+	return nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.m[id]; ok {
+		s.remove(e)
+	}
+	return nil
+}
+
+func (s *memoryStore) List(_ context.Context, userID string) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	recs := []Record{}
+	for _, e := range s.m {
+		rec := e.Value.(Record)
+		if rec.UserID != userID || rec.expired(s.idle, s.absolute, now) {
+			continue
+		}
+		rec.Values = maps.Clone(rec.Values)
+		recs = append(recs, rec)
+	}
+
+	return recs, nil
+}
+
+// remove deletes the session in e.
+//
+// +checklocks:s.mu
+func (s *memoryStore) remove(e *list.Element) {
+	s.lru.Remove(e)
+	delete(s.m, e.Value.(Record).ID)
+}
+
+// fileStore is a [Store] that keeps each session in a file.
+type fileStore struct {
+	dir      string
+	idle     time.Duration
+	absolute time.Duration
+
+	// mu makes checking that a session exists & replacing it atomic, with respect to deleting it.
+	mu sync.Mutex
+
+	sweepEvery time.Duration
+	// lastSweep is when the files of expired sessions were last removed, in unix nanoseconds.
+	lastSweep atomic.Int64
+}
+
+// NewFileStore returns a [Store] that keeps each session as a file in dir. The directory is created if it does not exist.
+// Listing the sessions of a user reads all the files in dir, so it is best suited to applications with a modest number of sessions.
+//
+// A session expires if it is not used for idle, or once absolute has elapsed since it was created. A zero duration means no limit.
+// The files of expired sessions are removed periodically, when new sessions are created.
+func NewFileStore(dir string, idle, absolute time.Duration) (Store, error) {
+	return newFileStore(dir, idle, absolute, fileStoreSweepInterval)
+}
+
+func newFileStore(dir string, idle, absolute, sweepEvery time.Duration) (*fileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &fileStore{
+		dir:        dir,
+		idle:       idle,
+		absolute:   absolute,
+		sweepEvery: sweepEvery,
+	}, nil
+}
+
+func (s *fileStore) path(id string) (string, error) {
+	if !idRegex.MatchString(id) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.dir, id+fileStoreExt), nil
+}
+
+func (s *fileStore) Get(_ context.Context, id string) (Record, error) {
+	p, err := s.path(id)
+	if err != nil {
+		return Record{}, err
+	}
+
+	return s.read(p)
+}
+
+func (s *fileStore) read(p string) (Record, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Record{}, ErrNotFound
+		}
+		return Record{}, err
+	}
+
+	var rec Record
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return Record{}, fmt.Errorf("ong/sess: corrupt session file %s: %w", p, err)
+	}
+	if rec.expired(s.idle, s.absolute, time.Now()) {
+		_ = os.Remove(p)
+		return Record{}, ErrNotFound
+	}
+
+	return rec, nil
+}
+
+func (s *fileStore) Create(_ context.Context, rec Record) error {
+	p, tmp, err := s.writeTemp(rec)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp) }()
+
+	// Unlike a rename, a link fails if the session file already exists.
+	if err := os.Link(tmp, p); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return errExists
+		}
+		return err
+	}
+
+	s.sweep(time.Now())
+	return nil
+}
+
+// sweep removes the files of expired sessions, since they are otherwise only removed when read.
+// It does so at most once every s.sweepEvery, so that creating sessions stays cheap.
+func (s *fileStore) sweep(now time.Time) {
+	if s.idle <= 0 && s.absolute <= 0 {
+		// Sessions never expire.
+		return
+	}
+	last := s.lastSweep.Load()
+	if now.UnixNano()-last < int64(s.sweepEvery) || !s.lastSweep.CompareAndSwap(last, now.UnixNano()) {
+		// Not yet time, or another goroutine is already sweeping.
+		return
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), fileStoreExt) {
+			continue
+		}
+		// read removes the file if the session has expired.
+		_, _ = s.read(filepath.Join(s.dir, e.Name()))
+	}
+}
+
+func (s *fileStore) Update(_ context.Context, rec Record) error {
+	p, tmp, err := s.writeTemp(rec)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.read(p); err != nil {
+		return err
+	}
+	// Rename, so that readers never see a partially written session.
+	return os.Rename(tmp, p)
+}
+
+// writeTemp writes rec to a temporary file. It returns the path of the session file & of the temporary file.
+func (s *fileStore) writeTemp(rec Record) (string, string, error) {
+	p, err := s.path(rec.ID)
+	if err != nil {
+		return "", "", errors.New("ong/sess: invalid session ID")
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return "", "", err
+	}
+
+	f, err := os.CreateTemp(s.dir, rec.ID+".*.tmp")
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return "", "", err
+	}
+
+	return p, f.Name(), nil
+}
+
+func (s *fileStore) Delete(_ context.Context, id string) error {
+	p, err := s.path(id)
+	if err != nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *fileStore) List(_ context.Context, userID string) ([]Record, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	recs := []Record{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), fileStoreExt) {
+			continue
+		}
+		rec, errR := s.read(filepath.Join(s.dir, e.Name()))
+		if errR != nil {
+			// The session could have expired or been deleted concurrently.
+			continue
+		}
+		if rec.UserID == userID {
+			recs = append(recs, rec)
+		}
+	}
+
+	return recs, nil
+}
@@ -0,0 +1,378 @@
+package sess
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/komuw/ong/cookie"
+	"go.akshayshah.org/attest"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	stores := map[string]func(t *testing.T, idle, absolute time.Duration) Store{
+		"memory": func(t *testing.T, idle, absolute time.Duration) Store {
+			return NewMemoryStore(idle, absolute)
+		},
+		"file": func(t *testing.T, idle, absolute time.Duration) Store {
+			s, err := NewFileStore(t.TempDir(), idle, absolute)
+			attest.Ok(t, err)
+			return s
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			t.Run("get set delete", func(t *testing.T) {
+				t.Parallel()
+
+				ctx := context.Background()
+				s := newStore(t, 0, 0)
+
+				_, err := s.Get(ctx, newID())
+				attest.ErrorIs(t, err, ErrNotFound)
+
+				now := time.Now()
+				rec := Record{ID: newID(), UserID: "alice", Values: M{"name": "John"}, CreatedAt: now, LastSeenAt: now}
+				attest.Ok(t, s.Create(ctx, rec))
+
+				got, err := s.Get(ctx, rec.ID)
+				attest.Ok(t, err)
+				attest.Equal(t, got.ID, rec.ID)
+				attest.Equal(t, got.UserID, rec.UserID)
+				attest.Equal(t, got.Values, rec.Values)
+
+				// mutating the returned record does not affect the store.
+				got.Values["name"] = "Jane"
+				again, err := s.Get(ctx, rec.ID)
+				attest.Ok(t, err)
+				attest.Equal(t, again.Values["name"], "John")
+
+				attest.Ok(t, s.Delete(ctx, rec.ID))
+				_, err = s.Get(ctx, rec.ID)
+				attest.ErrorIs(t, err, ErrNotFound)
+				// deleting a non-existent session is not an error.
+				attest.Ok(t, s.Delete(ctx, rec.ID))
+			})
+
+			t.Run("create & update", func(t *testing.T) {
+				t.Parallel()
+
+				ctx := context.Background()
+				s := newStore(t, 0, 0)
+
+				now := time.Now()
+				rec := Record{ID: newID(), Values: M{"name": "John"}, CreatedAt: now, LastSeenAt: now}
+
+				// Only existing sessions can be updated.
+				attest.ErrorIs(t, s.Update(ctx, rec), ErrNotFound)
+				_, err := s.Get(ctx, rec.ID)
+				attest.ErrorIs(t, err, ErrNotFound)
+
+				attest.Ok(t, s.Create(ctx, rec))
+				attest.Error(t, s.Create(ctx, rec))
+
+				rec.Values = M{"name": "Jane"}
+				attest.Ok(t, s.Update(ctx, rec))
+				got, err := s.Get(ctx, rec.ID)
+				attest.Ok(t, err)
+				attest.Equal(t, got.Values["name"], "Jane")
+
+				attest.Ok(t, s.Delete(ctx, rec.ID))
+				attest.ErrorIs(t, s.Update(ctx, rec), ErrNotFound)
+				_, err = s.Get(ctx, rec.ID)
+				attest.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("idle expiry", func(t *testing.T) {
+				t.Parallel()
+
+				ctx := context.Background()
+				s := newStore(t, time.Minute, 0)
+
+				now := time.Now()
+				fresh := Record{ID: newID(), CreatedAt: now.Add(-time.Hour), LastSeenAt: now}
+				idle := Record{ID: newID(), CreatedAt: now.Add(-time.Hour), LastSeenAt: now.Add(-2 * time.Minute)}
+				attest.Ok(t, s.Create(ctx, fresh))
+				attest.Ok(t, s.Create(ctx, idle))
+
+				_, err := s.Get(ctx, fresh.ID)
+				attest.Ok(t, err)
+				_, err = s.Get(ctx, idle.ID)
+				attest.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("absolute expiry", func(t *testing.T) {
+				t.Parallel()
+
+				ctx := context.Background()
+				s := newStore(t, time.Minute, time.Hour)
+
+				now := time.Now()
+				old := Record{ID: newID(), CreatedAt: now.Add(-2 * time.Hour), LastSeenAt: now}
+				attest.Ok(t, s.Create(ctx, old))
+
+				_, err := s.Get(ctx, old.ID)
+				attest.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("list and revoke", func(t *testing.T) {
+				t.Parallel()
+
+				ctx := context.Background()
+				s := newStore(t, time.Minute, 0)
+
+				now := time.Now()
+				a1 := Record{ID: newID(), UserID: "alice", CreatedAt: now, LastSeenAt: now}
+				a2 := Record{ID: newID(), UserID: "alice", CreatedAt: now, LastSeenAt: now}
+				aExpired := Record{ID: newID(), UserID: "alice", CreatedAt: now, LastSeenAt: now.Add(-time.Hour)}
+				b := Record{ID: newID(), UserID: "bob", CreatedAt: now, LastSeenAt: now}
+				for _, rec := range []Record{a1, a2, aExpired, b} {
+					attest.Ok(t, s.Create(ctx, rec))
+				}
+
+				recs, err := s.List(ctx, "alice")
+				attest.Ok(t, err)
+				attest.Equal(t, len(recs), 2)
+
+				attest.Ok(t, RevokeAll(ctx, s, "alice"))
+				recs, err = s.List(ctx, "alice")
+				attest.Ok(t, err)
+				attest.Equal(t, len(recs), 0)
+
+				recs, err = s.List(ctx, "bob")
+				attest.Ok(t, err)
+				attest.Equal(t, len(recs), 1)
+			})
+		})
+	}
+
+	t.Run("memory store is bounded", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		s := newMemoryStore(0, 0, 3)
+
+		now := time.Now()
+		ids := []string{}
+		for range 3 {
+			rec := Record{ID: newID(), CreatedAt: now, LastSeenAt: now}
+			attest.Ok(t, s.Create(ctx, rec))
+			ids = append(ids, rec.ID)
+		}
+		// The first session is used again, so the second one is now the least recently used.
+		attest.Ok(t, s.Update(ctx, Record{ID: ids[0], CreatedAt: now, LastSeenAt: time.Now()}))
+
+		attest.Ok(t, s.Create(ctx, Record{ID: newID(), CreatedAt: now, LastSeenAt: now}))
+		attest.Equal(t, len(s.m), 3)
+		attest.Equal(t, s.lru.Len(), 3)
+		_, err := s.Get(ctx, ids[1])
+		attest.ErrorIs(t, err, ErrNotFound)
+		_, err = s.Get(ctx, ids[0])
+		attest.Ok(t, err)
+	})
+
+	t.Run("memory store removes expired sessions", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		s := newMemoryStore(time.Minute, 0, 100)
+
+		old := time.Now().Add(-time.Hour)
+		for range 10 {
+			attest.Ok(t, s.Create(ctx, Record{ID: newID(), CreatedAt: old, LastSeenAt: old}))
+		}
+		now := time.Now()
+		attest.Ok(t, s.Create(ctx, Record{ID: newID(), CreatedAt: now, LastSeenAt: now}))
+		attest.Equal(t, len(s.m), 1)
+	})
+
+	t.Run("file store removes expired sessions", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		dir := t.TempDir()
+		s, err := newFileStore(dir, time.Minute, 0, time.Hour)
+		attest.Ok(t, err)
+
+		now := time.Now()
+		attest.Ok(t, s.Create(ctx, Record{ID: newID(), CreatedAt: now, LastSeenAt: now}))
+		old := now.Add(-time.Hour)
+		for range 10 {
+			attest.Ok(t, s.Create(ctx, Record{ID: newID(), CreatedAt: old, LastSeenAt: old}))
+		}
+		// The directory was swept by the first Create, it is not swept again until an hour later.
+		entries, err := os.ReadDir(dir)
+		attest.Ok(t, err)
+		attest.Equal(t, len(entries), 11)
+
+		s.lastSweep.Add(-int64(time.Hour))
+		attest.Ok(t, s.Create(ctx, Record{ID: newID(), CreatedAt: now, LastSeenAt: now}))
+		entries, err = os.ReadDir(dir)
+		attest.Ok(t, err)
+		attest.Equal(t, len(entries), 2)
+	})
+
+	t.Run("file store rejects bad IDs", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		dir := t.TempDir()
+		s, err := NewFileStore(dir, 0, 0)
+		attest.Ok(t, err)
+
+		attest.Error(t, s.Create(ctx, Record{ID: "../../etc/passwd"}))
+		attest.Error(t, s.Update(ctx, Record{ID: "../../etc/passwd"}))
+		_, err = s.Get(ctx, "../"+filepath.Base(dir))
+		attest.ErrorIs(t, err, ErrNotFound)
+
+		entries, err := os.ReadDir(dir)
+		attest.Ok(t, err)
+		attest.Equal(t, len(entries), 0)
+	})
+}
+
+func TestStoreSession(t *testing.T) {
+	t.Parallel()
+
+	t.Run("roundtrip", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		store := NewMemoryStore(time.Hour, 0)
+
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req = Initialise(req, kr, store, cookie.Opts{}, "")
+		attest.Zero(t, ID(req))
+		Set(req, "name", "John Doe")
+		SetUserID(req, "john")
+		rec := httptest.NewRecorder()
+		Save(req, rec, "localhost", time.Hour, kr, store)
+
+		id := ID(req)
+		attest.NotZero(t, id)
+		res := rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, len(res.Cookies()), 1)
+		c := res.Cookies()[0]
+		// The cookie does not contain the session data.
+		attest.False(t, len(c.Value) > 200)
+
+		req2 := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req2.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		req2 = Initialise(req2, kr, store, cookie.Opts{}, "")
+		attest.Equal(t, Get(req2, "name"), "John Doe")
+		attest.Equal(t, ID(req2), id)
+
+		recs, err := store.List(context.Background(), "john")
+		attest.Ok(t, err)
+		attest.Equal(t, len(recs), 1)
+		attest.Equal(t, recs[0].ID, id)
+
+		// A revoked session cannot be used.
+		attest.Ok(t, store.Delete(context.Background(), id))
+		req3 := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req3.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		req3 = Initialise(req3, kr, store, cookie.Opts{}, "")
+		attest.Zero(t, Get(req3, "name"))
+		attest.Zero(t, ID(req3))
+	})
+
+	t.Run("revoked while a request is in flight", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		stores := map[string]Store{"memory": NewMemoryStore(time.Hour, 0)}
+		fs, err := NewFileStore(t.TempDir(), time.Hour, 0)
+		attest.Ok(t, err)
+		stores["file"] = fs
+
+		for name, store := range stores {
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+
+				req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+				req = Initialise(req, kr, store, cookie.Opts{}, "")
+				Set(req, "name", "John Doe")
+				SetUserID(req, "john")
+				rec := httptest.NewRecorder()
+				Save(req, rec, "localhost", time.Hour, kr, store)
+				id := ID(req)
+
+				// A request loads the session.
+				req2 := Initialise(roundTrip(t, rec), kr, store, cookie.Opts{}, "")
+				attest.Equal(t, ID(req2), id)
+
+				// The session is revoked, say the user changed their password on another device.
+				attest.Ok(t, RevokeAll(context.Background(), store, "john"))
+
+				// The in-flight request finishes.
+				Set(req2, "visits", "2")
+				rec2 := httptest.NewRecorder()
+				Save(req2, rec2, "localhost", time.Hour, kr, store)
+
+				_, err := store.Get(context.Background(), id)
+				attest.ErrorIs(t, err, ErrNotFound)
+				recs, err := store.List(context.Background(), "john")
+				attest.Ok(t, err)
+				attest.Equal(t, len(recs), 0)
+
+				// The session cookie is removed.
+				res := rec2.Result()
+				defer res.Body.Close()
+				attest.Equal(t, len(res.Cookies()), 1)
+				attest.True(t, res.Cookies()[0].MaxAge < 0)
+			})
+		}
+	})
+
+	t.Run("large session", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		store := NewMemoryStore(0, 0)
+
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req = Initialise(req, kr, store, cookie.Opts{}, "")
+		big := M{}
+		for i := range 1_000 {
+			big[newID()] = newID() + string(rune('a'+i%26))
+		}
+		SetM(req, big)
+		rec := httptest.NewRecorder()
+		Save(req, rec, "localhost", time.Hour, kr, store)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, len(res.Cookies()), 1)
+
+		got, err := store.Get(context.Background(), ID(req))
+		attest.Ok(t, err)
+		attest.Equal(t, len(got.Values), len(big))
+	})
+
+	t.Run("empty session is not saved", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		store := NewMemoryStore(0, 0)
+
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req = Initialise(req, kr, store, cookie.Opts{}, "")
+		rec := httptest.NewRecorder()
+		Save(req, rec, "localhost", time.Hour, kr, store)
+
+		res := rec.Result()
+		defer res.Body.Close()
+		attest.Equal(t, len(res.Cookies()), 0)
+		attest.Zero(t, ID(req))
+	})
+}
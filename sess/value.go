@@ -0,0 +1,99 @@
+package sess
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+
+	"github.com/komuw/ong/cookie"
+)
+
+// ErrTooLarge is returned when the session would no longer fit in its cookie.
+// Consider storing less data in the session, or storing sessions server-side in a [Store].
+var ErrTooLarge = fmt.Errorf("ong/sess: session is too large to be stored in a cookie: %w", cookie.ErrTooLarge)
+
+// SetValue adds the key-value pair to the current http session. The value is stored in its JSON encoding.
+// Use [GetValue] to retrieve it.
+//
+// When sessions are backed by cookies, it returns [ErrTooLarge], and does not add the value, if the session cookie would be too large for browsers to accept.
+// r ought to be a request that was created by [Initialise]
+func SetValue[T any](r *http.Request, key string, v T) error {
+	s, ok := r.Context().Value(ctxKey).(M)
+	if !ok {
+		return errors.New("ong/sess: request was not created by Initialise")
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if st := getState(r); st != nil && st.kr != nil {
+		m := maps.Clone(s)
+		m[key] = string(b)
+		if err := checkSize(r, st, m); err != nil {
+			return err
+		}
+	}
+
+	s[key] = string(b)
+	return nil
+}
+
+// GetValue retrieves the value, added using [SetValue], corresponding to the given key from the current http session.
+// It returns false if key is not found in the session, or its value cannot be decoded into a T.
+// r ought to be a request that was created by [Initialise]
+func GetValue[T any](r *http.Request, key string) (T, bool) {
+	var v T
+
+	s, ok := r.Context().Value(ctxKey).(M)
+	if !ok {
+		return v, false
+	}
+	val, ok := s[key]
+	if !ok {
+		return v, false
+	}
+
+	if err := json.Unmarshal([]byte(val), &v); err != nil {
+		var zero T
+		return zero, false
+	}
+	return v, true
+}
+
+// PopValue is like [GetValue], except that it also removes the key from the current http session.
+// It is useful for values that should only be read once, like the state of a form across a post/redirect/get.
+// r ought to be a request that was created by [Initialise]
+func PopValue[T any](r *http.Request, key string) (T, bool) {
+	v, ok := GetValue[T](r, key)
+	if s, okS := r.Context().Value(ctxKey).(M); okS {
+		delete(s, key)
+	}
+	return v, ok
+}
+
+// Validate returns [ErrTooLarge] if the current http session has grown, say using [Set] or [SetM], beyond what fits in a cookie.
+// It always returns nil when sessions are backed by a [Store].
+// r ought to be a request that was created by [Initialise]
+func Validate(r *http.Request) error {
+	st := getState(r)
+	if st == nil || st.kr == nil {
+		return nil
+	}
+	return checkSize(r, st, GetM(r))
+}
+
+// checkSize returns [ErrTooLarge] if m cannot be stored in a session cookie.
+func checkSize(r *http.Request, st *state, m M) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := cookie.ValidateEncrypted(r, st.opts.Name(CookieName), string(b), st.kr); err != nil {
+		return ErrTooLarge
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package sess
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/komuw/ong/cookie"
+	"go.akshayshah.org/attest"
+)
+
+func TestValue(t *testing.T) {
+	t.Parallel()
+
+	type cart struct {
+		Items []string `json:"items"`
+		Total int      `json:"total"`
+	}
+
+	t.Run("roundtrip", func(t *testing.T) {
+		t.Parallel()
+
+		kr := testKeyring(t)
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req = Initialise(req, kr, nil, cookie.Opts{}, "")
+
+		c := cart{Items: []string{"apple", "mango"}, Total: 12}
+		attest.Ok(t, SetValue(req, "cart", c))
+		attest.Ok(t, SetValue(req, "visits", 3))
+
+		got, ok := GetValue[cart](req, "cart")
+		attest.True(t, ok)
+		attest.Equal(t, got, c)
+
+		visits, ok := GetValue[int](req, "visits")
+		attest.True(t, ok)
+		attest.Equal(t, visits, 3)
+
+		// survives a save.
+		rec := httptest.NewRecorder()
+		Save(req, rec, "localhost", time.Hour, kr, nil)
+		req2 := Initialise(roundTrip(t, rec), kr, nil, cookie.Opts{}, "")
+		got, ok = GetValue[cart](req2, "cart")
+		attest.True(t, ok)
+		attest.Equal(t, got, c)
+	})
+
+	t.Run("pop", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req = Initialise(req, testKeyring(t), nil, cookie.Opts{}, "")
+
+		c := cart{Items: []string{"apple"}, Total: 3}
+		attest.Ok(t, SetValue(req, "cart", c))
+
+		got, ok := PopValue[cart](req, "cart")
+		attest.True(t, ok)
+		attest.Equal(t, got, c)
+
+		_, ok = PopValue[cart](req, "cart")
+		attest.False(t, ok)
+		attest.Equal(t, Get(req, "cart"), "")
+	})
+
+	t.Run("missing or mistyped", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req = Initialise(req, testKeyring(t), nil, cookie.Opts{}, "")
+
+		_, ok := GetValue[int](req, "nope")
+		attest.False(t, ok)
+
+		Set(req, "name", "not json")
+		v, ok := GetValue[int](req, "name")
+		attest.False(t, ok)
+		attest.Zero(t, v)
+
+		// not initialised.
+		attest.Error(t, SetValue(httptest.NewRequest(http.MethodGet, "/someUri", nil), "a", 1))
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req = Initialise(req, testKeyring(t), nil, cookie.Opts{}, "")
+
+		// Large values are split across multiple cookies.
+		attest.Ok(t, SetValue(req, "medium", strings.Repeat("a", 10_000)))
+		err := SetValue(req, "big", strings.Repeat("a", 50_000))
+		attest.ErrorIs(t, err, ErrTooLarge)
+		_, ok := GetValue[string](req, "big")
+		attest.False(t, ok)
+		attest.Ok(t, Validate(req))
+
+		Set(req, "big", strings.Repeat("a", 50_000))
+		attest.ErrorIs(t, Validate(req), ErrTooLarge)
+	})
+
+	t.Run("store has no size limit", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/someUri", nil)
+		req = Initialise(req, testKeyring(t), NewMemoryStore(0, 0), cookie.Opts{}, "")
+
+		attest.Ok(t, SetValue(req, "big", strings.Repeat("a", 100_000)))
+		attest.Ok(t, Validate(req))
+	})
+}
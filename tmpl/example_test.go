@@ -0,0 +1,59 @@
+package tmpl_test
+
+import (
+	"context"
+	"embed"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/log"
+	"github.com/komuw/ong/mux"
+	"github.com/komuw/ong/tmpl"
+)
+
+// The directory has; layouts/base.html, partials/nav.html & home.html
+//
+//go:embed testdata/templates
+var templates embed.FS
+
+func ExampleNew() {
+	l := log.New(context.Background(), os.Stdout, 1000)
+	opts := config.DevOpts(l, "super-h@rd-Pas1word")
+
+	fsys, err := fs.Sub(templates, "testdata/templates")
+	if err != nil {
+		panic(err)
+	}
+	// With DevOpts, the templates are parsed again whenever they change.
+	// Use os.DirFS, instead of an embed.FS, for that to happen.
+	tpl, err := tmpl.New(opts, fsys, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	home := func(w http.ResponseWriter, r *http.Request) error {
+		// The templates can use cspNonce, csrfToken, csrfField, session & flashes.
+		return tpl.Render(w, r, "home.html", map[string]string{"Title": "Welcome"})
+	}
+
+	mx := mux.New(
+		opts,
+		nil,
+		mux.NewRoute(
+			"/",
+			mux.MethodGet,
+			mux.HandlerFunc(home),
+		),
+	)
+
+	server := &http.Server{
+		Handler: mx,
+		Addr:    ":65081",
+	}
+	err = server.ListenAndServe()
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,292 @@
+// Package tmpl renders [html/template] templates that are stored in an [fs.FS].
+// The templates get per-request functions for csp nonces, csrf tokens & http sessions,
+// so that handlers do not have to pass those values in themselves.
+package tmpl
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/middleware"
+	"github.com/komuw/ong/sess"
+)
+
+const (
+	layoutsDir  = "layouts"
+	partialsDir = "partials"
+	// reloadInterval is how often, in dev, the files are checked for changes.
+	reloadInterval = 1 * time.Second
+)
+
+// Templates is a collection of parsed html templates.
+// It is safe for concurrent use.
+type Templates struct {
+	fsys  fs.FS
+	funcs template.FuncMap
+	dev   bool
+
+	mu sync.RWMutex
+	// pages maps the name of each page to a template that contains the page, all the layouts & all the partials.
+	pages map[string]*page
+	// version identifies the state of the files in fsys when pages was parsed. It is only used in dev.
+	version uint64
+
+	reloadEvery time.Duration
+	// lastCheck is when the files were last checked for changes, in unix nanoseconds. It is only used in dev.
+	lastCheck atomic.Int64
+}
+
+// page is a parsed page.
+type page struct {
+	// tmpl is never executed, it is only cloned. Templates cannot be cloned after they have been executed.
+	tmpl *template.Template
+	// pool holds clones of tmpl that are ready to be executed.
+	// Each clone is escaped when it is first executed, and is then reused by later requests.
+	pool sync.Pool
+}
+
+// bound is a clone of a page whose request functions read the request in r.
+// It is only used by one call to [Templates.Execute] at a time.
+type bound struct {
+	tmpl *template.Template
+	r    *http.Request
+}
+
+func (p *page) get() (*bound, error) {
+	if b, ok := p.pool.Get().(*bound); ok {
+		return b, nil
+	}
+
+	c, err := p.tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	b := &bound{}
+	b.tmpl = c.Funcs(b.funcs())
+	return b, nil
+}
+
+func (p *page) put(b *bound) {
+	b.r = nil
+	p.pool.Put(b)
+}
+
+// New parses all the templates, which are the files ending in .html, in fsys.
+//
+// The templates in the layouts & partials directories are shared; they are available to every other template, which is a page.
+// Templates are named after their path in fsys. For example, a page can use a layout & a partial like this:
+//
+//	{{template "layouts/base.html" .}}
+//	{{define "content"}}
+//		{{template "partials/nav.html" .}}
+//		<h1>{{.Title}}</h1>
+//	{{end}}
+//
+// In addition to funcs, the templates can use these functions which are bound to the request being rendered:
+//
+//	cspNonce      the csp nonce, see [middleware.GetCspNonce]. eg: <script nonce="{{cspNonce}}">
+//	csrfToken     the csrf token, see [middleware.GetCsrfToken]
+//	csrfField     a hidden html input element that contains the csrf token. eg: <form method="POST">{{csrfField}} ...</form>
+//	session       the value of a key in the http session, see [sess.Get]. eg: {{session "userName"}}
+//	flashes       the one-time messages in the http session, see [sess.Flashes]
+//
+// The templates are parsed once. However, if o was created by [config.DevOpts], the templates are parsed again whenever the files in fsys change.
+// The files are checked for changes at most once every second.
+func New(o config.Opts, fsys fs.FS, funcs template.FuncMap) (*Templates, error) {
+	t := &Templates{
+		fsys:        fsys,
+		funcs:       funcs,
+		dev:         o.Dev,
+		reloadEvery: reloadInterval,
+	}
+	if err := t.parse(); err != nil {
+		return nil, err
+	}
+	t.lastCheck.Store(time.Now().UnixNano())
+
+	return t, nil
+}
+
+// Execute renders the page called name, with data, into w.
+// Nothing is written to w if rendering fails.
+func (t *Templates) Execute(w io.Writer, r *http.Request, name string, data any) error {
+	if t.dev {
+		if err := t.reload(); err != nil {
+			return err
+		}
+	}
+
+	t.mu.RLock()
+	p, ok := t.pages[name]
+	t.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("ong/tmpl: no page called %q", name)
+	}
+
+	b, err := p.get()
+	if err != nil {
+		return fmt.Errorf("ong/tmpl: %w", err)
+	}
+	defer p.put(b)
+	if r == nil {
+		r = &http.Request{}
+	}
+	b.r = r
+
+	buf := &bytes.Buffer{}
+	if err := b.tmpl.Execute(buf, data); err != nil {
+		return fmt.Errorf("ong/tmpl: %w", err)
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// Render renders the page called name, with data, as a html response with the status code 200.
+// Nothing is written to w if rendering fails.
+// It can be used in a [github.com/komuw/ong/mux.HandlerFunc] as; return tpl.Render(w, r, "home.html", data)
+func (t *Templates) Render(w http.ResponseWriter, r *http.Request, name string, data any) error {
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, r, name, data); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+	return nil
+}
+
+// parse parses the templates in t.fsys.
+func (t *Templates) parse() error {
+	files, version, err := walk(t.fsys)
+	if err != nil {
+		return err
+	}
+
+	// The request functions are placeholders, they need to exist when parsing.
+	funcs := (&bound{}).funcs()
+	for k, v := range t.funcs {
+		funcs[k] = v
+	}
+	shared := template.New("").Funcs(funcs)
+	pageNames := []string{}
+	for _, f := range files {
+		dir, _, _ := strings.Cut(f, "/")
+		if dir != layoutsDir && dir != partialsDir {
+			pageNames = append(pageNames, f)
+			continue
+		}
+		if err := parseFile(shared, t.fsys, f); err != nil {
+			return err
+		}
+	}
+
+	pages := make(map[string]*page, len(pageNames))
+	for _, name := range pageNames {
+		pt, err := shared.Clone()
+		if err != nil {
+			return fmt.Errorf("ong/tmpl: %w", err)
+		}
+		if err := parseFile(pt, t.fsys, name); err != nil {
+			return err
+		}
+		pages[name] = &page{tmpl: pt.Lookup(name)}
+	}
+
+	t.mu.Lock()
+	t.pages = pages
+	t.version = version
+	t.mu.Unlock()
+
+	return nil
+}
+
+// reload parses the templates again if the files in t.fsys have changed.
+// Walking t.fsys is not cheap, so it is done at most once every t.reloadEvery.
+func (t *Templates) reload() error {
+	now := time.Now().UnixNano()
+	last := t.lastCheck.Load()
+	if now-last < int64(t.reloadEvery) || !t.lastCheck.CompareAndSwap(last, now) {
+		return nil
+	}
+
+	_, version, err := walk(t.fsys)
+	if err != nil {
+		return err
+	}
+
+	t.mu.RLock()
+	changed := version != t.version
+	t.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+
+	return t.parse()
+}
+
+// walk returns the paths of the templates in fsys, plus a value that changes whenever any of those templates change.
+func walk(fsys fs.FS) ([]string, uint64, error) {
+	files := []string{}
+	h := fnv.New64a()
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(p) != ".html" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, p)
+		_, _ = fmt.Fprintf(h, "%s:%d:%d;", p, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("ong/tmpl: %w", err)
+	}
+	slices.Sort(files)
+
+	return files, h.Sum64(), nil
+}
+
+func parseFile(t *template.Template, fsys fs.FS, name string) error {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return fmt.Errorf("ong/tmpl: %w", err)
+	}
+	if _, err := t.New(name).Parse(string(b)); err != nil {
+		return fmt.Errorf("ong/tmpl: %w", err)
+	}
+	return nil
+}
+
+// funcs returns the template functions that read the request in b.
+func (b *bound) funcs() template.FuncMap {
+	return template.FuncMap{
+		"cspNonce":  func() string { return middleware.GetCspNonce(b.r.Context()) },
+		"csrfToken": func() string { return middleware.GetCsrfToken(b.r.Context()) },
+		"csrfField": func() template.HTML {
+			return template.HTML(fmt.Sprintf( // the token is escaped.
+				`<input type="hidden" name="%s" value="%s">`,
+				middleware.CsrfTokenFormName,
+				template.HTMLEscapeString(middleware.GetCsrfToken(b.r.Context())),
+			))
+		},
+		"session": func(key string) string { return sess.Get(b.r, key) },
+		"flashes": func() []string { return sess.Flashes(b.r) },
+	}
+}
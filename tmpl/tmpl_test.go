@@ -0,0 +1,226 @@
+package tmpl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/cookie"
+	"github.com/komuw/ong/cry"
+	"github.com/komuw/ong/internal/tst"
+	"github.com/komuw/ong/log"
+	"github.com/komuw/ong/middleware"
+	"github.com/komuw/ong/sess"
+	"go.akshayshah.org/attest"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"layouts/base.html":  {Data: []byte(`<html><body>{{block "content" .}}default{{end}}</body></html>`)},
+		"partials/nav.html":  {Data: []byte(`<nav>{{.User | upper}}</nav>`)},
+		"home.html":          {Data: []byte(`{{template "layouts/base.html" .}}{{define "content"}}{{template "partials/nav.html" .}}<h1>{{.Title}}</h1>{{end}}`)},
+		"users/profile.html": {Data: []byte(`{{template "layouts/base.html" .}}{{define "content"}}<p>{{session "name"}}</p>{{range flashes}}<i>{{.}}</i>{{end}}{{end}}`)},
+		"form.html":          {Data: []byte(`<script nonce="{{cspNonce}}"></script><form>{{csrfField}}</form><p>{{csrfToken}}</p>`)},
+		"styles.css":         {Data: []byte(`not a template {{`)},
+	}
+}
+
+func testOpts(t *testing.T) config.Opts {
+	t.Helper()
+
+	l := log.New(context.Background(), &bytes.Buffer{}, 500)
+	return config.WithOpts("localhost", 65081, tst.SecretKey(), config.DirectIpStrategy, l)
+}
+
+func TestTemplates(t *testing.T) {
+	t.Parallel()
+
+	funcs := map[string]any{"upper": strings.ToUpper}
+
+	t.Run("layouts & partials", func(t *testing.T) {
+		t.Parallel()
+
+		tpl, err := New(testOpts(t), testFS(), funcs)
+		attest.Ok(t, err)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err = tpl.Render(rec, req, "home.html", map[string]string{"User": "jane", "Title": "<b>Home</b>"})
+		attest.Ok(t, err)
+		attest.Equal(t, rec.Code, http.StatusOK)
+		attest.Equal(t, rec.Header().Get("Content-Type"), "text/html; charset=utf-8")
+		attest.Equal(t, rec.Body.String(), `<html><body><nav>JANE</nav><h1>&lt;b&gt;Home&lt;/b&gt;</h1></body></html>`)
+	})
+
+	t.Run("pages do not share blocks", func(t *testing.T) {
+		t.Parallel()
+
+		tpl, err := New(testOpts(t), testFS(), funcs)
+		attest.Ok(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		buf := &bytes.Buffer{}
+		attest.Ok(t, tpl.Execute(buf, req, "home.html", map[string]string{"User": "a", "Title": "b"}))
+		buf.Reset()
+		attest.Ok(t, tpl.Execute(buf, req, "users/profile.html", nil))
+		attest.Equal(t, buf.String(), `<html><body><p></p></body></html>`)
+	})
+
+	t.Run("session", func(t *testing.T) {
+		t.Parallel()
+
+		tpl, err := New(testOpts(t), testFS(), funcs)
+		attest.Ok(t, err)
+
+		kr, err := cry.NewKeyring(tst.SecretKey())
+		attest.Ok(t, err)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = sess.Initialise(req, kr, nil, cookie.Opts{}, "")
+		sess.Set(req, "name", "<jane>")
+		sess.AddFlash(req, "saved")
+
+		buf := &bytes.Buffer{}
+		attest.Ok(t, tpl.Execute(buf, req, "users/profile.html", nil))
+		attest.Equal(t, buf.String(), `<html><body><p>&lt;jane&gt;</p><i>saved</i></body></html>`)
+		attest.Zero(t, sess.Flashes(req))
+	})
+
+	t.Run("csp & csrf", func(t *testing.T) {
+		t.Parallel()
+
+		tpl, err := New(testOpts(t), testFS(), funcs)
+		attest.Ok(t, err)
+
+		var nonce, token string
+		h := middleware.Get(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				nonce = middleware.GetCspNonce(r.Context())
+				token = middleware.GetCsrfToken(r.Context())
+				attest.Ok(t, tpl.Render(w, r, "form.html", nil))
+			}),
+			testOpts(t),
+		)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "https://localhost:65081/form", nil))
+		attest.Equal(t, rec.Code, http.StatusOK)
+		attest.NotZero(t, nonce)
+		attest.NotZero(t, token)
+		attest.Subsequence(t, rec.Body.String(), `<script nonce="`+nonce+`"></script>`)
+		attest.Subsequence(t, rec.Body.String(), `<input type="hidden" name="`+middleware.CsrfTokenFormName+`" value="`+token+`">`)
+		attest.Subsequence(t, rec.Body.String(), `<p>`+token+`</p>`)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+
+		tpl, err := New(testOpts(t), testFS(), funcs)
+		attest.Ok(t, err)
+
+		rec := httptest.NewRecorder()
+		err = tpl.Render(rec, httptest.NewRequest(http.MethodGet, "/", nil), "nope.html", nil)
+		attest.Error(t, err)
+		attest.Subsequence(t, err.Error(), `no page called "nope.html"`)
+		attest.Zero(t, rec.Body.String())
+
+		// Nothing is written if execution fails.
+		err = tpl.Render(rec, httptest.NewRequest(http.MethodGet, "/", nil), "home.html", 3)
+		attest.Error(t, err)
+		attest.Zero(t, rec.Body.String())
+
+		// parse errors.
+		fsys := testFS()
+		fsys["bad.html"] = &fstest.MapFile{Data: []byte(`{{if}}`)}
+		_, err = New(testOpts(t), fsys, funcs)
+		attest.Error(t, err)
+
+		// unknown functions.
+		_, err = New(testOpts(t), testFS(), nil)
+		attest.Error(t, err)
+	})
+
+	t.Run("testdata", func(t *testing.T) {
+		t.Parallel()
+
+		tpl, err := New(testOpts(t), os.DirFS("testdata/templates"), nil)
+		attest.Ok(t, err)
+
+		rec := httptest.NewRecorder()
+		attest.Ok(t, tpl.Render(rec, httptest.NewRequest(http.MethodGet, "/", nil), "home.html", map[string]string{"Title": "Welcome"}))
+		attest.Subsequence(t, rec.Body.String(), "<h1>Welcome</h1>")
+		attest.Subsequence(t, rec.Body.String(), `<a href="/login">Login</a>`)
+	})
+
+	t.Run("reload in dev", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		p := filepath.Join(dir, "home.html")
+		attest.Ok(t, os.WriteFile(p, []byte(`<p>one</p>`), 0o600))
+
+		dev := testOpts(t)
+		dev.Dev = true
+		devTpl, err := New(dev, os.DirFS(dir), nil)
+		attest.Ok(t, err)
+		prodTpl, err := New(testOpts(t), os.DirFS(dir), nil)
+		attest.Ok(t, err)
+
+		render := func(tpl *Templates) string {
+			buf := &bytes.Buffer{}
+			attest.Ok(t, tpl.Execute(buf, httptest.NewRequest(http.MethodGet, "/", nil), "home.html", nil))
+			return buf.String()
+		}
+		attest.Equal(t, render(devTpl), `<p>one</p>`)
+		attest.Equal(t, render(prodTpl), `<p>one</p>`)
+
+		attest.Ok(t, os.WriteFile(p, []byte(`<p>two, changed</p>`), 0o600))
+		later := time.Now().Add(time.Minute)
+		attest.Ok(t, os.Chtimes(p, later, later))
+
+		// The files are not checked again until reloadEvery has elapsed.
+		attest.Equal(t, render(devTpl), `<p>one</p>`)
+		devTpl.lastCheck.Add(-int64(devTpl.reloadEvery))
+
+		attest.Equal(t, render(devTpl), `<p>two, changed</p>`)
+		attest.Equal(t, render(prodTpl), `<p>one</p>`)
+	})
+
+	t.Run("concurrent requests", func(t *testing.T) {
+		t.Parallel()
+
+		tpl, err := New(testOpts(t), testFS(), funcs)
+		attest.Ok(t, err)
+		kr, err := cry.NewKeyring(tst.SecretKey())
+		attest.Ok(t, err)
+
+		wg := &sync.WaitGroup{}
+		for i := range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				name := fmt.Sprintf("user-%d", i)
+				for range 10 {
+					req := httptest.NewRequest(http.MethodGet, "/", nil)
+					req = sess.Initialise(req, kr, nil, cookie.Opts{}, "")
+					sess.Set(req, "name", name)
+
+					buf := &bytes.Buffer{}
+					attest.Ok(t, tpl.Execute(buf, req, "users/profile.html", nil))
+					attest.Equal(t, buf.String(), `<html><body><p>`+name+`</p></body></html>`)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,58 @@
+package upload_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/komuw/ong/config"
+	"github.com/komuw/ong/log"
+	"github.com/komuw/ong/mux"
+	"github.com/komuw/ong/upload"
+)
+
+func ExampleToDir() {
+	l := log.New(context.Background(), os.Stdout, 1000)
+
+	uploadPhotos := func(w http.ResponseWriter, r *http.Request) error {
+		files, values, err := upload.ToDir(
+			r,
+			upload.Opts{
+				MaxFileSize:  5 * 1024 * 1024,
+				MaxTotalSize: 20 * 1024 * 1024,
+				AllowedTypes: []string{"image/png", "image/jpeg"},
+			},
+			"/var/uploads",
+		)
+		if err != nil {
+			// Files that are too large, or of the wrong type, are rejected with the appropriate http status code.
+			return err
+		}
+
+		for _, f := range files {
+			l.Info("saved photo", "album", values.Get("album"), "name", f.Filename, "path", f.Path, "size", f.Size)
+		}
+		_, _ = fmt.Fprintf(w, "uploaded %d photos", len(files))
+		return nil
+	}
+
+	mx := mux.New(
+		config.WithOpts("localhost", 8080, "super-h@rd-Pas1word", config.DirectIpStrategy, l),
+		nil,
+		mux.NewRoute(
+			"/photos",
+			mux.MethodPost,
+			mux.HandlerFunc(uploadPhotos),
+		),
+	)
+
+	server := &http.Server{
+		Handler: mx,
+		Addr:    ":8080",
+	}
+	err := server.ListenAndServe()
+	if err != nil {
+		panic(err)
+	}
+}
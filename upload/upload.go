@@ -0,0 +1,331 @@
+// Package upload streams the files of multipart http requests to their destination, without buffering them in memory or temporary files.
+// Unlike [http.Request.ParseMultipartForm], it enforces per-file size limits and checks the content type of each file.
+package upload
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/komuw/ong/errors"
+)
+
+const (
+	// DefaultMaxFileSize is the default maximum size in bytes of each uploaded file.
+	DefaultMaxFileSize = 10 * 1024 * 1024 // 10MB
+	// DefaultMaxTotalSize is the default maximum size in bytes of a whole multipart request body.
+	DefaultMaxTotalSize = 32 * 1024 * 1024 // 32MB
+
+	// maxFieldSize is the maximum size in bytes of the value of each non-file field.
+	maxFieldSize = 1 * 1024 * 1024 // 1MB
+	// sniffLen is the number of bytes that [http.DetectContentType] considers.
+	sniffLen = 512
+	// maxFilenameLen is the maximum length in bytes of a sanitized filename. Most filesystems allow 255.
+	maxFilenameLen = 200
+)
+
+// Opts are the limits that are applied to uploads.
+type Opts struct {
+	// MaxFileSize is the maximum size in bytes of each file. If it is less than 1, [DefaultMaxFileSize] is used.
+	MaxFileSize int64
+	// MaxTotalSize is the maximum size in bytes of the whole request body. If it is less than 1, [DefaultMaxTotalSize] is used.
+	// Note that the request body is also limited by the maxBodyBytes option of [github.com/komuw/ong/config.New]
+	MaxTotalSize int64
+	// AllowedTypes are the content types that files are allowed to have, eg "image/png".
+	// A type can also be a wildcard like "image/*". If it is empty, files of any content type are allowed.
+	//
+	// The content type of a file is detected from its first bytes using [http.DetectContentType],
+	// the Content-Type that the client claims is ignored.
+	AllowedTypes []string
+}
+
+// File is a file that has been uploaded.
+type File struct {
+	// Field is the name of the form field of the file.
+	Field string
+	// Filename is the name of the file, as given by the client but sanitized.
+	// It has no directories, no path separators and no control characters, so it is safe to use in a path. It is never empty.
+	Filename string
+	// ContentType is the media type of the file, detected from its content. eg "image/png"
+	ContentType string
+	// Size is the size of the file in bytes.
+	Size int64
+	// Path is where the file has been saved. It is only set by [ToDir].
+	Path string
+}
+
+// Stream reads the multipart form of r and writes each file to the writer returned by dst.
+// dst is called, for each file, once its content type has been detected but before any of its content is written.
+// If the writer returned by dst implements [io.Closer], it is closed once the file has been written.
+// The values of the other form fields are returned alongside the files.
+//
+// The errors returned include the http status code that clients should get, see [github.com/komuw/ong/errors.Status].
+// They can thus be returned from a [github.com/komuw/ong/mux.HandlerFunc] as they are.
+// If Stream returns an error, some files may have been partially written to their writers.
+// Use [ToDir] if that should be cleaned up automatically.
+func Stream(r *http.Request, o Opts, dst func(f File) (io.Writer, error)) ([]File, url.Values, error) {
+	if o.MaxFileSize < 1 {
+		o.MaxFileSize = DefaultMaxFileSize
+	}
+	if o.MaxTotalSize < 1 {
+		o.MaxTotalSize = DefaultMaxTotalSize
+	}
+
+	mt, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mt != "multipart/form-data" || params["boundary"] == "" {
+		return nil, nil, errors.WithStatus(
+			fmt.Errorf("ong/upload: request content type %q is not multipart/form-data", r.Header.Get("Content-Type")),
+			http.StatusUnsupportedMediaType,
+			"The request should be a multipart form.",
+		)
+	}
+
+	body := &limitedReader{
+		r:   &ctxReader{ctx: r.Context(), r: r.Body},
+		max: o.MaxTotalSize,
+	}
+	mr := multipart.NewReader(body, params["boundary"])
+
+	files := []File{}
+	values := url.Values{}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return files, values, nil
+		}
+		if err != nil {
+			return files, values, readError(err)
+		}
+
+		if part.FileName() == "" {
+			b, err := io.ReadAll(io.LimitReader(part, maxFieldSize+1))
+			if err != nil {
+				return files, values, readError(err)
+			}
+			if len(b) > maxFieldSize {
+				return files, values, errors.WithStatus(
+					fmt.Errorf("ong/upload: field %q is larger than %d bytes", part.FormName(), maxFieldSize),
+					http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("The field %s is too large.", part.FormName()),
+				)
+			}
+			values.Add(part.FormName(), string(b))
+			continue
+		}
+
+		f, err := streamFile(part, o, dst)
+		if err != nil {
+			return files, values, err
+		}
+		files = append(files, f)
+	}
+}
+
+// ToDir is like [Stream], except that it saves the files into the directory dir.
+// Each file is given a unique name that ends with its sanitized filename, see [File.Path].
+//
+// If ToDir returns an error, including when the request is cancelled, all the files that it has saved are removed.
+func ToDir(r *http.Request, o Opts, dir string) ([]File, url.Values, error) {
+	created := []string{}
+	files, values, err := Stream(r, o, func(f File) (io.Writer, error) {
+		fl, err := os.CreateTemp(dir, "*-"+f.Filename)
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+		created = append(created, fl.Name())
+		return fl, nil
+	})
+	if err != nil {
+		for _, p := range created {
+			_ = os.Remove(p)
+		}
+		return nil, nil, err
+	}
+
+	for i := range files {
+		files[i].Path = created[i]
+	}
+	return files, values, nil
+}
+
+// streamFile writes the file in part to the writer returned by dst.
+func streamFile(part *multipart.Part, o Opts, dst func(f File) (io.Writer, error)) (File, error) {
+	f := File{
+		Field:    part.FormName(),
+		Filename: sanitize(part.FileName()),
+	}
+
+	br := bufio.NewReaderSize(part, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return f, readError(err)
+	}
+	f.ContentType, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	if !allowed(f.ContentType, o.AllowedTypes) {
+		return f, errors.WithStatus(
+			fmt.Errorf("ong/upload: file %q has content type %q which is not allowed", f.Filename, f.ContentType),
+			http.StatusUnsupportedMediaType,
+			fmt.Sprintf("The file %s is of a type that is not allowed.", f.Filename),
+		)
+	}
+
+	w, err := dst(f)
+	if err != nil {
+		return f, err
+	}
+	ew := &errWriter{w: w}
+	n, err := io.Copy(ew, io.LimitReader(br, o.MaxFileSize+1))
+	f.Size = n
+	if c, ok := w.(io.Closer); ok {
+		if errC := c.Close(); errC != nil && ew.err == nil {
+			ew.err = errC
+		}
+	}
+	if ew.err != nil {
+		// Failures of the destination, like a full disk, are not the fault of the client.
+		return f, errors.Wrap(ew.err)
+	}
+	if err != nil {
+		return f, readError(err)
+	}
+	if n > o.MaxFileSize {
+		return f, errors.WithStatus(
+			fmt.Errorf("ong/upload: file %q is larger than %d bytes", f.Filename, o.MaxFileSize),
+			http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("The file %s is too large.", f.Filename),
+		)
+	}
+
+	return f, nil
+}
+
+// readError adds the appropriate http status code to an error that happened while reading a request body.
+func readError(err error) error {
+	var mbe *http.MaxBytesError
+	switch {
+	case errors.Is(err, errTooLarge), errors.As(err, &mbe):
+		return errors.WithStatus(err, http.StatusRequestEntityTooLarge, "The request body is too large.")
+	case errors.Is(err, context.DeadlineExceeded):
+		// The client took too long to send the body.
+		return errors.WithStatus(err, http.StatusRequestTimeout, "The request took too long.")
+	case errors.Is(err, context.Canceled):
+		// The client went away, it is not a server error. The response is unlikely to be seen anyway.
+		return errors.WithStatus(err, http.StatusBadRequest, "The request was cancelled.")
+	case errors.Status(err) != 0:
+		return err
+	default:
+		return errors.WithStatus(err, http.StatusBadRequest, "The request body is not a valid multipart form.")
+	}
+}
+
+// allowed reports whether the content type ct matches any of the types.
+func allowed(ct string, types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if t == ct {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok && strings.HasPrefix(ct, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitize returns a version of the client provided filename that is safe to use as part of a path.
+func sanitize(filename string) string {
+	// Browsers on windows may send the full path.
+	filename = path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if filename == "/" {
+		filename = ""
+	}
+
+	s := strings.Map(func(r rune) rune {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r), unicode.IsSpace(r):
+			return '_'
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, filename)
+	// No hidden files, nor "." & "..".
+	s = strings.TrimLeft(s, ".")
+
+	if len(s) > maxFilenameLen {
+		// Keep the extension.
+		ext := path.Ext(s)
+		if len(ext) > maxFilenameLen/2 {
+			ext = ""
+		}
+		s = strings.ToValidUTF8(s[:maxFilenameLen-len(ext)], "") + ext
+	}
+	if s == "" {
+		s = "file"
+	}
+	return s
+}
+
+var errTooLarge = errors.New("ong/upload: request body is too large")
+
+// limitedReader is like [io.LimitedReader] except that it returns an error, instead of io.EOF, when the limit is exceeded.
+type limitedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.read > l.max {
+		return 0, errTooLarge
+	}
+	if int64(len(p)) > l.max-l.read+1 {
+		p = p[:l.max-l.read+1]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		return n, errTooLarge
+	}
+	return n, err
+}
+
+// errWriter records the errors of w, so that they can be told apart from the errors of reading the request body.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	n, err := e.w.Write(p)
+	if err != nil {
+		e.err = err
+	}
+	return n, err
+}
+
+// ctxReader stops reading once ctx is done, say because the client went away.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,296 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/komuw/ong/errors"
+	"go.akshayshah.org/attest"
+)
+
+// pngHeader is the magic number of png files.
+var pngHeader = []byte("\x89PNG\x0D\x0A\x1A\x0A")
+
+type part struct {
+	field    string
+	filename string
+	ctype    string
+	content  []byte
+}
+
+func newRequest(t *testing.T, parts ...part) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for _, p := range parts {
+		if p.filename == "" {
+			attest.Ok(t, mw.WriteField(p.field, string(p.content)))
+			continue
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="`+p.field+`"; filename="`+p.filename+`"`)
+		h.Set("Content-Type", p.ctype)
+		w, err := mw.CreatePart(h)
+		attest.Ok(t, err)
+		_, err = w.Write(p.content)
+		attest.Ok(t, err)
+	}
+	attest.Ok(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+var errDiskFull = errors.New("disk is full")
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) { return 0, errDiskFull }
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+
+	png := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{1}, 1000)...)
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		req := newRequest(t,
+			part{field: "title", content: []byte("holiday")},
+			part{field: "photo", filename: "beach.png", ctype: "text/plain", content: png},
+			part{field: "notes", filename: "notes.txt", ctype: "image/png", content: []byte("hello world")},
+		)
+
+		bufs := map[string]*bytes.Buffer{}
+		files, values, err := Stream(req, Opts{AllowedTypes: []string{"image/*", "text/plain"}}, func(f File) (io.Writer, error) {
+			b := &bytes.Buffer{}
+			bufs[f.Filename] = b
+			return b, nil
+		})
+		attest.Ok(t, err)
+		attest.Equal(t, values.Get("title"), "holiday")
+		attest.Equal(t, files, []File{
+			{Field: "photo", Filename: "beach.png", ContentType: "image/png", Size: int64(len(png))},
+			{Field: "notes", Filename: "notes.txt", ContentType: "text/plain", Size: 11},
+		})
+		attest.Equal(t, bufs["beach.png"].Bytes(), png)
+		attest.Equal(t, bufs["notes.txt"].String(), "hello world")
+	})
+
+	t.Run("content type is sniffed", func(t *testing.T) {
+		t.Parallel()
+
+		// The client claims that it is an image.
+		req := newRequest(t, part{field: "photo", filename: "evil.png", ctype: "image/png", content: []byte("<html><script>alert(1)</script>")})
+		_, _, err := Stream(req, Opts{AllowedTypes: []string{"image/png"}}, func(f File) (io.Writer, error) {
+			t.Fatal("dst should not be called")
+			return nil, nil
+		})
+		attest.Error(t, err)
+		attest.Equal(t, errors.Status(err), http.StatusUnsupportedMediaType)
+		attest.Equal(t, errors.PublicMessage(err), "The file evil.png is of a type that is not allowed.")
+	})
+
+	t.Run("file too large", func(t *testing.T) {
+		t.Parallel()
+
+		req := newRequest(t, part{field: "photo", filename: "beach.png", content: png})
+		_, _, err := Stream(req, Opts{MaxFileSize: 500}, func(f File) (io.Writer, error) { return io.Discard, nil })
+		attest.Error(t, err)
+		attest.Equal(t, errors.Status(err), http.StatusRequestEntityTooLarge)
+		attest.Equal(t, errors.PublicMessage(err), "The file beach.png is too large.")
+
+		// exactly at the limit.
+		req = newRequest(t, part{field: "photo", filename: "beach.png", content: png})
+		_, _, err = Stream(req, Opts{MaxFileSize: int64(len(png))}, func(f File) (io.Writer, error) { return io.Discard, nil })
+		attest.Ok(t, err)
+	})
+
+	t.Run("total too large", func(t *testing.T) {
+		t.Parallel()
+
+		req := newRequest(t,
+			part{field: "a", filename: "a.png", content: png},
+			part{field: "b", filename: "b.png", content: png},
+		)
+		_, _, err := Stream(req, Opts{MaxTotalSize: 1500}, func(f File) (io.Writer, error) { return io.Discard, nil })
+		attest.Error(t, err)
+		attest.Equal(t, errors.Status(err), http.StatusRequestEntityTooLarge)
+
+		// The limit of the server.
+		req = newRequest(t, part{field: "a", filename: "a.png", content: png})
+		req.Body = http.MaxBytesReader(httptest.NewRecorder(), req.Body, 100)
+		_, _, err = Stream(req, Opts{}, func(f File) (io.Writer, error) { return io.Discard, nil })
+		attest.Equal(t, errors.Status(err), http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("field too large", func(t *testing.T) {
+		t.Parallel()
+
+		req := newRequest(t, part{field: "bio", content: bytes.Repeat([]byte("a"), maxFieldSize+1)})
+		_, _, err := Stream(req, Opts{}, func(f File) (io.Writer, error) { return io.Discard, nil })
+		attest.Equal(t, errors.Status(err), http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("destination fails", func(t *testing.T) {
+		t.Parallel()
+
+		req := newRequest(t, part{field: "photo", filename: "beach.png", content: png})
+		_, _, err := Stream(req, Opts{}, func(f File) (io.Writer, error) { return failWriter{}, nil })
+		attest.ErrorIs(t, err, errDiskFull)
+		attest.Equal(t, errors.Status(err), 0) // rendered as a http 500.
+	})
+
+	t.Run("not multipart", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("a=b"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		_, _, err := Stream(req, Opts{}, func(f File) (io.Writer, error) { return io.Discard, nil })
+		attest.Equal(t, errors.Status(err), http.StatusUnsupportedMediaType)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("--xyz\r\nnonsense"))
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+		_, _, err := Stream(req, Opts{}, func(f File) (io.Writer, error) { return io.Discard, nil })
+		attest.Equal(t, errors.Status(err), http.StatusBadRequest)
+	})
+}
+
+func TestToDir(t *testing.T) {
+	t.Parallel()
+
+	png := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{1}, 1000)...)
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		req := newRequest(t,
+			part{field: "photo", filename: `C:\Users\jane\..\beach.png`, content: png},
+			part{field: "photo", filename: "beach.png", content: png},
+		)
+		files, _, err := ToDir(req, Opts{AllowedTypes: []string{"image/png"}}, dir)
+		attest.Ok(t, err)
+		attest.Equal(t, len(files), 2)
+		attest.NotEqual(t, files[0].Path, files[1].Path)
+		for _, f := range files {
+			attest.Equal(t, f.Filename, "beach.png")
+			attest.Equal(t, filepath.Dir(f.Path), dir)
+			attest.True(t, strings.HasSuffix(f.Path, "-beach.png"))
+			b, err := os.ReadFile(f.Path)
+			attest.Ok(t, err)
+			attest.Equal(t, b, png)
+		}
+	})
+
+	t.Run("files are removed on error", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		req := newRequest(t,
+			part{field: "a", filename: "a.png", content: png},
+			part{field: "b", filename: "b.png", content: append(append([]byte{}, png...), png...)},
+		)
+		_, _, err := ToDir(req, Opts{MaxFileSize: 1500}, dir)
+		attest.Equal(t, errors.Status(err), http.StatusRequestEntityTooLarge)
+
+		entries, err := os.ReadDir(dir)
+		attest.Ok(t, err)
+		attest.Equal(t, len(entries), 0)
+	})
+
+	t.Run("files are removed on cancellation", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		pr, pw := io.Pipe()
+		mw := multipart.NewWriter(pw)
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			w, _ := mw.CreateFormFile("photo", "beach.png")
+			_, _ = w.Write(png)
+			// The client goes away in the middle of the upload.
+			cancel()
+			_, _ = w.Write(png)
+			_ = mw.Close()
+			_ = pw.Close()
+		}()
+
+		req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/upload", pr)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		_, _, err := ToDir(req, Opts{}, dir)
+		attest.ErrorIs(t, err, context.Canceled)
+		attest.Equal(t, errors.Status(err), http.StatusBadRequest)
+
+		entries, err := os.ReadDir(dir)
+		attest.Ok(t, err)
+		attest.Equal(t, len(entries), 0)
+	})
+
+	t.Run("slow client", func(t *testing.T) {
+		t.Parallel()
+
+		pr, pw := io.Pipe()
+		defer pr.Close()
+		mw := multipart.NewWriter(pw)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		go func() {
+			// The client sends the body too slowly.
+			w, _ := mw.CreateFormFile("photo", "beach.png")
+			for {
+				if _, err := w.Write(png); err != nil {
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+
+		req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/upload", pr)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		_, _, err := ToDir(req, Opts{}, t.TempDir())
+		attest.ErrorIs(t, err, context.DeadlineExceeded)
+		attest.Equal(t, errors.Status(err), http.StatusRequestTimeout)
+	})
+}
+
+func TestSanitize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"photo.png", "photo.png"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Windows\system32\cmd.exe`, "cmd.exe"},
+		{".htaccess", "htaccess"},
+		{"..", "file"},
+		{"", "file"},
+		{"/", "file"},
+		{"my holiday photo (1).jpg", "my_holiday_photo__1_.jpg"},
+		{"résumé.pdf", "résumé.pdf"},
+		{"a\x00b\nc.txt", "a_b_c.txt"},
+		{"<script>.html", "_script_.html"},
+		{strings.Repeat("a", 300) + ".png", strings.Repeat("a", maxFilenameLen-4) + ".png"},
+	}
+	for _, tt := range tests {
+		attest.Equal(t, sanitize(tt.in), tt.want, attest.Sprintf("in: %q", tt.in))
+	}
+}